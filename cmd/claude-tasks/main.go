@@ -4,14 +4,18 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
+	// Embedded zone database so task timezones resolve without system tzdata
+	_ "time/tzdata"
 
 	"github.com/ASRagab/claude-tasks/internal/api"
 	"github.com/ASRagab/claude-tasks/internal/db"
@@ -63,6 +67,18 @@ func main() {
 				os.Exit(1)
 			}
 			return
+		case "cancel":
+			if err := runCancel(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "secret":
+			if err := runSecret(os.Args[2:], os.Stdin); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			return
 		case "tui":
 			if err := runTUI(os.Args[2:]); err != nil {
 				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -196,6 +212,124 @@ func runDoctor() error {
 	return nil
 }
 
+func parseRunID(args []string) (int64, error) {
+	if len(args) != 1 {
+		return 0, fmt.Errorf("usage: claude-tasks cancel <run-id>")
+	}
+	runID, err := strconv.ParseInt(strings.TrimSpace(args[0]), 10, 64)
+	if err != nil || runID <= 0 {
+		return 0, fmt.Errorf("invalid run id %q", args[0])
+	}
+	return runID, nil
+}
+
+func runCancel(args []string) error {
+	runID, err := parseRunID(args)
+	if err != nil {
+		return err
+	}
+
+	dataDir := os.Getenv("CLAUDE_TASKS_DATA")
+	if dataDir == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return fmt.Errorf("getting home directory: %w", err)
+		}
+		dataDir = filepath.Join(homeDir, ".claude-tasks")
+	}
+
+	database, err := db.New(filepath.Join(dataDir, "tasks.db"))
+	if err != nil {
+		return fmt.Errorf("initializing database: %w", err)
+	}
+	defer database.Close()
+
+	// The owning process (daemon, serve or TUI) polls for the request and stops the run.
+	requested, err := database.RequestTaskRunCancel(runID)
+	if err != nil {
+		return err
+	}
+	if !requested {
+		return fmt.Errorf("run %d is not running", runID)
+	}
+
+	fmt.Printf("Cancellation requested for run %d\n", runID)
+	return nil
+}
+
+// readSecretValue reads a secret value from r: everything up to EOF with
+// trailing newlines removed, so both piped files and a typed line work
+func readSecretValue(r io.Reader) (string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("reading secret value: %w", err)
+	}
+	value := strings.TrimRight(string(data), "\r\n")
+	if value == "" {
+		return "", fmt.Errorf("secret value is empty")
+	}
+	return value, nil
+}
+
+func runSecret(args []string, stdin io.Reader) error {
+	usage := fmt.Errorf("usage: claude-tasks secret set <name> | list | rm <name>")
+	if len(args) == 0 {
+		return usage
+	}
+
+	dataDir := os.Getenv("CLAUDE_TASKS_DATA")
+	if dataDir == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return fmt.Errorf("getting home directory: %w", err)
+		}
+		dataDir = filepath.Join(homeDir, ".claude-tasks")
+	}
+
+	database, err := db.New(filepath.Join(dataDir, "tasks.db"))
+	if err != nil {
+		return fmt.Errorf("initializing database: %w", err)
+	}
+	defer database.Close()
+
+	switch {
+	case args[0] == "set" && len(args) == 2:
+		name, err := db.ParseSecretName(args[1])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Enter the value of %s, then press Ctrl-D:\n", name)
+		value, err := readSecretValue(stdin)
+		if err != nil {
+			return err
+		}
+		if err := database.SetSecret(name, value); err != nil {
+			return err
+		}
+		fmt.Printf("Secret %s saved; reference it in task env as ${secret:%s}\n", name, name)
+	case args[0] == "list" && len(args) == 1:
+		secrets, err := database.ListSecrets()
+		if err != nil {
+			return err
+		}
+		for _, secret := range secrets {
+			fmt.Printf("%s\t(updated %s)\n", secret.Name, secret.UpdatedAt.Local().Format("2006-01-02 15:04"))
+		}
+	case args[0] == "rm" && len(args) == 2:
+		deleted, err := database.DeleteSecret(args[1])
+		if err != nil {
+			return err
+		}
+		if !deleted {
+			return fmt.Errorf("secret %s not found", args[1])
+		}
+		fmt.Printf("Secret %s removed\n", args[1])
+	default:
+		return usage
+	}
+	return nil
+}
+
 func runDaemon() error {
 	daemonCmd := flag.NewFlagSet("daemon", flag.ExitOnError)
 	schedulerEnabled := daemonCmd.Bool("scheduler", true, "Enable scheduler loop")
@@ -381,6 +515,10 @@ Usage:
   claude-tasks serve [--port 8080] [--scheduler=true|false]
                                             Run HTTP API server (scheduler optional)
   claude-tasks doctor                       Run environment and runtime diagnostics
+  claude-tasks cancel <run-id>              Cancel an in-flight task run
+  claude-tasks secret set <name>            Store a secret read from stdin (encrypted)
+  claude-tasks secret list                  List secret names
+  claude-tasks secret rm <name>             Remove a secret
   claude-tasks version                      Show version information
   claude-tasks upgrade                      Upgrade to the latest version
   claude-tasks help                         Show this help message
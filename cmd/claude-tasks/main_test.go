@@ -1,6 +1,9 @@
 package main
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 func TestParseTUISchedulerMode(t *testing.T) {
 	tests := []struct {
@@ -58,3 +61,46 @@ func TestShouldStartTUIScheduler(t *testing.T) {
 		})
 	}
 }
+
+func TestParseRunID(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    int64
+		wantErr bool
+	}{
+		{name: "valid", args: []string{"42"}, want: 42},
+		{name: "missing", args: nil, wantErr: true},
+		{name: "extra args", args: []string{"1", "2"}, wantErr: true},
+		{name: "not a number", args: []string{"abc"}, wantErr: true},
+		{name: "zero", args: []string{"0"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRunID(tt.args)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error for args %v", tt.args)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parse run id: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("expected %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestReadSecretValue(t *testing.T) {
+	got, err := readSecretValue(strings.NewReader("s3cret value\n"))
+	if err != nil || got != "s3cret value" {
+		t.Fatalf("expected the trailing newline trimmed, got %q, %v", got, err)
+	}
+	if _, err := readSecretValue(strings.NewReader("\n")); err == nil {
+		t.Fatal("expected error for an empty secret")
+	}
+}
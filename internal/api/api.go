@@ -77,6 +77,29 @@ func (s *Server) setupRoutes() {
 			r.Get("/{id}/runs", s.GetTaskRuns)
 			r.Get("/{id}/runs/latest", s.GetLatestTaskRun)
 			r.Get("/{id}/runs/{runID}", s.GetTaskRun)
+			r.Get("/{id}/runs/{runID}/stream", s.StreamTaskRun)
+			r.Get("/{id}/runs/{runID}/diff", s.GetTaskRunDiff)
+			r.Get("/{id}/runs/{runID}/result", s.GetTaskRunResult)
+			r.Post("/{id}/runs/{runID}/cancel", s.CancelTaskRun)
+			r.Post("/{id}/prompt/preview", s.PreviewTaskPrompt)
+			r.Get("/{id}/triggers", s.ListTaskTriggers)
+			r.Post("/{id}/triggers", s.CreateTaskTrigger)
+			r.Delete("/{id}/triggers/{triggerID}", s.DeleteTaskTrigger)
+		})
+
+		// Account profiles
+		r.Route("/profiles", func(r chi.Router) {
+			r.Get("/", s.ListProfiles)
+			r.Post("/", s.CreateProfile)
+			r.Put("/{name}", s.UpdateProfile)
+			r.Delete("/{name}", s.DeleteProfile)
+		})
+
+		// Secrets referenced by task env values
+		r.Route("/secrets", func(r chi.Router) {
+			r.Get("/", s.ListSecrets)
+			r.Put("/{name}", s.SetSecret)
+			r.Delete("/{name}", s.DeleteSecret)
 		})
 
 		// Settings
@@ -85,6 +108,7 @@ func (s *Server) setupRoutes() {
 
 		// Usage
 		r.Get("/usage", s.GetUsage)
+		r.Get("/usage/history", s.GetUsageHistory)
 	})
 }
 
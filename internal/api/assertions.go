@@ -0,0 +1,45 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/ASRagab/claude-tasks/internal/db"
+)
+
+// parseAssertions converts the assertions of a request
+func parseAssertions(assertions []AssertionRequest) ([]db.Assertion, error) {
+	if len(assertions) > db.MaxAssertions {
+		return nil, validationError(fmt.Sprintf("Invalid assertions (use at most %d)", db.MaxAssertions))
+	}
+	var parsed []db.Assertion
+	for _, a := range assertions {
+		assertion, err := db.ParseAssertion(db.Assertion{Type: a.Type, Pattern: a.Pattern, Schema: a.Schema, Path: a.Path})
+		if err != nil {
+			return nil, validationError("Invalid assertions: " + err.Error())
+		}
+		parsed = append(parsed, assertion)
+	}
+	return parsed, nil
+}
+
+func assertionsToResponse(assertions []db.Assertion) []AssertionResponse {
+	if len(assertions) == 0 {
+		return nil
+	}
+	resp := make([]AssertionResponse, len(assertions))
+	for i, a := range assertions {
+		resp[i] = AssertionResponse{Type: a.Type, Pattern: a.Pattern, Schema: a.Schema, Path: a.Path}
+	}
+	return resp
+}
+
+func assertionResultsToResponse(results []db.AssertionResult) []AssertionResultResponse {
+	if len(results) == 0 {
+		return nil
+	}
+	resp := make([]AssertionResultResponse, len(results))
+	for i, result := range results {
+		resp[i] = AssertionResultResponse{Assertion: result.Assertion, Passed: result.Passed, Message: result.Message}
+	}
+	return resp
+}
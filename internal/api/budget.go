@@ -0,0 +1,45 @@
+package api
+
+import (
+	"log"
+	"time"
+
+	"github.com/ASRagab/claude-tasks/internal/db"
+)
+
+// budgetToResponse converts a budget status; nil stays nil
+func budgetToResponse(budget *db.BudgetStatus) *BudgetResponse {
+	if budget == nil {
+		return nil
+	}
+	resp := &BudgetResponse{
+		Period:      budget.Period,
+		LimitUSD:    budget.LimitUSD,
+		LimitTokens: budget.LimitTokens,
+		SpentUSD:    budget.Spent.CostUSD,
+		SpentTokens: budget.Spent.TotalTokens(),
+		PeriodStart: budget.Start,
+		ResetsAt:    budget.ResetsAt,
+		Exhausted:   budget.Exhausted(),
+	}
+	if budget.LimitUSD > 0 {
+		remaining := budget.RemainingUSD()
+		resp.RemainingUSD = &remaining
+	}
+	if budget.LimitTokens > 0 {
+		remaining := budget.RemainingTokens()
+		resp.RemainingTokens = &remaining
+	}
+	return resp
+}
+
+// globalBudgetResponse reports this month's spending against the monthly
+// budget. Failures are logged rather than failing the usage request.
+func (s *Server) globalBudgetResponse() *BudgetResponse {
+	budget, err := s.db.GetGlobalBudgetStatus(time.Now())
+	if err != nil {
+		log.Printf("api usage: failed to fetch monthly budget: %v", err)
+		return nil
+	}
+	return budgetToResponse(budget)
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// GetTaskRunDiff handles GET /api/v1/tasks/{id}/runs/{runID}/diff
+func (s *Server) GetTaskRunDiff(w http.ResponseWriter, r *http.Request) {
+	taskID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "Invalid task ID", err)
+		return
+	}
+
+	runID, err := strconv.ParseInt(chi.URLParam(r, "runID"), 10, 64)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "Invalid run ID", err)
+		return
+	}
+
+	if _, err := s.db.GetTaskRun(taskID, runID); err != nil {
+		s.errorResponse(w, http.StatusNotFound, "Run not found", err)
+		return
+	}
+
+	changes, err := s.db.GetRunChanges(runID)
+	if errors.Is(err, sql.ErrNoRows) {
+		s.errorResponse(w, http.StatusNotFound, "No changes recorded for this run", nil)
+		return
+	}
+	if err != nil {
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to fetch run changes", err)
+		return
+	}
+
+	response := RunDiffResponse{
+		RunID:          changes.RunID,
+		HeadBefore:     changes.HeadBefore,
+		HeadAfter:      changes.HeadAfter,
+		DirtyBefore:    changes.DirtyBefore,
+		Summary:        changes.Summary(),
+		Files:          make([]ChangedFileResponse, len(changes.Files)),
+		Insertions:     changes.Insertions,
+		Deletions:      changes.Deletions,
+		Patch:          changes.Patch,
+		PatchTruncated: changes.PatchTruncated,
+	}
+	for i, file := range changes.Files {
+		response.Files[i] = ChangedFileResponse(file)
+	}
+	s.jsonResponse(w, http.StatusOK, response)
+}
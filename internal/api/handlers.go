@@ -1,6 +1,7 @@
 package api
 
 import (
+	"bytes"
 	"database/sql"
 	"encoding/json"
 	"errors"
@@ -13,6 +14,8 @@ import (
 	"time"
 
 	"github.com/ASRagab/claude-tasks/internal/db"
+	"github.com/ASRagab/claude-tasks/internal/executor"
+	"github.com/ASRagab/claude-tasks/internal/prompt"
 	"github.com/ASRagab/claude-tasks/internal/usage"
 	"github.com/ASRagab/claude-tasks/internal/version"
 	"github.com/go-chi/chi/v5"
@@ -29,6 +32,12 @@ func (s *Server) HealthCheck(w http.ResponseWriter, r *http.Request) {
 
 // ListTasks handles GET /api/v1/tasks
 func (s *Server) ListTasks(w http.ResponseWriter, r *http.Request) {
+	viewer, err := viewerLocation(r)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, errInvalidViewerTZ.Error(), err)
+		return
+	}
+
 	tasks, err := s.db.ListTasks()
 	if err != nil {
 		s.errorResponse(w, http.StatusInternalServerError, "Failed to fetch tasks", err)
@@ -47,8 +56,23 @@ func (s *Server) ListTasks(w http.ResponseWriter, r *http.Request) {
 		Total: len(tasks),
 	}
 
+	now := time.Now()
+	usageTotals, usageErr := s.db.GetUsageTotals(time.Time{})
+	if usageErr != nil {
+		log.Printf("api list tasks: failed to fetch usage totals: %v", usageErr)
+		usageTotals = make(map[int64]*db.UsageTotals)
+	}
+
+	budgets, budgetErr := s.db.GetTaskBudgetStatuses(tasks, now)
+	if budgetErr != nil {
+		log.Printf("api list tasks: failed to fetch budgets: %v", budgetErr)
+		budgets = make(map[int64]*db.BudgetStatus)
+	}
+
 	for i, task := range tasks {
-		response.Tasks[i] = s.taskToResponse(task, statuses[task.ID])
+		response.Tasks[i] = s.taskToResponse(task, statuses[task.ID], viewer)
+		response.Tasks[i].Usage = usageToResponse(usageTotals[task.ID])
+		response.Tasks[i].Budget = budgetToResponse(budgets[task.ID])
 	}
 
 	s.jsonResponse(w, http.StatusOK, response)
@@ -56,6 +80,12 @@ func (s *Server) ListTasks(w http.ResponseWriter, r *http.Request) {
 
 // CreateTask handles POST /api/v1/tasks
 func (s *Server) CreateTask(w http.ResponseWriter, r *http.Request) {
+	viewer, err := viewerLocation(r)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, errInvalidViewerTZ.Error(), err)
+		return
+	}
+
 	var req TaskRequest
 	if !s.decodeJSONBody(w, r, &req) {
 		return
@@ -77,6 +107,16 @@ func (s *Server) CreateTask(w http.ResponseWriter, r *http.Request) {
 		PermissionMode: req.PermissionMode,
 		Enabled:        req.Enabled,
 	}
+	task.Timeout, _ = db.ParseTimeout(req.Timeout) // validated above
+	task.Timezone, _ = db.ParseTimezone(req.Timezone)
+	task.PromptVars = req.PromptVars
+	task.Env = req.Env
+	task.EnvFile = strings.TrimSpace(req.EnvFile)
+	if err := applyClaudeOptions(task, &req); err != nil {
+		s.errorResponse(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	applyRunPolicies(task, &req)
 
 	// Parse scheduled_at for one-off tasks
 	if req.ScheduledAt != nil && *req.ScheduledAt != "" {
@@ -101,7 +141,7 @@ func (s *Server) CreateTask(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	s.jsonResponse(w, http.StatusCreated, s.taskToResponse(task, ""))
+	s.jsonResponse(w, http.StatusCreated, s.taskToResponse(task, "", viewer))
 }
 
 // GetTask handles GET /api/v1/tasks/{id}
@@ -111,6 +151,11 @@ func (s *Server) GetTask(w http.ResponseWriter, r *http.Request) {
 		s.errorResponse(w, http.StatusBadRequest, "Invalid task ID", err)
 		return
 	}
+	viewer, err := viewerLocation(r)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, errInvalidViewerTZ.Error(), err)
+		return
+	}
 
 	task, err := s.db.GetTask(id)
 	if err != nil {
@@ -128,7 +173,22 @@ func (s *Server) GetTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.jsonResponse(w, http.StatusOK, s.taskToResponse(task, status))
+	totals, err := s.db.GetTaskUsageTotals(id, time.Time{})
+	if err != nil {
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to fetch usage totals", err)
+		return
+	}
+
+	budget, err := s.db.GetTaskBudgetStatus(task, time.Now())
+	if err != nil {
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to fetch budget", err)
+		return
+	}
+
+	resp := s.taskToResponse(task, status, viewer)
+	resp.Usage = usageToResponse(totals)
+	resp.Budget = budgetToResponse(budget)
+	s.jsonResponse(w, http.StatusOK, resp)
 }
 
 // UpdateTask handles PUT /api/v1/tasks/{id}
@@ -138,6 +198,11 @@ func (s *Server) UpdateTask(w http.ResponseWriter, r *http.Request) {
 		s.errorResponse(w, http.StatusBadRequest, "Invalid task ID", err)
 		return
 	}
+	viewer, err := viewerLocation(r)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, errInvalidViewerTZ.Error(), err)
+		return
+	}
 
 	task, err := s.db.GetTask(id)
 	if err != nil {
@@ -145,8 +210,20 @@ func (s *Server) UpdateTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var body json.RawMessage
+	if !s.decodeJSONBody(w, r, &body) {
+		return
+	}
 	var req TaskRequest
-	if !s.decodeJSONBody(w, r, &req) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	var sent map[string]json.RawMessage
+	if err := json.Unmarshal(body, &sent); err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "Invalid request body", err)
 		return
 	}
 
@@ -156,6 +233,7 @@ func (s *Server) UpdateTask(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Update task fields
+	stored := *task
 	task.Name = req.Name
 	task.Prompt = req.Prompt
 	task.CronExpr = req.CronExpr
@@ -164,6 +242,17 @@ func (s *Server) UpdateTask(w http.ResponseWriter, r *http.Request) {
 	task.SlackWebhook = req.SlackWebhook
 	task.Model = req.Model
 	task.PermissionMode = req.PermissionMode
+	task.Timeout, _ = db.ParseTimeout(req.Timeout) // validated above
+	task.Timezone, _ = db.ParseTimezone(req.Timezone)
+	task.PromptVars = req.PromptVars
+	task.Env = req.Env
+	task.EnvFile = strings.TrimSpace(req.EnvFile)
+	if err := applyClaudeOptions(task, &req); err != nil {
+		s.errorResponse(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	applyRunPolicies(task, &req)
+	keepOmittedSettings(task, &stored, sent)
 	task.Enabled = req.Enabled
 
 	// Parse scheduled_at for one-off tasks
@@ -191,7 +280,7 @@ func (s *Server) UpdateTask(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	s.jsonResponse(w, http.StatusOK, s.taskToResponse(task, ""))
+	s.jsonResponse(w, http.StatusOK, s.taskToResponse(task, "", viewer))
 }
 
 // DeleteTask handles DELETE /api/v1/tasks/{id}
@@ -232,6 +321,11 @@ func (s *Server) ToggleTask(w http.ResponseWriter, r *http.Request) {
 		s.errorResponse(w, http.StatusBadRequest, "Invalid task ID", err)
 		return
 	}
+	viewer, err := viewerLocation(r)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, errInvalidViewerTZ.Error(), err)
+		return
+	}
 
 	if err := s.db.ToggleTask(id); err != nil {
 		s.errorResponse(w, http.StatusInternalServerError, "Failed to toggle task", err)
@@ -253,7 +347,7 @@ func (s *Server) ToggleTask(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	s.jsonResponse(w, http.StatusOK, s.taskToResponse(task, ""))
+	s.jsonResponse(w, http.StatusOK, s.taskToResponse(task, "", viewer))
 }
 
 // RunTask handles POST /api/v1/tasks/{id}/run
@@ -277,14 +371,20 @@ func (s *Server) RunTask(w http.ResponseWriter, r *http.Request) {
 
 	select {
 	case s.runSemaphore <- struct{}{}:
-		resultCh := s.executor.ExecuteAsync(task)
-		go func(taskID int64) {
-			result := <-resultCh
+		go func(task *db.Task) {
+			// Through the scheduler, a failed run is retried like a
+			// scheduled one; without a scheduler it is not retried
+			var result *executor.Result
+			if s.scheduler != nil {
+				result = s.scheduler.ExecuteTask(task)
+			} else {
+				result = <-s.executor.ExecuteAsync(task)
+			}
 			if result != nil && result.Error != nil {
-				log.Printf("api run task failed: task_id=%d err=%v", taskID, result.Error)
+				log.Printf("api run task failed: task_id=%d err=%v", task.ID, result.Error)
 			}
 			<-s.runSemaphore
-		}(task.ID)
+		}(task)
 	default:
 		s.errorResponse(w, http.StatusServiceUnavailable, "Task execution queue is full", nil)
 		return
@@ -367,6 +467,40 @@ func (s *Server) GetTaskRun(w http.ResponseWriter, r *http.Request) {
 	s.jsonResponse(w, http.StatusOK, s.taskRunToResponse(run))
 }
 
+// CancelTaskRun handles POST /api/v1/tasks/{id}/runs/{runID}/cancel
+func (s *Server) CancelTaskRun(w http.ResponseWriter, r *http.Request) {
+	taskID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "Invalid task ID", err)
+		return
+	}
+
+	runID, err := strconv.ParseInt(chi.URLParam(r, "runID"), 10, 64)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "Invalid run ID", err)
+		return
+	}
+
+	if _, err := s.db.GetTaskRun(taskID, runID); err != nil {
+		s.errorResponse(w, http.StatusNotFound, "Run not found", err)
+		return
+	}
+
+	if err := s.executor.CancelRun(runID); err != nil {
+		if errors.Is(err, executor.ErrRunNotActive) {
+			s.errorResponse(w, http.StatusConflict, "Run is not running", nil)
+			return
+		}
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to cancel run", err)
+		return
+	}
+
+	s.jsonResponse(w, http.StatusAccepted, SuccessResponse{
+		Success: true,
+		Message: "Run cancellation requested",
+	})
+}
+
 // GetLatestTaskRun handles GET /api/v1/tasks/{id}/runs/latest
 func (s *Server) GetLatestTaskRun(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
@@ -386,15 +520,13 @@ func (s *Server) GetLatestTaskRun(w http.ResponseWriter, r *http.Request) {
 
 // GetSettings handles GET /api/v1/settings
 func (s *Server) GetSettings(w http.ResponseWriter, r *http.Request) {
-	threshold, err := s.db.GetUsageThreshold()
+	settings, err := s.loadSettings()
 	if err != nil {
 		s.errorResponse(w, http.StatusInternalServerError, "Failed to fetch settings", err)
 		return
 	}
 
-	s.jsonResponse(w, http.StatusOK, SettingsResponse{
-		UsageThreshold: threshold,
-	})
+	s.jsonResponse(w, http.StatusOK, settings)
 }
 
 // UpdateSettings handles PUT /api/v1/settings
@@ -404,23 +536,93 @@ func (s *Server) UpdateSettings(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate threshold
-	if req.UsageThreshold < 0 || req.UsageThreshold > 100 {
+	// Validate thresholds
+	if req.UsageThreshold != nil && (*req.UsageThreshold < 0 || *req.UsageThreshold > 100) {
 		s.errorResponse(w, http.StatusBadRequest, "Usage threshold must be between 0 and 100", nil)
 		return
 	}
+	thresholds := make(map[string]db.UsageThresholds, len(req.UsageThresholds))
+	for name, value := range req.UsageThresholds {
+		priority, err := db.ParsePriority(name)
+		if err != nil || priority == "" {
+			s.errorResponse(w, http.StatusBadRequest, errInvalidPriority.Error(), nil)
+			return
+		}
+		threshold := db.UsageThresholds{FiveHour: value.FiveHour, SevenDay: value.SevenDay}
+		if err := threshold.Validate(); err != nil {
+			s.errorResponse(w, http.StatusBadRequest, errInvalidThreshold.Error(), nil)
+			return
+		}
+		thresholds[priority] = threshold
+	}
 
-	if err := s.db.SetUsageThreshold(req.UsageThreshold); err != nil {
-		s.errorResponse(w, http.StatusInternalServerError, "Failed to update settings", err)
+	if req.MonthlyBudgetUSD != nil && *req.MonthlyBudgetUSD < 0 {
+		s.errorResponse(w, http.StatusBadRequest, errInvalidMonthlyCap.Error(), nil)
 		return
 	}
 
-	s.jsonResponse(w, http.StatusOK, SettingsResponse(req))
+	if req.UsageThreshold != nil {
+		if err := s.db.SetUsageThreshold(*req.UsageThreshold); err != nil {
+			s.errorResponse(w, http.StatusInternalServerError, "Failed to update settings", err)
+			return
+		}
+	}
+	for priority, threshold := range thresholds {
+		if err := s.db.SetUsageThresholds(priority, threshold); err != nil {
+			s.errorResponse(w, http.StatusInternalServerError, "Failed to update settings", err)
+			return
+		}
+	}
+	if req.MonthlyBudgetUSD != nil {
+		if err := s.db.SetMonthlyBudget(*req.MonthlyBudgetUSD); err != nil {
+			s.errorResponse(w, http.StatusInternalServerError, "Failed to update settings", err)
+			return
+		}
+	}
+
+	settings, err := s.loadSettings()
+	if err != nil {
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to fetch settings", err)
+		return
+	}
+	s.jsonResponse(w, http.StatusOK, settings)
+}
+
+func (s *Server) loadSettings() (SettingsResponse, error) {
+	threshold, err := s.db.GetUsageThreshold()
+	if err != nil {
+		return SettingsResponse{}, err
+	}
+	all, err := s.db.GetAllUsageThresholds()
+	if err != nil {
+		return SettingsResponse{}, err
+	}
+	monthlyBudget, err := s.db.GetMonthlyBudget()
+	if err != nil {
+		return SettingsResponse{}, err
+	}
+	thresholds := make(map[string]UsageThresholds, len(all))
+	for priority, threshold := range all {
+		thresholds[priority] = UsageThresholds{FiveHour: threshold.FiveHour, SevenDay: threshold.SevenDay}
+	}
+	return SettingsResponse{UsageThreshold: threshold, UsageThresholds: thresholds, MonthlyBudgetUSD: monthlyBudget}, nil
 }
 
-// GetUsage handles GET /api/v1/usage
+// GetUsage handles GET /api/v1/usage, for the account profile named by the
+// profile query parameter or the default account
 func (s *Server) GetUsage(w http.ResponseWriter, r *http.Request) {
-	client, err := usage.NewClient()
+	profileName := strings.TrimSpace(r.URL.Query().Get("profile"))
+	cfg := usage.ConfigFromEnv()
+	if profileName != "" {
+		profile, err := s.db.GetProfile(profileName)
+		if err != nil {
+			s.errorResponse(w, http.StatusNotFound, "Profile not found", err)
+			return
+		}
+		cfg = usage.ConfigForDir(profile.ConfigDir)
+	}
+
+	client, err := usage.NewClientWithConfig(cfg)
 	if err != nil {
 		if isTruthy(strings.TrimSpace(os.Getenv("CLAUDE_TASKS_DISABLE_USAGE_CHECK"))) {
 			now := time.Now().Format(time.RFC3339)
@@ -433,6 +635,7 @@ func (s *Server) GetUsage(w http.ResponseWriter, r *http.Request) {
 					Utilization: 0,
 					ResetsAt:    now,
 				},
+				Budget: s.globalBudgetResponse(),
 			})
 			return
 		}
@@ -441,6 +644,7 @@ func (s *Server) GetUsage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	client.RecordSamples(s.db, profileName)
 	data, err := client.Fetch()
 	if err != nil {
 		s.errorResponse(w, http.StatusInternalServerError, "Failed to fetch usage", err)
@@ -456,6 +660,7 @@ func (s *Server) GetUsage(w http.ResponseWriter, r *http.Request) {
 			Utilization: data.SevenDay.Utilization,
 			ResetsAt:    data.SevenDay.ResetsAt,
 		},
+		Budget: s.globalBudgetResponse(),
 	})
 }
 
@@ -470,7 +675,17 @@ func isTruthy(value string) bool {
 	}
 }
 
-func (s *Server) taskToResponse(task *db.Task, status db.RunStatus) TaskResponse {
+// viewerLocation returns the zone requested through the tz query parameter,
+// defaulting to the server's local zone
+func viewerLocation(r *http.Request) (*time.Location, error) {
+	name := strings.TrimSpace(r.URL.Query().Get("tz"))
+	if name == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(name)
+}
+
+func (s *Server) taskToResponse(task *db.Task, status db.RunStatus, viewer *time.Location) TaskResponse {
 	resp := TaskResponse{
 		ID:             task.ID,
 		Name:           task.Name,
@@ -483,12 +698,54 @@ func (s *Server) taskToResponse(task *db.Task, status db.RunStatus) TaskResponse
 		SlackWebhook:   task.SlackWebhook,
 		Model:          task.Model,
 		PermissionMode: task.PermissionMode,
+		Timeout:        db.FormatDuration(task.EffectiveTimeout()),
+		MaxRetries:     task.MaxRetries,
+		RetryBackoff:   db.FormatDuration(task.RetryDelay(1)),
+		RetryOn:        task.RetryOn,
 		Enabled:        task.Enabled,
 		CreatedAt:      task.CreatedAt,
 		UpdatedAt:      task.UpdatedAt,
 		LastRunAt:      task.LastRunAt,
 		NextRunAt:      task.NextRunAt,
 	}
+	resp.ConcurrencyPolicy = task.EffectiveConcurrencyPolicy()
+	resp.Timezone = task.Location().String()
+	resp.MisfirePolicy = task.EffectiveMisfirePolicy()
+	resp.LastScheduledAt = task.LastScheduledAt
+	resp.PromptVars = task.PromptVars
+	resp.Env = task.Env
+	resp.EnvFile = task.EnvFile
+	resp.AllowedTools = task.AllowedTools
+	resp.DisallowedTools = task.DisallowedTools
+	resp.MaxTurns = task.MaxTurns
+	resp.AppendSystemPrompt = task.AppendSystemPrompt
+	resp.MCPConfig = task.MCPConfig
+	resp.AddDirs = task.AddDirs
+	resp.SessionMode = task.EffectiveSessionMode()
+	resp.MaxSessionRuns = task.EffectiveMaxSessionRuns()
+	resp.Isolation = task.EffectiveIsolation()
+	if resp.Isolation == db.IsolationWorktree {
+		resp.WorktreeCleanup = task.EffectiveWorktreeCleanup()
+	}
+	resp.PreHooks = hooksToResponse(task.PreHooks)
+	resp.PostHooks = hooksToResponse(task.PostHooks)
+	resp.Assertions = assertionsToResponse(task.Assertions)
+	resp.OutputSchema = task.OutputSchema
+	if task.HasBudget() {
+		resp.BudgetUSD = task.BudgetUSD
+		resp.BudgetTokens = task.BudgetTokens
+		resp.BudgetPeriod = task.EffectiveBudgetPeriod()
+	}
+	resp.OnUsageLimit = task.EffectiveUsageLimitPolicy()
+	resp.Priority = task.EffectivePriority()
+	resp.Profile = task.Profile
+	resp.ViewerTimezone = viewer.String()
+	if task.NextRunAt != nil {
+		taskTime := task.NextRunAt.In(task.Location())
+		viewerTime := task.NextRunAt.In(viewer)
+		resp.NextRunAtTaskTZ = &taskTime
+		resp.NextRunAtViewerTZ = &viewerTime
+	}
 	if status != "" {
 		resp.LastRunStatus = string(status)
 	}
@@ -497,15 +754,44 @@ func (s *Server) taskToResponse(task *db.Task, status db.RunStatus) TaskResponse
 
 func (s *Server) taskRunToResponse(run *db.TaskRun) TaskRunResponse {
 	resp := TaskRunResponse{
-		ID:        run.ID,
-		TaskID:    run.TaskID,
-		StartedAt: run.StartedAt,
-		EndedAt:   run.EndedAt,
-		Status:    string(run.Status),
-		Output:    run.Output,
-		Error:     run.Error,
-		SessionID: run.SessionID,
+		ID:          run.ID,
+		TaskID:      run.TaskID,
+		StartedAt:   run.StartedAt,
+		EndedAt:     run.EndedAt,
+		Status:      string(run.Status),
+		Output:      run.Output,
+		Error:       run.Error,
+		SessionID:   run.SessionID,
+		Attempt:     run.Attempt,
+		ParentRunID: run.ParentRunID,
+	}
+	resp.ScheduledFor = run.ScheduledFor
+	resp.TriggeredByRunID = run.TriggeredByRunID
+	resp.RenderedPrompt = run.RenderedPrompt
+	resp.DeferredUntil = run.DeferredUntil
+	resp.ResumedFromRunID = run.ResumedFromRunID
+	resp.ThreadRunID = run.ThreadID()
+	resp.ThreadDepth = max(run.ThreadDepth, 1)
+	if wt := run.Worktree; wt != nil {
+		resp.Worktree = &RunWorktreeResponse{
+			Branch:     wt.Branch,
+			Path:       wt.Path,
+			BaseCommit: wt.BaseCommit,
+			Commit:     wt.Commit,
+			DiffStat:   wt.DiffStat,
+			Changed:    wt.Changed(),
+		}
 	}
+	resp.Steps = stepsToResponse(run.Steps)
+	resp.Assertions = assertionResultsToResponse(run.Assertions)
+	resp.Result = run.ResultJSON
+	resp.ModelUsed = run.Usage.Model
+	resp.CostUSD = run.Usage.CostUSD
+	resp.InputTokens = run.Usage.InputTokens
+	resp.OutputTokens = run.Usage.OutputTokens
+	resp.CacheCreationTokens = run.Usage.CacheCreationTokens
+	resp.CacheReadTokens = run.Usage.CacheReadTokens
+	resp.NumTurns = run.Usage.NumTurns
 	if run.EndedAt != nil {
 		durationMs := run.EndedAt.Sub(run.StartedAt).Milliseconds()
 		resp.DurationMs = &durationMs
@@ -513,6 +799,118 @@ func (s *Server) taskRunToResponse(run *db.TaskRun) TaskRunResponse {
 	return resp
 }
 
+func usageToResponse(totals *db.UsageTotals) *TaskUsageResponse {
+	if totals == nil {
+		return &TaskUsageResponse{}
+	}
+	return &TaskUsageResponse{
+		Runs:                totals.Runs,
+		CostUSD:             totals.CostUSD,
+		InputTokens:         totals.InputTokens,
+		OutputTokens:        totals.OutputTokens,
+		CacheCreationTokens: totals.CacheCreationTokens,
+		CacheReadTokens:     totals.CacheReadTokens,
+		NumTurns:            totals.NumTurns,
+	}
+}
+
+// applyRunPolicies copies a validated request's retry, concurrency, misfire,
+// budget, usage limit, priority and profile settings onto a task
+func applyRunPolicies(task *db.Task, req *TaskRequest) {
+	task.MaxRetries = req.MaxRetries
+	task.RetryBackoff, _ = db.ParseRetryBackoff(req.RetryBackoff)
+	task.RetryOn, _ = db.ParseRetryOn(strings.Join(req.RetryOn, ","))
+	task.ConcurrencyPolicy, _ = db.ParseConcurrencyPolicy(req.ConcurrencyPolicy)
+	task.MisfirePolicy, _ = db.ParseMisfirePolicy(req.MisfirePolicy)
+	task.BudgetUSD = req.BudgetUSD
+	task.BudgetTokens = req.BudgetTokens
+	task.BudgetPeriod, _ = db.ParseBudgetPeriod(req.BudgetPeriod)
+	task.OnUsageLimit, _ = db.ParseUsageLimitPolicy(req.OnUsageLimit)
+	task.Priority, _ = db.ParsePriority(req.Priority)
+	task.Profile = req.Profile
+}
+
+// applyClaudeOptions copies a validated request's claude CLI options,
+// session and isolation settings onto a task, and parses its hooks,
+// assertions and output schema. It returns a validation error if those are
+// invalid.
+func applyClaudeOptions(task *db.Task, req *TaskRequest) error {
+	task.AllowedTools = req.AllowedTools
+	task.DisallowedTools = req.DisallowedTools
+	task.MaxTurns = req.MaxTurns
+	task.AppendSystemPrompt = strings.TrimSpace(req.AppendSystemPrompt)
+	task.MCPConfig = strings.TrimSpace(req.MCPConfig)
+	task.AddDirs = nil
+	for _, dir := range req.AddDirs {
+		task.AddDirs = append(task.AddDirs, strings.TrimSpace(dir))
+	}
+	task.SessionMode, _ = db.ParseSessionMode(req.SessionMode)
+	task.MaxSessionRuns = req.MaxSessionRuns
+	task.Isolation, _ = db.ParseIsolation(req.Isolation)
+	task.WorktreeCleanup, _ = db.ParseWorktreeCleanup(req.WorktreeCleanup)
+	var err error
+	if task.PreHooks, err = parseHooks("pre_hooks", req.PreHooks); err != nil {
+		return err
+	}
+	if task.PostHooks, err = parseHooks("post_hooks", req.PostHooks); err != nil {
+		return err
+	}
+	if task.Assertions, err = parseAssertions(req.Assertions); err != nil {
+		return err
+	}
+	if task.OutputSchema, err = db.ParseSchema(req.OutputSchema); err != nil {
+		return validationError("Invalid output_schema: " + err.Error())
+	}
+	return nil
+}
+
+// omittableSettings restores, by request field, the task settings an update
+// keeps when the field is left out. Clients written before a setting existed,
+// such as the mobile app, send only the original fields; without this every
+// edit they make would reset the newer settings to their defaults.
+var omittableSettings = map[string]func(task, stored *db.Task){
+	"timeout":              func(t, s *db.Task) { t.Timeout = s.Timeout },
+	"max_retries":          func(t, s *db.Task) { t.MaxRetries = s.MaxRetries },
+	"retry_backoff":        func(t, s *db.Task) { t.RetryBackoff = s.RetryBackoff },
+	"retry_on":             func(t, s *db.Task) { t.RetryOn = s.RetryOn },
+	"concurrency_policy":   func(t, s *db.Task) { t.ConcurrencyPolicy = s.ConcurrencyPolicy },
+	"timezone":             func(t, s *db.Task) { t.Timezone = s.Timezone },
+	"misfire_policy":       func(t, s *db.Task) { t.MisfirePolicy = s.MisfirePolicy },
+	"prompt_vars":          func(t, s *db.Task) { t.PromptVars = s.PromptVars },
+	"budget_usd":           func(t, s *db.Task) { t.BudgetUSD = s.BudgetUSD },
+	"budget_tokens":        func(t, s *db.Task) { t.BudgetTokens = s.BudgetTokens },
+	"budget_period":        func(t, s *db.Task) { t.BudgetPeriod = s.BudgetPeriod },
+	"on_usage_limit":       func(t, s *db.Task) { t.OnUsageLimit = s.OnUsageLimit },
+	"priority":             func(t, s *db.Task) { t.Priority = s.Priority },
+	"profile":              func(t, s *db.Task) { t.Profile = s.Profile },
+	"env":                  func(t, s *db.Task) { t.Env = s.Env },
+	"env_file":             func(t, s *db.Task) { t.EnvFile = s.EnvFile },
+	"allowed_tools":        func(t, s *db.Task) { t.AllowedTools = s.AllowedTools },
+	"disallowed_tools":     func(t, s *db.Task) { t.DisallowedTools = s.DisallowedTools },
+	"max_turns":            func(t, s *db.Task) { t.MaxTurns = s.MaxTurns },
+	"append_system_prompt": func(t, s *db.Task) { t.AppendSystemPrompt = s.AppendSystemPrompt },
+	"mcp_config":           func(t, s *db.Task) { t.MCPConfig = s.MCPConfig },
+	"add_dirs":             func(t, s *db.Task) { t.AddDirs = s.AddDirs },
+	"session_mode":         func(t, s *db.Task) { t.SessionMode = s.SessionMode },
+	"max_session_runs":     func(t, s *db.Task) { t.MaxSessionRuns = s.MaxSessionRuns },
+	"isolation":            func(t, s *db.Task) { t.Isolation = s.Isolation },
+	"worktree_cleanup":     func(t, s *db.Task) { t.WorktreeCleanup = s.WorktreeCleanup },
+	"pre_hooks":            func(t, s *db.Task) { t.PreHooks = s.PreHooks },
+	"post_hooks":           func(t, s *db.Task) { t.PostHooks = s.PostHooks },
+	"assertions":           func(t, s *db.Task) { t.Assertions = s.Assertions },
+	"output_schema":        func(t, s *db.Task) { t.OutputSchema = s.OutputSchema },
+}
+
+// keepOmittedSettings restores the settings of the fields absent from an
+// update request's body to their stored values
+func keepOmittedSettings(task, stored *db.Task, sent map[string]json.RawMessage) {
+	for field, restore := range omittableSettings {
+		if _, ok := sent[field]; !ok {
+			restore(task, stored)
+		}
+	}
+}
+
 func (s *Server) validateTaskRequest(req *TaskRequest) error {
 	if req.Name == "" {
 		return errEmptyName
@@ -520,6 +918,22 @@ func (s *Server) validateTaskRequest(req *TaskRequest) error {
 	if req.Prompt == "" {
 		return errEmptyPrompt
 	}
+	if err := prompt.Validate(req.Prompt); err != nil {
+		return validationError("Invalid prompt template: " + err.Error())
+	}
+	if err := prompt.ValidateVars(req.PromptVars); err != nil {
+		return validationError("Invalid prompt_vars: " + err.Error())
+	}
+	if err := db.ValidateEnv(req.Env); err != nil {
+		return validationError("Invalid env: " + err.Error())
+	}
+	for _, value := range req.Env {
+		for _, name := range db.SecretRefs(value) {
+			if exists, err := s.db.SecretExists(name); err != nil || !exists {
+				return validationError("Unknown secret " + name + " (set it with PUT /api/v1/secrets/" + name + " first)")
+			}
+		}
+	}
 	// CronExpr is empty for one-off tasks, non-empty for recurring
 	if req.CronExpr != "" {
 		// Validate cron expression if provided
@@ -528,6 +942,67 @@ func (s *Server) validateTaskRequest(req *TaskRequest) error {
 			return errInvalidCron
 		}
 	}
+	if _, err := db.ParseTimeout(req.Timeout); err != nil {
+		return errInvalidTimeout
+	}
+	if req.MaxRetries < 0 || req.MaxRetries > db.MaxRetries {
+		return errInvalidMaxRetries
+	}
+	if _, err := db.ParseRetryBackoff(req.RetryBackoff); err != nil {
+		return errInvalidRetryBackoff
+	}
+	if _, err := db.ParseRetryOn(strings.Join(req.RetryOn, ",")); err != nil {
+		return errInvalidRetryOn
+	}
+	if _, err := db.ParseConcurrencyPolicy(req.ConcurrencyPolicy); err != nil {
+		return errInvalidConcurrency
+	}
+	if _, err := db.ParseTimezone(req.Timezone); err != nil {
+		return errInvalidTimezone
+	}
+	if _, err := db.ParseMisfirePolicy(req.MisfirePolicy); err != nil {
+		return errInvalidMisfire
+	}
+	if req.BudgetUSD < 0 || req.BudgetTokens < 0 {
+		return errInvalidBudget
+	}
+	if _, err := db.ParseBudgetPeriod(req.BudgetPeriod); err != nil {
+		return errInvalidBudgetPeriod
+	}
+	if _, err := db.ParseUsageLimitPolicy(req.OnUsageLimit); err != nil {
+		return errInvalidUsageLimit
+	}
+	if _, err := db.ParsePriority(req.Priority); err != nil {
+		return errInvalidPriority
+	}
+	if req.Profile = strings.ToLower(strings.TrimSpace(req.Profile)); req.Profile != "" {
+		if _, err := s.db.GetProfile(req.Profile); err != nil {
+			return errUnknownProfile
+		}
+	}
+	if db.ValidateTools(req.AllowedTools) != nil || db.ValidateTools(req.DisallowedTools) != nil {
+		return errInvalidTools
+	}
+	if req.MaxTurns < 0 || req.MaxTurns > db.MaxTurnsLimit {
+		return errInvalidMaxTurns
+	}
+	for _, dir := range req.AddDirs {
+		if strings.TrimSpace(dir) == "" {
+			return errInvalidAddDirs
+		}
+	}
+	if _, err := db.ParseSessionMode(req.SessionMode); err != nil {
+		return errInvalidSessionMode
+	}
+	if req.MaxSessionRuns < 0 || req.MaxSessionRuns > db.MaxSessionRunsLimit {
+		return errInvalidMaxSessions
+	}
+	if _, err := db.ParseIsolation(req.Isolation); err != nil {
+		return errInvalidIsolation
+	}
+	if _, err := db.ParseWorktreeCleanup(req.WorktreeCleanup); err != nil {
+		return errInvalidWorktreeCleanup
+	}
 	if req.WorkingDir == "" {
 		req.WorkingDir = "."
 	}
@@ -580,7 +1055,35 @@ type validationError string
 func (e validationError) Error() string { return string(e) }
 
 const (
-	errEmptyName   validationError = "Name is required"
-	errEmptyPrompt validationError = "Prompt is required"
-	errInvalidCron validationError = "Invalid cron expression"
+	errEmptyName      validationError = "Name is required"
+	errEmptyPrompt    validationError = "Prompt is required"
+	errInvalidCron    validationError = "Invalid cron expression"
+	errInvalidTimeout validationError = "Invalid timeout (use a duration between 1s and 24h, e.g. 5m or 2h)"
+
+	errInvalidMaxRetries   validationError = "Invalid max_retries (use 0 to 10)"
+	errInvalidRetryBackoff validationError = "Invalid retry_backoff (use a duration between 1s and 6h, e.g. 30s or 5m)"
+	errInvalidRetryOn      validationError = "Invalid retry_on (use exit_error, timeout, preflight, orphaned or assertion)"
+	errInvalidConcurrency  validationError = "Invalid concurrency_policy (use allow, forbid or queue)"
+	errInvalidTimezone     validationError = "Invalid timezone (use an IANA name such as America/New_York)"
+	errInvalidViewerTZ     validationError = "Invalid tz (use an IANA name such as America/New_York)"
+	errInvalidMisfire      validationError = "Invalid misfire_policy (use skip, run_once or run_all)"
+	errInvalidCondition    validationError = "Invalid condition (use on_success, on_failure or on_complete)"
+	errInvalidBudget       validationError = "Invalid budget (budget_usd and budget_tokens must not be negative)"
+	errInvalidBudgetPeriod validationError = "Invalid budget_period (use day, week or month)"
+	errInvalidMonthlyCap   validationError = "Monthly budget must not be negative"
+	errInvalidUsageLimit   validationError = "Invalid on_usage_limit (use skip, defer_until_reset or run_anyway)"
+	errInvalidPriority     validationError = "Invalid priority (use low, normal or critical)"
+	errInvalidThreshold    validationError = "Usage thresholds must be between 0 and 100"
+	errUnknownProfile      validationError = "Unknown profile (create it with POST /api/v1/profiles first)"
+	errInvalidProfileName  validationError = "Invalid profile name (use up to 32 lowercase letters, digits, - and _; default is reserved)"
+	errInvalidConfigDir    validationError = "Invalid config_dir (use an absolute or ~/ path)"
+	errInvalidTools        validationError = "Invalid allowed_tools or disallowed_tools (use tool names such as Read or Bash(git diff:*))"
+	errInvalidMaxTurns     validationError = "Invalid max_turns (use 0 to 1000)"
+	errInvalidAddDirs      validationError = "Invalid add_dirs (directories must not be empty)"
+	errInvalidSessionMode  validationError = "Invalid session_mode (use fresh, continue_last or fork_last)"
+	errInvalidMaxSessions  validationError = "Invalid max_session_runs (use 0 to 1000)"
+	errInvalidIsolation    validationError = "Invalid isolation (use none or worktree)"
+	errInvalidSecretName   validationError = "Invalid secret name (use letters, digits and underscores, not starting with a digit)"
+
+	errInvalidWorktreeCleanup validationError = "Invalid worktree_cleanup (use remove, keep or keep_on_failure)"
 )
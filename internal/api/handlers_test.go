@@ -4,11 +4,16 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/ASRagab/claude-tasks/internal/db"
+	"github.com/ASRagab/claude-tasks/internal/scheduler"
 	"github.com/ASRagab/claude-tasks/internal/testutil"
 )
 
@@ -133,6 +138,83 @@ func TestUpdateTaskAllowsHTTPWebhooks(t *testing.T) {
 	}
 }
 
+func TestUpdateTaskKeepsOmittedSettings(t *testing.T) {
+	srv := newTestServer(t)
+
+	createReq := TaskRequest{
+		Name: "backup", Prompt: "echo {{.Vars.target}}", CronExpr: "0 * * * * *", WorkingDir: ".",
+		Timeout: "10m", MaxRetries: 2, RetryBackoff: "1m", RetryOn: []string{"timeout"},
+		ConcurrencyPolicy: "queue", Timezone: "Europe/Berlin", MisfirePolicy: "run_once",
+		PromptVars: map[string]string{"target": "db"},
+		BudgetUSD:  5, BudgetTokens: 1000, BudgetPeriod: "week", OnUsageLimit: "run_anyway", Priority: "critical",
+		Env: map[string]string{"STAGE": "prod"}, EnvFile: ".env",
+		AllowedTools: []string{"Read"}, MaxTurns: 3, AppendSystemPrompt: "be brief",
+		SessionMode: "continue_last", MaxSessionRuns: 4, Isolation: "worktree", WorktreeCleanup: "keep",
+		PreHooks:     []HookRequest{{Command: "git pull"}},
+		Assertions:   []AssertionRequest{{Type: "matches", Pattern: "ok"}},
+		OutputSchema: []byte(`{"type": "object"}`),
+		Enabled:      true,
+	}
+	rr := httptest.NewRecorder()
+	srv.Router().ServeHTTP(rr, testutil.JSONRequest(t, http.MethodPost, "/api/v1/tasks", createReq))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	created := testutil.DecodeJSON[TaskResponse](t, rr)
+
+	// The fields an older client such as the mobile app sends
+	updateReq := map[string]interface{}{
+		"name": "nightly backup", "prompt": createReq.Prompt, "cron_expr": createReq.CronExpr,
+		"working_dir": ".", "model": "", "permission_mode": "", "enabled": true,
+	}
+	rr = httptest.NewRecorder()
+	srv.Router().ServeHTTP(rr, testutil.JSONRequest(t, http.MethodPut, fmt.Sprintf("/api/v1/tasks/%d", created.ID), updateReq))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	updated := testutil.DecodeJSON[TaskResponse](t, rr)
+	if updated.Name != "nightly backup" {
+		t.Fatalf("expected the name to change, got %q", updated.Name)
+	}
+
+	created.Name, created.CreatedAt, created.UpdatedAt = updated.Name, updated.CreatedAt, updated.UpdatedAt
+	if !reflect.DeepEqual(created, updated) {
+		t.Fatalf("settings changed by an update that left them out:\nbefore %+v\nafter  %+v", created, updated)
+	}
+
+	// Fields that are sent still replace the stored values, empty or not
+	updateReq["timeout"] = ""
+	updateReq["env"] = map[string]string{}
+	updateReq["pre_hooks"] = []HookRequest{}
+	rr = httptest.NewRecorder()
+	srv.Router().ServeHTTP(rr, testutil.JSONRequest(t, http.MethodPut, fmt.Sprintf("/api/v1/tasks/%d", created.ID), updateReq))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	updated = testutil.DecodeJSON[TaskResponse](t, rr)
+	if updated.Timeout != db.FormatDuration(db.DefaultTimeout) || len(updated.Env) != 0 || len(updated.PreHooks) != 0 {
+		t.Fatalf("expected sent fields to be cleared, got timeout %q env %v pre_hooks %v", updated.Timeout, updated.Env, updated.PreHooks)
+	}
+	if updated.MaxRetries != 2 || updated.Timezone != "Europe/Berlin" || len(updated.Assertions) != 1 {
+		t.Fatalf("expected omitted settings to survive, got %+v", updated)
+	}
+}
+
+func TestOmittableSettingsCoverNewerTaskFields(t *testing.T) {
+	// Fields every client has always sent; an update replaces them as given
+	original := map[string]bool{
+		"name": true, "prompt": true, "cron_expr": true, "scheduled_at": true, "working_dir": true,
+		"discord_webhook": true, "slack_webhook": true, "model": true, "permission_mode": true, "enabled": true,
+	}
+	fields := reflect.TypeOf(TaskRequest{})
+	for i := 0; i < fields.NumField(); i++ {
+		name := strings.Split(fields.Field(i).Tag.Get("json"), ",")[0]
+		if _, ok := omittableSettings[name]; !ok && !original[name] {
+			t.Errorf("TaskRequest field %q is missing from omittableSettings", name)
+		}
+	}
+}
+
 func TestGetTaskReturns404ForMissingTask(t *testing.T) {
 	srv := newTestServer(t)
 
@@ -288,6 +370,63 @@ func TestRunTaskPersistsPreflightFailureRun(t *testing.T) {
 	t.Fatalf("expected latest run to be available within timeout")
 }
 
+func TestRunTaskRetriesThroughScheduler(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake claude script requires a POSIX shell")
+	}
+	t.Setenv("CLAUDE_TASKS_DISABLE_USAGE_CHECK", "1")
+	binDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(binDir, "claude"), []byte("#!/bin/sh\nexit 1\n"), 0o755); err != nil {
+		t.Fatalf("write fake claude binary: %v", err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	database, dataDir := testutil.NewTestDB(t)
+	sched := scheduler.New(database, dataDir)
+	if err := sched.Start(); err != nil {
+		t.Fatalf("start scheduler: %v", err)
+	}
+	defer sched.Stop()
+	srv := NewServer(database, sched, dataDir)
+
+	task := &db.Task{
+		Name:         "flaky",
+		Prompt:       "fail",
+		WorkingDir:   t.TempDir(),
+		MaxRetries:   1,
+		RetryBackoff: time.Second,
+		RetryOn:      []string{db.RetryOnExitError},
+	}
+	if err := database.CreateTask(task); err != nil {
+		t.Fatalf("create task: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	srv.Router().ServeHTTP(rr, testutil.JSONRequest(t, http.MethodPost, fmt.Sprintf("/api/v1/tasks/%d/run", task.ID), nil))
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("expected %d, got %d: %s", http.StatusAccepted, rr.Code, rr.Body.String())
+	}
+
+	var runs []*db.TaskRun
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		var err error
+		if runs, err = database.GetTaskRuns(task.ID, 10); err != nil {
+			t.Fatalf("get runs: %v", err)
+		}
+		if len(runs) == 2 && runs[0].EndedAt != nil {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if len(runs) != 2 {
+		t.Fatalf("expected the run started through the API and one retry, got %d runs", len(runs))
+	}
+	if retry := runs[0]; retry.Attempt != 2 || retry.ParentRunID == nil || *retry.ParentRunID != runs[1].ID {
+		t.Fatalf("unexpected retry: attempt=%d parent=%v", retry.Attempt, retry.ParentRunID)
+	}
+}
+
 func TestGetTaskRunReturnsSpecificRun(t *testing.T) {
 	srv := newTestServer(t)
 	task := &db.Task{
@@ -350,3 +489,1237 @@ func TestGetUsageReturnsZeroWhenUsageCheckDisabledAndCredentialsMissing(t *testi
 		t.Fatalf("expected non-empty reset timestamps when usage check is disabled")
 	}
 }
+
+func TestCancelTaskRun(t *testing.T) {
+	srv := newTestServer(t)
+	task := &db.Task{
+		Name:       "backup",
+		Prompt:     "echo hi",
+		CronExpr:   "0 * * * * *",
+		WorkingDir: ".",
+		Enabled:    true,
+	}
+	if err := srv.db.CreateTask(task); err != nil {
+		t.Fatalf("create task: %v", err)
+	}
+
+	running := &db.TaskRun{TaskID: task.ID, StartedAt: time.Now(), Status: db.RunStatusRunning}
+	if err := srv.db.CreateTaskRun(running); err != nil {
+		t.Fatalf("create running run: %v", err)
+	}
+	finished := &db.TaskRun{TaskID: task.ID, StartedAt: time.Now(), Status: db.RunStatusCompleted}
+	if err := srv.db.CreateTaskRun(finished); err != nil {
+		t.Fatalf("create finished run: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	req := testutil.JSONRequest(t, http.MethodPost, fmt.Sprintf("/api/v1/tasks/%d/runs/%d/cancel", task.ID, running.ID), nil)
+	srv.Router().ServeHTTP(rr, req)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("expected %d, got %d: %s", http.StatusAccepted, rr.Code, rr.Body.String())
+	}
+	requested, err := srv.db.IsTaskRunCancelRequested(running.ID)
+	if err != nil {
+		t.Fatalf("check cancel flag: %v", err)
+	}
+	if !requested {
+		t.Fatalf("expected cancellation to be recorded for running run")
+	}
+
+	conflictRR := httptest.NewRecorder()
+	conflictReq := testutil.JSONRequest(t, http.MethodPost, fmt.Sprintf("/api/v1/tasks/%d/runs/%d/cancel", task.ID, finished.ID), nil)
+	srv.Router().ServeHTTP(conflictRR, conflictReq)
+	if conflictRR.Code != http.StatusConflict {
+		t.Fatalf("expected %d, got %d: %s", http.StatusConflict, conflictRR.Code, conflictRR.Body.String())
+	}
+
+	missingRR := httptest.NewRecorder()
+	missingReq := testutil.JSONRequest(t, http.MethodPost, fmt.Sprintf("/api/v1/tasks/%d/runs/999/cancel", task.ID), nil)
+	srv.Router().ServeHTTP(missingRR, missingReq)
+	if missingRR.Code != http.StatusNotFound {
+		t.Fatalf("expected %d, got %d: %s", http.StatusNotFound, missingRR.Code, missingRR.Body.String())
+	}
+}
+
+func TestStreamTaskRunReplaysChunksAndFinishes(t *testing.T) {
+	srv := newTestServer(t)
+	task := &db.Task{
+		Name:       "backup",
+		Prompt:     "echo hi",
+		CronExpr:   "0 * * * * *",
+		WorkingDir: ".",
+		Enabled:    true,
+	}
+	if err := srv.db.CreateTask(task); err != nil {
+		t.Fatalf("create task: %v", err)
+	}
+	run := &db.TaskRun{TaskID: task.ID, StartedAt: time.Now(), Status: db.RunStatusCompleted, Output: "done"}
+	if err := srv.db.CreateTaskRun(run); err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+	for seq, content := range []string{"one", "two"} {
+		chunk := &db.TaskRunChunk{RunID: run.ID, Seq: int64(seq + 1), Kind: db.RunChunkText, Content: content}
+		if err := srv.db.AppendTaskRunChunk(chunk); err != nil {
+			t.Fatalf("append chunk: %v", err)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	req := testutil.JSONRequest(t, http.MethodGet, fmt.Sprintf("/api/v1/tasks/%d/runs/%d/stream", task.ID, run.ID), nil)
+	req.Header.Set("Last-Event-ID", "1")
+	srv.Router().ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("expected event stream content type, got %q", ct)
+	}
+	body := rr.Body.String()
+	if strings.Contains(body, `"content":"one"`) {
+		t.Fatalf("expected chunks up to Last-Event-ID to be skipped: %s", body)
+	}
+	if !strings.Contains(body, "id: 2\nevent: chunk\n") || !strings.Contains(body, `"content":"two"`) {
+		t.Fatalf("expected chunk 2 event, got: %s", body)
+	}
+	if !strings.Contains(body, "event: done\n") {
+		t.Fatalf("expected done event for finished run, got: %s", body)
+	}
+}
+
+func TestCreateTaskWithTimeout(t *testing.T) {
+	srv := newTestServer(t)
+
+	createReq := TaskRequest{
+		Name:       "refactor",
+		Prompt:     "refactor things",
+		CronExpr:   "0 0 2 * * *",
+		WorkingDir: ".",
+		Timeout:    "2h",
+		Enabled:    true,
+	}
+
+	rr := httptest.NewRecorder()
+	req := testutil.JSONRequest(t, http.MethodPost, "/api/v1/tasks", createReq)
+	srv.Router().ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	created := testutil.DecodeJSON[TaskResponse](t, rr)
+	if created.Timeout != "2h" {
+		t.Fatalf("expected timeout 2h, got %q", created.Timeout)
+	}
+
+	stored, err := srv.db.GetTask(created.ID)
+	if err != nil {
+		t.Fatalf("get task: %v", err)
+	}
+	if stored.Timeout != 2*time.Hour {
+		t.Fatalf("expected stored timeout 2h, got %s", stored.Timeout)
+	}
+
+	createReq.Timeout = "forever"
+	badRR := httptest.NewRecorder()
+	badReq := testutil.JSONRequest(t, http.MethodPost, "/api/v1/tasks", createReq)
+	srv.Router().ServeHTTP(badRR, badReq)
+	if badRR.Code != http.StatusBadRequest {
+		t.Fatalf("expected %d, got %d: %s", http.StatusBadRequest, badRR.Code, badRR.Body.String())
+	}
+}
+
+func TestCreateTaskWithRetryPolicy(t *testing.T) {
+	srv := newTestServer(t)
+
+	createReq := TaskRequest{
+		Name:         "flaky",
+		Prompt:       "sometimes fails",
+		CronExpr:     "0 0 * * * *",
+		WorkingDir:   ".",
+		MaxRetries:   3,
+		RetryBackoff: "30s",
+		RetryOn:      []string{"timeout", "exit_error"},
+		Enabled:      true,
+	}
+
+	rr := httptest.NewRecorder()
+	req := testutil.JSONRequest(t, http.MethodPost, "/api/v1/tasks", createReq)
+	srv.Router().ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	created := testutil.DecodeJSON[TaskResponse](t, rr)
+	if created.MaxRetries != 3 || created.RetryBackoff != "30s" || len(created.RetryOn) != 2 {
+		t.Fatalf("unexpected retry policy in response: %+v", created)
+	}
+
+	stored, err := srv.db.GetTask(created.ID)
+	if err != nil {
+		t.Fatalf("get task: %v", err)
+	}
+	if stored.MaxRetries != 3 || stored.RetryBackoff != 30*time.Second || !stored.RetriesOn(db.RetryOnTimeout) || stored.RetriesOn(db.RetryOnPreflight) {
+		t.Fatalf("unexpected stored retry policy: %+v", stored)
+	}
+
+	for _, bad := range []TaskRequest{
+		{Name: "x", Prompt: "y", MaxRetries: 11},
+		{Name: "x", Prompt: "y", RetryBackoff: "7h"},
+		{Name: "x", Prompt: "y", RetryOn: []string{"crash"}},
+	} {
+		badRR := httptest.NewRecorder()
+		badReq := testutil.JSONRequest(t, http.MethodPost, "/api/v1/tasks", bad)
+		srv.Router().ServeHTTP(badRR, badReq)
+		if badRR.Code != http.StatusBadRequest {
+			t.Fatalf("expected %d for %+v, got %d", http.StatusBadRequest, bad, badRR.Code)
+		}
+	}
+}
+
+func TestGetTaskRunsIncludesRetryAttempts(t *testing.T) {
+	srv := newTestServer(t)
+	task := &db.Task{Name: "flaky", Prompt: "p", CronExpr: "0 * * * * *", WorkingDir: ".", MaxRetries: 1}
+	if err := srv.db.CreateTask(task); err != nil {
+		t.Fatalf("create task: %v", err)
+	}
+
+	first := &db.TaskRun{TaskID: task.ID, StartedAt: time.Now().Add(-time.Minute), Status: db.RunStatusFailed}
+	if err := srv.db.CreateTaskRun(first); err != nil {
+		t.Fatalf("create first run: %v", err)
+	}
+	retry := &db.TaskRun{TaskID: task.ID, StartedAt: time.Now(), Status: db.RunStatusCompleted, Attempt: 2, ParentRunID: &first.ID}
+	if err := srv.db.CreateTaskRun(retry); err != nil {
+		t.Fatalf("create retry run: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	req := testutil.JSONRequest(t, http.MethodGet, fmt.Sprintf("/api/v1/tasks/%d/runs/%d", task.ID, retry.ID), nil)
+	srv.Router().ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	resp := testutil.DecodeJSON[TaskRunResponse](t, rr)
+	if resp.Attempt != 2 || resp.ParentRunID == nil || *resp.ParentRunID != first.ID {
+		t.Fatalf("expected attempt 2 of run %d, got attempt %d parent %v", first.ID, resp.Attempt, resp.ParentRunID)
+	}
+}
+
+func TestCreateTaskWithConcurrencyPolicy(t *testing.T) {
+	srv := newTestServer(t)
+
+	createReq := TaskRequest{
+		Name:              "nightly",
+		Prompt:            "long job",
+		CronExpr:          "0 */5 * * * *",
+		WorkingDir:        ".",
+		ConcurrencyPolicy: "skip",
+	}
+
+	rr := httptest.NewRecorder()
+	req := testutil.JSONRequest(t, http.MethodPost, "/api/v1/tasks", createReq)
+	srv.Router().ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	created := testutil.DecodeJSON[TaskResponse](t, rr)
+	if created.ConcurrencyPolicy != db.ConcurrencyForbid {
+		t.Fatalf("expected policy %q, got %q", db.ConcurrencyForbid, created.ConcurrencyPolicy)
+	}
+
+	createReq.ConcurrencyPolicy = "parallel"
+	badRR := httptest.NewRecorder()
+	badReq := testutil.JSONRequest(t, http.MethodPost, "/api/v1/tasks", createReq)
+	srv.Router().ServeHTTP(badRR, badReq)
+	if badRR.Code != http.StatusBadRequest {
+		t.Fatalf("expected %d, got %d: %s", http.StatusBadRequest, badRR.Code, badRR.Body.String())
+	}
+}
+
+func TestTaskTimezoneAndViewerNextRunTimes(t *testing.T) {
+	srv := newTestServer(t)
+
+	createReq := TaskRequest{
+		Name:       "standup",
+		Prompt:     "summarize",
+		CronExpr:   "0 0 9 * * 1-5",
+		WorkingDir: ".",
+		Timezone:   "America/New_York",
+	}
+
+	rr := httptest.NewRecorder()
+	req := testutil.JSONRequest(t, http.MethodPost, "/api/v1/tasks", createReq)
+	srv.Router().ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	created := testutil.DecodeJSON[TaskResponse](t, rr)
+	if created.Timezone != "America/New_York" {
+		t.Fatalf("expected timezone America/New_York, got %q", created.Timezone)
+	}
+
+	task, err := srv.db.GetTask(created.ID)
+	if err != nil {
+		t.Fatalf("get task: %v", err)
+	}
+	next := time.Date(2030, time.January, 7, 14, 0, 0, 0, time.UTC)
+	task.NextRunAt = &next
+	if err := srv.db.UpdateTask(task); err != nil {
+		t.Fatalf("update task: %v", err)
+	}
+
+	getRR := httptest.NewRecorder()
+	getReq := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/v1/tasks/%d?tz=Asia/Tokyo", created.ID), nil)
+	srv.Router().ServeHTTP(getRR, getReq)
+	if getRR.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d: %s", http.StatusOK, getRR.Code, getRR.Body.String())
+	}
+	got := testutil.DecodeJSON[TaskResponse](t, getRR)
+	if got.ViewerTimezone != "Asia/Tokyo" {
+		t.Fatalf("expected viewer timezone Asia/Tokyo, got %q", got.ViewerTimezone)
+	}
+	if got.NextRunAtTaskTZ == nil || got.NextRunAtTaskTZ.Hour() != 9 {
+		t.Fatalf("expected 09:00 in the task zone, got %v", got.NextRunAtTaskTZ)
+	}
+	if got.NextRunAtViewerTZ == nil || got.NextRunAtViewerTZ.Hour() != 23 {
+		t.Fatalf("expected 23:00 in the viewer zone, got %v", got.NextRunAtViewerTZ)
+	}
+
+	badRR := httptest.NewRecorder()
+	badReq := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/v1/tasks/%d?tz=Nowhere/Else", created.ID), nil)
+	srv.Router().ServeHTTP(badRR, badReq)
+	if badRR.Code != http.StatusBadRequest {
+		t.Fatalf("expected %d for invalid tz, got %d", http.StatusBadRequest, badRR.Code)
+	}
+
+	createReq.Timezone = "Mars/Olympus"
+	invalidRR := httptest.NewRecorder()
+	invalidReq := testutil.JSONRequest(t, http.MethodPost, "/api/v1/tasks", createReq)
+	srv.Router().ServeHTTP(invalidRR, invalidReq)
+	if invalidRR.Code != http.StatusBadRequest {
+		t.Fatalf("expected %d for invalid timezone, got %d", http.StatusBadRequest, invalidRR.Code)
+	}
+}
+
+func TestCreateTaskWithMisfirePolicy(t *testing.T) {
+	srv := newTestServer(t)
+
+	createReq := TaskRequest{
+		Name:          "report",
+		Prompt:        "summarize",
+		CronExpr:      "0 0 9 * * *",
+		WorkingDir:    ".",
+		MisfirePolicy: "RUN_ONCE",
+	}
+
+	rr := httptest.NewRecorder()
+	req := testutil.JSONRequest(t, http.MethodPost, "/api/v1/tasks", createReq)
+	srv.Router().ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	created := testutil.DecodeJSON[TaskResponse](t, rr)
+	if created.MisfirePolicy != db.MisfireRunOnce {
+		t.Fatalf("expected policy %q, got %q", db.MisfireRunOnce, created.MisfirePolicy)
+	}
+
+	createReq.MisfirePolicy = "catch_up"
+	badRR := httptest.NewRecorder()
+	badReq := testutil.JSONRequest(t, http.MethodPost, "/api/v1/tasks", createReq)
+	srv.Router().ServeHTTP(badRR, badReq)
+	if badRR.Code != http.StatusBadRequest {
+		t.Fatalf("expected %d, got %d: %s", http.StatusBadRequest, badRR.Code, badRR.Body.String())
+	}
+}
+
+func TestTaskTriggersCreateListAndDelete(t *testing.T) {
+	srv := newTestServer(t)
+	newTask := func(name string) *db.Task {
+		task := &db.Task{Name: name, Prompt: "hi", CronExpr: "0 * * * * *", WorkingDir: ".", Enabled: true}
+		if err := srv.db.CreateTask(task); err != nil {
+			t.Fatalf("create task: %v", err)
+		}
+		return task
+	}
+	collect := newTask("collect")
+	report := newTask("report")
+
+	rr := httptest.NewRecorder()
+	req := testutil.JSONRequest(t, http.MethodPost, fmt.Sprintf("/api/v1/tasks/%d/triggers", collect.ID), TaskTriggerRequest{
+		TargetTaskID: report.ID,
+		Condition:    db.TriggerOnSuccess,
+	})
+	srv.Router().ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	created := testutil.DecodeJSON[TaskTriggerResponse](t, rr)
+	if created.Condition != db.TriggerOnSuccess || created.TargetTaskName != "report" {
+		t.Fatalf("unexpected trigger: %+v", created)
+	}
+
+	for _, tc := range []struct {
+		taskID int64
+		body   TaskTriggerRequest
+		want   int
+	}{
+		{collect.ID, TaskTriggerRequest{TargetTaskID: report.ID, Condition: db.TriggerOnSuccess}, http.StatusConflict},
+		{report.ID, TaskTriggerRequest{TargetTaskID: collect.ID, Condition: db.TriggerOnFailure}, http.StatusBadRequest},
+		{collect.ID, TaskTriggerRequest{TargetTaskID: report.ID, Condition: "sometimes"}, http.StatusBadRequest},
+		{collect.ID, TaskTriggerRequest{TargetTaskID: 999, Condition: db.TriggerOnComplete}, http.StatusBadRequest},
+	} {
+		rr := httptest.NewRecorder()
+		req := testutil.JSONRequest(t, http.MethodPost, fmt.Sprintf("/api/v1/tasks/%d/triggers", tc.taskID), tc.body)
+		srv.Router().ServeHTTP(rr, req)
+		if rr.Code != tc.want {
+			t.Fatalf("%+v: expected %d, got %d: %s", tc.body, tc.want, rr.Code, rr.Body.String())
+		}
+	}
+
+	listRR := httptest.NewRecorder()
+	listReq := testutil.JSONRequest(t, http.MethodGet, fmt.Sprintf("/api/v1/tasks/%d/triggers", report.ID), nil)
+	srv.Router().ServeHTTP(listRR, listReq)
+	if listRR.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d: %s", http.StatusOK, listRR.Code, listRR.Body.String())
+	}
+	list := testutil.DecodeJSON[TaskTriggerListResponse](t, listRR)
+	if len(list.Triggers) != 0 || len(list.TriggeredBy) != 1 || list.TriggeredBy[0].TaskName != "collect" {
+		t.Fatalf("unexpected trigger list: %+v", list)
+	}
+
+	deleteRR := httptest.NewRecorder()
+	deleteReq := testutil.JSONRequest(t, http.MethodDelete, fmt.Sprintf("/api/v1/tasks/%d/triggers/%d", collect.ID, created.ID), nil)
+	srv.Router().ServeHTTP(deleteRR, deleteReq)
+	if deleteRR.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d: %s", http.StatusOK, deleteRR.Code, deleteRR.Body.String())
+	}
+	missingRR := httptest.NewRecorder()
+	missingReq := testutil.JSONRequest(t, http.MethodDelete, fmt.Sprintf("/api/v1/tasks/%d/triggers/%d", collect.ID, created.ID), nil)
+	srv.Router().ServeHTTP(missingRR, missingReq)
+	if missingRR.Code != http.StatusNotFound {
+		t.Fatalf("expected %d, got %d: %s", http.StatusNotFound, missingRR.Code, missingRR.Body.String())
+	}
+}
+
+func TestPreviewTaskPrompt(t *testing.T) {
+	srv := newTestServer(t)
+
+	createReq := TaskRequest{
+		Name:       "digest",
+		Prompt:     "Summarize {{.Vars.repo}}",
+		CronExpr:   "0 0 9 * * *",
+		WorkingDir: ".",
+		PromptVars: map[string]string{"repo": "api"},
+	}
+	rr := httptest.NewRecorder()
+	req := testutil.JSONRequest(t, http.MethodPost, "/api/v1/tasks", createReq)
+	srv.Router().ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	created := testutil.DecodeJSON[TaskResponse](t, rr)
+	if created.PromptVars["repo"] != "api" {
+		t.Fatalf("expected prompt vars to be saved, got %v", created.PromptVars)
+	}
+
+	previewRR := httptest.NewRecorder()
+	previewReq := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/v1/tasks/%d/prompt/preview", created.ID), nil)
+	srv.Router().ServeHTTP(previewRR, previewReq)
+	if previewRR.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d: %s", http.StatusOK, previewRR.Code, previewRR.Body.String())
+	}
+	if preview := testutil.DecodeJSON[PromptPreviewResponse](t, previewRR); preview.Prompt != "Summarize api" {
+		t.Fatalf("unexpected preview %q", preview.Prompt)
+	}
+
+	overrideRR := httptest.NewRecorder()
+	overrideReq := testutil.JSONRequest(t, http.MethodPost, fmt.Sprintf("/api/v1/tasks/%d/prompt/preview", created.ID), PromptPreviewRequest{
+		Prompt:     "Check {{.Vars.repo}} for {{.Task.Name}}",
+		PromptVars: map[string]string{"repo": "web"},
+	})
+	srv.Router().ServeHTTP(overrideRR, overrideReq)
+	if overrideRR.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d: %s", http.StatusOK, overrideRR.Code, overrideRR.Body.String())
+	}
+	if preview := testutil.DecodeJSON[PromptPreviewResponse](t, overrideRR); preview.Prompt != "Check web for digest" {
+		t.Fatalf("unexpected preview %q", preview.Prompt)
+	}
+
+	// env reads only the task's own settings, and secret values are redacted
+	if err := srv.db.SetSecret("GH_TOKEN", "ghp_secret"); err != nil {
+		t.Fatalf("set secret: %v", err)
+	}
+	task, err := srv.db.GetTask(created.ID)
+	if err != nil {
+		t.Fatalf("get task: %v", err)
+	}
+	task.Env = map[string]string{"STAGE": "prod", "GH_TOKEN": "${secret:GH_TOKEN}"}
+	if err := srv.db.UpdateTask(task); err != nil {
+		t.Fatalf("update task: %v", err)
+	}
+	envRR := httptest.NewRecorder()
+	envReq := testutil.JSONRequest(t, http.MethodPost, fmt.Sprintf("/api/v1/tasks/%d/prompt/preview", created.ID), PromptPreviewRequest{
+		Prompt:     `{{env "STAGE"}} {{env "GH_TOKEN"}} {{.Vars.token}} {{env "PATH" | default "unset"}}`,
+		PromptVars: map[string]string{"token": "ghp_secret"},
+	})
+	srv.Router().ServeHTTP(envRR, envReq)
+	if envRR.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d: %s", http.StatusOK, envRR.Code, envRR.Body.String())
+	}
+	if preview := testutil.DecodeJSON[PromptPreviewResponse](t, envRR); preview.Prompt != "prod ${secret:GH_TOKEN} [REDACTED] unset" {
+		t.Fatalf("unexpected preview %q", preview.Prompt)
+	}
+
+	badRR := httptest.NewRecorder()
+	badReq := testutil.JSONRequest(t, http.MethodPost, fmt.Sprintf("/api/v1/tasks/%d/prompt/preview", created.ID), PromptPreviewRequest{
+		Prompt: "Check {{.Vars.unknown}}",
+	})
+	srv.Router().ServeHTTP(badRR, badReq)
+	if badRR.Code != http.StatusBadRequest {
+		t.Fatalf("expected %d, got %d: %s", http.StatusBadRequest, badRR.Code, badRR.Body.String())
+	}
+
+	createReq.Prompt = "Summarize {{.Vars.repo"
+	invalidRR := httptest.NewRecorder()
+	invalidReq := testutil.JSONRequest(t, http.MethodPost, "/api/v1/tasks", createReq)
+	srv.Router().ServeHTTP(invalidRR, invalidReq)
+	if invalidRR.Code != http.StatusBadRequest {
+		t.Fatalf("expected %d, got %d: %s", http.StatusBadRequest, invalidRR.Code, invalidRR.Body.String())
+	}
+}
+
+func TestRunUsageAndTaskTotals(t *testing.T) {
+	srv := newTestServer(t)
+	task := &db.Task{Name: "digest", Prompt: "p", CronExpr: "0 * * * * *", WorkingDir: "."}
+	if err := srv.db.CreateTask(task); err != nil {
+		t.Fatalf("create task: %v", err)
+	}
+	for _, cost := range []float64{0.25, 0.5} {
+		run := &db.TaskRun{TaskID: task.ID, StartedAt: time.Now(), Status: db.RunStatusCompleted}
+		if err := srv.db.CreateTaskRun(run); err != nil {
+			t.Fatalf("create run: %v", err)
+		}
+		run.Usage = db.RunUsage{Model: "claude-sonnet-4-5", CostUSD: cost, InputTokens: 10, OutputTokens: 20, NumTurns: 1}
+		if err := srv.db.UpdateTaskRun(run); err != nil {
+			t.Fatalf("update run: %v", err)
+		}
+	}
+
+	runsRR := httptest.NewRecorder()
+	runsReq := testutil.JSONRequest(t, http.MethodGet, fmt.Sprintf("/api/v1/tasks/%d/runs/latest", task.ID), nil)
+	srv.Router().ServeHTTP(runsRR, runsReq)
+	if runsRR.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d: %s", http.StatusOK, runsRR.Code, runsRR.Body.String())
+	}
+	run := testutil.DecodeJSON[TaskRunResponse](t, runsRR)
+	if run.ModelUsed != "claude-sonnet-4-5" || run.OutputTokens != 20 || run.CostUSD == 0 {
+		t.Fatalf("unexpected run usage %+v", run)
+	}
+
+	for _, target := range []string{fmt.Sprintf("/api/v1/tasks/%d", task.ID), "/api/v1/tasks"} {
+		rr := httptest.NewRecorder()
+		srv.Router().ServeHTTP(rr, testutil.JSONRequest(t, http.MethodGet, target, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: expected %d, got %d: %s", target, http.StatusOK, rr.Code, rr.Body.String())
+		}
+		var usage *TaskUsageResponse
+		if strings.HasSuffix(target, "/tasks") {
+			usage = testutil.DecodeJSON[TaskListResponse](t, rr).Tasks[0].Usage
+		} else {
+			usage = testutil.DecodeJSON[TaskResponse](t, rr).Usage
+		}
+		if usage == nil || usage.Runs != 2 || usage.CostUSD != 0.75 || usage.InputTokens != 20 {
+			t.Fatalf("%s: unexpected usage totals %+v", target, usage)
+		}
+	}
+}
+
+func TestTaskAndMonthlyBudgets(t *testing.T) {
+	t.Setenv("CLAUDE_TASKS_DISABLE_USAGE_CHECK", "1")
+	t.Setenv("HOME", t.TempDir())
+	srv := newTestServer(t)
+
+	createRR := httptest.NewRecorder()
+	srv.Router().ServeHTTP(createRR, testutil.JSONRequest(t, http.MethodPost, "/api/v1/tasks", map[string]any{
+		"name": "digest", "prompt": "p", "cron_expr": "0 * * * * *", "budget_usd": 1, "budget_period": "daily",
+	}))
+	if createRR.Code != http.StatusCreated {
+		t.Fatalf("expected %d, got %d: %s", http.StatusCreated, createRR.Code, createRR.Body.String())
+	}
+	created := testutil.DecodeJSON[TaskResponse](t, createRR)
+	if created.BudgetUSD != 1 || created.BudgetPeriod != db.BudgetDay {
+		t.Fatalf("unexpected budget fields %+v", created)
+	}
+
+	run := &db.TaskRun{TaskID: created.ID, StartedAt: time.Now(), Status: db.RunStatusCompleted}
+	if err := srv.db.CreateTaskRun(run); err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+	run.Usage.CostUSD = 0.4
+	if err := srv.db.UpdateTaskRun(run); err != nil {
+		t.Fatalf("update run: %v", err)
+	}
+
+	getRR := httptest.NewRecorder()
+	srv.Router().ServeHTTP(getRR, testutil.JSONRequest(t, http.MethodGet, fmt.Sprintf("/api/v1/tasks/%d", created.ID), nil))
+	budget := testutil.DecodeJSON[TaskResponse](t, getRR).Budget
+	if budget == nil || budget.SpentUSD != 0.4 || budget.RemainingUSD == nil || *budget.RemainingUSD != 0.6 || budget.Exhausted {
+		t.Fatalf("unexpected task budget %+v", budget)
+	}
+
+	badRR := httptest.NewRecorder()
+	srv.Router().ServeHTTP(badRR, testutil.JSONRequest(t, http.MethodPost, "/api/v1/tasks", map[string]any{
+		"name": "bad", "prompt": "p", "budget_period": "hourly",
+	}))
+	if badRR.Code != http.StatusBadRequest {
+		t.Fatalf("expected %d for an unknown budget period, got %d", http.StatusBadRequest, badRR.Code)
+	}
+
+	settingsRR := httptest.NewRecorder()
+	srv.Router().ServeHTTP(settingsRR, testutil.JSONRequest(t, http.MethodPut, "/api/v1/settings", map[string]any{
+		"usage_threshold": 80, "monthly_budget_usd": 0.4,
+	}))
+	if settings := testutil.DecodeJSON[SettingsResponse](t, settingsRR); settings.MonthlyBudgetUSD != 0.4 {
+		t.Fatalf("unexpected settings %+v", settings)
+	}
+
+	// Omitting the monthly budget keeps it
+	keepRR := httptest.NewRecorder()
+	srv.Router().ServeHTTP(keepRR, testutil.JSONRequest(t, http.MethodPut, "/api/v1/settings", map[string]any{"usage_threshold": 70}))
+	if settings := testutil.DecodeJSON[SettingsResponse](t, keepRR); settings.UsageThreshold != 70 || settings.MonthlyBudgetUSD != 0.4 {
+		t.Fatalf("unexpected settings after partial update %+v", settings)
+	}
+
+	usageRR := httptest.NewRecorder()
+	srv.Router().ServeHTTP(usageRR, testutil.JSONRequest(t, http.MethodGet, "/api/v1/usage", nil))
+	usage := testutil.DecodeJSON[UsageResponse](t, usageRR)
+	if usage.Budget == nil || !usage.Budget.Exhausted || usage.Budget.Period != db.BudgetMonth {
+		t.Fatalf("unexpected monthly budget %+v", usage.Budget)
+	}
+}
+
+func TestUsageLimitPolicyAndDeferredRuns(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	srv := newTestServer(t)
+
+	createRR := httptest.NewRecorder()
+	srv.Router().ServeHTTP(createRR, testutil.JSONRequest(t, http.MethodPost, "/api/v1/tasks", map[string]any{
+		"name": "nightly", "prompt": "p", "cron_expr": "0 0 3 * * *", "on_usage_limit": "defer",
+	}))
+	if createRR.Code != http.StatusCreated {
+		t.Fatalf("expected %d, got %d: %s", http.StatusCreated, createRR.Code, createRR.Body.String())
+	}
+	created := testutil.DecodeJSON[TaskResponse](t, createRR)
+	if created.OnUsageLimit != db.UsageLimitDefer {
+		t.Fatalf("expected on_usage_limit %q, got %q", db.UsageLimitDefer, created.OnUsageLimit)
+	}
+
+	deferredUntil := time.Now().Add(time.Hour).Truncate(time.Second)
+	run := &db.TaskRun{TaskID: created.ID, StartedAt: time.Now(), Status: db.RunStatusDeferred, DeferredUntil: &deferredUntil}
+	if err := srv.db.CreateTaskRun(run); err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+	runRR := httptest.NewRecorder()
+	srv.Router().ServeHTTP(runRR, testutil.JSONRequest(t, http.MethodGet, fmt.Sprintf("/api/v1/tasks/%d/runs/%d", created.ID, run.ID), nil))
+	got := testutil.DecodeJSON[TaskRunResponse](t, runRR)
+	if got.Status != string(db.RunStatusDeferred) || got.DeferredUntil == nil || !got.DeferredUntil.Equal(deferredUntil) {
+		t.Fatalf("unexpected deferred run %+v", got)
+	}
+
+	cancelRR := httptest.NewRecorder()
+	srv.Router().ServeHTTP(cancelRR, testutil.JSONRequest(t, http.MethodPost, fmt.Sprintf("/api/v1/tasks/%d/runs/%d/cancel", created.ID, run.ID), nil))
+	if cancelRR.Code != http.StatusAccepted {
+		t.Fatalf("expected %d cancelling a deferred run, got %d: %s", http.StatusAccepted, cancelRR.Code, cancelRR.Body.String())
+	}
+
+	badRR := httptest.NewRecorder()
+	srv.Router().ServeHTTP(badRR, testutil.JSONRequest(t, http.MethodPost, "/api/v1/tasks", map[string]any{
+		"name": "bad", "prompt": "p", "on_usage_limit": "wait",
+	}))
+	if badRR.Code != http.StatusBadRequest {
+		t.Fatalf("expected %d for an unknown usage limit policy, got %d", http.StatusBadRequest, badRR.Code)
+	}
+}
+
+func TestPriorityUsageThresholds(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	srv := newTestServer(t)
+
+	createRR := httptest.NewRecorder()
+	srv.Router().ServeHTTP(createRR, testutil.JSONRequest(t, http.MethodPost, "/api/v1/tasks", map[string]any{
+		"name": "digest", "prompt": "p", "priority": "low",
+	}))
+	if createRR.Code != http.StatusCreated {
+		t.Fatalf("expected %d, got %d: %s", http.StatusCreated, createRR.Code, createRR.Body.String())
+	}
+	if created := testutil.DecodeJSON[TaskResponse](t, createRR); created.Priority != db.PriorityLow {
+		t.Fatalf("expected priority %q, got %q", db.PriorityLow, created.Priority)
+	}
+
+	settingsRR := httptest.NewRecorder()
+	srv.Router().ServeHTTP(settingsRR, testutil.JSONRequest(t, http.MethodPut, "/api/v1/settings", map[string]any{
+		"usage_thresholds": map[string]any{
+			"normal":   map[string]any{"five_hour": 85, "seven_day": 70},
+			"critical": map[string]any{"five_hour": 98, "seven_day": 95},
+		},
+	}))
+	if settingsRR.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d: %s", http.StatusOK, settingsRR.Code, settingsRR.Body.String())
+	}
+	settings := testutil.DecodeJSON[SettingsResponse](t, settingsRR)
+	if settings.UsageThreshold != 70 {
+		t.Fatalf("expected usage_threshold to be the lower normal threshold, got %v", settings.UsageThreshold)
+	}
+	expected := map[string]UsageThresholds{
+		db.PriorityLow:      {FiveHour: 60, SevenDay: 60},
+		db.PriorityNormal:   {FiveHour: 85, SevenDay: 70},
+		db.PriorityCritical: {FiveHour: 98, SevenDay: 95},
+	}
+	for priority, want := range expected {
+		if settings.UsageThresholds[priority] != want {
+			t.Fatalf("expected %s thresholds %+v, got %+v", priority, want, settings.UsageThresholds[priority])
+		}
+	}
+
+	for _, body := range []map[string]any{
+		{"usage_thresholds": map[string]any{"urgent": map[string]any{"five_hour": 50, "seven_day": 50}}},
+		{"usage_thresholds": map[string]any{"low": map[string]any{"five_hour": 150, "seven_day": 50}}},
+	} {
+		badRR := httptest.NewRecorder()
+		srv.Router().ServeHTTP(badRR, testutil.JSONRequest(t, http.MethodPut, "/api/v1/settings", body))
+		if badRR.Code != http.StatusBadRequest {
+			t.Fatalf("expected %d for %v, got %d", http.StatusBadRequest, body, badRR.Code)
+		}
+	}
+}
+
+func TestGetUsageHistory(t *testing.T) {
+	srv := newTestServer(t)
+	task := &db.Task{Name: "digest", Prompt: "p", CronExpr: "0 * * * * *", WorkingDir: "."}
+	if err := srv.db.CreateTask(task); err != nil {
+		t.Fatalf("create task: %v", err)
+	}
+	now := time.Now()
+	for _, sample := range []*db.UsageSample{
+		{SampledAt: now.Add(-3 * 24 * time.Hour), FiveHour: 10, SevenDay: 5},
+		{SampledAt: now.Add(-2 * time.Hour), FiveHour: 30, SevenDay: 12},
+		{SampledAt: now.Add(-time.Hour), FiveHour: 45, SevenDay: 14},
+	} {
+		if _, err := srv.db.RecordUsageSample(sample); err != nil {
+			t.Fatalf("record sample: %v", err)
+		}
+	}
+	run := &db.TaskRun{TaskID: task.ID, StartedAt: now.Add(-90 * time.Minute), Status: db.RunStatusCompleted}
+	if err := srv.db.CreateTaskRun(run); err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	srv.Router().ServeHTTP(rr, testutil.JSONRequest(t, http.MethodGet, "/api/v1/usage/history?range=24h", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	history := testutil.DecodeJSON[UsageHistoryResponse](t, rr)
+	if history.Range != "24h" || len(history.Samples) != 2 || history.Samples[1].FiveHour != 45 {
+		t.Fatalf("unexpected usage history %+v", history)
+	}
+	if len(history.Runs) != 1 || history.Runs[0].TaskName != "digest" || history.Runs[0].RunID != run.ID {
+		t.Fatalf("unexpected usage history runs %+v", history.Runs)
+	}
+
+	defaultRR := httptest.NewRecorder()
+	srv.Router().ServeHTTP(defaultRR, testutil.JSONRequest(t, http.MethodGet, "/api/v1/usage/history", nil))
+	if history := testutil.DecodeJSON[UsageHistoryResponse](t, defaultRR); history.Range != "7d" || len(history.Samples) != 3 {
+		t.Fatalf("expected the 7d default with every sample, got %+v", history)
+	}
+
+	badRR := httptest.NewRecorder()
+	srv.Router().ServeHTTP(badRR, testutil.JSONRequest(t, http.MethodGet, "/api/v1/usage/history?range=90d", nil))
+	if badRR.Code != http.StatusBadRequest {
+		t.Fatalf("expected %d, got %d", http.StatusBadRequest, badRR.Code)
+	}
+}
+
+func TestProfilesAndTaskProfile(t *testing.T) {
+	srv := newTestServer(t)
+	configDir := t.TempDir()
+
+	rr := httptest.NewRecorder()
+	srv.Router().ServeHTTP(rr, testutil.JSONRequest(t, http.MethodPost, "/api/v1/profiles",
+		ProfileRequest{Name: "Work", ConfigDir: configDir, UsageThreshold: 70}))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	if profile := testutil.DecodeJSON[ProfileResponse](t, rr); profile.Name != "work" || profile.ConfigDir != configDir {
+		t.Fatalf("unexpected profile %+v", profile)
+	}
+
+	dupRR := httptest.NewRecorder()
+	srv.Router().ServeHTTP(dupRR, testutil.JSONRequest(t, http.MethodPost, "/api/v1/profiles",
+		ProfileRequest{Name: "work", ConfigDir: configDir}))
+	if dupRR.Code != http.StatusConflict {
+		t.Fatalf("expected %d for a duplicate profile, got %d", http.StatusConflict, dupRR.Code)
+	}
+
+	unknownRR := httptest.NewRecorder()
+	srv.Router().ServeHTTP(unknownRR, testutil.JSONRequest(t, http.MethodPost, "/api/v1/tasks",
+		TaskRequest{Name: "t", Prompt: "p", CronExpr: "0 * * * * *", WorkingDir: ".", Profile: "personal"}))
+	if unknownRR.Code != http.StatusBadRequest {
+		t.Fatalf("expected %d for an unknown profile, got %d", http.StatusBadRequest, unknownRR.Code)
+	}
+
+	taskRR := httptest.NewRecorder()
+	srv.Router().ServeHTTP(taskRR, testutil.JSONRequest(t, http.MethodPost, "/api/v1/tasks",
+		TaskRequest{Name: "t", Prompt: "p", CronExpr: "0 * * * * *", WorkingDir: ".", Profile: "work"}))
+	if taskRR.Code != http.StatusCreated {
+		t.Fatalf("expected %d, got %d: %s", http.StatusCreated, taskRR.Code, taskRR.Body.String())
+	}
+	if task := testutil.DecodeJSON[TaskResponse](t, taskRR); task.Profile != "work" {
+		t.Fatalf("expected the task to use profile work, got %q", task.Profile)
+	}
+
+	inUseRR := httptest.NewRecorder()
+	srv.Router().ServeHTTP(inUseRR, testutil.JSONRequest(t, http.MethodDelete, "/api/v1/profiles/work", nil))
+	if inUseRR.Code != http.StatusConflict {
+		t.Fatalf("expected %d for a profile in use, got %d", http.StatusConflict, inUseRR.Code)
+	}
+
+	updateRR := httptest.NewRecorder()
+	srv.Router().ServeHTTP(updateRR, testutil.JSONRequest(t, http.MethodPut, "/api/v1/profiles/work",
+		ProfileRequest{ConfigDir: configDir, UsageThreshold: 50}))
+	if updateRR.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d: %s", http.StatusOK, updateRR.Code, updateRR.Body.String())
+	}
+	listRR := httptest.NewRecorder()
+	srv.Router().ServeHTTP(listRR, testutil.JSONRequest(t, http.MethodGet, "/api/v1/profiles", nil))
+	if list := testutil.DecodeJSON[ProfileListResponse](t, listRR); len(list.Profiles) != 1 || list.Profiles[0].UsageThreshold != 50 {
+		t.Fatalf("unexpected profiles %+v", list)
+	}
+
+	missingRR := httptest.NewRecorder()
+	srv.Router().ServeHTTP(missingRR, testutil.JSONRequest(t, http.MethodGet, "/api/v1/usage/history?profile=personal", nil))
+	if missingRR.Code != http.StatusNotFound {
+		t.Fatalf("expected %d for usage of an unknown profile, got %d", http.StatusNotFound, missingRR.Code)
+	}
+}
+
+func TestSecretsAndTaskEnv(t *testing.T) {
+	srv := newTestServer(t)
+
+	setRR := httptest.NewRecorder()
+	srv.Router().ServeHTTP(setRR, testutil.JSONRequest(t, http.MethodPut, "/api/v1/secrets/GH_TOKEN", SecretRequest{Value: "ghp_secret"}))
+	if setRR.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d: %s", http.StatusOK, setRR.Code, setRR.Body.String())
+	}
+	if strings.Contains(setRR.Body.String(), "ghp_secret") {
+		t.Fatalf("expected the secret value not to be returned, got %s", setRR.Body.String())
+	}
+
+	badNameRR := httptest.NewRecorder()
+	srv.Router().ServeHTTP(badNameRR, testutil.JSONRequest(t, http.MethodPut, "/api/v1/secrets/1bad", SecretRequest{Value: "x"}))
+	if badNameRR.Code != http.StatusBadRequest {
+		t.Fatalf("expected %d for an invalid secret name, got %d", http.StatusBadRequest, badNameRR.Code)
+	}
+
+	listRR := httptest.NewRecorder()
+	srv.Router().ServeHTTP(listRR, testutil.JSONRequest(t, http.MethodGet, "/api/v1/secrets", nil))
+	if list := testutil.DecodeJSON[SecretListResponse](t, listRR); len(list.Secrets) != 1 || list.Secrets[0].Name != "GH_TOKEN" {
+		t.Fatalf("unexpected secrets %+v", list)
+	}
+
+	unknownRR := httptest.NewRecorder()
+	srv.Router().ServeHTTP(unknownRR, testutil.JSONRequest(t, http.MethodPost, "/api/v1/tasks",
+		TaskRequest{Name: "t", Prompt: "p", CronExpr: "0 * * * * *", WorkingDir: ".", Env: map[string]string{"TOKEN": "${secret:MISSING}"}}))
+	if unknownRR.Code != http.StatusBadRequest {
+		t.Fatalf("expected %d for an unknown secret, got %d", http.StatusBadRequest, unknownRR.Code)
+	}
+
+	taskRR := httptest.NewRecorder()
+	srv.Router().ServeHTTP(taskRR, testutil.JSONRequest(t, http.MethodPost, "/api/v1/tasks",
+		TaskRequest{Name: "t", Prompt: "p", CronExpr: "0 * * * * *", WorkingDir: ".",
+			Env: map[string]string{"GITHUB_TOKEN": "${secret:GH_TOKEN}"}, EnvFile: ".env"}))
+	if taskRR.Code != http.StatusCreated {
+		t.Fatalf("expected %d, got %d: %s", http.StatusCreated, taskRR.Code, taskRR.Body.String())
+	}
+	task := testutil.DecodeJSON[TaskResponse](t, taskRR)
+	if task.Env["GITHUB_TOKEN"] != "${secret:GH_TOKEN}" || task.EnvFile != ".env" {
+		t.Fatalf("unexpected task env %+v, %q", task.Env, task.EnvFile)
+	}
+
+	deleteRR := httptest.NewRecorder()
+	srv.Router().ServeHTTP(deleteRR, testutil.JSONRequest(t, http.MethodDelete, "/api/v1/secrets/GH_TOKEN", nil))
+	if deleteRR.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, deleteRR.Code)
+	}
+	missingRR := httptest.NewRecorder()
+	srv.Router().ServeHTTP(missingRR, testutil.JSONRequest(t, http.MethodDelete, "/api/v1/secrets/GH_TOKEN", nil))
+	if missingRR.Code != http.StatusNotFound {
+		t.Fatalf("expected %d, got %d", http.StatusNotFound, missingRR.Code)
+	}
+}
+
+func TestTaskClaudeOptions(t *testing.T) {
+	srv := newTestServer(t)
+
+	req := TaskRequest{
+		Name: "t", Prompt: "p", CronExpr: "0 * * * * *", WorkingDir: ".",
+		AllowedTools:       []string{"Read", "Bash(git diff:*)"},
+		DisallowedTools:    []string{"WebFetch"},
+		MaxTurns:           20,
+		AppendSystemPrompt: "Never push to main.",
+		MCPConfig:          ".mcp.json",
+		AddDirs:            []string{"../shared"},
+	}
+	rr := httptest.NewRecorder()
+	srv.Router().ServeHTTP(rr, testutil.JSONRequest(t, http.MethodPost, "/api/v1/tasks", req))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	task := testutil.DecodeJSON[TaskResponse](t, rr)
+	if len(task.AllowedTools) != 2 || task.AllowedTools[1] != "Bash(git diff:*)" || task.MaxTurns != 20 ||
+		task.AppendSystemPrompt != "Never push to main." || task.MCPConfig != ".mcp.json" || len(task.AddDirs) != 1 {
+		t.Fatalf("unexpected claude options %+v", task)
+	}
+
+	for _, bad := range []TaskRequest{
+		{AllowedTools: []string{"not a tool"}},
+		{DisallowedTools: []string{"Bash(unclosed"}},
+		{MaxTurns: -1},
+		{MaxTurns: 5000},
+		{AddDirs: []string{" "}},
+	} {
+		bad.Name, bad.Prompt, bad.CronExpr = "t", "p", "0 * * * * *"
+		badRR := httptest.NewRecorder()
+		srv.Router().ServeHTTP(badRR, testutil.JSONRequest(t, http.MethodPost, "/api/v1/tasks", bad))
+		if badRR.Code != http.StatusBadRequest {
+			t.Fatalf("expected %d for %+v, got %d", http.StatusBadRequest, bad, badRR.Code)
+		}
+	}
+}
+
+func TestTaskSessionModeAndRunThreads(t *testing.T) {
+	srv := newTestServer(t)
+
+	req := TaskRequest{Name: "t", Prompt: "p", CronExpr: "0 * * * * *", WorkingDir: ".", SessionMode: "continue", MaxSessionRuns: 3}
+	rr := httptest.NewRecorder()
+	srv.Router().ServeHTTP(rr, testutil.JSONRequest(t, http.MethodPost, "/api/v1/tasks", req))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	task := testutil.DecodeJSON[TaskResponse](t, rr)
+	if task.SessionMode != db.SessionContinueLast || task.MaxSessionRuns != 3 {
+		t.Fatalf("unexpected session settings %q %d", task.SessionMode, task.MaxSessionRuns)
+	}
+
+	for _, bad := range []TaskRequest{{SessionMode: "resume"}, {MaxSessionRuns: -1}, {MaxSessionRuns: 5000}} {
+		bad.Name, bad.Prompt, bad.CronExpr = "t", "p", "0 * * * * *"
+		badRR := httptest.NewRecorder()
+		srv.Router().ServeHTTP(badRR, testutil.JSONRequest(t, http.MethodPost, "/api/v1/tasks", bad))
+		if badRR.Code != http.StatusBadRequest {
+			t.Fatalf("expected %d for %+v, got %d", http.StatusBadRequest, bad, badRR.Code)
+		}
+	}
+
+	first := &db.TaskRun{TaskID: task.ID, StartedAt: time.Now().Add(-time.Hour), Status: db.RunStatusCompleted, SessionID: "s1"}
+	if err := srv.db.CreateTaskRun(first); err != nil {
+		t.Fatalf("create first run: %v", err)
+	}
+	second := &db.TaskRun{TaskID: task.ID, StartedAt: time.Now(), Status: db.RunStatusCompleted, SessionID: "s1",
+		ResumedFromRunID: &first.ID, ThreadRunID: &first.ID, ThreadDepth: 2}
+	if err := srv.db.CreateTaskRun(second); err != nil {
+		t.Fatalf("create second run: %v", err)
+	}
+
+	rr = httptest.NewRecorder()
+	srv.Router().ServeHTTP(rr, testutil.JSONRequest(t, http.MethodGet, fmt.Sprintf("/api/v1/tasks/%d/runs/%d", task.ID, first.ID), nil))
+	resp := testutil.DecodeJSON[TaskRunResponse](t, rr)
+	if resp.ThreadRunID != first.ID || resp.ThreadDepth != 1 || resp.ResumedFromRunID != nil {
+		t.Fatalf("expected the first run to start its thread, got %+v", resp)
+	}
+	rr = httptest.NewRecorder()
+	srv.Router().ServeHTTP(rr, testutil.JSONRequest(t, http.MethodGet, fmt.Sprintf("/api/v1/tasks/%d/runs/%d", task.ID, second.ID), nil))
+	resp = testutil.DecodeJSON[TaskRunResponse](t, rr)
+	if resp.ThreadRunID != first.ID || resp.ThreadDepth != 2 || resp.ResumedFromRunID == nil || *resp.ResumedFromRunID != first.ID {
+		t.Fatalf("expected the second run to continue the first, got %+v", resp)
+	}
+}
+
+func TestTaskIsolationAndRunWorktree(t *testing.T) {
+	srv := newTestServer(t)
+
+	req := TaskRequest{Name: "t", Prompt: "p", CronExpr: "0 * * * * *", WorkingDir: ".", Isolation: "worktree", WorktreeCleanup: "keep_on_failure"}
+	rr := httptest.NewRecorder()
+	srv.Router().ServeHTTP(rr, testutil.JSONRequest(t, http.MethodPost, "/api/v1/tasks", req))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	task := testutil.DecodeJSON[TaskResponse](t, rr)
+	if task.Isolation != db.IsolationWorktree || task.WorktreeCleanup != db.WorktreeKeepOnFailure {
+		t.Fatalf("unexpected isolation %q %q", task.Isolation, task.WorktreeCleanup)
+	}
+
+	for _, bad := range []TaskRequest{{Isolation: "container"}, {WorktreeCleanup: "never"}} {
+		bad.Name, bad.Prompt, bad.CronExpr = "t", "p", "0 * * * * *"
+		badRR := httptest.NewRecorder()
+		srv.Router().ServeHTTP(badRR, testutil.JSONRequest(t, http.MethodPost, "/api/v1/tasks", bad))
+		if badRR.Code != http.StatusBadRequest {
+			t.Fatalf("expected %d for %+v, got %d", http.StatusBadRequest, bad, badRR.Code)
+		}
+	}
+
+	run := &db.TaskRun{TaskID: task.ID, StartedAt: time.Now(), Status: db.RunStatusRunning}
+	if err := srv.db.CreateTaskRun(run); err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+	endedAt := time.Now()
+	run.Status, run.EndedAt = db.RunStatusCompleted, &endedAt
+	run.Worktree = &db.RunWorktree{Branch: "claude-tasks/t/1", BaseCommit: "abc", Commit: "def", DiffStat: "1 file changed, 2 insertions(+)"}
+	if err := srv.db.UpdateTaskRun(run); err != nil {
+		t.Fatalf("update run: %v", err)
+	}
+
+	rr = httptest.NewRecorder()
+	srv.Router().ServeHTTP(rr, testutil.JSONRequest(t, http.MethodGet, fmt.Sprintf("/api/v1/tasks/%d/runs/%d", task.ID, run.ID), nil))
+	resp := testutil.DecodeJSON[TaskRunResponse](t, rr)
+	if resp.Worktree == nil || resp.Worktree.Branch != "claude-tasks/t/1" || !resp.Worktree.Changed || resp.Worktree.DiffStat == "" {
+		t.Fatalf("unexpected run worktree %+v", resp.Worktree)
+	}
+}
+
+func TestGetTaskRunDiff(t *testing.T) {
+	srv := newTestServer(t)
+
+	task := &db.Task{Name: "t", Prompt: "p", CronExpr: "0 * * * * *", WorkingDir: ".", Enabled: true}
+	if err := srv.db.CreateTask(task); err != nil {
+		t.Fatalf("create task: %v", err)
+	}
+	run := &db.TaskRun{TaskID: task.ID, StartedAt: time.Now(), Status: db.RunStatusCompleted}
+	if err := srv.db.CreateTaskRun(run); err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+	path := fmt.Sprintf("/api/v1/tasks/%d/runs/%d/diff", task.ID, run.ID)
+
+	rr := httptest.NewRecorder()
+	srv.Router().ServeHTTP(rr, testutil.JSONRequest(t, http.MethodGet, path, nil))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected %d without recorded changes, got %d", http.StatusNotFound, rr.Code)
+	}
+
+	changes := &db.RunChanges{
+		RunID:      run.ID,
+		HeadBefore: "abc",
+		HeadAfter:  "abc",
+		Files:      []db.ChangedFile{{Path: "main.go", Insertions: 2, Deletions: 1}, {Path: "logo.png", Binary: true}},
+		Insertions: 2,
+		Deletions:  1,
+		Patch:      "diff --git a/main.go b/main.go\n",
+	}
+	if err := srv.db.SaveRunChanges(changes); err != nil {
+		t.Fatalf("save changes: %v", err)
+	}
+
+	rr = httptest.NewRecorder()
+	srv.Router().ServeHTTP(rr, testutil.JSONRequest(t, http.MethodGet, path, nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	resp := testutil.DecodeJSON[RunDiffResponse](t, rr)
+	if resp.Summary != "2 files changed, +2 -1" || len(resp.Files) != 2 || !resp.Files[1].Binary || resp.Patch != changes.Patch {
+		t.Fatalf("unexpected diff %+v", resp)
+	}
+
+	rr = httptest.NewRecorder()
+	srv.Router().ServeHTTP(rr, testutil.JSONRequest(t, http.MethodGet, fmt.Sprintf("/api/v1/tasks/%d/runs/%d/diff", task.ID+1, run.ID), nil))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected %d for another task's run, got %d", http.StatusNotFound, rr.Code)
+	}
+}
+
+func TestTaskHooksAndRunSteps(t *testing.T) {
+	srv := newTestServer(t)
+
+	req := TaskRequest{
+		Name: "t", Prompt: "p", CronExpr: "0 * * * * *", WorkingDir: ".",
+		PreHooks:  []HookRequest{{Command: "git pull"}},
+		PostHooks: []HookRequest{{Command: "go test ./...", Timeout: "10m"}},
+	}
+	rr := httptest.NewRecorder()
+	srv.Router().ServeHTTP(rr, testutil.JSONRequest(t, http.MethodPost, "/api/v1/tasks", req))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	task := testutil.DecodeJSON[TaskResponse](t, rr)
+	if len(task.PreHooks) != 1 || task.PreHooks[0].Command != "git pull" || task.PreHooks[0].Timeout != "5m" ||
+		len(task.PostHooks) != 1 || task.PostHooks[0].Timeout != "10m" {
+		t.Fatalf("unexpected hooks %+v %+v", task.PreHooks, task.PostHooks)
+	}
+
+	tooMany := make([]HookRequest, db.MaxHooks+1)
+	for i := range tooMany {
+		tooMany[i].Command = "true"
+	}
+	for _, bad := range []TaskRequest{
+		{PreHooks: []HookRequest{{Command: " "}}},
+		{PostHooks: []HookRequest{{Command: "make", Timeout: "soon"}}},
+		{PostHooks: tooMany},
+	} {
+		bad.Name, bad.Prompt, bad.CronExpr = "t", "p", "0 * * * * *"
+		badRR := httptest.NewRecorder()
+		srv.Router().ServeHTTP(badRR, testutil.JSONRequest(t, http.MethodPost, "/api/v1/tasks", bad))
+		if badRR.Code != http.StatusBadRequest {
+			t.Fatalf("expected %d for %+v, got %d", http.StatusBadRequest, bad, badRR.Code)
+		}
+	}
+
+	run := &db.TaskRun{TaskID: task.ID, StartedAt: time.Now(), Status: db.RunStatusRunning}
+	if err := srv.db.CreateTaskRun(run); err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+	endedAt := time.Now()
+	run.Status, run.EndedAt = db.RunStatusFailed, &endedAt
+	run.Steps = []db.RunStep{
+		{Phase: db.HookPre, Command: "git pull", StartedAt: endedAt.Add(-3 * time.Second), EndedAt: endedAt.Add(-2 * time.Second)},
+		{Phase: db.HookPost, Command: "go test ./...", ExitCode: 1, Stderr: "FAIL", StartedAt: endedAt.Add(-time.Second), EndedAt: endedAt},
+	}
+	if err := srv.db.UpdateTaskRun(run); err != nil {
+		t.Fatalf("update run: %v", err)
+	}
+
+	rr = httptest.NewRecorder()
+	srv.Router().ServeHTTP(rr, testutil.JSONRequest(t, http.MethodGet, fmt.Sprintf("/api/v1/tasks/%d/runs/%d", task.ID, run.ID), nil))
+	resp := testutil.DecodeJSON[TaskRunResponse](t, rr)
+	if len(resp.Steps) != 2 || resp.Steps[1].Phase != db.HookPost || resp.Steps[1].ExitCode != 1 ||
+		resp.Steps[1].Stderr != "FAIL" || resp.Steps[0].DurationMs != 1000 {
+		t.Fatalf("unexpected steps %+v", resp.Steps)
+	}
+}
+
+func TestTaskAssertionsAndRunResults(t *testing.T) {
+	srv := newTestServer(t)
+
+	req := TaskRequest{
+		Name: "t", Prompt: "p", CronExpr: "0 * * * * *", WorkingDir: ".",
+		Assertions: []AssertionRequest{
+			{Type: "not_matches", Pattern: "(?i)couldn't access"},
+			{Type: "json_schema", Schema: []byte(`{"type": "object",  "required": ["status"]}`)},
+			{Type: "file_exists", Path: " report.md "},
+		},
+		RetryOn: []string{"assertion"},
+	}
+	rr := httptest.NewRecorder()
+	srv.Router().ServeHTTP(rr, testutil.JSONRequest(t, http.MethodPost, "/api/v1/tasks", req))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	task := testutil.DecodeJSON[TaskResponse](t, rr)
+	if len(task.Assertions) != 3 || string(task.Assertions[1].Schema) != `{"type":"object","required":["status"]}` ||
+		task.Assertions[2].Path != "report.md" || len(task.RetryOn) != 1 {
+		t.Fatalf("unexpected assertions %+v", task.Assertions)
+	}
+
+	for _, bad := range []TaskRequest{
+		{Assertions: []AssertionRequest{{Type: "contains", Pattern: "x"}}},
+		{Assertions: []AssertionRequest{{Type: "matches", Pattern: "("}}},
+		{Assertions: []AssertionRequest{{Type: "json_schema", Schema: []byte(`{"type": "date"}`)}}},
+		{Assertions: []AssertionRequest{{Type: "json_schema", Schema: []byte(`{"$defs": {"a": {"$ref": "#/$defs/a"}}, "$ref": "#/$defs/a"}`)}}},
+		{Assertions: []AssertionRequest{{Type: "file_exists"}}},
+	} {
+		bad.Name, bad.Prompt, bad.CronExpr = "t", "p", "0 * * * * *"
+		badRR := httptest.NewRecorder()
+		srv.Router().ServeHTTP(badRR, testutil.JSONRequest(t, http.MethodPost, "/api/v1/tasks", bad))
+		if badRR.Code != http.StatusBadRequest {
+			t.Fatalf("expected %d for %+v, got %d", http.StatusBadRequest, bad, badRR.Code)
+		}
+	}
+
+	run := &db.TaskRun{TaskID: task.ID, StartedAt: time.Now(), Status: db.RunStatusRunning}
+	if err := srv.db.CreateTaskRun(run); err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+	endedAt := time.Now()
+	run.Status, run.EndedAt = db.RunStatusAssertionFailed, &endedAt
+	run.Assertions = []db.AssertionResult{
+		{Assertion: `not_matches "(?i)couldn't access"`, Message: `output matches at "couldn't access"`},
+		{Assertion: `file_exists "report.md"`, Passed: true},
+	}
+	if err := srv.db.UpdateTaskRun(run); err != nil {
+		t.Fatalf("update run: %v", err)
+	}
+
+	rr = httptest.NewRecorder()
+	srv.Router().ServeHTTP(rr, testutil.JSONRequest(t, http.MethodGet, fmt.Sprintf("/api/v1/tasks/%d/runs/%d", task.ID, run.ID), nil))
+	resp := testutil.DecodeJSON[TaskRunResponse](t, rr)
+	if resp.Status != "assertion_failed" || len(resp.Assertions) != 2 || resp.Assertions[0].Passed || resp.Assertions[0].Message == "" ||
+		!resp.Assertions[1].Passed {
+		t.Fatalf("unexpected run %s with assertions %+v", resp.Status, resp.Assertions)
+	}
+}
+
+func TestTaskOutputSchemaAndRunResult(t *testing.T) {
+	srv := newTestServer(t)
+
+	req := TaskRequest{
+		Name: "t", Prompt: "p", CronExpr: "0 * * * * *", WorkingDir: ".",
+		OutputSchema: []byte(`{"type": "object", "required": ["vulnerable"]}`),
+	}
+	rr := httptest.NewRecorder()
+	srv.Router().ServeHTTP(rr, testutil.JSONRequest(t, http.MethodPost, "/api/v1/tasks", req))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	task := testutil.DecodeJSON[TaskResponse](t, rr)
+	if string(task.OutputSchema) != `{"type":"object","required":["vulnerable"]}` {
+		t.Fatalf("unexpected output schema %s", task.OutputSchema)
+	}
+
+	bad := TaskRequest{Name: "t", Prompt: "p", CronExpr: "0 * * * * *", OutputSchema: []byte(`{"required": "vulnerable"}`)}
+	rr = httptest.NewRecorder()
+	srv.Router().ServeHTTP(rr, testutil.JSONRequest(t, http.MethodPost, "/api/v1/tasks", bad))
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "Invalid output_schema") {
+		t.Fatalf("expected %d for an invalid schema, got %d: %s", http.StatusBadRequest, rr.Code, rr.Body.String())
+	}
+
+	// A schema that fails to parse is rejected on update, leaving the task
+	// unchanged
+	update := req
+	update.OutputSchema = []byte(`{"$ref": "#"}`)
+	rr = httptest.NewRecorder()
+	srv.Router().ServeHTTP(rr, testutil.JSONRequest(t, http.MethodPut, fmt.Sprintf("/api/v1/tasks/%d", task.ID), update))
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "$ref cycle") {
+		t.Fatalf("expected %d for a cyclic schema, got %d: %s", http.StatusBadRequest, rr.Code, rr.Body.String())
+	}
+	if stored, err := srv.db.GetTask(task.ID); err != nil || string(stored.OutputSchema) != `{"type":"object","required":["vulnerable"]}` {
+		t.Fatalf("expected the stored schema unchanged, got %+v, %v", stored, err)
+	}
+
+	run := &db.TaskRun{TaskID: task.ID, StartedAt: time.Now(), Status: db.RunStatusRunning}
+	if err := srv.db.CreateTaskRun(run); err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+	resultPath := fmt.Sprintf("/api/v1/tasks/%d/runs/%d/result", task.ID, run.ID)
+	rr = httptest.NewRecorder()
+	srv.Router().ServeHTTP(rr, testutil.JSONRequest(t, http.MethodGet, resultPath, nil))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected %d before a result is recorded, got %d", http.StatusNotFound, rr.Code)
+	}
+
+	endedAt := time.Now()
+	run.Status, run.EndedAt = db.RunStatusCompleted, &endedAt
+	run.ResultJSON = []byte(`{"vulnerable":true,"count":2}`)
+	if err := srv.db.UpdateTaskRun(run); err != nil {
+		t.Fatalf("update run: %v", err)
+	}
+
+	rr = httptest.NewRecorder()
+	srv.Router().ServeHTTP(rr, testutil.JSONRequest(t, http.MethodGet, resultPath, nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	result := testutil.DecodeJSON[RunResultResponse](t, rr)
+	if result.RunID != run.ID || result.TaskID != task.ID || string(result.Result) != `{"vulnerable":true,"count":2}` {
+		t.Fatalf("unexpected result %+v", result)
+	}
+
+	rr = httptest.NewRecorder()
+	srv.Router().ServeHTTP(rr, testutil.JSONRequest(t, http.MethodGet, fmt.Sprintf("/api/v1/tasks/%d/runs/%d", task.ID, run.ID), nil))
+	if resp := testutil.DecodeJSON[TaskRunResponse](t, rr); string(resp.Result) != `{"vulnerable":true,"count":2}` {
+		t.Fatalf("expected the result on the run, got %s", resp.Result)
+	}
+}
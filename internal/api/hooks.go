@@ -0,0 +1,55 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/ASRagab/claude-tasks/internal/db"
+)
+
+// parseHooks converts the hooks of a request for one phase
+func parseHooks(field string, hooks []HookRequest) ([]db.Hook, error) {
+	if len(hooks) > db.MaxHooks {
+		return nil, validationError(fmt.Sprintf("Invalid %s (use at most %d hooks)", field, db.MaxHooks))
+	}
+	var parsed []db.Hook
+	for _, hook := range hooks {
+		h, err := db.ParseHook(hook.Command, hook.Timeout)
+		if err != nil {
+			return nil, validationError("Invalid " + field + ": " + err.Error())
+		}
+		parsed = append(parsed, h)
+	}
+	return parsed, nil
+}
+
+func hooksToResponse(hooks []db.Hook) []HookResponse {
+	if len(hooks) == 0 {
+		return nil
+	}
+	resp := make([]HookResponse, len(hooks))
+	for i, hook := range hooks {
+		resp[i] = HookResponse{Command: hook.Command, Timeout: db.FormatDuration(hook.EffectiveTimeout())}
+	}
+	return resp
+}
+
+func stepsToResponse(steps []db.RunStep) []RunStepResponse {
+	if len(steps) == 0 {
+		return nil
+	}
+	resp := make([]RunStepResponse, len(steps))
+	for i, step := range steps {
+		resp[i] = RunStepResponse{
+			Phase:      step.Phase,
+			Command:    step.Command,
+			ExitCode:   step.ExitCode,
+			Stdout:     step.Stdout,
+			Stderr:     step.Stderr,
+			Error:      step.Error,
+			StartedAt:  step.StartedAt,
+			EndedAt:    step.EndedAt,
+			DurationMs: step.EndedAt.Sub(step.StartedAt).Milliseconds(),
+		}
+	}
+	return resp
+}
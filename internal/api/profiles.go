@@ -0,0 +1,135 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/ASRagab/claude-tasks/internal/db"
+	"github.com/go-chi/chi/v5"
+)
+
+// ListProfiles handles GET /api/v1/profiles
+func (s *Server) ListProfiles(w http.ResponseWriter, r *http.Request) {
+	profiles, err := s.db.ListProfiles()
+	if err != nil {
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to fetch profiles", err)
+		return
+	}
+
+	response := ProfileListResponse{Profiles: make([]ProfileResponse, len(profiles))}
+	for i, profile := range profiles {
+		response.Profiles[i] = profileToResponse(profile)
+	}
+	s.jsonResponse(w, http.StatusOK, response)
+}
+
+// CreateProfile handles POST /api/v1/profiles
+func (s *Server) CreateProfile(w http.ResponseWriter, r *http.Request) {
+	var req ProfileRequest
+	if !s.decodeJSONBody(w, r, &req) {
+		return
+	}
+
+	name, err := db.ParseProfileName(req.Name)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, errInvalidProfileName.Error(), nil)
+		return
+	}
+	profile, err := parseProfileRequest(name, &req)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	if err := s.db.CreateProfile(profile); err != nil {
+		if errors.Is(err, db.ErrProfileExists) {
+			s.errorResponse(w, http.StatusConflict, "Profile already exists", nil)
+			return
+		}
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to create profile", err)
+		return
+	}
+
+	s.jsonResponse(w, http.StatusCreated, profileToResponse(profile))
+}
+
+// UpdateProfile handles PUT /api/v1/profiles/{name}
+func (s *Server) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	var req ProfileRequest
+	if !s.decodeJSONBody(w, r, &req) {
+		return
+	}
+	if req.Name != "" && req.Name != name {
+		s.errorResponse(w, http.StatusBadRequest, "Profiles cannot be renamed", nil)
+		return
+	}
+	profile, err := parseProfileRequest(name, &req)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	updated, err := s.db.UpdateProfile(profile)
+	if err != nil {
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to update profile", err)
+		return
+	}
+	if !updated {
+		s.errorResponse(w, http.StatusNotFound, "Profile not found", nil)
+		return
+	}
+
+	profile, err = s.db.GetProfile(name)
+	if err != nil {
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to fetch profile", err)
+		return
+	}
+	s.jsonResponse(w, http.StatusOK, profileToResponse(profile))
+}
+
+// DeleteProfile handles DELETE /api/v1/profiles/{name}
+func (s *Server) DeleteProfile(w http.ResponseWriter, r *http.Request) {
+	deleted, err := s.db.DeleteProfile(chi.URLParam(r, "name"))
+	if err != nil {
+		if errors.Is(err, db.ErrProfileInUse) {
+			s.errorResponse(w, http.StatusConflict, "Profile is used by tasks", nil)
+			return
+		}
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to delete profile", err)
+		return
+	}
+	if !deleted {
+		s.errorResponse(w, http.StatusNotFound, "Profile not found", nil)
+		return
+	}
+
+	s.jsonResponse(w, http.StatusOK, SuccessResponse{
+		Success: true,
+		Message: "Profile deleted",
+	})
+}
+
+// parseProfileRequest validates the config dir and usage threshold of a
+// profile request
+func parseProfileRequest(name string, req *ProfileRequest) (*db.Profile, error) {
+	configDir, err := db.ParseConfigDir(req.ConfigDir)
+	if err != nil {
+		return nil, errInvalidConfigDir
+	}
+	if req.UsageThreshold < 0 || req.UsageThreshold > 100 {
+		return nil, errInvalidThreshold
+	}
+	return &db.Profile{Name: name, ConfigDir: configDir, UsageThreshold: req.UsageThreshold}, nil
+}
+
+func profileToResponse(profile *db.Profile) ProfileResponse {
+	return ProfileResponse{
+		ID:             profile.ID,
+		Name:           profile.Name,
+		ConfigDir:      profile.ConfigDir,
+		UsageThreshold: profile.UsageThreshold,
+		CreatedAt:      profile.CreatedAt,
+	}
+}
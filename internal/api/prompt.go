@@ -0,0 +1,69 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ASRagab/claude-tasks/internal/prompt"
+	"github.com/go-chi/chi/v5"
+)
+
+// PreviewTaskPrompt handles POST /api/v1/tasks/{id}/prompt/preview. The body
+// is optional; without one the saved prompt is rendered.
+func (s *Server) PreviewTaskPrompt(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "Invalid task ID", err)
+		return
+	}
+
+	task, err := s.db.GetTask(id)
+	if err != nil {
+		s.errorResponse(w, http.StatusNotFound, "Task not found", err)
+		return
+	}
+
+	var req PromptPreviewRequest
+	if r.ContentLength != 0 && !s.decodeJSONBody(w, r, &req) {
+		return
+	}
+	if req.Prompt != "" {
+		task.Prompt = req.Prompt
+	}
+	if req.PromptVars != nil {
+		if err := prompt.ValidateVars(req.PromptVars); err != nil {
+			s.errorResponse(w, http.StatusBadRequest, "Invalid prompt_vars: "+err.Error(), nil)
+			return
+		}
+		task.PromptVars = req.PromptVars
+	}
+
+	upstreamRunID := req.UpstreamRunID
+	if upstreamRunID == nil {
+		if upstreamRunID, err = prompt.SampleUpstreamRunID(s.db, task.ID); err != nil {
+			s.errorResponse(w, http.StatusInternalServerError, "Failed to load upstream run", err)
+			return
+		}
+	}
+
+	data, err := prompt.Load(s.db, task, upstreamRunID, time.Now())
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "Failed to load template data", err)
+		return
+	}
+	rendered, err := prompt.Render(task.Prompt, data)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "Invalid prompt template: "+err.Error(), nil)
+		return
+	}
+	if rendered, err = s.executor.RedactSecrets(task, rendered); err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "Failed to set up environment: "+err.Error(), nil)
+		return
+	}
+
+	s.jsonResponse(w, http.StatusOK, PromptPreviewResponse{
+		Prompt:        rendered,
+		UpstreamRunID: upstreamRunID,
+	})
+}
@@ -0,0 +1,35 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// GetTaskRunResult handles GET /api/v1/tasks/{id}/runs/{runID}/result
+func (s *Server) GetTaskRunResult(w http.ResponseWriter, r *http.Request) {
+	taskID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "Invalid task ID", err)
+		return
+	}
+
+	runID, err := strconv.ParseInt(chi.URLParam(r, "runID"), 10, 64)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "Invalid run ID", err)
+		return
+	}
+
+	run, err := s.db.GetTaskRun(taskID, runID)
+	if err != nil {
+		s.errorResponse(w, http.StatusNotFound, "Run not found", err)
+		return
+	}
+	if len(run.ResultJSON) == 0 {
+		s.errorResponse(w, http.StatusNotFound, "No structured result recorded for this run", nil)
+		return
+	}
+
+	s.jsonResponse(w, http.StatusOK, RunResultResponse{RunID: run.ID, TaskID: run.TaskID, Result: run.ResultJSON})
+}
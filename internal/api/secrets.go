@@ -0,0 +1,85 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/ASRagab/claude-tasks/internal/db"
+	"github.com/go-chi/chi/v5"
+)
+
+// ListSecrets handles GET /api/v1/secrets
+func (s *Server) ListSecrets(w http.ResponseWriter, r *http.Request) {
+	secrets, err := s.db.ListSecrets()
+	if err != nil {
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to fetch secrets", err)
+		return
+	}
+
+	response := SecretListResponse{Secrets: make([]SecretResponse, len(secrets))}
+	for i, secret := range secrets {
+		response.Secrets[i] = secretToResponse(secret)
+	}
+	s.jsonResponse(w, http.StatusOK, response)
+}
+
+// SetSecret handles PUT /api/v1/secrets/{name}
+func (s *Server) SetSecret(w http.ResponseWriter, r *http.Request) {
+	name, err := db.ParseSecretName(chi.URLParam(r, "name"))
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, errInvalidSecretName.Error(), nil)
+		return
+	}
+
+	var req SecretRequest
+	if !s.decodeJSONBody(w, r, &req) {
+		return
+	}
+	if req.Value == "" {
+		s.errorResponse(w, http.StatusBadRequest, "Secret value is required", nil)
+		return
+	}
+
+	if err := s.db.SetSecret(name, req.Value); err != nil {
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to store secret", err)
+		return
+	}
+
+	secrets, err := s.db.ListSecrets()
+	if err != nil {
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to fetch secret", err)
+		return
+	}
+	for _, secret := range secrets {
+		if secret.Name == name {
+			s.jsonResponse(w, http.StatusOK, secretToResponse(secret))
+			return
+		}
+	}
+	s.errorResponse(w, http.StatusInternalServerError, "Failed to fetch secret", nil)
+}
+
+// DeleteSecret handles DELETE /api/v1/secrets/{name}
+func (s *Server) DeleteSecret(w http.ResponseWriter, r *http.Request) {
+	deleted, err := s.db.DeleteSecret(chi.URLParam(r, "name"))
+	if err != nil {
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to delete secret", err)
+		return
+	}
+	if !deleted {
+		s.errorResponse(w, http.StatusNotFound, "Secret not found", nil)
+		return
+	}
+
+	s.jsonResponse(w, http.StatusOK, SuccessResponse{
+		Success: true,
+		Message: "Secret deleted",
+	})
+}
+
+func secretToResponse(secret *db.Secret) SecretResponse {
+	return SecretResponse{
+		Name:      secret.Name,
+		CreatedAt: secret.CreatedAt,
+		UpdatedAt: secret.UpdatedAt,
+	}
+}
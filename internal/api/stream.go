@@ -0,0 +1,137 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ASRagab/claude-tasks/internal/db"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// streamPollInterval controls how often the SSE handler checks for new chunks
+	streamPollInterval = 500 * time.Millisecond
+	// streamBatchSize bounds the number of chunks read per poll
+	streamBatchSize = 500
+)
+
+// StreamTaskRun handles GET /api/v1/tasks/{id}/runs/{runID}/stream
+//
+// Output chunks are sent as Server-Sent Events with the chunk sequence number
+// as the event ID, so clients can resume with Last-Event-ID. A final "done"
+// event carries the run once it has finished.
+func (s *Server) StreamTaskRun(w http.ResponseWriter, r *http.Request) {
+	taskID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "Invalid task ID", err)
+		return
+	}
+
+	runID, err := strconv.ParseInt(chi.URLParam(r, "runID"), 10, 64)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "Invalid run ID", err)
+		return
+	}
+
+	if _, err := s.db.GetTaskRun(taskID, runID); err != nil {
+		s.errorResponse(w, http.StatusNotFound, "Run not found", err)
+		return
+	}
+
+	afterSeq, err := parseLastEventID(r)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "Invalid Last-Event-ID", err)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		s.errorResponse(w, http.StatusInternalServerError, "Streaming not supported", nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(streamPollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Read the run status before the chunks so that every chunk written
+		// before the run finished is delivered ahead of the done event.
+		run, err := s.db.GetTaskRun(taskID, runID)
+		if err != nil {
+			writeSSE(w, "error", "", ErrorResponse{Error: "Run not found"})
+			flusher.Flush()
+			return
+		}
+		finished := run.Status != db.RunStatusRunning && run.Status != db.RunStatusPending
+
+		for {
+			chunks, err := s.db.GetTaskRunChunks(runID, afterSeq, streamBatchSize)
+			if err != nil {
+				writeSSE(w, "error", "", ErrorResponse{Error: "Failed to read run output"})
+				flusher.Flush()
+				return
+			}
+			for _, chunk := range chunks {
+				writeSSE(w, "chunk", strconv.FormatInt(chunk.Seq, 10), TaskRunChunkResponse{
+					Seq:       chunk.Seq,
+					Kind:      string(chunk.Kind),
+					Content:   chunk.Content,
+					CreatedAt: chunk.CreatedAt,
+				})
+				afterSeq = chunk.Seq
+			}
+			if len(chunks) < streamBatchSize {
+				break
+			}
+		}
+
+		if finished {
+			writeSSE(w, "done", "", s.taskRunToResponse(run))
+			flusher.Flush()
+			return
+		}
+		flusher.Flush()
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func parseLastEventID(r *http.Request) (int64, error) {
+	value := strings.TrimSpace(r.Header.Get("Last-Event-ID"))
+	if value == "" {
+		value = strings.TrimSpace(r.URL.Query().Get("after"))
+	}
+	if value == "" {
+		return 0, nil
+	}
+	seq, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seq < 0 {
+		return 0, fmt.Errorf("invalid event id %q", value)
+	}
+	return seq, nil
+}
+
+func writeSSE(w http.ResponseWriter, event, id string, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+	if id != "" {
+		fmt.Fprintf(w, "id: %s\n", id)
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/ASRagab/claude-tasks/internal/db"
+	"github.com/go-chi/chi/v5"
+)
+
+// ListTaskTriggers handles GET /api/v1/tasks/{id}/triggers
+func (s *Server) ListTaskTriggers(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "Invalid task ID", err)
+		return
+	}
+
+	if _, err := s.db.GetTask(id); err != nil {
+		s.errorResponse(w, http.StatusNotFound, "Task not found", err)
+		return
+	}
+
+	triggers, err := s.db.ListTaskTriggers(id)
+	if err != nil {
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to fetch triggers", err)
+		return
+	}
+	triggeredBy, err := s.db.ListTaskTriggersTargeting(id)
+	if err != nil {
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to fetch triggers", err)
+		return
+	}
+
+	response := TaskTriggerListResponse{
+		Triggers:    make([]TaskTriggerResponse, len(triggers)),
+		TriggeredBy: make([]TaskTriggerResponse, len(triggeredBy)),
+	}
+	for i, trigger := range triggers {
+		response.Triggers[i] = taskTriggerToResponse(trigger)
+	}
+	for i, trigger := range triggeredBy {
+		response.TriggeredBy[i] = taskTriggerToResponse(trigger)
+	}
+
+	s.jsonResponse(w, http.StatusOK, response)
+}
+
+// CreateTaskTrigger handles POST /api/v1/tasks/{id}/triggers
+func (s *Server) CreateTaskTrigger(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "Invalid task ID", err)
+		return
+	}
+
+	task, err := s.db.GetTask(id)
+	if err != nil {
+		s.errorResponse(w, http.StatusNotFound, "Task not found", err)
+		return
+	}
+
+	var req TaskTriggerRequest
+	if !s.decodeJSONBody(w, r, &req) {
+		return
+	}
+
+	condition, err := db.ParseTriggerCondition(req.Condition)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, errInvalidCondition.Error(), nil)
+		return
+	}
+	target, err := s.db.GetTask(req.TargetTaskID)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "Target task not found", nil)
+		return
+	}
+
+	trigger := &db.TaskTrigger{
+		TaskID:         task.ID,
+		TaskName:       task.Name,
+		TargetTaskID:   target.ID,
+		TargetTaskName: target.Name,
+		Condition:      condition,
+	}
+	if err := s.db.CreateTaskTrigger(trigger); err != nil {
+		switch {
+		case errors.Is(err, db.ErrTriggerCycle):
+			s.errorResponse(w, http.StatusBadRequest, "Trigger would create a cycle", nil)
+		case errors.Is(err, db.ErrTriggerExists):
+			s.errorResponse(w, http.StatusConflict, "Trigger already exists", nil)
+		default:
+			s.errorResponse(w, http.StatusInternalServerError, "Failed to create trigger", err)
+		}
+		return
+	}
+
+	s.jsonResponse(w, http.StatusCreated, taskTriggerToResponse(trigger))
+}
+
+// DeleteTaskTrigger handles DELETE /api/v1/tasks/{id}/triggers/{triggerID}
+func (s *Server) DeleteTaskTrigger(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "Invalid task ID", err)
+		return
+	}
+
+	triggerID, err := strconv.ParseInt(chi.URLParam(r, "triggerID"), 10, 64)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "Invalid trigger ID", err)
+		return
+	}
+
+	deleted, err := s.db.DeleteTaskTrigger(id, triggerID)
+	if err != nil {
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to delete trigger", err)
+		return
+	}
+	if !deleted {
+		s.errorResponse(w, http.StatusNotFound, "Trigger not found", nil)
+		return
+	}
+
+	s.jsonResponse(w, http.StatusOK, SuccessResponse{
+		Success: true,
+		Message: "Trigger deleted",
+	})
+}
+
+func taskTriggerToResponse(trigger *db.TaskTrigger) TaskTriggerResponse {
+	return TaskTriggerResponse{
+		ID:             trigger.ID,
+		TaskID:         trigger.TaskID,
+		TaskName:       trigger.TaskName,
+		TargetTaskID:   trigger.TargetTaskID,
+		TargetTaskName: trigger.TargetTaskName,
+		Condition:      trigger.Condition,
+		CreatedAt:      trigger.CreatedAt,
+	}
+}
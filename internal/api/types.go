@@ -1,19 +1,134 @@
 package api
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // TaskRequest represents a task creation/update request
 type TaskRequest struct {
-	Name           string  `json:"name"`
-	Prompt         string  `json:"prompt"`
-	CronExpr       string  `json:"cron_expr"`                // Empty for one-off tasks
-	ScheduledAt    *string `json:"scheduled_at,omitempty"`   // ISO datetime for one-off tasks
-	WorkingDir     string  `json:"working_dir"`
-	DiscordWebhook string  `json:"discord_webhook,omitempty"`
-	SlackWebhook   string  `json:"slack_webhook,omitempty"`
-	Model          string  `json:"model,omitempty"`
-	PermissionMode string  `json:"permission_mode,omitempty"`
-	Enabled        bool    `json:"enabled"`
+	Name           string   `json:"name"`
+	Prompt         string   `json:"prompt"`
+	CronExpr       string   `json:"cron_expr"`              // Empty for one-off tasks
+	ScheduledAt    *string  `json:"scheduled_at,omitempty"` // ISO datetime for one-off tasks
+	WorkingDir     string   `json:"working_dir"`
+	DiscordWebhook string   `json:"discord_webhook,omitempty"`
+	SlackWebhook   string   `json:"slack_webhook,omitempty"`
+	Model          string   `json:"model,omitempty"`
+	PermissionMode string   `json:"permission_mode,omitempty"`
+	Timeout        string   `json:"timeout,omitempty"` // Duration such as "5m" or "2h"; empty uses the default
+	MaxRetries     int      `json:"max_retries,omitempty"`
+	RetryBackoff   string   `json:"retry_backoff,omitempty"` // Delay before the first retry, doubled per attempt
+	RetryOn        []string `json:"retry_on,omitempty"`      // exit_error, timeout, preflight, orphaned, assertion; empty retries all
+	Enabled        bool     `json:"enabled"`
+
+	// ConcurrencyPolicy is allow (default), forbid (alias skip) or queue
+	ConcurrencyPolicy string `json:"concurrency_policy,omitempty"`
+	// Timezone is the IANA zone for cron_expr; empty uses the server's zone
+	Timezone string `json:"timezone,omitempty"`
+	// MisfirePolicy is skip (default), run_once or run_all
+	MisfirePolicy string `json:"misfire_policy,omitempty"`
+	// PromptVars are custom values the prompt template reads as .Vars
+	PromptVars map[string]string `json:"prompt_vars,omitempty"`
+	// BudgetUSD and BudgetTokens cap the task's spending per BudgetPeriod
+	// (day, week or month, the default); zero means no cap
+	BudgetUSD    float64 `json:"budget_usd,omitempty"`
+	BudgetTokens int64   `json:"budget_tokens,omitempty"`
+	BudgetPeriod string  `json:"budget_period,omitempty"`
+	// OnUsageLimit is skip (default), defer_until_reset or run_anyway
+	OnUsageLimit string `json:"on_usage_limit,omitempty"`
+	// Priority is low, normal (default) or critical; it selects the usage
+	// thresholds the task runs under
+	Priority string `json:"priority,omitempty"`
+	// Profile names the Claude account profile the task runs as; empty
+	// uses the default account
+	Profile string `json:"profile,omitempty"`
+	// Env sets environment variables for claude; values may reference
+	// secrets as ${secret:NAME}
+	Env map[string]string `json:"env,omitempty"`
+	// EnvFile is a .env file loaded before Env; relative to working_dir
+	// unless absolute
+	EnvFile string `json:"env_file,omitempty"`
+
+	// Claude CLI options. Tools are names with an optional permission
+	// pattern such as Bash(git diff:*); max_turns 0 is unlimited
+	AllowedTools       []string `json:"allowed_tools,omitempty"`
+	DisallowedTools    []string `json:"disallowed_tools,omitempty"`
+	MaxTurns           int      `json:"max_turns,omitempty"`
+	AppendSystemPrompt string   `json:"append_system_prompt,omitempty"`
+	MCPConfig          string   `json:"mcp_config,omitempty"` // Relative to working_dir unless absolute
+	AddDirs            []string `json:"add_dirs,omitempty"`
+
+	// SessionMode is fresh (default), continue_last or fork_last;
+	// max_session_runs caps the runs in one thread, 0 uses the default of 10
+	SessionMode    string `json:"session_mode,omitempty"`
+	MaxSessionRuns int    `json:"max_session_runs,omitempty"`
+
+	// Isolation is none (default) or worktree, which runs claude in a new
+	// git worktree on its own branch; worktree_cleanup is remove (default),
+	// keep or keep_on_failure
+	Isolation       string `json:"isolation,omitempty"`
+	WorktreeCleanup string `json:"worktree_cleanup,omitempty"`
+
+	// PreHooks run in order before claude; the first that fails aborts the
+	// run. PostHooks run after it; the first that fails fails the run.
+	PreHooks  []HookRequest `json:"pre_hooks,omitempty"`
+	PostHooks []HookRequest `json:"post_hooks,omitempty"`
+
+	// Assertions are checked after claude exits successfully; a run failing
+	// any of them ends as assertion_failed
+	Assertions []AssertionRequest `json:"assertions,omitempty"`
+	// OutputSchema is a JSON Schema passed to claude for structured
+	// output; runs store the validated result, served by the run's
+	// result endpoint
+	OutputSchema json.RawMessage `json:"output_schema,omitempty"`
+}
+
+// HookRequest is a shell command run in the working dir before or after
+// claude
+type HookRequest struct {
+	Command string `json:"command"`
+	Timeout string `json:"timeout,omitempty"` // Duration such as "30s" or "10m"; empty uses 5m
+}
+
+// HookResponse is a hook with its effective timeout
+type HookResponse struct {
+	Command string `json:"command"`
+	Timeout string `json:"timeout"`
+}
+
+// AssertionRequest is a check on a run's output. Type is matches or
+// not_matches with a regex pattern, json_schema with a schema the output
+// must be JSON valid against, or file_exists with a path or glob relative to
+// the working dir.
+type AssertionRequest struct {
+	Type    string          `json:"type"`
+	Pattern string          `json:"pattern,omitempty"`
+	Schema  json.RawMessage `json:"schema,omitempty"`
+	Path    string          `json:"path,omitempty"`
+}
+
+// AssertionResponse is an assertion of a task
+type AssertionResponse struct {
+	Type    string          `json:"type"`
+	Pattern string          `json:"pattern,omitempty"`
+	Schema  json.RawMessage `json:"schema,omitempty"`
+	Path    string          `json:"path,omitempty"`
+}
+
+// RunResultResponse is the structured output of a run
+type RunResultResponse struct {
+	RunID  int64           `json:"run_id"`
+	TaskID int64           `json:"task_id"`
+	Result json.RawMessage `json:"result"`
+}
+
+// AssertionResultResponse is how a run fared on one of its task's
+// assertions; Message says why it failed
+type AssertionResultResponse struct {
+	Assertion string `json:"assertion"`
+	Passed    bool   `json:"passed"`
+	Message   string `json:"message,omitempty"`
 }
 
 // TaskResponse represents a task in API responses
@@ -29,12 +144,96 @@ type TaskResponse struct {
 	SlackWebhook   string     `json:"slack_webhook,omitempty"`
 	Model          string     `json:"model,omitempty"`
 	PermissionMode string     `json:"permission_mode,omitempty"`
+	Timeout        string     `json:"timeout"`
+	MaxRetries     int        `json:"max_retries"`
+	RetryBackoff   string     `json:"retry_backoff"`
+	RetryOn        []string   `json:"retry_on,omitempty"`
 	Enabled        bool       `json:"enabled"`
 	CreatedAt      time.Time  `json:"created_at"`
 	UpdatedAt      time.Time  `json:"updated_at"`
 	LastRunAt      *time.Time `json:"last_run_at,omitempty"`
 	NextRunAt      *time.Time `json:"next_run_at,omitempty"`
 	LastRunStatus  string     `json:"last_run_status,omitempty"`
+
+	// ConcurrencyPolicy is the effective policy for overlapping runs
+	ConcurrencyPolicy string `json:"concurrency_policy"`
+
+	// Timezone is the zone the schedule is evaluated in ("Local" for the
+	// server's zone). Next run times are repeated in that zone and in the
+	// viewer's zone, chosen with the tz query parameter.
+	Timezone          string     `json:"timezone"`
+	ViewerTimezone    string     `json:"viewer_timezone"`
+	NextRunAtTaskTZ   *time.Time `json:"next_run_at_task_tz,omitempty"`
+	NextRunAtViewerTZ *time.Time `json:"next_run_at_viewer_tz,omitempty"`
+
+	// MisfirePolicy is the effective policy for fire times missed while no
+	// scheduler was running; LastScheduledAt is the latest fire time handled
+	MisfirePolicy   string     `json:"misfire_policy"`
+	LastScheduledAt *time.Time `json:"last_scheduled_at,omitempty"`
+
+	PromptVars map[string]string `json:"prompt_vars,omitempty"`
+
+	// Usage sums the cost and tokens of all the task's recorded runs
+	Usage *TaskUsageResponse `json:"usage,omitempty"`
+
+	// The budget fields are absent for tasks without a budget; Budget is
+	// what the task has spent in its current budget period
+	BudgetUSD    float64         `json:"budget_usd,omitempty"`
+	BudgetTokens int64           `json:"budget_tokens,omitempty"`
+	BudgetPeriod string          `json:"budget_period,omitempty"`
+	Budget       *BudgetResponse `json:"budget,omitempty"`
+
+	OnUsageLimit string `json:"on_usage_limit,omitempty"`
+	Priority     string `json:"priority,omitempty"`
+	Profile      string `json:"profile,omitempty"`
+
+	// Env holds the configured values, so secrets appear as references
+	Env     map[string]string `json:"env,omitempty"`
+	EnvFile string            `json:"env_file,omitempty"`
+
+	AllowedTools       []string `json:"allowed_tools,omitempty"`
+	DisallowedTools    []string `json:"disallowed_tools,omitempty"`
+	MaxTurns           int      `json:"max_turns,omitempty"`
+	AppendSystemPrompt string   `json:"append_system_prompt,omitempty"`
+	MCPConfig          string   `json:"mcp_config,omitempty"`
+	AddDirs            []string `json:"add_dirs,omitempty"`
+
+	SessionMode    string `json:"session_mode"`
+	MaxSessionRuns int    `json:"max_session_runs"`
+
+	Isolation       string `json:"isolation"`
+	WorktreeCleanup string `json:"worktree_cleanup,omitempty"`
+
+	PreHooks  []HookResponse `json:"pre_hooks,omitempty"`
+	PostHooks []HookResponse `json:"post_hooks,omitempty"`
+
+	Assertions   []AssertionResponse `json:"assertions,omitempty"`
+	OutputSchema json.RawMessage     `json:"output_schema,omitempty"`
+}
+
+// BudgetResponse is the spending against a budget in its current period
+type BudgetResponse struct {
+	Period          string    `json:"period"`
+	LimitUSD        float64   `json:"limit_usd,omitempty"`
+	LimitTokens     int64     `json:"limit_tokens,omitempty"`
+	SpentUSD        float64   `json:"spent_usd"`
+	SpentTokens     int64     `json:"spent_tokens"`
+	RemainingUSD    *float64  `json:"remaining_usd,omitempty"`
+	RemainingTokens *int64    `json:"remaining_tokens,omitempty"`
+	PeriodStart     time.Time `json:"period_start"`
+	ResetsAt        time.Time `json:"resets_at"`
+	Exhausted       bool      `json:"exhausted"`
+}
+
+// TaskUsageResponse sums the usage of a task's runs
+type TaskUsageResponse struct {
+	Runs                int     `json:"runs"`
+	CostUSD             float64 `json:"cost_usd"`
+	InputTokens         int64   `json:"input_tokens"`
+	OutputTokens        int64   `json:"output_tokens"`
+	CacheCreationTokens int64   `json:"cache_creation_tokens"`
+	CacheReadTokens     int64   `json:"cache_read_tokens"`
+	NumTurns            int     `json:"num_turns"`
 }
 
 // TaskListResponse represents a list of tasks
@@ -45,15 +244,150 @@ type TaskListResponse struct {
 
 // TaskRunResponse represents a task run in API responses
 type TaskRunResponse struct {
-	ID         int64      `json:"id"`
-	TaskID     int64      `json:"task_id"`
-	StartedAt  time.Time  `json:"started_at"`
-	EndedAt    *time.Time `json:"ended_at,omitempty"`
-	Status     string     `json:"status"`
-	Output     string     `json:"output"`
-	Error      string     `json:"error,omitempty"`
-	SessionID  string     `json:"session_id,omitempty"`
-	DurationMs *int64     `json:"duration_ms,omitempty"`
+	ID          int64      `json:"id"`
+	TaskID      int64      `json:"task_id"`
+	StartedAt   time.Time  `json:"started_at"`
+	EndedAt     *time.Time `json:"ended_at,omitempty"`
+	Status      string     `json:"status"`
+	Output      string     `json:"output"`
+	Error       string     `json:"error,omitempty"`
+	SessionID   string     `json:"session_id,omitempty"`
+	Attempt     int        `json:"attempt"`
+	ParentRunID *int64     `json:"parent_run_id,omitempty"`
+	DurationMs  *int64     `json:"duration_ms,omitempty"`
+
+	// ScheduledFor is the cron fire time the run was started for
+	ScheduledFor *time.Time `json:"scheduled_for,omitempty"`
+	// TriggeredByRunID is the upstream run that queued this run
+	TriggeredByRunID *int64 `json:"triggered_by_run_id,omitempty"`
+	// RenderedPrompt is the prompt sent to claude after template rendering
+	RenderedPrompt string `json:"rendered_prompt,omitempty"`
+	// DeferredUntil is when a deferred run is planned to start
+	DeferredUntil *time.Time `json:"deferred_until,omitempty"`
+	// ResumedFromRunID is the run whose session this run continued or
+	// forked; ThreadRunID is the first run of its conversation thread and
+	// ThreadDepth the run's position in it
+	ResumedFromRunID *int64 `json:"resumed_from_run_id,omitempty"`
+	ThreadRunID      int64  `json:"thread_run_id"`
+	ThreadDepth      int    `json:"thread_depth"`
+	// Worktree is the git worktree and branch of an isolated run
+	Worktree *RunWorktreeResponse `json:"worktree,omitempty"`
+	// Steps are the hooks that ran before and after claude, in order
+	Steps []RunStepResponse `json:"steps,omitempty"`
+	// Assertions are the results of the task's assertions, checked when
+	// claude exited successfully
+	Assertions []AssertionResultResponse `json:"assertions,omitempty"`
+	// Result is the structured output of a run whose task has an output
+	// schema, once validated against it
+	Result json.RawMessage `json:"result,omitempty"`
+
+	// Cost and token usage reported by claude; ModelUsed is the model that
+	// actually served the run
+	ModelUsed           string  `json:"model_used,omitempty"`
+	CostUSD             float64 `json:"cost_usd"`
+	InputTokens         int64   `json:"input_tokens"`
+	OutputTokens        int64   `json:"output_tokens"`
+	CacheCreationTokens int64   `json:"cache_creation_tokens"`
+	CacheReadTokens     int64   `json:"cache_read_tokens"`
+	NumTurns            int     `json:"num_turns"`
+}
+
+// RunWorktreeResponse is the git worktree an isolated run ran in. Commit
+// includes the changes claude left uncommitted; Path is empty once the
+// worktree is removed.
+type RunWorktreeResponse struct {
+	Branch     string `json:"branch"`
+	Path       string `json:"path,omitempty"`
+	BaseCommit string `json:"base_commit"`
+	Commit     string `json:"commit,omitempty"`
+	DiffStat   string `json:"diff_stat,omitempty"`
+	Changed    bool   `json:"changed"`
+}
+
+// RunStepResponse is a hook that ran as part of a run. ExitCode is -1 when
+// the hook did not exit on its own; Error says why, such as a timeout.
+type RunStepResponse struct {
+	Phase      string    `json:"phase"`
+	Command    string    `json:"command"`
+	ExitCode   int       `json:"exit_code"`
+	Stdout     string    `json:"stdout,omitempty"`
+	Stderr     string    `json:"stderr,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	EndedAt    time.Time `json:"ended_at"`
+	DurationMs int64     `json:"duration_ms"`
+}
+
+// RunDiffResponse is what a run changed in its git working dir, against
+// the working tree before the run. DirtyBefore is set when there were
+// uncommitted changes already; those are not part of the diff.
+type RunDiffResponse struct {
+	RunID          int64                 `json:"run_id"`
+	HeadBefore     string                `json:"head_before"`
+	HeadAfter      string                `json:"head_after"`
+	DirtyBefore    bool                  `json:"dirty_before"`
+	Summary        string                `json:"summary"`
+	Files          []ChangedFileResponse `json:"files"`
+	Insertions     int                   `json:"insertions"`
+	Deletions      int                   `json:"deletions"`
+	Patch          string                `json:"patch"`
+	PatchTruncated bool                  `json:"patch_truncated"`
+}
+
+// ChangedFileResponse is a file a run changed; binary files have no line
+// counts
+type ChangedFileResponse struct {
+	Path       string `json:"path"`
+	Insertions int    `json:"insertions"`
+	Deletions  int    `json:"deletions"`
+	Binary     bool   `json:"binary,omitempty"`
+}
+
+// PromptPreviewRequest overrides the saved prompt and variables for a
+// preview; empty fields use the task's own
+type PromptPreviewRequest struct {
+	Prompt        string            `json:"prompt,omitempty"`
+	PromptVars    map[string]string `json:"prompt_vars,omitempty"`
+	UpstreamRunID *int64            `json:"upstream_run_id,omitempty"` // Defaults to the latest run of a task triggering this one
+}
+
+// PromptPreviewResponse is a prompt rendered as it would be for a run
+// starting now
+type PromptPreviewResponse struct {
+	Prompt        string `json:"prompt"`
+	UpstreamRunID *int64 `json:"upstream_run_id,omitempty"`
+}
+
+// TaskTriggerRequest represents a trigger creation request
+type TaskTriggerRequest struct {
+	TargetTaskID int64  `json:"target_task_id"`
+	Condition    string `json:"condition"` // on_success, on_failure or on_complete
+}
+
+// TaskTriggerResponse represents a task trigger in API responses
+type TaskTriggerResponse struct {
+	ID             int64     `json:"id"`
+	TaskID         int64     `json:"task_id"`
+	TaskName       string    `json:"task_name"`
+	TargetTaskID   int64     `json:"target_task_id"`
+	TargetTaskName string    `json:"target_task_name"`
+	Condition      string    `json:"condition"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// TaskTriggerListResponse lists the triggers a task fires and the triggers
+// that start it
+type TaskTriggerListResponse struct {
+	Triggers    []TaskTriggerResponse `json:"triggers"`
+	TriggeredBy []TaskTriggerResponse `json:"triggered_by"`
+}
+
+// TaskRunChunkResponse represents a streamed piece of run output
+type TaskRunChunkResponse struct {
+	Seq       int64     `json:"seq"`
+	Kind      string    `json:"kind"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 // TaskRunsResponse represents a list of task runs
@@ -64,12 +398,32 @@ type TaskRunsResponse struct {
 
 // SettingsResponse represents the settings
 type SettingsResponse struct {
+	// UsageThreshold is the lower of the normal priority's thresholds
 	UsageThreshold float64 `json:"usage_threshold"`
+	// UsageThresholds holds the five-hour and seven-day thresholds of each
+	// task priority
+	UsageThresholds  map[string]UsageThresholds `json:"usage_thresholds"`
+	MonthlyBudgetUSD float64                    `json:"monthly_budget_usd"` // Zero means no cap
 }
 
-// SettingsRequest represents a settings update request
+// UsageThresholds are the utilization percentages at which runs of a
+// priority stop starting
+type UsageThresholds struct {
+	FiveHour float64 `json:"five_hour"`
+	SevenDay float64 `json:"seven_day"`
+}
+
+// SettingsRequest represents a settings update request. Omitted fields keep
+// their current values.
 type SettingsRequest struct {
-	UsageThreshold float64 `json:"usage_threshold"`
+	// UsageThreshold sets both thresholds of the normal priority
+	UsageThreshold *float64 `json:"usage_threshold,omitempty"`
+	// UsageThresholds sets the thresholds of the priorities it lists,
+	// overriding UsageThreshold
+	UsageThresholds map[string]UsageThresholds `json:"usage_thresholds,omitempty"`
+	// MonthlyBudgetUSD caps the cost of all tasks per calendar month; zero
+	// removes the cap and omitting it keeps the current one
+	MonthlyBudgetUSD *float64 `json:"monthly_budget_usd,omitempty"`
 }
 
 // UsageBucketResponse represents a usage bucket
@@ -82,6 +436,80 @@ type UsageBucketResponse struct {
 type UsageResponse struct {
 	FiveHour UsageBucketResponse `json:"five_hour"`
 	SevenDay UsageBucketResponse `json:"seven_day"`
+
+	// Budget is this month's spending against the monthly budget; absent
+	// when no monthly budget is set
+	Budget *BudgetResponse `json:"budget,omitempty"`
+}
+
+// UsageHistoryResponse is recorded usage over a time range, with the runs
+// that started in it so spikes can be matched to tasks
+type UsageHistoryResponse struct {
+	Profile string                `json:"profile,omitempty"`
+	Range   string                `json:"range"`
+	Since   time.Time             `json:"since"`
+	Samples []UsageSampleResponse `json:"samples"`
+	Runs    []UsageRunResponse    `json:"runs"`
+}
+
+// UsageSampleResponse is the utilization of both usage buckets at one time
+type UsageSampleResponse struct {
+	SampledAt time.Time `json:"sampled_at"`
+	FiveHour  float64   `json:"five_hour"`
+	SevenDay  float64   `json:"seven_day"`
+}
+
+// UsageRunResponse is a run shown against usage history
+type UsageRunResponse struct {
+	RunID     int64      `json:"run_id"`
+	TaskID    int64      `json:"task_id"`
+	TaskName  string     `json:"task_name"`
+	Status    string     `json:"status"`
+	StartedAt time.Time  `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+	CostUSD   float64    `json:"cost_usd"`
+}
+
+// ProfileRequest represents a profile creation or update request. The name
+// of an existing profile cannot be changed.
+type ProfileRequest struct {
+	Name      string `json:"name"`
+	ConfigDir string `json:"config_dir"` // Absolute or ~/ path, passed to claude as CLAUDE_CONFIG_DIR
+	// UsageThreshold caps the priority usage thresholds of the profile's
+	// tasks; zero leaves them as they are
+	UsageThreshold float64 `json:"usage_threshold,omitempty"`
+}
+
+// ProfileResponse represents a Claude account profile in API responses
+type ProfileResponse struct {
+	ID             int64     `json:"id"`
+	Name           string    `json:"name"`
+	ConfigDir      string    `json:"config_dir"`
+	UsageThreshold float64   `json:"usage_threshold,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// ProfileListResponse represents a list of profiles
+type ProfileListResponse struct {
+	Profiles []ProfileResponse `json:"profiles"`
+}
+
+// SecretRequest sets a secret's value
+type SecretRequest struct {
+	Value string `json:"value"`
+}
+
+// SecretResponse represents a secret in API responses; values are never
+// returned
+type SecretResponse struct {
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SecretListResponse represents a list of secrets
+type SecretListResponse struct {
+	Secrets []SecretResponse `json:"secrets"`
 }
 
 // ErrorResponse represents an error response
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ASRagab/claude-tasks/internal/db"
+)
+
+// GetUsageHistory handles GET /api/v1/usage/history?range=7d, for the account
+// profile named by the profile query parameter or the default account
+func (s *Server) GetUsageHistory(w http.ResponseWriter, r *http.Request) {
+	profile := strings.TrimSpace(r.URL.Query().Get("profile"))
+	if profile != "" {
+		if _, err := s.db.GetProfile(profile); err != nil {
+			s.errorResponse(w, http.StatusNotFound, "Profile not found", err)
+			return
+		}
+	}
+
+	rangeParam := r.URL.Query().Get("range")
+	window, err := db.ParseUsageRange(rangeParam)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "Invalid range (use 1h to 30d, e.g. 24h or 7d)", err)
+		return
+	}
+	if rangeParam == "" {
+		rangeParam = "7d"
+	}
+	since := time.Now().Add(-window)
+
+	samples, err := s.db.ListUsageSamples(profile, since)
+	if err != nil {
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to fetch usage history", err)
+		return
+	}
+	runs, err := s.db.ListUsageRuns(profile, since)
+	if err != nil {
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to fetch usage history", err)
+		return
+	}
+
+	response := UsageHistoryResponse{
+		Profile: profile,
+		Range:   rangeParam,
+		Since:   since,
+		Samples: make([]UsageSampleResponse, len(samples)),
+		Runs:    make([]UsageRunResponse, len(runs)),
+	}
+	for i, sample := range samples {
+		response.Samples[i] = UsageSampleResponse{
+			SampledAt: sample.SampledAt,
+			FiveHour:  sample.FiveHour,
+			SevenDay:  sample.SevenDay,
+		}
+	}
+	for i, run := range runs {
+		response.Runs[i] = UsageRunResponse{
+			RunID:     run.RunID,
+			TaskID:    run.TaskID,
+			TaskName:  run.TaskName,
+			Status:    string(run.Status),
+			StartedAt: run.StartedAt,
+			EndedAt:   run.EndedAt,
+			CostUSD:   run.CostUSD,
+		}
+	}
+
+	s.jsonResponse(w, http.StatusOK, response)
+}
@@ -0,0 +1,98 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Assertion types
+const (
+	AssertMatches    = "matches"     // The output must match Pattern
+	AssertNotMatches = "not_matches" // The output must not match Pattern
+	AssertJSONSchema = "json_schema" // The output must be JSON valid against Schema
+	AssertFileExists = "file_exists" // A file matching Path must exist
+)
+
+// AssertionTypes lists the supported assertion types
+var AssertionTypes = []string{AssertMatches, AssertNotMatches, AssertJSONSchema, AssertFileExists}
+
+// MaxAssertions is the most assertions a task may check
+const MaxAssertions = 20
+
+// Assertion is a check on a run's result, evaluated after claude exits
+// successfully
+type Assertion struct {
+	Type    string          `json:"type"`
+	Pattern string          `json:"pattern,omitempty"` // A Go regular expression, for matches and not_matches
+	Schema  json.RawMessage `json:"schema,omitempty"`  // A JSON Schema, for json_schema
+	// Path is a file or glob pattern, relative to the working dir, for
+	// file_exists
+	Path string `json:"path,omitempty"`
+}
+
+// ParseAssertion validates an assertion and normalizes its type and schema
+func ParseAssertion(a Assertion) (Assertion, error) {
+	parsed := Assertion{Type: strings.ToLower(strings.TrimSpace(a.Type))}
+	switch parsed.Type {
+	case AssertMatches, AssertNotMatches:
+		if a.Pattern == "" {
+			return Assertion{}, fmt.Errorf("%s assertion needs a pattern", parsed.Type)
+		}
+		if _, err := regexp.Compile(a.Pattern); err != nil {
+			return Assertion{}, fmt.Errorf("invalid %s pattern: %w", parsed.Type, err)
+		}
+		parsed.Pattern = a.Pattern
+	case AssertJSONSchema:
+		schema, err := ParseSchema(a.Schema)
+		if err != nil {
+			return Assertion{}, fmt.Errorf("invalid json_schema: %w", err)
+		}
+		if schema == nil {
+			return Assertion{}, fmt.Errorf("json_schema assertion needs a schema")
+		}
+		parsed.Schema = schema
+	case AssertFileExists:
+		parsed.Path = strings.TrimSpace(a.Path)
+		if parsed.Path == "" {
+			return Assertion{}, fmt.Errorf("file_exists assertion needs a path")
+		}
+		if _, err := filepath.Match(parsed.Path, ""); err != nil {
+			return Assertion{}, fmt.Errorf("invalid file_exists path %q: %w", parsed.Path, err)
+		}
+	default:
+		return Assertion{}, fmt.Errorf("unknown assertion type %q (use %s)", a.Type, strings.Join(AssertionTypes, ", "))
+	}
+	return parsed, nil
+}
+
+// String describes the assertion, such as `matches "^OK"`
+func (a Assertion) String() string {
+	switch a.Type {
+	case AssertMatches, AssertNotMatches:
+		return fmt.Sprintf("%s %q", a.Type, a.Pattern)
+	case AssertJSONSchema:
+		return a.Type
+	}
+	return fmt.Sprintf("%s %q", a.Type, a.Path)
+}
+
+// AssertionResult is the outcome of one of a task's assertions for a run
+type AssertionResult struct {
+	Assertion string `json:"assertion"` // The assertion as described by Assertion.String
+	Passed    bool   `json:"passed"`
+	Message   string `json:"message,omitempty"` // Why the assertion failed
+}
+
+// FailedAssertions returns the assertions the run failed
+func (r *TaskRun) FailedAssertions() []AssertionResult {
+	var failed []AssertionResult
+	for _, result := range r.Assertions {
+		if !result.Passed {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
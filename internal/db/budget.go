@@ -0,0 +1,171 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// monthlyBudgetSetting holds the dollar cap shared by all tasks per
+// calendar month
+const monthlyBudgetSetting = "monthly_budget_usd"
+
+// BudgetStatus is what has been spent against a budget in its current period
+type BudgetStatus struct {
+	Period      string    // One of BudgetPeriods
+	LimitUSD    float64   // Zero when cost is not capped
+	LimitTokens int64     // Zero when tokens are not capped
+	Start       time.Time // Start of the current period
+	ResetsAt    time.Time // Start of the next period
+	Spent       UsageTotals
+}
+
+// Exhausted reports whether spending has reached either cap
+func (b *BudgetStatus) Exhausted() bool {
+	return (b.LimitUSD > 0 && b.Spent.CostUSD >= b.LimitUSD) ||
+		(b.LimitTokens > 0 && b.Spent.TotalTokens() >= b.LimitTokens)
+}
+
+// RemainingUSD returns the dollars left this period, never below zero
+func (b *BudgetStatus) RemainingUSD() float64 {
+	return max(b.LimitUSD-b.Spent.CostUSD, 0)
+}
+
+// RemainingTokens returns the tokens left this period, never below zero
+func (b *BudgetStatus) RemainingTokens() int64 {
+	return max(b.LimitTokens-b.Spent.TotalTokens(), 0)
+}
+
+// BudgetWindow returns the start of the budget period containing now and the
+// start of the next one, both in now's location
+func BudgetWindow(period string, now time.Time) (start, end time.Time) {
+	year, month, day := now.Date()
+	switch period {
+	case BudgetDay:
+		start = time.Date(year, month, day, 0, 0, 0, 0, now.Location())
+		return start, start.AddDate(0, 0, 1)
+	case BudgetWeek:
+		daysSinceMonday := (int(now.Weekday()) + 6) % 7
+		start = time.Date(year, month, day-daysSinceMonday, 0, 0, 0, 0, now.Location())
+		return start, start.AddDate(0, 0, 7)
+	default:
+		start = time.Date(year, month, 1, 0, 0, 0, 0, now.Location())
+		return start, start.AddDate(0, 1, 0)
+	}
+}
+
+// GetTaskBudgetStatus returns what the task has spent in its current budget
+// period, evaluated in the task's timezone. Returns nil if the task has no
+// budget.
+func (db *DB) GetTaskBudgetStatus(task *Task, now time.Time) (*BudgetStatus, error) {
+	if !task.HasBudget() {
+		return nil, nil
+	}
+	status := newBudgetStatus(task, now)
+	spent, err := db.GetTaskUsageTotals(task.ID, status.Start)
+	if err != nil {
+		return nil, err
+	}
+	status.Spent = *spent
+	return status, nil
+}
+
+// GetTaskBudgetStatuses returns the budget status of each of the tasks that
+// has a budget, keyed by task ID. The spending of all of them is summed in
+// one query.
+func (db *DB) GetTaskBudgetStatuses(tasks []*Task, now time.Time) (map[int64]*BudgetStatus, error) {
+	statuses := make(map[int64]*BudgetStatus)
+	var windows []string
+	var args []any
+	for _, task := range tasks {
+		if !task.HasBudget() {
+			continue
+		}
+		status := newBudgetStatus(task, now)
+		statuses[task.ID] = status
+		windows = append(windows, "(?, ?)")
+		args = append(args, task.ID, status.Start)
+	}
+	if len(windows) == 0 {
+		return statuses, nil
+	}
+
+	// Each task's runs are summed from the start of its own period
+	rows, err := db.conn.Query(`WITH windows(task_id, start) AS (VALUES `+strings.Join(windows, ", ")+`)
+		SELECT r.task_id, `+usageTotalsColumns+` FROM task_runs r
+		JOIN windows w ON w.task_id = r.task_id AND julianday(r.started_at) >= julianday(w.start)
+		GROUP BY r.task_id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query budget spending: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var taskID int64
+		spent, err := scanUsageTotals(rows, &taskID)
+		if err != nil {
+			return nil, fmt.Errorf("scan budget spending: %w", err)
+		}
+		statuses[taskID].Spent = *spent
+	}
+	return statuses, rows.Err()
+}
+
+// newBudgetStatus returns the task's budget status for the period
+// containing now, evaluated in the task's timezone, with nothing spent
+func newBudgetStatus(task *Task, now time.Time) *BudgetStatus {
+	period := task.EffectiveBudgetPeriod()
+	start, end := BudgetWindow(period, now.In(task.Location()))
+	return &BudgetStatus{
+		Period:      period,
+		LimitUSD:    task.BudgetUSD,
+		LimitTokens: task.BudgetTokens,
+		Start:       start,
+		ResetsAt:    end,
+	}
+}
+
+// GetMonthlyBudget retrieves the monthly dollar cap across all tasks; zero
+// means no cap
+func (db *DB) GetMonthlyBudget() (float64, error) {
+	val, err := db.GetSetting(monthlyBudgetSetting)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("get monthly budget: %w", err)
+	}
+	budget, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse monthly budget %q: %w", val, err)
+	}
+	return budget, nil
+}
+
+// SetMonthlyBudget sets the monthly dollar cap across all tasks
+func (db *DB) SetMonthlyBudget(usd float64) error {
+	return db.SetSetting(monthlyBudgetSetting, strconv.FormatFloat(usd, 'f', -1, 64))
+}
+
+// GetGlobalBudgetStatus returns what all tasks have spent this calendar
+// month, in now's location. Returns nil if no monthly budget is set.
+func (db *DB) GetGlobalBudgetStatus(now time.Time) (*BudgetStatus, error) {
+	limit, err := db.GetMonthlyBudget()
+	if err != nil || limit <= 0 {
+		return nil, err
+	}
+	start, end := BudgetWindow(BudgetMonth, now)
+	spent, err := db.GetTotalUsageTotals(start)
+	if err != nil {
+		return nil, err
+	}
+	return &BudgetStatus{
+		Period:   BudgetMonth,
+		LimitUSD: limit,
+		Start:    start,
+		ResetsAt: end,
+		Spent:    *spent,
+	}, nil
+}
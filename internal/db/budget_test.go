@@ -0,0 +1,164 @@
+package db_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ASRagab/claude-tasks/internal/db"
+)
+
+func TestBudgetWindow(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatalf("load zone: %v", err)
+	}
+	// A Sunday evening, so the week started six days earlier
+	now := time.Date(2026, time.March, 1, 21, 30, 0, 0, tokyo)
+
+	tests := []struct {
+		period     string
+		start, end time.Time
+	}{
+		{db.BudgetDay, time.Date(2026, time.March, 1, 0, 0, 0, 0, tokyo), time.Date(2026, time.March, 2, 0, 0, 0, 0, tokyo)},
+		{db.BudgetWeek, time.Date(2026, time.February, 23, 0, 0, 0, 0, tokyo), time.Date(2026, time.March, 2, 0, 0, 0, 0, tokyo)},
+		{db.BudgetMonth, time.Date(2026, time.March, 1, 0, 0, 0, 0, tokyo), time.Date(2026, time.April, 1, 0, 0, 0, 0, tokyo)},
+	}
+	for _, tt := range tests {
+		start, end := db.BudgetWindow(tt.period, now)
+		if !start.Equal(tt.start) || !end.Equal(tt.end) {
+			t.Fatalf("%s window = %s - %s, want %s - %s", tt.period, start, end, tt.start, tt.end)
+		}
+	}
+}
+
+func TestTaskBudgetStatus(t *testing.T) {
+	database := newLeaseTestDB(t)
+	task := createTriggerTestTask(t, database, "budgeted")
+	other := createTriggerTestTask(t, database, "other")
+
+	addRun := func(task *db.Task, startedAt time.Time, usage db.RunUsage) {
+		run := &db.TaskRun{TaskID: task.ID, StartedAt: startedAt, Status: db.RunStatusCompleted}
+		if err := database.CreateTaskRun(run); err != nil {
+			t.Fatalf("create run: %v", err)
+		}
+		run.Usage = usage
+		if err := database.UpdateTaskRun(run); err != nil {
+			t.Fatalf("update run: %v", err)
+		}
+	}
+	now := time.Date(2026, time.March, 18, 12, 0, 0, 0, time.UTC)
+	addRun(task, now.AddDate(0, 0, -1), db.RunUsage{CostUSD: 3, InputTokens: 1000})
+	addRun(task, now.Add(-time.Hour), db.RunUsage{CostUSD: 1.5, InputTokens: 400, OutputTokens: 100})
+	addRun(other, now.Add(-time.Hour), db.RunUsage{CostUSD: 10})
+
+	status, err := database.GetTaskBudgetStatus(task, now)
+	if err != nil {
+		t.Fatalf("budget status without budget: %v", err)
+	}
+	if status != nil {
+		t.Fatalf("expected no status for a task without a budget, got %+v", status)
+	}
+
+	task.Timezone = "UTC"
+	task.BudgetUSD = 2
+	task.BudgetPeriod = db.BudgetDay
+	status, err = database.GetTaskBudgetStatus(task, now)
+	if err != nil {
+		t.Fatalf("daily budget status: %v", err)
+	}
+	if status.Spent.CostUSD != 1.5 || status.RemainingUSD() != 0.5 || status.Exhausted() {
+		t.Fatalf("unexpected daily status %+v", status)
+	}
+
+	task.BudgetPeriod = db.BudgetWeek
+	status, err = database.GetTaskBudgetStatus(task, now)
+	if err != nil {
+		t.Fatalf("weekly budget status: %v", err)
+	}
+	if status.Spent.CostUSD != 4.5 || status.RemainingUSD() != 0 || !status.Exhausted() {
+		t.Fatalf("unexpected weekly status %+v", status)
+	}
+
+	task.BudgetUSD = 0
+	task.BudgetTokens = 1500
+	status, err = database.GetTaskBudgetStatus(task, now)
+	if err != nil {
+		t.Fatalf("token budget status: %v", err)
+	}
+	if status.Spent.TotalTokens() != 1500 || status.RemainingTokens() != 0 || !status.Exhausted() {
+		t.Fatalf("unexpected token status %+v", status)
+	}
+
+	// Statuses of several tasks are summed from each task's own period
+	addRun(other, now.AddDate(0, 0, -1), db.RunUsage{CostUSD: 5})
+	other.Timezone = "UTC"
+	other.BudgetUSD = 20
+	other.BudgetPeriod = db.BudgetDay
+	idle := createTriggerTestTask(t, database, "idle")
+	idle.BudgetTokens = 10
+	unbudgeted := createTriggerTestTask(t, database, "unbudgeted")
+	statuses, err := database.GetTaskBudgetStatuses([]*db.Task{task, other, idle, unbudgeted}, now)
+	if err != nil {
+		t.Fatalf("budget statuses: %v", err)
+	}
+	if len(statuses) != 3 || statuses[unbudgeted.ID] != nil {
+		t.Fatalf("expected statuses of the three budgeted tasks, got %+v", statuses)
+	}
+	for _, budgeted := range []*db.Task{task, other, idle} {
+		want, err := database.GetTaskBudgetStatus(budgeted, now)
+		if err != nil {
+			t.Fatalf("budget status of %s: %v", budgeted.Name, err)
+		}
+		if got := statuses[budgeted.ID]; *got != *want {
+			t.Fatalf("status of %s = %+v, want %+v", budgeted.Name, got, want)
+		}
+	}
+	if statuses[other.ID].Spent.CostUSD != 10 || statuses[task.ID].Spent.Runs != 2 || statuses[idle.ID].Spent.Runs != 0 {
+		t.Fatalf("unexpected spending %+v %+v %+v", statuses[other.ID].Spent, statuses[task.ID].Spent, statuses[idle.ID].Spent)
+	}
+}
+
+func TestGlobalBudgetStatus(t *testing.T) {
+	database := newLeaseTestDB(t)
+	now := time.Now()
+
+	budget, err := database.GetMonthlyBudget()
+	if err != nil || budget != 0 {
+		t.Fatalf("default monthly budget = %v, %v; want 0", budget, err)
+	}
+	status, err := database.GetGlobalBudgetStatus(now)
+	if err != nil || status != nil {
+		t.Fatalf("expected no status without a monthly budget, got %+v, %v", status, err)
+	}
+
+	first := createTriggerTestTask(t, database, "first")
+	second := createTriggerTestTask(t, database, "second")
+	for _, task := range []*db.Task{first, second} {
+		run := &db.TaskRun{TaskID: task.ID, StartedAt: now, Status: db.RunStatusCompleted}
+		if err := database.CreateTaskRun(run); err != nil {
+			t.Fatalf("create run: %v", err)
+		}
+		run.Usage.CostUSD = 6
+		if err := database.UpdateTaskRun(run); err != nil {
+			t.Fatalf("update run: %v", err)
+		}
+	}
+
+	if err := database.SetMonthlyBudget(12.5); err != nil {
+		t.Fatalf("set monthly budget: %v", err)
+	}
+	status, err = database.GetGlobalBudgetStatus(now)
+	if err != nil {
+		t.Fatalf("global budget status: %v", err)
+	}
+	if status.LimitUSD != 12.5 || status.Spent.CostUSD != 12 || status.Exhausted() || status.Period != db.BudgetMonth {
+		t.Fatalf("unexpected global status %+v", status)
+	}
+
+	if err := database.SetMonthlyBudget(12); err != nil {
+		t.Fatalf("lower monthly budget: %v", err)
+	}
+	if status, err = database.GetGlobalBudgetStatus(now); err != nil || !status.Exhausted() {
+		t.Fatalf("expected exhausted global budget, got %+v, %v", status, err)
+	}
+}
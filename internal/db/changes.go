@@ -0,0 +1,87 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// RunChanges is what a run changed in its git working dir: the difference
+// between the working tree before and after the run, uncommitted and
+// untracked files included
+type RunChanges struct {
+	RunID int64 `json:"run_id"`
+	// HeadBefore and HeadAfter are the commits checked out before and after
+	// the run; empty in a repository without commits
+	HeadBefore string `json:"head_before"`
+	HeadAfter  string `json:"head_after"`
+	// DirtyBefore is set when the working tree had uncommitted changes
+	// before the run; those are not part of the run's changes
+	DirtyBefore    bool          `json:"dirty_before"`
+	Files          []ChangedFile `json:"files"`
+	Insertions     int           `json:"insertions"`
+	Deletions      int           `json:"deletions"`
+	Patch          string        `json:"patch"`
+	PatchTruncated bool          `json:"patch_truncated"` // The patch was cut at the size cap
+	CreatedAt      time.Time     `json:"created_at"`
+}
+
+// ChangedFile is a file a run added, modified or deleted
+type ChangedFile struct {
+	Path       string `json:"path"`
+	Insertions int    `json:"insertions"`
+	Deletions  int    `json:"deletions"`
+	Binary     bool   `json:"binary,omitempty"` // Binary files have no line counts
+}
+
+// Summary describes the changes in a line, such as
+// "3 files changed, +12 -4"
+func (c *RunChanges) Summary() string {
+	if len(c.Files) == 0 {
+		return "no changes"
+	}
+	files := "files"
+	if len(c.Files) == 1 {
+		files = "file"
+	}
+	return fmt.Sprintf("%d %s changed, +%d -%d", len(c.Files), files, c.Insertions, c.Deletions)
+}
+
+// SaveRunChanges stores the changes of a run, replacing any stored before
+func (db *DB) SaveRunChanges(changes *RunChanges) error {
+	files, err := json.Marshal(changes.Files)
+	if err != nil {
+		return fmt.Errorf("encode changed files: %w", err)
+	}
+	if changes.CreatedAt.IsZero() {
+		changes.CreatedAt = time.Now()
+	}
+	_, err = db.conn.Exec(`
+		INSERT OR REPLACE INTO run_changes (run_id, head_before, head_after, dirty_before, files, insertions, deletions, patch, patch_truncated, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, changes.RunID, changes.HeadBefore, changes.HeadAfter, changes.DirtyBefore, string(files),
+		changes.Insertions, changes.Deletions, changes.Patch, changes.PatchTruncated, changes.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("save changes of run %d: %w", changes.RunID, err)
+	}
+	return nil
+}
+
+// GetRunChanges retrieves the changes of a run. Returns sql.ErrNoRows if
+// none were recorded, as for runs outside a git repository.
+func (db *DB) GetRunChanges(runID int64) (*RunChanges, error) {
+	changes := &RunChanges{}
+	var files string
+	err := db.conn.QueryRow(`
+		SELECT run_id, head_before, head_after, dirty_before, files, insertions, deletions, patch, patch_truncated, created_at
+		FROM run_changes WHERE run_id = ?
+	`, runID).Scan(&changes.RunID, &changes.HeadBefore, &changes.HeadAfter, &changes.DirtyBefore, &files,
+		&changes.Insertions, &changes.Deletions, &changes.Patch, &changes.PatchTruncated, &changes.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(files), &changes.Files); err != nil {
+		return nil, fmt.Errorf("decode changed files of run %d: %w", runID, err)
+	}
+	return changes, nil
+}
@@ -0,0 +1,52 @@
+package db
+
+import (
+	"fmt"
+	"time"
+)
+
+// AppendTaskRunChunk stores a piece of streamed output for a run.
+// Chunks are ordered by Seq, which the caller assigns per run.
+func (db *DB) AppendTaskRunChunk(chunk *TaskRunChunk) error {
+	if chunk.CreatedAt.IsZero() {
+		chunk.CreatedAt = time.Now()
+	}
+
+	result, err := db.conn.Exec(`
+		INSERT INTO task_run_chunks (run_id, seq, kind, content, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, chunk.RunID, chunk.Seq, chunk.Kind, chunk.Content, chunk.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("insert run chunk: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("insert run chunk: %w", err)
+	}
+	chunk.ID = id
+	return nil
+}
+
+// GetTaskRunChunks returns up to limit chunks for a run with a sequence
+// number greater than afterSeq, in order.
+func (db *DB) GetTaskRunChunks(runID, afterSeq int64, limit int) ([]*TaskRunChunk, error) {
+	rows, err := db.conn.Query(`
+		SELECT id, run_id, seq, kind, content, created_at
+		FROM task_run_chunks WHERE run_id = ? AND seq > ? ORDER BY seq ASC LIMIT ?
+	`, runID, afterSeq, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query run chunks: %w", err)
+	}
+	defer rows.Close()
+
+	var chunks []*TaskRunChunk
+	for rows.Next() {
+		chunk := &TaskRunChunk{}
+		if err := rows.Scan(&chunk.ID, &chunk.RunID, &chunk.Seq, &chunk.Kind, &chunk.Content, &chunk.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan run chunk: %w", err)
+		}
+		chunks = append(chunks, chunk)
+	}
+	return chunks, rows.Err()
+}
@@ -0,0 +1,44 @@
+package db_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ASRagab/claude-tasks/internal/db"
+)
+
+func TestTaskRunChunksAreReturnedInOrderAfterSeq(t *testing.T) {
+	database := newLeaseTestDB(t)
+
+	task := &db.Task{Name: "stream", Prompt: "hi", CronExpr: "0 * * * * *", WorkingDir: ".", Enabled: true}
+	if err := database.CreateTask(task); err != nil {
+		t.Fatalf("create task: %v", err)
+	}
+	run := &db.TaskRun{TaskID: task.ID, StartedAt: time.Now(), Status: db.RunStatusRunning}
+	if err := database.CreateTaskRun(run); err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+
+	for seq, content := range []string{"first", "second", "third"} {
+		chunk := &db.TaskRunChunk{RunID: run.ID, Seq: int64(seq + 1), Kind: db.RunChunkText, Content: content}
+		if err := database.AppendTaskRunChunk(chunk); err != nil {
+			t.Fatalf("append chunk: %v", err)
+		}
+	}
+
+	chunks, err := database.GetTaskRunChunks(run.ID, 1, 10)
+	if err != nil {
+		t.Fatalf("get chunks: %v", err)
+	}
+	if len(chunks) != 2 {
+		t.Fatalf("expected 2 chunks after seq 1, got %d", len(chunks))
+	}
+	if chunks[0].Content != "second" || chunks[1].Content != "third" {
+		t.Fatalf("unexpected chunk order: %q, %q", chunks[0].Content, chunks[1].Content)
+	}
+
+	duplicate := &db.TaskRunChunk{RunID: run.ID, Seq: 2, Kind: db.RunChunkText, Content: "dup"}
+	if err := database.AppendTaskRunChunk(duplicate); err == nil {
+		t.Fatalf("expected duplicate sequence number to be rejected")
+	}
+}
@@ -0,0 +1,134 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// StartTaskRun records a new run subject to the task's concurrency policy.
+// The policy check and the insert happen in a single statement, so processes
+// sharing the database cannot both start a run of a forbid or queue task.
+// On return run.Status is running, pending (queued behind an active run) or
+// skipped.
+func (db *DB) StartTaskRun(run *TaskRun, policy string) error {
+	if policy == "" || policy == ConcurrencyAllow {
+		run.Status = RunStatusRunning
+		return db.CreateTaskRun(run)
+	}
+
+	if run.Attempt < 1 {
+		run.Attempt = 1
+	}
+	if run.ThreadDepth < 1 {
+		run.ThreadDepth = 1
+	}
+	queueStatus := RunStatusSkipped
+	skipReason := "Skipped: another run of this task is still active (concurrency policy forbid)"
+	if policy == ConcurrencyQueue {
+		queueStatus = RunStatusPending
+		skipReason = "Skipped: a run of this task is already queued (concurrency policy queue)"
+	}
+
+	result, err := db.conn.Exec(`
+		INSERT INTO task_runs (task_id, started_at, ended_at, status, output, error, session_id, attempt, parent_run_id,
+			owner_id, owner_host, owner_pid, heartbeat_at, scheduled_for, triggered_by_run_id, rendered_prompt,
+			resumed_from_run_id, thread_run_id, thread_depth)
+		SELECT ?, ?,
+			CASE d.status WHEN 'skipped' THEN ? END,
+			d.status, '',
+			CASE d.status WHEN 'skipped' THEN ? ELSE '' END,
+			CASE d.status WHEN 'skipped' THEN '' ELSE ? END,
+			?, ?,
+			CASE d.status WHEN 'running' THEN ? ELSE '' END,
+			CASE d.status WHEN 'running' THEN ? ELSE '' END,
+			CASE d.status WHEN 'running' THEN ? ELSE 0 END,
+			CASE d.status WHEN 'running' THEN ? END,
+			?, ?, ?,
+			CASE d.status WHEN 'skipped' THEN NULL ELSE ? END,
+			CASE d.status WHEN 'skipped' THEN NULL ELSE ? END,
+			CASE d.status WHEN 'skipped' THEN 1 ELSE ? END
+		FROM (SELECT CASE
+			WHEN NOT EXISTS (SELECT 1 FROM task_runs WHERE task_id = ? AND status IN ('running', 'pending')) THEN 'running'
+			WHEN ? = 'pending' AND NOT EXISTS (SELECT 1 FROM task_runs WHERE task_id = ? AND status = 'pending') THEN 'pending'
+			ELSE 'skipped'
+		END AS status) d
+	`, run.TaskID, run.StartedAt, time.Now(), skipReason, run.SessionID, run.Attempt, run.ParentRunID,
+		run.Owner.ID, run.Owner.Host, run.Owner.PID, run.HeartbeatAt, run.ScheduledFor, run.TriggeredByRunID, run.RenderedPrompt,
+		run.ResumedFromRunID, run.ThreadRunID, run.ThreadDepth,
+		run.TaskID, queueStatus, run.TaskID)
+	if err != nil {
+		return fmt.Errorf("start task run: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("start task run: %w", err)
+	}
+	stored, err := db.GetTaskRunByID(id)
+	if err != nil {
+		return fmt.Errorf("read started task run: %w", err)
+	}
+	*run = *stored
+	return nil
+}
+
+// ClaimQueuedTaskRun moves the oldest pending run of a task to running, owned
+// by owner, once no other run of the task is active. It returns nil when
+// there is nothing to start or another process claimed the run first.
+func (db *DB) ClaimQueuedTaskRun(taskID int64, owner RunOwner) (*TaskRun, error) {
+	var runID int64
+	err := db.conn.QueryRow(`
+		SELECT id FROM task_runs WHERE task_id = ? AND status = ? ORDER BY id LIMIT 1
+	`, taskID, RunStatusPending).Scan(&runID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("find queued run: %w", err)
+	}
+
+	now := time.Now()
+	result, err := db.conn.Exec(`
+		UPDATE task_runs SET status = ?, started_at = ?, owner_id = ?, owner_host = ?, owner_pid = ?, heartbeat_at = ?
+		WHERE id = ? AND status = ?
+			AND NOT EXISTS (SELECT 1 FROM task_runs WHERE task_id = ? AND status = ?)
+	`, RunStatusRunning, now, owner.ID, owner.Host, owner.PID, now, runID, RunStatusPending, taskID, RunStatusRunning)
+	if err != nil {
+		return nil, fmt.Errorf("claim queued run: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("claim queued run: %w", err)
+	}
+	if affected == 0 {
+		return nil, nil
+	}
+	return db.GetTaskRunByID(runID)
+}
+
+// ListTasksWithStartableQueuedRuns returns the IDs of tasks that have a
+// pending run but no running one, e.g. because the process that owned the
+// active run exited before starting the queued run.
+func (db *DB) ListTasksWithStartableQueuedRuns() ([]int64, error) {
+	rows, err := db.conn.Query(`
+		SELECT DISTINCT task_id FROM task_runs p
+		WHERE p.status = ?
+			AND NOT EXISTS (SELECT 1 FROM task_runs r WHERE r.task_id = p.task_id AND r.status = ?)
+	`, RunStatusPending, RunStatusRunning)
+	if err != nil {
+		return nil, fmt.Errorf("list queued runs: %w", err)
+	}
+	defer rows.Close()
+
+	var taskIDs []int64
+	for rows.Next() {
+		var taskID int64
+		if err := rows.Scan(&taskID); err != nil {
+			return nil, fmt.Errorf("scan queued run: %w", err)
+		}
+		taskIDs = append(taskIDs, taskID)
+	}
+	return taskIDs, rows.Err()
+}
@@ -0,0 +1,114 @@
+package db_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ASRagab/claude-tasks/internal/db"
+)
+
+func startRun(t *testing.T, database *db.DB, taskID int64, policy string) *db.TaskRun {
+	t.Helper()
+	run := &db.TaskRun{TaskID: taskID, StartedAt: time.Now(), SessionID: "session"}
+	if err := database.StartTaskRun(run, policy); err != nil {
+		t.Fatalf("start run: %v", err)
+	}
+	return run
+}
+
+func TestStartTaskRunForbidSkipsWhileRunActive(t *testing.T) {
+	database := newLeaseTestDB(t)
+	task := &db.Task{Name: "forbid", Prompt: "hi", CronExpr: "0 * * * * *", WorkingDir: "."}
+	if err := database.CreateTask(task); err != nil {
+		t.Fatalf("create task: %v", err)
+	}
+
+	first := startRun(t, database, task.ID, db.ConcurrencyForbid)
+	if first.Status != db.RunStatusRunning {
+		t.Fatalf("expected first run to start, got %s", first.Status)
+	}
+
+	second := startRun(t, database, task.ID, db.ConcurrencyForbid)
+	if second.Status != db.RunStatusSkipped || second.EndedAt == nil || second.Error == "" {
+		t.Fatalf("expected recorded skipped run, got status=%s ended=%v error=%q", second.Status, second.EndedAt, second.Error)
+	}
+	if second.SessionID != "" {
+		t.Fatalf("expected skipped run without session, got %q", second.SessionID)
+	}
+
+	first.Status = db.RunStatusCompleted
+	if err := database.UpdateTaskRun(first); err != nil {
+		t.Fatalf("finish run: %v", err)
+	}
+	if third := startRun(t, database, task.ID, db.ConcurrencyForbid); third.Status != db.RunStatusRunning {
+		t.Fatalf("expected run to start after the active one finished, got %s", third.Status)
+	}
+}
+
+func TestStartTaskRunQueueKeepsOnePendingRun(t *testing.T) {
+	database := newLeaseTestDB(t)
+	task := &db.Task{Name: "queue", Prompt: "hi", CronExpr: "0 * * * * *", WorkingDir: "."}
+	if err := database.CreateTask(task); err != nil {
+		t.Fatalf("create task: %v", err)
+	}
+
+	active := startRun(t, database, task.ID, db.ConcurrencyQueue)
+	queued := startRun(t, database, task.ID, db.ConcurrencyQueue)
+	extra := startRun(t, database, task.ID, db.ConcurrencyQueue)
+	if active.Status != db.RunStatusRunning || queued.Status != db.RunStatusPending || extra.Status != db.RunStatusSkipped {
+		t.Fatalf("unexpected statuses: %s, %s, %s", active.Status, queued.Status, extra.Status)
+	}
+
+	claimed, err := database.ClaimQueuedTaskRun(task.ID, db.RunOwner{ID: "test"})
+	if err != nil {
+		t.Fatalf("claim queued run: %v", err)
+	}
+	if claimed != nil {
+		t.Fatalf("expected no claim while a run is active, got run %d", claimed.ID)
+	}
+
+	active.Status = db.RunStatusCompleted
+	if err := database.UpdateTaskRun(active); err != nil {
+		t.Fatalf("finish run: %v", err)
+	}
+	startable, err := database.ListTasksWithStartableQueuedRuns()
+	if err != nil {
+		t.Fatalf("list startable queued runs: %v", err)
+	}
+	if len(startable) != 1 || startable[0] != task.ID {
+		t.Fatalf("expected task %d to have a startable queued run, got %v", task.ID, startable)
+	}
+
+	claimed, err = database.ClaimQueuedTaskRun(task.ID, db.RunOwner{ID: "test"})
+	if err != nil {
+		t.Fatalf("claim queued run: %v", err)
+	}
+	if claimed == nil || claimed.ID != queued.ID || claimed.Status != db.RunStatusRunning {
+		t.Fatalf("expected queued run %d to be claimed, got %+v", queued.ID, claimed)
+	}
+	if again, err := database.ClaimQueuedTaskRun(task.ID, db.RunOwner{ID: "test"}); err != nil || again != nil {
+		t.Fatalf("expected nothing left to claim, got %+v (err %v)", again, err)
+	}
+}
+
+func TestRequestTaskRunCancelCancelsQueuedRun(t *testing.T) {
+	database := newLeaseTestDB(t)
+	task := &db.Task{Name: "queue", Prompt: "hi", CronExpr: "0 * * * * *", WorkingDir: "."}
+	if err := database.CreateTask(task); err != nil {
+		t.Fatalf("create task: %v", err)
+	}
+	startRun(t, database, task.ID, db.ConcurrencyQueue)
+	queued := startRun(t, database, task.ID, db.ConcurrencyQueue)
+
+	requested, err := database.RequestTaskRunCancel(queued.ID)
+	if err != nil || !requested {
+		t.Fatalf("cancel queued run: requested=%v err=%v", requested, err)
+	}
+	stored, err := database.GetTaskRunByID(queued.ID)
+	if err != nil {
+		t.Fatalf("get run: %v", err)
+	}
+	if stored.Status != db.RunStatusCancelled || stored.EndedAt == nil {
+		t.Fatalf("expected queued run to be cancelled, got %s", stored.Status)
+	}
+}
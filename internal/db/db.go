@@ -2,6 +2,8 @@ package db
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -14,6 +16,8 @@ import (
 // DB wraps the SQLite database connection
 type DB struct {
 	conn *sql.DB
+	// secretKeyPath is the file holding the key secrets are encrypted with
+	secretKeyPath string
 }
 
 // New creates a new database connection
@@ -29,7 +33,7 @@ func New(dbPath string) (*DB, error) {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
-	db := &DB{conn: conn}
+	db := &DB{conn: conn, secretKeyPath: filepath.Join(dir, "secret.key")}
 	if err := db.migrate(); err != nil {
 		conn.Close()
 		return nil, fmt.Errorf("failed to migrate database: %w", err)
@@ -74,11 +78,76 @@ func (db *DB) migrate() error {
 	CREATE INDEX IF NOT EXISTS idx_task_runs_task_id ON task_runs(task_id);
 	CREATE INDEX IF NOT EXISTS idx_task_runs_started_at ON task_runs(started_at);
 
+	CREATE TABLE IF NOT EXISTS task_run_chunks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		run_id INTEGER NOT NULL,
+		seq INTEGER NOT NULL,
+		kind TEXT NOT NULL,
+		content TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (run_id) REFERENCES task_runs(id) ON DELETE CASCADE
+	);
+
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_task_run_chunks_run_seq ON task_run_chunks(run_id, seq);
+
+	CREATE TABLE IF NOT EXISTS task_triggers (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		task_id INTEGER NOT NULL,
+		target_task_id INTEGER NOT NULL,
+		condition TEXT NOT NULL,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (task_id) REFERENCES tasks(id) ON DELETE CASCADE,
+		FOREIGN KEY (target_task_id) REFERENCES tasks(id) ON DELETE CASCADE,
+		UNIQUE (task_id, target_task_id, condition)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_task_triggers_target ON task_triggers(target_task_id);
+
 	CREATE TABLE IF NOT EXISTS settings (
 		key TEXT PRIMARY KEY,
 		value TEXT NOT NULL
 	);
 
+	CREATE TABLE IF NOT EXISTS usage_samples (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		sampled_at DATETIME NOT NULL,
+		five_hour REAL NOT NULL,
+		seven_day REAL NOT NULL,
+		five_hour_resets_at TEXT NOT NULL DEFAULT '',
+		seven_day_resets_at TEXT NOT NULL DEFAULT ''
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_usage_samples_sampled_at ON usage_samples(sampled_at);
+
+	CREATE TABLE IF NOT EXISTS profiles (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE,
+		config_dir TEXT NOT NULL,
+		usage_threshold REAL NOT NULL DEFAULT 0,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS secrets (
+		name TEXT PRIMARY KEY,
+		value BLOB NOT NULL,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS run_changes (
+		run_id INTEGER PRIMARY KEY,
+		head_before TEXT NOT NULL DEFAULT '',
+		head_after TEXT NOT NULL DEFAULT '',
+		dirty_before INTEGER NOT NULL DEFAULT 0,
+		files TEXT NOT NULL DEFAULT '[]',
+		insertions INTEGER NOT NULL DEFAULT 0,
+		deletions INTEGER NOT NULL DEFAULT 0,
+		patch TEXT NOT NULL DEFAULT '',
+		patch_truncated INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (run_id) REFERENCES task_runs(id) ON DELETE CASCADE
+	);
+
 	CREATE TABLE IF NOT EXISTS scheduler_leases (
 		id INTEGER PRIMARY KEY CHECK (id = 1),
 		holder_id TEXT NOT NULL,
@@ -108,6 +177,67 @@ func (db *DB) migrate() error {
 		"ALTER TABLE tasks ADD COLUMN model TEXT DEFAULT ''",
 		"ALTER TABLE tasks ADD COLUMN permission_mode TEXT DEFAULT ''",
 		"ALTER TABLE task_runs ADD COLUMN session_id TEXT DEFAULT ''",
+		"ALTER TABLE task_runs ADD COLUMN cancel_requested INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE tasks ADD COLUMN timeout_seconds INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE tasks ADD COLUMN max_retries INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE tasks ADD COLUMN retry_backoff_seconds INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE tasks ADD COLUMN retry_on TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE task_runs ADD COLUMN attempt INTEGER NOT NULL DEFAULT 1",
+		"ALTER TABLE task_runs ADD COLUMN parent_run_id INTEGER",
+		"ALTER TABLE tasks ADD COLUMN concurrency_policy TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE task_runs ADD COLUMN owner_id TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE task_runs ADD COLUMN owner_host TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE task_runs ADD COLUMN owner_pid INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE task_runs ADD COLUMN heartbeat_at DATETIME",
+		"ALTER TABLE tasks ADD COLUMN timezone TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE tasks ADD COLUMN misfire_policy TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE tasks ADD COLUMN last_scheduled_at DATETIME",
+		"ALTER TABLE task_runs ADD COLUMN scheduled_for DATETIME",
+		"ALTER TABLE task_runs ADD COLUMN triggered_by_run_id INTEGER",
+		"ALTER TABLE tasks ADD COLUMN prompt_vars TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE task_runs ADD COLUMN rendered_prompt TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE task_runs ADD COLUMN model_used TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE task_runs ADD COLUMN cost_usd REAL NOT NULL DEFAULT 0",
+		"ALTER TABLE task_runs ADD COLUMN input_tokens INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE task_runs ADD COLUMN output_tokens INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE task_runs ADD COLUMN cache_creation_tokens INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE task_runs ADD COLUMN cache_read_tokens INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE task_runs ADD COLUMN num_turns INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE tasks ADD COLUMN budget_usd REAL NOT NULL DEFAULT 0",
+		"ALTER TABLE tasks ADD COLUMN budget_tokens INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE tasks ADD COLUMN budget_period TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE tasks ADD COLUMN on_usage_limit TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE task_runs ADD COLUMN deferred_until DATETIME",
+		"ALTER TABLE tasks ADD COLUMN priority TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE tasks ADD COLUMN profile TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE usage_samples ADD COLUMN profile TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE tasks ADD COLUMN env TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE tasks ADD COLUMN env_file TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE tasks ADD COLUMN allowed_tools TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE tasks ADD COLUMN disallowed_tools TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE tasks ADD COLUMN max_turns INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE tasks ADD COLUMN append_system_prompt TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE tasks ADD COLUMN mcp_config TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE tasks ADD COLUMN add_dirs TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE tasks ADD COLUMN session_mode TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE tasks ADD COLUMN max_session_runs INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE task_runs ADD COLUMN resumed_from_run_id INTEGER",
+		"ALTER TABLE task_runs ADD COLUMN thread_run_id INTEGER",
+		"ALTER TABLE task_runs ADD COLUMN thread_depth INTEGER NOT NULL DEFAULT 1",
+		"ALTER TABLE tasks ADD COLUMN isolation TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE tasks ADD COLUMN worktree_cleanup TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE task_runs ADD COLUMN worktree_branch TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE task_runs ADD COLUMN worktree_path TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE task_runs ADD COLUMN worktree_base TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE task_runs ADD COLUMN worktree_commit TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE task_runs ADD COLUMN worktree_diffstat TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE tasks ADD COLUMN pre_hooks TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE tasks ADD COLUMN post_hooks TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE task_runs ADD COLUMN steps TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE tasks ADD COLUMN assertions TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE task_runs ADD COLUMN assertion_results TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE tasks ADD COLUMN output_schema TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE task_runs ADD COLUMN result_json TEXT NOT NULL DEFAULT ''",
 	}
 
 	for _, stmt := range alterStmts {
@@ -149,31 +279,225 @@ func (db *DB) SetSetting(key, value string) error {
 	return err
 }
 
-// GetUsageThreshold retrieves the usage threshold as a float
+// GetUsageThreshold returns the lower of the normal priority's usage
+// thresholds, for callers that show a single threshold
 func (db *DB) GetUsageThreshold() (float64, error) {
+	thresholds, err := db.GetUsageThresholds(PriorityNormal)
+	if err != nil {
+		return 0, err
+	}
+	return min(thresholds.FiveHour, thresholds.SevenDay), nil
+}
+
+// legacyUsageThreshold reads the single usage threshold that predates
+// per-bucket thresholds; it is the default for normal priority tasks
+func (db *DB) legacyUsageThreshold() float64 {
 	val, err := db.GetSetting("usage_threshold")
 	if err != nil {
-		return 80, nil // Default to 80%
+		return 80 // Default to 80%
 	}
 	var threshold float64
 	_, err = fmt.Sscanf(val, "%f", &threshold)
 	if err != nil {
-		return 80, nil
+		return 80
 	}
-	return threshold, nil
+	return threshold
 }
 
-// SetUsageThreshold sets the usage threshold
+// SetUsageThreshold sets both usage thresholds of normal priority tasks
 func (db *DB) SetUsageThreshold(threshold float64) error {
-	return db.SetSetting("usage_threshold", fmt.Sprintf("%.0f", threshold))
+	return db.SetUsageThresholds(PriorityNormal, UsageThresholds{FiveHour: threshold, SevenDay: threshold})
+}
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+const taskColumns = `id, name, prompt, cron_expr, scheduled_at, working_dir, discord_webhook, slack_webhook, model, permission_mode, enabled, created_at, updated_at, last_run_at, next_run_at, timeout_seconds, max_retries, retry_backoff_seconds, retry_on, concurrency_policy, timezone, misfire_policy, last_scheduled_at, prompt_vars, budget_usd, budget_tokens, budget_period, on_usage_limit, priority, profile, env, env_file, allowed_tools, disallowed_tools, max_turns, append_system_prompt, mcp_config, add_dirs, session_mode, max_session_runs, isolation, worktree_cleanup, pre_hooks, post_hooks, assertions, output_schema`
+
+func scanTask(row rowScanner) (*Task, error) {
+	task := &Task{}
+	var timeoutSeconds, retryBackoffSeconds int64
+	var retryOn, promptVars, env, allowedTools, disallowedTools, addDirs, preHooks, postHooks, assertions, outputSchema string
+	err := row.Scan(&task.ID, &task.Name, &task.Prompt, &task.CronExpr, &task.ScheduledAt, &task.WorkingDir, &task.DiscordWebhook, &task.SlackWebhook, &task.Model, &task.PermissionMode, &task.Enabled, &task.CreatedAt, &task.UpdatedAt, &task.LastRunAt, &task.NextRunAt, &timeoutSeconds, &task.MaxRetries, &retryBackoffSeconds, &retryOn, &task.ConcurrencyPolicy, &task.Timezone, &task.MisfirePolicy, &task.LastScheduledAt, &promptVars, &task.BudgetUSD, &task.BudgetTokens, &task.BudgetPeriod, &task.OnUsageLimit, &task.Priority, &task.Profile, &env, &task.EnvFile,
+		&allowedTools, &disallowedTools, &task.MaxTurns, &task.AppendSystemPrompt, &task.MCPConfig, &addDirs, &task.SessionMode, &task.MaxSessionRuns, &task.Isolation, &task.WorktreeCleanup,
+		&preHooks, &postHooks, &assertions, &outputSchema)
+	if err != nil {
+		return nil, err
+	}
+	if promptVars != "" {
+		if err := json.Unmarshal([]byte(promptVars), &task.PromptVars); err != nil {
+			return nil, fmt.Errorf("decode prompt vars of task %d: %w", task.ID, err)
+		}
+	}
+	if env != "" {
+		if err := json.Unmarshal([]byte(env), &task.Env); err != nil {
+			return nil, fmt.Errorf("decode env of task %d: %w", task.ID, err)
+		}
+	}
+	lists := []struct {
+		column string
+		dest   *[]string
+	}{{allowedTools, &task.AllowedTools}, {disallowedTools, &task.DisallowedTools}, {addDirs, &task.AddDirs}}
+	for _, list := range lists {
+		if list.column != "" {
+			if err := json.Unmarshal([]byte(list.column), list.dest); err != nil {
+				return nil, fmt.Errorf("decode claude options of task %d: %w", task.ID, err)
+			}
+		}
+	}
+	hooks := []struct {
+		column string
+		dest   *[]Hook
+	}{{preHooks, &task.PreHooks}, {postHooks, &task.PostHooks}}
+	for _, list := range hooks {
+		if list.column != "" {
+			if err := json.Unmarshal([]byte(list.column), list.dest); err != nil {
+				return nil, fmt.Errorf("decode hooks of task %d: %w", task.ID, err)
+			}
+		}
+	}
+	if assertions != "" {
+		if err := json.Unmarshal([]byte(assertions), &task.Assertions); err != nil {
+			return nil, fmt.Errorf("decode assertions of task %d: %w", task.ID, err)
+		}
+	}
+	if outputSchema != "" {
+		task.OutputSchema = json.RawMessage(outputSchema)
+	}
+	task.Timeout = time.Duration(timeoutSeconds) * time.Second
+	task.RetryBackoff = time.Duration(retryBackoffSeconds) * time.Second
+	task.RetryOn = splitList(retryOn)
+	return task, nil
+}
+
+const taskRunColumns = `id, task_id, started_at, ended_at, status, output, error, session_id, attempt, parent_run_id,
+	owner_id, owner_host, owner_pid, heartbeat_at, scheduled_for, triggered_by_run_id, rendered_prompt,
+	model_used, cost_usd, input_tokens, output_tokens, cache_creation_tokens, cache_read_tokens, num_turns, deferred_until,
+	resumed_from_run_id, thread_run_id, thread_depth,
+	worktree_branch, worktree_path, worktree_base, worktree_commit, worktree_diffstat, steps, assertion_results, result_json`
+
+func scanTaskRun(row rowScanner) (*TaskRun, error) {
+	run := &TaskRun{}
+	var worktree RunWorktree
+	var steps, assertions, resultJSON string
+	err := row.Scan(&run.ID, &run.TaskID, &run.StartedAt, &run.EndedAt, &run.Status, &run.Output, &run.Error, &run.SessionID, &run.Attempt, &run.ParentRunID,
+		&run.Owner.ID, &run.Owner.Host, &run.Owner.PID, &run.HeartbeatAt, &run.ScheduledFor, &run.TriggeredByRunID, &run.RenderedPrompt,
+		&run.Usage.Model, &run.Usage.CostUSD, &run.Usage.InputTokens, &run.Usage.OutputTokens, &run.Usage.CacheCreationTokens, &run.Usage.CacheReadTokens, &run.Usage.NumTurns, &run.DeferredUntil,
+		&run.ResumedFromRunID, &run.ThreadRunID, &run.ThreadDepth,
+		&worktree.Branch, &worktree.Path, &worktree.BaseCommit, &worktree.Commit, &worktree.DiffStat, &steps, &assertions, &resultJSON)
+	if err != nil {
+		return nil, err
+	}
+	if worktree.Branch != "" {
+		run.Worktree = &worktree
+	}
+	if steps != "" {
+		if err := json.Unmarshal([]byte(steps), &run.Steps); err != nil {
+			return nil, fmt.Errorf("decode steps of run %d: %w", run.ID, err)
+		}
+	}
+	if assertions != "" {
+		if err := json.Unmarshal([]byte(assertions), &run.Assertions); err != nil {
+			return nil, fmt.Errorf("decode assertion results of run %d: %w", run.ID, err)
+		}
+	}
+	if resultJSON != "" {
+		run.ResultJSON = json.RawMessage(resultJSON)
+	}
+	return run, nil
+}
+
+// splitList parses a comma-separated column value
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// encodeVars stores a string map as a JSON column value
+func encodeVars(vars map[string]string) (string, error) {
+	if len(vars) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(vars)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// encodeList stores a string list as a JSON column value
+func encodeList(items []string) (string, error) {
+	if len(items) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(items)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// encodeItems stores a list of structs as a JSON column value
+func encodeItems[T any](items []T) (string, error) {
+	if len(items) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(items)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// claudeOptionColumns encodes the list-valued claude CLI options of a task
+func claudeOptionColumns(task *Task) (allowedTools, disallowedTools, addDirs string, err error) {
+	if allowedTools, err = encodeList(task.AllowedTools); err != nil {
+		return "", "", "", fmt.Errorf("encode allowed tools: %w", err)
+	}
+	if disallowedTools, err = encodeList(task.DisallowedTools); err != nil {
+		return "", "", "", fmt.Errorf("encode disallowed tools: %w", err)
+	}
+	if addDirs, err = encodeList(task.AddDirs); err != nil {
+		return "", "", "", fmt.Errorf("encode add dirs: %w", err)
+	}
+	return allowedTools, disallowedTools, addDirs, nil
 }
 
 // CreateTask creates a new task
 func (db *DB) CreateTask(task *Task) error {
+	promptVars, err := encodeVars(task.PromptVars)
+	if err != nil {
+		return fmt.Errorf("encode prompt vars: %w", err)
+	}
+	env, err := encodeVars(task.Env)
+	if err != nil {
+		return fmt.Errorf("encode env: %w", err)
+	}
+	allowedTools, disallowedTools, addDirs, err := claudeOptionColumns(task)
+	if err != nil {
+		return err
+	}
+	preHooks, postHooks, err := hookColumns(task)
+	if err != nil {
+		return err
+	}
+	assertions, err := encodeItems(task.Assertions)
+	if err != nil {
+		return fmt.Errorf("encode assertions: %w", err)
+	}
 	result, err := db.conn.Exec(`
-		INSERT INTO tasks (name, prompt, cron_expr, scheduled_at, working_dir, discord_webhook, slack_webhook, model, permission_mode, enabled, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`, task.Name, task.Prompt, task.CronExpr, task.ScheduledAt, task.WorkingDir, task.DiscordWebhook, task.SlackWebhook, task.Model, task.PermissionMode, task.Enabled, time.Now(), time.Now())
+		INSERT INTO tasks (name, prompt, cron_expr, scheduled_at, working_dir, discord_webhook, slack_webhook, model, permission_mode, enabled, created_at, updated_at, timeout_seconds, max_retries, retry_backoff_seconds, retry_on, concurrency_policy, timezone, misfire_policy, prompt_vars, budget_usd, budget_tokens, budget_period, on_usage_limit, priority, profile, env, env_file,
+			allowed_tools, disallowed_tools, max_turns, append_system_prompt, mcp_config, add_dirs, session_mode, max_session_runs, isolation, worktree_cleanup, pre_hooks, post_hooks, assertions, output_schema)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, task.Name, task.Prompt, task.CronExpr, task.ScheduledAt, task.WorkingDir, task.DiscordWebhook, task.SlackWebhook, task.Model, task.PermissionMode, task.Enabled, time.Now(), time.Now(), int64(task.Timeout/time.Second), task.MaxRetries, int64(task.RetryBackoff/time.Second), strings.Join(task.RetryOn, ","), task.ConcurrencyPolicy, task.Timezone, task.MisfirePolicy, promptVars, task.BudgetUSD, task.BudgetTokens, task.BudgetPeriod, task.OnUsageLimit, task.Priority, task.Profile, env, task.EnvFile,
+		allowedTools, disallowedTools, task.MaxTurns, task.AppendSystemPrompt, task.MCPConfig, addDirs, task.SessionMode, task.MaxSessionRuns, task.Isolation, task.WorktreeCleanup, preHooks, postHooks, assertions, string(task.OutputSchema))
 	if err != nil {
 		return err
 	}
@@ -188,23 +512,12 @@ func (db *DB) CreateTask(task *Task) error {
 
 // GetTask retrieves a task by ID
 func (db *DB) GetTask(id int64) (*Task, error) {
-	task := &Task{}
-	err := db.conn.QueryRow(`
-		SELECT id, name, prompt, cron_expr, scheduled_at, working_dir, discord_webhook, slack_webhook, model, permission_mode, enabled, created_at, updated_at, last_run_at, next_run_at
-		FROM tasks WHERE id = ?
-	`, id).Scan(&task.ID, &task.Name, &task.Prompt, &task.CronExpr, &task.ScheduledAt, &task.WorkingDir, &task.DiscordWebhook, &task.SlackWebhook, &task.Model, &task.PermissionMode, &task.Enabled, &task.CreatedAt, &task.UpdatedAt, &task.LastRunAt, &task.NextRunAt)
-	if err != nil {
-		return nil, err
-	}
-	return task, nil
+	return scanTask(db.conn.QueryRow(`SELECT `+taskColumns+` FROM tasks WHERE id = ?`, id))
 }
 
 // ListTasks retrieves all tasks
 func (db *DB) ListTasks() ([]*Task, error) {
-	rows, err := db.conn.Query(`
-		SELECT id, name, prompt, cron_expr, scheduled_at, working_dir, discord_webhook, slack_webhook, model, permission_mode, enabled, created_at, updated_at, last_run_at, next_run_at
-		FROM tasks ORDER BY created_at DESC
-	`)
+	rows, err := db.conn.Query(`SELECT ` + taskColumns + ` FROM tasks ORDER BY created_at DESC`)
 	if err != nil {
 		return nil, err
 	}
@@ -212,8 +525,7 @@ func (db *DB) ListTasks() ([]*Task, error) {
 
 	var tasks []*Task
 	for rows.Next() {
-		task := &Task{}
-		err := rows.Scan(&task.ID, &task.Name, &task.Prompt, &task.CronExpr, &task.ScheduledAt, &task.WorkingDir, &task.DiscordWebhook, &task.SlackWebhook, &task.Model, &task.PermissionMode, &task.Enabled, &task.CreatedAt, &task.UpdatedAt, &task.LastRunAt, &task.NextRunAt)
+		task, err := scanTask(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -224,11 +536,40 @@ func (db *DB) ListTasks() ([]*Task, error) {
 
 // UpdateTask updates a task
 func (db *DB) UpdateTask(task *Task) error {
+	promptVars, err := encodeVars(task.PromptVars)
+	if err != nil {
+		return fmt.Errorf("encode prompt vars: %w", err)
+	}
+	env, err := encodeVars(task.Env)
+	if err != nil {
+		return fmt.Errorf("encode env: %w", err)
+	}
+	allowedTools, disallowedTools, addDirs, err := claudeOptionColumns(task)
+	if err != nil {
+		return err
+	}
+	preHooks, postHooks, err := hookColumns(task)
+	if err != nil {
+		return err
+	}
+	assertions, err := encodeItems(task.Assertions)
+	if err != nil {
+		return fmt.Errorf("encode assertions: %w", err)
+	}
 	task.UpdatedAt = time.Now()
-	_, err := db.conn.Exec(`
-		UPDATE tasks SET name = ?, prompt = ?, cron_expr = ?, scheduled_at = ?, working_dir = ?, discord_webhook = ?, slack_webhook = ?, model = ?, permission_mode = ?, enabled = ?, updated_at = ?, last_run_at = ?, next_run_at = ?
+	// A changed schedule, or enabling the task, restarts the window missed
+	// fire times are looked for in; other writes leave it alone. SET
+	// expressions see the row's old values.
+	_, err = db.conn.Exec(`
+		UPDATE tasks SET last_scheduled_at = CASE WHEN cron_expr != ? OR timezone != ? OR (? AND NOT enabled) THEN ? ELSE last_scheduled_at END,
+			name = ?, prompt = ?, cron_expr = ?, scheduled_at = ?, working_dir = ?, discord_webhook = ?, slack_webhook = ?, model = ?, permission_mode = ?, enabled = ?, updated_at = ?, last_run_at = ?, next_run_at = ?, timeout_seconds = ?, max_retries = ?, retry_backoff_seconds = ?, retry_on = ?, concurrency_policy = ?, timezone = ?, misfire_policy = ?, prompt_vars = ?, budget_usd = ?, budget_tokens = ?, budget_period = ?, on_usage_limit = ?, priority = ?, profile = ?, env = ?, env_file = ?,
+			allowed_tools = ?, disallowed_tools = ?, max_turns = ?, append_system_prompt = ?, mcp_config = ?, add_dirs = ?,
+			session_mode = ?, max_session_runs = ?, isolation = ?, worktree_cleanup = ?, pre_hooks = ?, post_hooks = ?, assertions = ?, output_schema = ?
 		WHERE id = ?
-	`, task.Name, task.Prompt, task.CronExpr, task.ScheduledAt, task.WorkingDir, task.DiscordWebhook, task.SlackWebhook, task.Model, task.PermissionMode, task.Enabled, task.UpdatedAt, task.LastRunAt, task.NextRunAt, task.ID)
+	`, task.CronExpr, task.Timezone, task.Enabled, task.UpdatedAt.UTC(),
+		task.Name, task.Prompt, task.CronExpr, task.ScheduledAt, task.WorkingDir, task.DiscordWebhook, task.SlackWebhook, task.Model, task.PermissionMode, task.Enabled, task.UpdatedAt, task.LastRunAt, task.NextRunAt, int64(task.Timeout/time.Second), task.MaxRetries, int64(task.RetryBackoff/time.Second), strings.Join(task.RetryOn, ","), task.ConcurrencyPolicy, task.Timezone, task.MisfirePolicy, promptVars, task.BudgetUSD, task.BudgetTokens, task.BudgetPeriod, task.OnUsageLimit, task.Priority, task.Profile, env, task.EnvFile,
+		allowedTools, disallowedTools, task.MaxTurns, task.AppendSystemPrompt, task.MCPConfig, addDirs,
+		task.SessionMode, task.MaxSessionRuns, task.Isolation, task.WorktreeCleanup, preHooks, postHooks, assertions, string(task.OutputSchema), task.ID)
 	return err
 }
 
@@ -238,18 +579,33 @@ func (db *DB) DeleteTask(id int64) error {
 	return err
 }
 
-// ToggleTask enables or disables a task
+// ToggleTask enables or disables a task. Enabling it restarts the window
+// missed fire times are looked for in, as in UpdateTask.
 func (db *DB) ToggleTask(id int64) error {
-	_, err := db.conn.Exec("UPDATE tasks SET enabled = NOT enabled, updated_at = ? WHERE id = ?", time.Now(), id)
+	now := time.Now()
+	_, err := db.conn.Exec(`
+		UPDATE tasks SET last_scheduled_at = CASE WHEN enabled THEN last_scheduled_at ELSE ? END,
+			enabled = NOT enabled, updated_at = ?
+		WHERE id = ?
+	`, now.UTC(), now, id)
 	return err
 }
 
 // CreateTaskRun creates a new task run record
 func (db *DB) CreateTaskRun(run *TaskRun) error {
+	if run.Attempt < 1 {
+		run.Attempt = 1
+	}
+	if run.ThreadDepth < 1 {
+		run.ThreadDepth = 1
+	}
 	result, err := db.conn.Exec(`
-		INSERT INTO task_runs (task_id, started_at, status, output, error, session_id)
-		VALUES (?, ?, ?, ?, ?, ?)
-	`, run.TaskID, run.StartedAt, run.Status, run.Output, run.Error, run.SessionID)
+		INSERT INTO task_runs (task_id, started_at, ended_at, status, output, error, session_id, attempt, parent_run_id, owner_id, owner_host, owner_pid, heartbeat_at, scheduled_for,
+			triggered_by_run_id, rendered_prompt, deferred_until, resumed_from_run_id, thread_run_id, thread_depth)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, run.TaskID, run.StartedAt, run.EndedAt, run.Status, run.Output, run.Error, run.SessionID, run.Attempt, run.ParentRunID,
+		run.Owner.ID, run.Owner.Host, run.Owner.PID, run.HeartbeatAt, run.ScheduledFor, run.TriggeredByRunID, run.RenderedPrompt, run.DeferredUntil,
+		run.ResumedFromRunID, run.ThreadRunID, run.ThreadDepth)
 	if err != nil {
 		return err
 	}
@@ -264,19 +620,110 @@ func (db *DB) CreateTaskRun(run *TaskRun) error {
 
 // UpdateTaskRun updates a task run
 func (db *DB) UpdateTaskRun(run *TaskRun) error {
-	_, err := db.conn.Exec(`
-		UPDATE task_runs SET ended_at = ?, status = ?, output = ?, error = ?, session_id = ?
+	var worktree RunWorktree
+	if run.Worktree != nil {
+		worktree = *run.Worktree
+	}
+	steps, err := encodeItems(run.Steps)
+	if err != nil {
+		return fmt.Errorf("encode run steps: %w", err)
+	}
+	assertions, err := encodeItems(run.Assertions)
+	if err != nil {
+		return fmt.Errorf("encode assertion results: %w", err)
+	}
+	_, err = db.conn.Exec(`
+		UPDATE task_runs SET ended_at = ?, status = ?, output = ?, error = ?, session_id = ?, rendered_prompt = ?,
+			model_used = ?, cost_usd = ?, input_tokens = ?, output_tokens = ?, cache_creation_tokens = ?, cache_read_tokens = ?, num_turns = ?,
+			deferred_until = ?, resumed_from_run_id = ?, thread_run_id = ?, thread_depth = ?,
+			worktree_branch = ?, worktree_path = ?, worktree_base = ?, worktree_commit = ?, worktree_diffstat = ?, steps = ?, assertion_results = ?, result_json = ?
 		WHERE id = ?
-	`, run.EndedAt, run.Status, run.Output, run.Error, run.SessionID, run.ID)
+	`, run.EndedAt, run.Status, run.Output, run.Error, run.SessionID, run.RenderedPrompt,
+		run.Usage.Model, run.Usage.CostUSD, run.Usage.InputTokens, run.Usage.OutputTokens, run.Usage.CacheCreationTokens, run.Usage.CacheReadTokens, run.Usage.NumTurns,
+		run.DeferredUntil, run.ResumedFromRunID, run.ThreadRunID, max(run.ThreadDepth, 1),
+		worktree.Branch, worktree.Path, worktree.BaseCommit, worktree.Commit, worktree.DiffStat, steps, assertions, string(run.ResultJSON), run.ID)
 	return err
 }
 
+// SetTaskRunSession records the claude session a queued run starts in and
+// the thread it continues, which are only known once it starts
+func (db *DB) SetTaskRunSession(run *TaskRun) error {
+	_, err := db.conn.Exec(`
+		UPDATE task_runs SET session_id = ?, resumed_from_run_id = ?, thread_run_id = ?, thread_depth = ?
+		WHERE id = ?
+	`, run.SessionID, run.ResumedFromRunID, run.ThreadRunID, max(run.ThreadDepth, 1), run.ID)
+	if err != nil {
+		return fmt.Errorf("set run session: %w", err)
+	}
+	return nil
+}
+
+// SetTaskRunWorktree records the git worktree a run is isolated in while
+// it runs
+func (db *DB) SetTaskRunWorktree(run *TaskRun) error {
+	var worktree RunWorktree
+	if run.Worktree != nil {
+		worktree = *run.Worktree
+	}
+	_, err := db.conn.Exec(`
+		UPDATE task_runs SET worktree_branch = ?, worktree_path = ?, worktree_base = ?, worktree_commit = ?, worktree_diffstat = ?
+		WHERE id = ?
+	`, worktree.Branch, worktree.Path, worktree.BaseCommit, worktree.Commit, worktree.DiffStat, run.ID)
+	if err != nil {
+		return fmt.Errorf("set run worktree: %w", err)
+	}
+	return nil
+}
+
+// RequestTaskRunCancel flags a running task run for cancellation. The process
+// that owns the run polls this flag, so cancellation works across processes.
+// Queued and deferred runs have no owner yet and are cancelled directly.
+// Returns false if the run does not exist or is no longer running, queued or
+// deferred.
+func (db *DB) RequestTaskRunCancel(runID int64) (bool, error) {
+	endTime := time.Now()
+	result, err := db.conn.Exec(`
+		UPDATE task_runs SET status = ?, ended_at = ?,
+			error = CASE status WHEN ? THEN ? ELSE ? END
+		WHERE id = ? AND status IN (?, ?)
+	`, RunStatusCancelled, endTime, RunStatusDeferred, "Deferred run cancelled on request", "Queued run cancelled on request",
+		runID, RunStatusPending, RunStatusDeferred)
+	if err != nil {
+		return false, fmt.Errorf("cancel queued run: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return false, fmt.Errorf("cancel queued run: %w", err)
+	} else if affected > 0 {
+		return true, nil
+	}
+
+	result, err = db.conn.Exec(`
+		UPDATE task_runs SET cancel_requested = 1
+		WHERE id = ? AND status = ?
+	`, runID, RunStatusRunning)
+	if err != nil {
+		return false, fmt.Errorf("request run cancel: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("request run cancel: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// IsTaskRunCancelRequested reports whether cancellation was requested for a run
+func (db *DB) IsTaskRunCancelRequested(runID int64) (bool, error) {
+	var requested bool
+	err := db.conn.QueryRow("SELECT cancel_requested FROM task_runs WHERE id = ?", runID).Scan(&requested)
+	if err != nil {
+		return false, err
+	}
+	return requested, nil
+}
+
 // GetTaskRuns retrieves runs for a task
 func (db *DB) GetTaskRuns(taskID int64, limit int) ([]*TaskRun, error) {
-	rows, err := db.conn.Query(`
-		SELECT id, task_id, started_at, ended_at, status, output, error, session_id
-		FROM task_runs WHERE task_id = ? ORDER BY started_at DESC LIMIT ?
-	`, taskID, limit)
+	rows, err := db.conn.Query(`SELECT `+taskRunColumns+` FROM task_runs WHERE task_id = ? ORDER BY started_at DESC LIMIT ?`, taskID, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -284,8 +731,7 @@ func (db *DB) GetTaskRuns(taskID int64, limit int) ([]*TaskRun, error) {
 
 	var runs []*TaskRun
 	for rows.Next() {
-		run := &TaskRun{}
-		err := rows.Scan(&run.ID, &run.TaskID, &run.StartedAt, &run.EndedAt, &run.Status, &run.Output, &run.Error, &run.SessionID)
+		run, err := scanTaskRun(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -296,28 +742,56 @@ func (db *DB) GetTaskRuns(taskID int64, limit int) ([]*TaskRun, error) {
 
 // GetTaskRun retrieves a specific run for a task
 func (db *DB) GetTaskRun(taskID, runID int64) (*TaskRun, error) {
-	run := &TaskRun{}
-	err := db.conn.QueryRow(`
-		SELECT id, task_id, started_at, ended_at, status, output, error, session_id
-		FROM task_runs WHERE task_id = ? AND id = ?
-	`, taskID, runID).Scan(&run.ID, &run.TaskID, &run.StartedAt, &run.EndedAt, &run.Status, &run.Output, &run.Error, &run.SessionID)
-	if err != nil {
-		return nil, err
-	}
-	return run, nil
+	return scanTaskRun(db.conn.QueryRow(`SELECT `+taskRunColumns+` FROM task_runs WHERE task_id = ? AND id = ?`, taskID, runID))
+}
+
+// GetTaskRunByID retrieves a run by ID without requiring its task ID
+func (db *DB) GetTaskRunByID(runID int64) (*TaskRun, error) {
+	return scanTaskRun(db.conn.QueryRow(`SELECT `+taskRunColumns+` FROM task_runs WHERE id = ?`, runID))
 }
 
 // GetLatestTaskRun retrieves the most recent run for a task
 func (db *DB) GetLatestTaskRun(taskID int64) (*TaskRun, error) {
-	run := &TaskRun{}
-	err := db.conn.QueryRow(`
-		SELECT id, task_id, started_at, ended_at, status, output, error, session_id
-		FROM task_runs WHERE task_id = ? ORDER BY started_at DESC LIMIT 1
-	`, taskID).Scan(&run.ID, &run.TaskID, &run.StartedAt, &run.EndedAt, &run.Status, &run.Output, &run.Error, &run.SessionID)
-	if err != nil {
-		return nil, err
+	return scanTaskRun(db.conn.QueryRow(`SELECT `+taskRunColumns+` FROM task_runs WHERE task_id = ? ORDER BY started_at DESC LIMIT 1`, taskID))
+}
+
+// GetLatestFinishedTaskRun retrieves the most recent run of a task that
+// completed, failed, timed out, failed an assertion or was cancelled.
+// Returns nil if there is none.
+func (db *DB) GetLatestFinishedTaskRun(taskID int64) (*TaskRun, error) {
+	run, err := scanTaskRun(db.conn.QueryRow(`SELECT `+taskRunColumns+` FROM task_runs
+		WHERE task_id = ? AND status IN (?, ?, ?, ?, ?)
+		ORDER BY started_at DESC LIMIT 1`,
+		taskID, RunStatusCompleted, RunStatusFailed, RunStatusTimedOut, RunStatusAssertionFailed, RunStatusCancelled))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
 	}
-	return run, nil
+	return run, err
+}
+
+// GetLatestSessionRun retrieves the most recent completed run of a task
+// that has a claude session, the run a continued or forked session resumes.
+// Returns nil if there is none.
+func (db *DB) GetLatestSessionRun(taskID int64) (*TaskRun, error) {
+	run, err := scanTaskRun(db.conn.QueryRow(`SELECT `+taskRunColumns+` FROM task_runs
+		WHERE task_id = ? AND status = ? AND session_id != ''
+		ORDER BY started_at DESC LIMIT 1`,
+		taskID, RunStatusCompleted))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return run, err
+}
+
+// GetLastSuccessAt returns when the task's latest completed run ended, or nil
+func (db *DB) GetLastSuccessAt(taskID int64) (*time.Time, error) {
+	var endedAt *time.Time
+	err := db.conn.QueryRow(`SELECT ended_at FROM task_runs WHERE task_id = ? AND status = ?
+		ORDER BY started_at DESC LIMIT 1`, taskID, RunStatusCompleted).Scan(&endedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return endedAt, err
 }
 
 // GetLastRunStatuses retrieves the last run status for all tasks
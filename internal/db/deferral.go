@@ -0,0 +1,57 @@
+package db
+
+import (
+	"fmt"
+	"time"
+)
+
+// HasDeferredTaskRun reports whether a task has a deferred run other than
+// exceptRunID
+func (db *DB) HasDeferredTaskRun(taskID, exceptRunID int64) (bool, error) {
+	var exists bool
+	err := db.conn.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM task_runs WHERE task_id = ? AND status = ? AND id != ?)
+	`, taskID, RunStatusDeferred, exceptRunID).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("check deferred runs: %w", err)
+	}
+	return exists, nil
+}
+
+// ReleaseDueDeferredRuns queues the deferred runs whose planned time has
+// passed, so they start like runs queued by the concurrency policy. Deferred
+// runs of recurring tasks disabled since are skipped instead. Returns the
+// number of runs queued.
+func (db *DB) ReleaseDueDeferredRuns(now time.Time) (int64, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("begin release of deferred runs: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	_, err = tx.Exec(`
+		UPDATE task_runs SET status = ?, ended_at = ?, error = ?
+		WHERE status = ? AND julianday(deferred_until) <= julianday(?)
+			AND task_id IN (SELECT id FROM tasks WHERE enabled = 0 AND cron_expr != '')
+	`, RunStatusSkipped, now, "Deferred run dropped: the task was disabled", RunStatusDeferred, now)
+	if err != nil {
+		return 0, fmt.Errorf("skip deferred runs of disabled tasks: %w", err)
+	}
+
+	result, err := tx.Exec(`
+		UPDATE task_runs SET status = ?, error = ''
+		WHERE status = ? AND julianday(deferred_until) <= julianday(?)
+	`, RunStatusPending, RunStatusDeferred, now)
+	if err != nil {
+		return 0, fmt.Errorf("queue deferred runs: %w", err)
+	}
+	released, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("queue deferred runs: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit release of deferred runs: %w", err)
+	}
+	return released, nil
+}
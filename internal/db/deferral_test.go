@@ -0,0 +1,100 @@
+package db_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ASRagab/claude-tasks/internal/db"
+)
+
+func createDeferredRun(t *testing.T, database *db.DB, taskID int64, until time.Time) *db.TaskRun {
+	t.Helper()
+	run := &db.TaskRun{TaskID: taskID, StartedAt: time.Now(), Status: db.RunStatusDeferred, DeferredUntil: &until, Error: "Usage over threshold"}
+	if err := database.CreateTaskRun(run); err != nil {
+		t.Fatalf("create deferred run: %v", err)
+	}
+	return run
+}
+
+func TestReleaseDueDeferredRuns(t *testing.T) {
+	database := newLeaseTestDB(t)
+	task := &db.Task{Name: "deferred", Prompt: "hi", CronExpr: "0 * * * * *", WorkingDir: ".", Enabled: true}
+	if err := database.CreateTask(task); err != nil {
+		t.Fatalf("create task: %v", err)
+	}
+	now := time.Now()
+	run := createDeferredRun(t, database, task.ID, now.Add(time.Hour))
+
+	waiting, err := database.HasDeferredTaskRun(task.ID, 0)
+	if err != nil || !waiting {
+		t.Fatalf("expected a deferred run, got %v (err %v)", waiting, err)
+	}
+	if waiting, _ := database.HasDeferredTaskRun(task.ID, run.ID); waiting {
+		t.Fatal("expected the excepted run to be ignored")
+	}
+
+	if released, err := database.ReleaseDueDeferredRuns(now); err != nil || released != 0 {
+		t.Fatalf("expected nothing released before the planned time, got %d (err %v)", released, err)
+	}
+	released, err := database.ReleaseDueDeferredRuns(now.Add(2 * time.Hour))
+	if err != nil || released != 1 {
+		t.Fatalf("expected one run released, got %d (err %v)", released, err)
+	}
+	stored, err := database.GetTaskRunByID(run.ID)
+	if err != nil {
+		t.Fatalf("get run: %v", err)
+	}
+	if stored.Status != db.RunStatusPending || stored.Error != "" || stored.DeferredUntil == nil {
+		t.Fatalf("expected released run to be queued with its planned time, got %+v", stored)
+	}
+
+	startable, err := database.ListTasksWithStartableQueuedRuns()
+	if err != nil {
+		t.Fatalf("list startable queued runs: %v", err)
+	}
+	if len(startable) != 1 || startable[0] != task.ID {
+		t.Fatalf("expected task %d to have a startable queued run, got %v", task.ID, startable)
+	}
+}
+
+func TestReleaseDueDeferredRunsSkipsDisabledTasks(t *testing.T) {
+	database := newLeaseTestDB(t)
+	task := &db.Task{Name: "disabled", Prompt: "hi", CronExpr: "0 * * * * *", WorkingDir: "."}
+	if err := database.CreateTask(task); err != nil {
+		t.Fatalf("create task: %v", err)
+	}
+	now := time.Now()
+	run := createDeferredRun(t, database, task.ID, now.Add(-time.Minute))
+
+	if released, err := database.ReleaseDueDeferredRuns(now); err != nil || released != 0 {
+		t.Fatalf("expected no runs released for a disabled task, got %d (err %v)", released, err)
+	}
+	stored, err := database.GetTaskRunByID(run.ID)
+	if err != nil {
+		t.Fatalf("get run: %v", err)
+	}
+	if stored.Status != db.RunStatusSkipped || stored.EndedAt == nil {
+		t.Fatalf("expected deferred run of a disabled task to be skipped, got %s", stored.Status)
+	}
+}
+
+func TestRequestTaskRunCancelCancelsDeferredRun(t *testing.T) {
+	database := newLeaseTestDB(t)
+	task := &db.Task{Name: "deferred", Prompt: "hi", CronExpr: "0 * * * * *", WorkingDir: ".", Enabled: true}
+	if err := database.CreateTask(task); err != nil {
+		t.Fatalf("create task: %v", err)
+	}
+	run := createDeferredRun(t, database, task.ID, time.Now().Add(time.Hour))
+
+	requested, err := database.RequestTaskRunCancel(run.ID)
+	if err != nil || !requested {
+		t.Fatalf("cancel deferred run: requested=%v err=%v", requested, err)
+	}
+	stored, err := database.GetTaskRunByID(run.ID)
+	if err != nil {
+		t.Fatalf("get run: %v", err)
+	}
+	if stored.Status != db.RunStatusCancelled || stored.Error != "Deferred run cancelled on request" {
+		t.Fatalf("expected deferred run to be cancelled, got %s (%q)", stored.Status, stored.Error)
+	}
+}
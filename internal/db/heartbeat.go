@@ -0,0 +1,62 @@
+package db
+
+import (
+	"fmt"
+	"time"
+)
+
+// HeartbeatTaskRun records that the owner of a running run is still alive
+func (db *DB) HeartbeatTaskRun(runID int64) error {
+	_, err := db.conn.Exec(`
+		UPDATE task_runs SET heartbeat_at = ?
+		WHERE id = ? AND status = ?
+	`, time.Now(), runID, RunStatusRunning)
+	if err != nil {
+		return fmt.Errorf("heartbeat run: %w", err)
+	}
+	return nil
+}
+
+// ListRunningTaskRuns returns every run currently recorded as running
+func (db *DB) ListRunningTaskRuns() ([]*TaskRun, error) {
+	rows, err := db.conn.Query(`SELECT `+taskRunColumns+` FROM task_runs WHERE status = ? ORDER BY id`, RunStatusRunning)
+	if err != nil {
+		return nil, fmt.Errorf("list running runs: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []*TaskRun
+	for rows.Next() {
+		run, err := scanTaskRun(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan running run: %w", err)
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// FailOrphanedTaskRun marks a running run whose owner is gone as failed.
+// The owner must still match, so a run that was reclaimed or finished in
+// the meantime is left alone. Returns false if the run was not updated.
+func (db *DB) FailOrphanedTaskRun(run *TaskRun, reason string) (bool, error) {
+	endTime := time.Now()
+	result, err := db.conn.Exec(`
+		UPDATE task_runs SET status = ?, ended_at = ?, error = ?
+		WHERE id = ? AND status = ? AND owner_id = ?
+	`, RunStatusFailed, endTime, reason, run.ID, RunStatusRunning, run.Owner.ID)
+	if err != nil {
+		return false, fmt.Errorf("fail orphaned run: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("fail orphaned run: %w", err)
+	}
+	if affected == 0 {
+		return false, nil
+	}
+	run.Status = RunStatusFailed
+	run.EndedAt = &endTime
+	run.Error = reason
+	return true, nil
+}
@@ -0,0 +1,60 @@
+package db_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ASRagab/claude-tasks/internal/db"
+)
+
+func TestHeartbeatAndFailOrphanedTaskRun(t *testing.T) {
+	database := newLeaseTestDB(t)
+	task := &db.Task{Name: "orphan", Prompt: "hi", CronExpr: "0 * * * * *", WorkingDir: "."}
+	if err := database.CreateTask(task); err != nil {
+		t.Fatalf("create task: %v", err)
+	}
+
+	started := time.Now().Add(-time.Hour)
+	run := &db.TaskRun{
+		TaskID:      task.ID,
+		StartedAt:   started,
+		Status:      db.RunStatusRunning,
+		Owner:       db.RunOwner{ID: "owner-a", Host: "host", PID: 42},
+		HeartbeatAt: &started,
+	}
+	if err := database.CreateTaskRun(run); err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+
+	if err := database.HeartbeatTaskRun(run.ID); err != nil {
+		t.Fatalf("heartbeat: %v", err)
+	}
+	running, err := database.ListRunningTaskRuns()
+	if err != nil {
+		t.Fatalf("list running runs: %v", err)
+	}
+	if len(running) != 1 || running[0].Owner != run.Owner {
+		t.Fatalf("expected the run with its owner, got %+v", running)
+	}
+	if running[0].HeartbeatAt == nil || !running[0].HeartbeatAt.After(started) {
+		t.Fatalf("expected heartbeat to be refreshed, got %v", running[0].HeartbeatAt)
+	}
+
+	stale := *running[0]
+	stale.Owner.ID = "owner-b"
+	if ok, err := database.FailOrphanedTaskRun(&stale, "orphaned"); err != nil || ok {
+		t.Fatalf("expected no update for a different owner, got ok=%v err=%v", ok, err)
+	}
+
+	ok, err := database.FailOrphanedTaskRun(running[0], "Orphaned: owner exited")
+	if err != nil || !ok {
+		t.Fatalf("fail orphaned run: ok=%v err=%v", ok, err)
+	}
+	stored, err := database.GetTaskRunByID(run.ID)
+	if err != nil {
+		t.Fatalf("get run: %v", err)
+	}
+	if stored.Status != db.RunStatusFailed || stored.EndedAt == nil || stored.Error != "Orphaned: owner exited" {
+		t.Fatalf("unexpected orphaned run: %+v", stored)
+	}
+}
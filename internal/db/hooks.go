@@ -0,0 +1,79 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultHookTimeout applies to hooks without an explicit timeout
+	DefaultHookTimeout = 5 * time.Minute
+	// MaxHooks is the most hooks a task may run before or after claude
+	MaxHooks = 20
+)
+
+// Phases a hook runs in
+const (
+	HookPre  = "pre"  // Before claude; a failing pre-hook aborts the run
+	HookPost = "post" // After claude; a failing post-hook fails the run
+)
+
+// Hook is a shell command run in the working dir before or after claude,
+// with the run's environment
+type Hook struct {
+	Command        string `json:"command"`
+	TimeoutSeconds int64  `json:"timeout_seconds,omitempty"` // Zero uses DefaultHookTimeout
+}
+
+// EffectiveTimeout returns how long the hook may run
+func (h Hook) EffectiveTimeout() time.Duration {
+	if h.TimeoutSeconds > 0 {
+		return time.Duration(h.TimeoutSeconds) * time.Second
+	}
+	return DefaultHookTimeout
+}
+
+// ParseHook validates a hook command and its timeout, a duration such as
+// "30s" or "10m"; an empty timeout selects the default
+func ParseHook(command, timeout string) (Hook, error) {
+	command = strings.TrimSpace(command)
+	if command == "" {
+		return Hook{}, fmt.Errorf("hook command is required")
+	}
+	d, err := ParseTimeout(timeout)
+	if err != nil {
+		return Hook{}, fmt.Errorf("hook %q: %w", command, err)
+	}
+	return Hook{Command: command, TimeoutSeconds: int64(d / time.Second)}, nil
+}
+
+// RunStep is a hook that ran as part of a run
+type RunStep struct {
+	Phase    string `json:"phase"` // HookPre or HookPost
+	Command  string `json:"command"`
+	ExitCode int    `json:"exit_code"` // -1 when the hook did not exit on its own
+	Stdout   string `json:"stdout,omitempty"`
+	Stderr   string `json:"stderr,omitempty"`
+	// Error says why a hook without an exit code stopped, such as a
+	// timeout
+	Error     string    `json:"error,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+	EndedAt   time.Time `json:"ended_at"`
+}
+
+// Failed reports whether the hook failed
+func (s RunStep) Failed() bool {
+	return s.ExitCode != 0
+}
+
+// hookColumns encodes the pre- and post-hooks of a task
+func hookColumns(task *Task) (preHooks, postHooks string, err error) {
+	if preHooks, err = encodeItems(task.PreHooks); err != nil {
+		return "", "", fmt.Errorf("encode pre-hooks: %w", err)
+	}
+	if postHooks, err = encodeItems(task.PostHooks); err != nil {
+		return "", "", fmt.Errorf("encode post-hooks: %w", err)
+	}
+	return preHooks, postHooks, nil
+}
@@ -21,6 +21,11 @@ func TestMigrateCreatesExpectedColumns(t *testing.T) {
 		"id", "name", "prompt", "cron_expr", "scheduled_at", "working_dir",
 		"discord_webhook", "slack_webhook", "model", "permission_mode",
 		"enabled", "created_at", "updated_at", "last_run_at", "next_run_at",
+		"timeout_seconds", "max_retries", "retry_backoff_seconds", "retry_on",
+		"concurrency_policy", "timezone", "misfire_policy", "last_scheduled_at", "prompt_vars",
+		"budget_usd", "budget_tokens", "budget_period", "on_usage_limit", "priority", "profile",
+		"env", "env_file", "allowed_tools", "disallowed_tools", "max_turns", "append_system_prompt", "mcp_config", "add_dirs",
+		"session_mode", "max_session_runs", "isolation", "worktree_cleanup", "pre_hooks", "post_hooks", "assertions", "output_schema",
 	}
 
 	for _, col := range expected {
@@ -30,8 +35,13 @@ func TestMigrateCreatesExpectedColumns(t *testing.T) {
 	}
 
 	runColumns := tableColumns(t, database, "task_runs")
-	if !runColumns["session_id"] {
-		t.Fatalf("expected task_runs.session_id column to exist")
+	for _, col := range []string{"session_id", "cancel_requested", "attempt", "parent_run_id", "owner_id", "owner_host", "owner_pid", "heartbeat_at", "scheduled_for", "triggered_by_run_id", "rendered_prompt",
+		"model_used", "cost_usd", "input_tokens", "output_tokens", "cache_creation_tokens", "cache_read_tokens", "num_turns", "deferred_until",
+		"resumed_from_run_id", "thread_run_id", "thread_depth",
+		"worktree_branch", "worktree_path", "worktree_base", "worktree_commit", "worktree_diffstat", "steps", "assertion_results", "result_json"} {
+		if !runColumns[col] {
+			t.Fatalf("expected task_runs.%s column to exist", col)
+		}
 	}
 }
 
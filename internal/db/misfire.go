@@ -0,0 +1,26 @@
+package db
+
+import (
+	"fmt"
+	"time"
+)
+
+// ClaimScheduledFire records at as the latest fire time handled for a task.
+// It returns false when the task is gone or a fire time at or after at was
+// already claimed, so a fire time is acted on at most once across processes
+// sharing the database.
+func (db *DB) ClaimScheduledFire(taskID int64, at time.Time) (bool, error) {
+	at = at.UTC()
+	result, err := db.conn.Exec(`
+		UPDATE tasks SET last_scheduled_at = ?
+		WHERE id = ? AND (last_scheduled_at IS NULL OR last_scheduled_at < ?)
+	`, at, taskID, at)
+	if err != nil {
+		return false, fmt.Errorf("claim scheduled fire: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("claim scheduled fire: %w", err)
+	}
+	return n > 0, nil
+}
@@ -0,0 +1,98 @@
+package db_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ASRagab/claude-tasks/internal/db"
+)
+
+func TestClaimScheduledFire(t *testing.T) {
+	database := newLeaseTestDB(t)
+	task := &db.Task{Name: "hourly", Prompt: "hi", CronExpr: "0 0 * * * *", WorkingDir: "."}
+	if err := database.CreateTask(task); err != nil {
+		t.Fatalf("create task: %v", err)
+	}
+
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("load location: %v", err)
+	}
+	fire := time.Date(2026, time.March, 10, 9, 0, 0, 0, ny)
+
+	if ok, err := database.ClaimScheduledFire(task.ID, fire); err != nil || !ok {
+		t.Fatalf("first claim: ok=%v err=%v", ok, err)
+	}
+	// The same instant in another zone is the same fire time
+	if ok, err := database.ClaimScheduledFire(task.ID, fire.UTC()); err != nil || ok {
+		t.Fatalf("expected repeated claim to fail, got ok=%v err=%v", ok, err)
+	}
+	if ok, err := database.ClaimScheduledFire(task.ID, fire.Add(-time.Hour)); err != nil || ok {
+		t.Fatalf("expected earlier claim to fail, got ok=%v err=%v", ok, err)
+	}
+	if ok, err := database.ClaimScheduledFire(task.ID, fire.Add(time.Hour)); err != nil || !ok {
+		t.Fatalf("expected later claim to succeed, got ok=%v err=%v", ok, err)
+	}
+
+	stored, err := database.GetTask(task.ID)
+	if err != nil {
+		t.Fatalf("get task: %v", err)
+	}
+	if stored.LastScheduledAt == nil || !stored.LastScheduledAt.Equal(fire.Add(time.Hour)) {
+		t.Fatalf("unexpected last scheduled time %v", stored.LastScheduledAt)
+	}
+}
+
+func TestOnlyScheduleChangesMoveLastScheduledAt(t *testing.T) {
+	database := newLeaseTestDB(t)
+	task := &db.Task{Name: "hourly", Prompt: "hi", CronExpr: "0 0 * * * *", WorkingDir: ".", Enabled: true}
+	if err := database.CreateTask(task); err != nil {
+		t.Fatalf("create task: %v", err)
+	}
+	fire := time.Date(2026, time.March, 10, 9, 0, 0, 0, time.UTC)
+	if ok, err := database.ClaimScheduledFire(task.ID, fire); err != nil || !ok {
+		t.Fatalf("claim: ok=%v err=%v", ok, err)
+	}
+	lastScheduledAt := func() *time.Time {
+		t.Helper()
+		stored, err := database.GetTask(task.ID)
+		if err != nil {
+			t.Fatalf("get task: %v", err)
+		}
+		return stored.LastScheduledAt
+	}
+
+	// Edits and run bookkeeping keep the window
+	task.Prompt = "hello"
+	task.LastRunAt = &fire
+	if err := database.UpdateTask(task); err != nil {
+		t.Fatalf("update task: %v", err)
+	}
+	if got := lastScheduledAt(); got == nil || !got.Equal(fire) {
+		t.Fatalf("expected an edit to keep last scheduled time %v, got %v", fire, got)
+	}
+
+	// A new schedule restarts it
+	task.CronExpr = "0 30 * * * *"
+	if err := database.UpdateTask(task); err != nil {
+		t.Fatalf("update task: %v", err)
+	}
+	got := lastScheduledAt()
+	if got == nil || got.Before(task.UpdatedAt.Add(-time.Second)) {
+		t.Fatalf("expected a schedule change to restart the window, got %v", got)
+	}
+
+	// Enabling does too, disabling does not
+	for _, enabled := range []bool{false, true} {
+		if ok, err := database.ClaimScheduledFire(task.ID, time.Now().Add(time.Hour)); err != nil || !ok {
+			t.Fatalf("claim: ok=%v err=%v", ok, err)
+		}
+		before := lastScheduledAt()
+		if err := database.ToggleTask(task.ID); err != nil {
+			t.Fatalf("toggle task: %v", err)
+		}
+		if got := lastScheduledAt(); got.Equal(*before) == enabled {
+			t.Fatalf("toggle to enabled=%v: last scheduled time went from %v to %v", enabled, before, got)
+		}
+	}
+}
@@ -1,24 +1,105 @@
 package db
 
-import "time"
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
 
 // Task represents a scheduled Claude task
 type Task struct {
-	ID             int64      `json:"id"`
-	Name           string     `json:"name"`
-	Prompt         string     `json:"prompt"`
-	CronExpr       string     `json:"cron_expr"`                // Empty for one-off tasks
-	ScheduledAt    *time.Time `json:"scheduled_at,omitempty"`   // When one-off task should run (nil = run immediately)
-	WorkingDir     string     `json:"working_dir"`
-	DiscordWebhook string     `json:"discord_webhook,omitempty"`
-	SlackWebhook   string     `json:"slack_webhook,omitempty"`
-	Model          string     `json:"model,omitempty"`
-	PermissionMode string     `json:"permission_mode,omitempty"`
-	Enabled        bool       `json:"enabled"`
-	CreatedAt      time.Time  `json:"created_at"`
-	UpdatedAt      time.Time  `json:"updated_at"`
-	LastRunAt      *time.Time `json:"last_run_at,omitempty"`
-	NextRunAt      *time.Time `json:"next_run_at,omitempty"`
+	ID             int64         `json:"id"`
+	Name           string        `json:"name"`
+	Prompt         string        `json:"prompt"`
+	CronExpr       string        `json:"cron_expr"`              // Empty for one-off tasks
+	ScheduledAt    *time.Time    `json:"scheduled_at,omitempty"` // When one-off task should run (nil = run immediately)
+	WorkingDir     string        `json:"working_dir"`
+	DiscordWebhook string        `json:"discord_webhook,omitempty"`
+	SlackWebhook   string        `json:"slack_webhook,omitempty"`
+	Model          string        `json:"model,omitempty"`
+	PermissionMode string        `json:"permission_mode,omitempty"`
+	Timeout        time.Duration `json:"timeout,omitempty"` // Zero uses DefaultTimeout
+	MaxRetries     int           `json:"max_retries,omitempty"`
+	RetryBackoff   time.Duration `json:"retry_backoff,omitempty"` // Delay before the first retry, doubled per attempt
+	RetryOn        []string      `json:"retry_on,omitempty"`      // Failure kinds to retry; empty retries all of them
+	Enabled        bool          `json:"enabled"`
+	CreatedAt      time.Time     `json:"created_at"`
+	UpdatedAt      time.Time     `json:"updated_at"`
+	LastRunAt      *time.Time    `json:"last_run_at,omitempty"`
+	NextRunAt      *time.Time    `json:"next_run_at,omitempty"`
+
+	// ConcurrencyPolicy decides what happens when a run starts while
+	// another run of the task is active; empty allows parallel runs
+	ConcurrencyPolicy string `json:"concurrency_policy,omitempty"`
+	// Timezone is the IANA zone the cron expression is evaluated in;
+	// empty uses the server's local zone
+	Timezone string `json:"timezone,omitempty"`
+	// MisfirePolicy decides what happens to fire times missed while no
+	// scheduler was running; LastScheduledAt is the latest fire time handled,
+	// or when the schedule last changed or the task was enabled
+	MisfirePolicy   string     `json:"misfire_policy,omitempty"`
+	LastScheduledAt *time.Time `json:"last_scheduled_at,omitempty"`
+	// PromptVars are custom values the prompt template reads as .Vars
+	PromptVars map[string]string `json:"prompt_vars,omitempty"`
+	// BudgetUSD and BudgetTokens cap what the task's runs may spend per
+	// BudgetPeriod; zero means no cap
+	BudgetUSD    float64 `json:"budget_usd,omitempty"`
+	BudgetTokens int64   `json:"budget_tokens,omitempty"`
+	BudgetPeriod string  `json:"budget_period,omitempty"`
+	// OnUsageLimit decides what happens to a run that starts while usage
+	// is above the threshold; empty skips it
+	OnUsageLimit string `json:"on_usage_limit,omitempty"`
+	// Priority selects which usage thresholds apply to the task; empty is
+	// normal
+	Priority string `json:"priority,omitempty"`
+	// Profile names the Claude account profile the task runs as; empty
+	// uses the default account
+	Profile string `json:"profile,omitempty"`
+	// Env sets environment variables for claude on top of the daemon's
+	// own; values may reference secrets as ${secret:NAME}
+	Env map[string]string `json:"env,omitempty"`
+	// EnvFile is a .env file whose variables are loaded before Env; a
+	// relative path is resolved against the working directory
+	EnvFile string `json:"env_file,omitempty"`
+
+	// Claude CLI options; see ParseToolList and MaxTurnsLimit
+	AllowedTools       []string `json:"allowed_tools,omitempty"`
+	DisallowedTools    []string `json:"disallowed_tools,omitempty"`
+	MaxTurns           int      `json:"max_turns,omitempty"` // Zero leaves the turns unlimited
+	AppendSystemPrompt string   `json:"append_system_prompt,omitempty"`
+	MCPConfig          string   `json:"mcp_config,omitempty"` // MCP config file, relative to the working dir unless absolute
+	AddDirs            []string `json:"add_dirs,omitempty"`   // Extra directories claude may access
+
+	// SessionMode decides whether a run starts a new claude session or
+	// resumes the last completed run's; empty starts a new one.
+	// MaxSessionRuns caps the runs in one conversation thread, after which
+	// a new session is started; zero uses DefaultMaxSessionRuns
+	SessionMode    string `json:"session_mode,omitempty"`
+	MaxSessionRuns int    `json:"max_session_runs,omitempty"`
+
+	// Isolation decides where claude runs; empty runs it in the working
+	// dir. WorktreeCleanup decides what happens to a run's git worktree
+	// afterwards; empty removes it
+	Isolation       string `json:"isolation,omitempty"`
+	WorktreeCleanup string `json:"worktree_cleanup,omitempty"`
+
+	// PreHooks run in order before claude and PostHooks after it; see
+	// Hook
+	PreHooks  []Hook `json:"pre_hooks,omitempty"`
+	PostHooks []Hook `json:"post_hooks,omitempty"`
+
+	// Assertions are checked after claude exits successfully; a run
+	// failing any of them ends as assertion_failed
+	Assertions []Assertion `json:"assertions,omitempty"`
+	// OutputSchema is a JSON Schema for claude's structured output. Runs
+	// of a task with one store the validated result as their ResultJSON.
+	OutputSchema json.RawMessage `json:"output_schema,omitempty"`
 }
 
 // IsOneOff returns true if this is a one-off (non-recurring) task
@@ -26,6 +107,65 @@ func (t *Task) IsOneOff() bool {
 	return t.CronExpr == ""
 }
 
+// EffectiveTimeout returns the run timeout for this task
+func (t *Task) EffectiveTimeout() time.Duration {
+	if t.Timeout > 0 {
+		return t.Timeout
+	}
+	return DefaultTimeout
+}
+
+// Location returns the zone the task's schedule is evaluated in
+func (t *Task) Location() *time.Location {
+	if t.Timezone != "" {
+		if loc, err := time.LoadLocation(t.Timezone); err == nil {
+			return loc
+		}
+	}
+	return time.Local
+}
+
+// CronSpec returns the cron expression with the task's timezone applied as a
+// CRON_TZ prefix, leaving expressions that already name a zone untouched
+func (t *Task) CronSpec() string {
+	if t.Timezone == "" || strings.HasPrefix(t.CronExpr, "CRON_TZ=") || strings.HasPrefix(t.CronExpr, "TZ=") {
+		return t.CronExpr
+	}
+	return "CRON_TZ=" + t.Timezone + " " + t.CronExpr
+}
+
+// RetriesOn reports whether the retry policy covers a failure kind
+func (t *Task) RetriesOn(kind string) bool {
+	if t.MaxRetries <= 0 {
+		return false
+	}
+	if len(t.RetryOn) == 0 {
+		return true
+	}
+	for _, k := range t.RetryOn {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// RetryDelay returns how long to wait after the given failed attempt before
+// starting the next one. The backoff doubles with each attempt.
+func (t *Task) RetryDelay(failedAttempt int) time.Duration {
+	delay := t.RetryBackoff
+	if delay <= 0 {
+		delay = DefaultRetryBackoff
+	}
+	for i := 1; i < failedAttempt && delay < MaxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > MaxRetryDelay {
+		delay = MaxRetryDelay
+	}
+	return delay
+}
+
 // TaskRun represents an execution of a task
 type TaskRun struct {
 	ID        int64      `json:"id"`
@@ -36,8 +176,128 @@ type TaskRun struct {
 	Output    string     `json:"output"`
 	Error     string     `json:"error,omitempty"`
 	SessionID string     `json:"session_id,omitempty"`
+	// Attempt is 1 for the first run; retries count up from there and
+	// link back to the first run through ParentRunID
+	Attempt     int    `json:"attempt"`
+	ParentRunID *int64 `json:"parent_run_id,omitempty"`
+	// Owner is the process executing the run, which refreshes HeartbeatAt
+	// while the run is in flight
+	Owner       RunOwner   `json:"owner"`
+	HeartbeatAt *time.Time `json:"heartbeat_at,omitempty"`
+	// ScheduledFor is the cron fire time the run was started for; it differs
+	// from StartedAt for runs caught up after a misfire
+	ScheduledFor *time.Time `json:"scheduled_for,omitempty"`
+	// TriggeredByRunID is the upstream run whose completion queued this run
+	TriggeredByRunID *int64 `json:"triggered_by_run_id,omitempty"`
+	// RenderedPrompt is the prompt sent to claude after template rendering
+	RenderedPrompt string `json:"rendered_prompt,omitempty"`
+	// Usage is what the run consumed, as reported by claude
+	Usage RunUsage `json:"usage"`
+	// DeferredUntil is when a run deferred by the usage limit is planned to
+	// start
+	DeferredUntil *time.Time `json:"deferred_until,omitempty"`
+	// ResumedFromRunID is the run whose session this run continued or
+	// forked. ThreadRunID is the first run of the conversation thread, nil
+	// when this run started it, and ThreadDepth counts the thread's runs up
+	// to this one.
+	ResumedFromRunID *int64 `json:"resumed_from_run_id,omitempty"`
+	ThreadRunID      *int64 `json:"thread_run_id,omitempty"`
+	ThreadDepth      int    `json:"thread_depth"`
+	// Worktree is the git worktree a run of a worktree-isolated task ran
+	// in; nil for other runs
+	Worktree *RunWorktree `json:"worktree,omitempty"`
+	// Changes is what the run changed in its git working dir. It is set by
+	// the executor when the run finishes and not loaded with the run; see
+	// GetRunChanges.
+	Changes *RunChanges `json:"-"`
+	// Steps are the task's hooks that ran, in order
+	Steps []RunStep `json:"steps,omitempty"`
+	// Assertions are the results of the task's assertions, in order; empty
+	// when they were not checked
+	Assertions []AssertionResult `json:"assertions,omitempty"`
+	// ResultJSON is the structured output of a run whose task has an
+	// output schema, once validated against it
+	ResultJSON json.RawMessage `json:"result_json,omitempty"`
+}
+
+// RunWorktree is the git worktree and branch an isolated run works on
+type RunWorktree struct {
+	Branch     string `json:"branch"`
+	Path       string `json:"path,omitempty"` // Empty once the worktree is removed
+	BaseCommit string `json:"base_commit"`    // The working dir's HEAD when the run started
+	// Commit is the branch's commit after the run, including changes
+	// claude left uncommitted, and DiffStat summarizes it against BaseCommit
+	Commit   string `json:"commit,omitempty"`
+	DiffStat string `json:"diff_stat,omitempty"`
+}
+
+// Changed reports whether the run left commits or changes on its branch
+func (w *RunWorktree) Changed() bool {
+	return w.Commit != "" && w.Commit != w.BaseCommit
+}
+
+// ThreadID returns the ID of the first run of the run's conversation thread
+func (r *TaskRun) ThreadID() int64 {
+	if r.ThreadRunID != nil {
+		return *r.ThreadRunID
+	}
+	return r.ID
 }
 
+// RunUsage is the cost and token usage claude reports for a run
+type RunUsage struct {
+	Model               string  `json:"model,omitempty"` // The model claude actually used
+	CostUSD             float64 `json:"cost_usd"`
+	InputTokens         int64   `json:"input_tokens"`
+	OutputTokens        int64   `json:"output_tokens"`
+	CacheCreationTokens int64   `json:"cache_creation_tokens"`
+	CacheReadTokens     int64   `json:"cache_read_tokens"`
+	NumTurns            int     `json:"num_turns"`
+}
+
+// TotalInputTokens counts all prompt-side tokens, cached or not
+func (u RunUsage) TotalInputTokens() int64 {
+	return u.InputTokens + u.CacheCreationTokens + u.CacheReadTokens
+}
+
+// TotalTokens counts every token the run consumed
+func (u RunUsage) TotalTokens() int64 {
+	return u.TotalInputTokens() + u.OutputTokens
+}
+
+// UsageTotals sums the usage of a task's runs
+type UsageTotals struct {
+	Runs int `json:"runs"`
+	RunUsage
+}
+
+// RunOwner identifies the process executing a run
+type RunOwner struct {
+	ID   string `json:"id,omitempty"`
+	Host string `json:"host,omitempty"`
+	PID  int    `json:"pid,omitempty"`
+}
+
+// TaskRunChunk is a piece of run output persisted while the run is in flight
+type TaskRunChunk struct {
+	ID        int64        `json:"id"`
+	RunID     int64        `json:"run_id"`
+	Seq       int64        `json:"seq"`
+	Kind      RunChunkKind `json:"kind"`
+	Content   string       `json:"content"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// RunChunkKind identifies what a streamed output chunk contains
+type RunChunkKind string
+
+const (
+	RunChunkText       RunChunkKind = "text"
+	RunChunkToolUse    RunChunkKind = "tool_use"
+	RunChunkToolResult RunChunkKind = "tool_result"
+	RunChunkResult     RunChunkKind = "result"
+)
+
 // RunStatus represents the status of a task run
 type RunStatus string
 
@@ -46,8 +306,757 @@ const (
 	RunStatusRunning   RunStatus = "running"
 	RunStatusCompleted RunStatus = "completed"
 	RunStatusFailed    RunStatus = "failed"
+	RunStatusCancelled RunStatus = "cancelled"
+	RunStatusTimedOut  RunStatus = "timed_out"
+	RunStatusSkipped   RunStatus = "skipped"
+	RunStatusDeferred  RunStatus = "deferred" // Waiting for usage to reset
+
+	// RunStatusAssertionFailed marks a run claude completed whose output
+	// failed one of the task's assertions
+	RunStatusAssertionFailed RunStatus = "assertion_failed"
 )
 
-var ModelAliases    = []string{"", "opus", "sonnet", "haiku"}
+var ModelAliases = []string{"", "opus", "sonnet", "haiku"}
 var PermissionModes = []string{"bypassPermissions", "default", "acceptEdits", "plan"}
+
 const DefaultPermissionMode = "bypassPermissions"
+
+const (
+	// DefaultTimeout applies to tasks without an explicit timeout
+	DefaultTimeout = 30 * time.Minute
+	// MaxTimeout is the longest timeout a task may configure
+	MaxTimeout = 24 * time.Hour
+)
+
+// ParseTimeout parses a task timeout such as "5m" or "2h". An empty value
+// selects the default timeout and is returned as zero.
+func ParseTimeout(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timeout %q (use a duration like 5m or 2h)", value)
+	}
+	if d < time.Second {
+		return 0, fmt.Errorf("timeout must be at least 1s")
+	}
+	if d > MaxTimeout {
+		return 0, fmt.Errorf("timeout must be at most %s", FormatDuration(MaxTimeout))
+	}
+	return d.Truncate(time.Second), nil
+}
+
+// ParseTimezone validates an IANA timezone name such as "America/New_York".
+// An empty value selects the server's local zone.
+func ParseTimezone(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", nil
+	}
+	if strings.EqualFold(value, "local") {
+		return "", fmt.Errorf("timezone must name a zone such as UTC or America/New_York")
+	}
+	loc, err := time.LoadLocation(value)
+	if err != nil {
+		return "", fmt.Errorf("unknown timezone %q (use an IANA name such as America/New_York)", value)
+	}
+	return loc.String(), nil
+}
+
+// FormatDuration renders a duration compactly, e.g. "2h" instead of "2h0m0s"
+func FormatDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+// Failure kinds a task's retry policy can match
+const (
+	RetryOnExitError = "exit_error"
+	RetryOnTimeout   = "timeout"
+	RetryOnPreflight = "preflight"
+	RetryOnOrphaned  = "orphaned"
+	RetryOnAssertion = "assertion"
+)
+
+// RetryConditions lists the supported retry_on values
+var RetryConditions = []string{RetryOnExitError, RetryOnTimeout, RetryOnPreflight, RetryOnOrphaned, RetryOnAssertion}
+
+const (
+	// MaxRetries bounds the retries a task may configure
+	MaxRetries = 10
+	// DefaultRetryBackoff applies when a task retries without a backoff
+	DefaultRetryBackoff = time.Minute
+	// MaxRetryDelay caps the exponential backoff between attempts
+	MaxRetryDelay = 6 * time.Hour
+)
+
+// ParseRetryBackoff parses the delay before a task's first retry. An empty
+// value selects the default backoff and is returned as zero.
+func ParseRetryBackoff(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid retry backoff %q (use a duration like 30s or 5m)", value)
+	}
+	if d < time.Second {
+		return 0, fmt.Errorf("retry backoff must be at least 1s")
+	}
+	if d > MaxRetryDelay {
+		return 0, fmt.Errorf("retry backoff must be at most %s", FormatDuration(MaxRetryDelay))
+	}
+	return d.Truncate(time.Second), nil
+}
+
+// ParseRetryOn parses a comma-separated list of retry conditions
+func ParseRetryOn(value string) ([]string, error) {
+	var conditions []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		valid := false
+		for _, c := range RetryConditions {
+			if item == c {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return nil, fmt.Errorf("unknown retry condition %q (use %s)", item, strings.Join(RetryConditions, ", "))
+		}
+		conditions = append(conditions, item)
+	}
+	return conditions, nil
+}
+
+// Concurrency policies for runs that start while another run is active
+const (
+	ConcurrencyAllow  = "allow"  // Start a parallel run
+	ConcurrencyForbid = "forbid" // Skip the new run
+	ConcurrencyQueue  = "queue"  // Keep one pending run to start afterwards
+)
+
+// ConcurrencyPolicies lists the supported concurrency_policy values
+var ConcurrencyPolicies = []string{ConcurrencyAllow, ConcurrencyForbid, ConcurrencyQueue}
+
+// EffectiveConcurrencyPolicy returns the task's concurrency policy
+func (t *Task) EffectiveConcurrencyPolicy() string {
+	if t.ConcurrencyPolicy == "" {
+		return ConcurrencyAllow
+	}
+	return t.ConcurrencyPolicy
+}
+
+// ParseConcurrencyPolicy validates a concurrency policy. An empty value
+// selects the default and "skip" is accepted as an alias for "forbid".
+func ParseConcurrencyPolicy(value string) (string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	switch value {
+	case "":
+		return "", nil
+	case "skip":
+		return ConcurrencyForbid, nil
+	case ConcurrencyAllow, ConcurrencyForbid, ConcurrencyQueue:
+		return value, nil
+	}
+	return "", fmt.Errorf("unknown concurrency policy %q (use %s)", value, strings.Join(ConcurrencyPolicies, ", "))
+}
+
+// Misfire policies for cron fire times missed while no scheduler was running
+const (
+	MisfireSkip    = "skip"     // Drop missed fire times
+	MisfireRunOnce = "run_once" // Run once for the latest missed fire time
+	MisfireRunAll  = "run_all"  // Run for each missed fire time, up to MaxMisfireRuns
+)
+
+// MisfirePolicies lists the supported misfire_policy values
+var MisfirePolicies = []string{MisfireSkip, MisfireRunOnce, MisfireRunAll}
+
+// MaxMisfireRuns caps the catch-up runs started under the run_all policy;
+// only the most recent missed fire times are run
+const MaxMisfireRuns = 10
+
+// EffectiveMisfirePolicy returns the task's misfire policy
+func (t *Task) EffectiveMisfirePolicy() string {
+	if t.MisfirePolicy == "" {
+		return MisfireSkip
+	}
+	return t.MisfirePolicy
+}
+
+// ParseMisfirePolicy validates a misfire policy. An empty value selects the
+// default.
+func ParseMisfirePolicy(value string) (string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	switch value {
+	case "":
+		return "", nil
+	case MisfireSkip, MisfireRunOnce, MisfireRunAll:
+		return value, nil
+	}
+	return "", fmt.Errorf("unknown misfire policy %q (use %s)", value, strings.Join(MisfirePolicies, ", "))
+}
+
+// Usage limit policies for runs that start while usage is above the threshold
+const (
+	UsageLimitSkip      = "skip"              // Record a skipped run and drop it
+	UsageLimitDefer     = "defer_until_reset" // Start the run once usage resets
+	UsageLimitRunAnyway = "run_anyway"        // Ignore the threshold
+)
+
+// UsageLimitPolicies lists the supported on_usage_limit values
+var UsageLimitPolicies = []string{UsageLimitSkip, UsageLimitDefer, UsageLimitRunAnyway}
+
+// EffectiveUsageLimitPolicy returns the task's usage limit policy
+func (t *Task) EffectiveUsageLimitPolicy() string {
+	if t.OnUsageLimit == "" {
+		return UsageLimitSkip
+	}
+	return t.OnUsageLimit
+}
+
+// ParseUsageLimitPolicy validates a usage limit policy. An empty value
+// selects the default and "defer" is accepted as an alias.
+func ParseUsageLimitPolicy(value string) (string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	switch value {
+	case "":
+		return "", nil
+	case "defer":
+		return UsageLimitDefer, nil
+	case UsageLimitSkip, UsageLimitDefer, UsageLimitRunAnyway:
+		return value, nil
+	}
+	return "", fmt.Errorf("unknown usage limit policy %q (use %s)", value, strings.Join(UsageLimitPolicies, ", "))
+}
+
+// Task priorities; each has its own usage thresholds
+const (
+	PriorityLow      = "low"
+	PriorityNormal   = "normal"
+	PriorityCritical = "critical"
+)
+
+// Priorities lists the supported task priorities, lowest first
+var Priorities = []string{PriorityLow, PriorityNormal, PriorityCritical}
+
+// EffectivePriority returns the task's priority
+func (t *Task) EffectivePriority() string {
+	if t.Priority == "" {
+		return PriorityNormal
+	}
+	return t.Priority
+}
+
+// ParsePriority validates a task priority. An empty value selects the
+// default.
+func ParsePriority(value string) (string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	switch value {
+	case "":
+		return "", nil
+	case PriorityLow, PriorityNormal, PriorityCritical:
+		return value, nil
+	}
+	return "", fmt.Errorf("unknown priority %q (use %s)", value, strings.Join(Priorities, ", "))
+}
+
+// UsageThresholds are the utilization percentages of the five-hour and
+// seven-day usage buckets at which runs stop starting
+type UsageThresholds struct {
+	FiveHour float64 `json:"five_hour"`
+	SevenDay float64 `json:"seven_day"`
+}
+
+// Validate checks that both thresholds are percentages
+func (u UsageThresholds) Validate() error {
+	if u.FiveHour < 0 || u.FiveHour > 100 || u.SevenDay < 0 || u.SevenDay > 100 {
+		return fmt.Errorf("usage thresholds must be between 0 and 100")
+	}
+	return nil
+}
+
+// Profile is a Claude account with its own config dir, and so its own
+// credentials and usage limits
+type Profile struct {
+	ID        int64  `json:"id"`
+	Name      string `json:"name"`
+	ConfigDir string `json:"config_dir"` // Passed to claude as CLAUDE_CONFIG_DIR
+	// UsageThreshold caps the priority usage thresholds of the profile's
+	// tasks; zero leaves them as they are
+	UsageThreshold float64   `json:"usage_threshold,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// CapThresholds applies the profile's usage threshold to a task's priority
+// thresholds
+func (p *Profile) CapThresholds(thresholds UsageThresholds) UsageThresholds {
+	if p == nil || p.UsageThreshold <= 0 {
+		return thresholds
+	}
+	return UsageThresholds{
+		FiveHour: min(thresholds.FiveHour, p.UsageThreshold),
+		SevenDay: min(thresholds.SevenDay, p.UsageThreshold),
+	}
+}
+
+var profileNameRE = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// ParseProfileName validates a profile name: up to 32 lowercase letters,
+// digits, dashes and underscores. "default" is reserved for the account
+// tasks without a profile use.
+func ParseProfileName(value string) (string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "default" {
+		return "", fmt.Errorf("profile name %q is reserved", value)
+	}
+	if !profileNameRE.MatchString(value) {
+		return "", fmt.Errorf("invalid profile name %q (use up to 32 lowercase letters, digits, - and _)", value)
+	}
+	return value, nil
+}
+
+// ParseConfigDir validates a profile's Claude config dir, expanding a
+// leading ~ to the home directory
+func ParseConfigDir(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "~" || strings.HasPrefix(value, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("could not determine home directory: %w", err)
+		}
+		value = filepath.Join(home, strings.TrimPrefix(value, "~"))
+	}
+	if value == "" || !filepath.IsAbs(value) {
+		return "", fmt.Errorf("config dir must be an absolute path")
+	}
+	return filepath.Clean(value), nil
+}
+
+var (
+	// envNameRE matches environment variable and secret names
+	envNameRE = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	// secretRefRE matches a ${secret:NAME} reference in an env value
+	secretRefRE = regexp.MustCompile(`\$\{secret:([^}]*)\}`)
+)
+
+// ParseSecretName validates a secret name, which follows the rules of
+// environment variable names
+func ParseSecretName(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if !envNameRE.MatchString(value) {
+		return "", fmt.Errorf("invalid secret name %q (use letters, digits and underscores, not starting with a digit)", value)
+	}
+	return value, nil
+}
+
+// ValidateEnv checks a task's environment variable names and the secret
+// references in their values
+func ValidateEnv(env map[string]string) error {
+	for name, value := range env {
+		if !envNameRE.MatchString(name) {
+			return fmt.Errorf("invalid environment variable name %q (use letters, digits and underscores, not starting with a digit)", name)
+		}
+		for _, ref := range SecretRefs(value) {
+			if _, err := ParseSecretName(ref); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// SecretRefs returns the names of the secrets a value references
+func SecretRefs(value string) []string {
+	var names []string
+	for _, match := range secretRefRE.FindAllStringSubmatch(value, -1) {
+		names = append(names, match[1])
+	}
+	return names
+}
+
+// ExpandSecretRefs replaces each ${secret:NAME} in value with the secret
+// lookup returns for NAME
+func ExpandSecretRefs(value string, lookup func(name string) (string, error)) (string, error) {
+	var expandErr error
+	expanded := secretRefRE.ReplaceAllStringFunc(value, func(ref string) string {
+		secret, err := lookup(secretRefRE.FindStringSubmatch(ref)[1])
+		if err != nil && expandErr == nil {
+			expandErr = err
+		}
+		return secret
+	})
+	if expandErr != nil {
+		return "", expandErr
+	}
+	return expanded, nil
+}
+
+// ResolveEnvFile returns the path of a task's env file, expanding a leading
+// ~ and resolving a relative path against the working directory
+func (t *Task) ResolveEnvFile() (string, error) {
+	path := strings.TrimSpace(t.EnvFile)
+	if path == "" {
+		return "", nil
+	}
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("could not determine home directory: %w", err)
+		}
+		path = filepath.Join(home, strings.TrimPrefix(path, "~"))
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(t.WorkingDir, path)
+	}
+	return filepath.Clean(path), nil
+}
+
+// MaxTurnsLimit is the highest max_turns a task may set
+const MaxTurnsLimit = 1000
+
+// toolSpecRE matches a tool name with an optional permission pattern, such
+// as Read, mcp__github__create_issue or Bash(git diff:*)
+var toolSpecRE = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_.-]*(\([^()]*\))?$`)
+
+// ParseToolList parses a comma-separated tool list; commas inside a tool's
+// parentheses do not split it
+func ParseToolList(value string) ([]string, error) {
+	var tools []string
+	depth, start := 0, 0
+	for i := 0; i <= len(value); i++ {
+		if i < len(value) {
+			switch value[i] {
+			case '(':
+				depth++
+				continue
+			case ')':
+				depth--
+				continue
+			case ',':
+				if depth > 0 {
+					continue
+				}
+			default:
+				continue
+			}
+		}
+		if tool := strings.TrimSpace(value[start:i]); tool != "" {
+			tools = append(tools, tool)
+		}
+		start = i + 1
+	}
+	if err := ValidateTools(tools); err != nil {
+		return nil, err
+	}
+	return tools, nil
+}
+
+// ValidateTools checks that each entry is a tool name with an optional
+// (pattern)
+func ValidateTools(tools []string) error {
+	for _, tool := range tools {
+		if !toolSpecRE.MatchString(tool) {
+			return fmt.Errorf("invalid tool %q (use a name such as Read or Bash(git diff:*))", tool)
+		}
+	}
+	return nil
+}
+
+// ParseMaxTurns parses a task's max turns; blank is unlimited
+func ParseMaxTurns(value string) (int, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+	turns, err := strconv.Atoi(value)
+	if err != nil || turns < 0 || turns > MaxTurnsLimit {
+		return 0, fmt.Errorf("max turns must be between 0 and %d", MaxTurnsLimit)
+	}
+	return turns, nil
+}
+
+// ResolveMCPConfig returns the absolute path of a task's MCP config file,
+// resolving a relative path against the working directory; empty without
+// one. It is absolute so isolated runs, which start in a worktree, read the
+// same file.
+func (t *Task) ResolveMCPConfig() string {
+	if t.MCPConfig == "" {
+		return ""
+	}
+	path := t.MCPConfig
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(t.WorkingDir, path)
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// Session modes deciding which claude session a run starts in
+const (
+	SessionFresh        = "fresh"         // Start a new session
+	SessionContinueLast = "continue_last" // Resume the last completed run's session
+	SessionForkLast     = "fork_last"     // Resume a copy of the last completed run's session
+)
+
+// SessionModes lists the supported session_mode values
+var SessionModes = []string{SessionFresh, SessionContinueLast, SessionForkLast}
+
+// DefaultMaxSessionRuns is how many runs a thread may have when the task
+// does not set a cap
+const DefaultMaxSessionRuns = 10
+
+// MaxSessionRunsLimit is the highest max_session_runs a task may set
+const MaxSessionRunsLimit = 1000
+
+// EffectiveSessionMode returns the task's session mode
+func (t *Task) EffectiveSessionMode() string {
+	if t.SessionMode == "" {
+		return SessionFresh
+	}
+	return t.SessionMode
+}
+
+// EffectiveMaxSessionRuns returns how many runs one of the task's threads
+// may have
+func (t *Task) EffectiveMaxSessionRuns() int {
+	if t.MaxSessionRuns <= 0 {
+		return DefaultMaxSessionRuns
+	}
+	return t.MaxSessionRuns
+}
+
+// ParseSessionMode validates a session mode. An empty value selects the
+// default and "continue" and "fork" are accepted as aliases.
+func ParseSessionMode(value string) (string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	switch value {
+	case "":
+		return "", nil
+	case "continue":
+		return SessionContinueLast, nil
+	case "fork":
+		return SessionForkLast, nil
+	case SessionFresh, SessionContinueLast, SessionForkLast:
+		return value, nil
+	}
+	return "", fmt.Errorf("unknown session mode %q (use %s)", value, strings.Join(SessionModes, ", "))
+}
+
+// ParseMaxSessionRuns parses a task's thread cap; blank uses the default
+func ParseMaxSessionRuns(value string) (int, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+	runs, err := strconv.Atoi(value)
+	if err != nil || runs < 0 || runs > MaxSessionRunsLimit {
+		return 0, fmt.Errorf("max session runs must be between 0 and %d", MaxSessionRunsLimit)
+	}
+	return runs, nil
+}
+
+// Isolation modes deciding where a task's runs execute
+const (
+	IsolationNone     = "none"     // Run in the working dir
+	IsolationWorktree = "worktree" // Run in a new git worktree of the working dir's repository
+)
+
+// IsolationModes lists the supported isolation values
+var IsolationModes = []string{IsolationNone, IsolationWorktree}
+
+// Worktree cleanup policies for the worktrees of isolated runs
+const (
+	WorktreeRemove        = "remove"          // Remove the worktree; its branch is kept if the run changed anything
+	WorktreeKeep          = "keep"            // Keep the worktree
+	WorktreeKeepOnFailure = "keep_on_failure" // Keep the worktree of runs that did not complete
+)
+
+// WorktreeCleanupPolicies lists the supported worktree_cleanup values
+var WorktreeCleanupPolicies = []string{WorktreeRemove, WorktreeKeep, WorktreeKeepOnFailure}
+
+// EffectiveIsolation returns the task's isolation mode
+func (t *Task) EffectiveIsolation() string {
+	if t.Isolation == "" {
+		return IsolationNone
+	}
+	return t.Isolation
+}
+
+// EffectiveWorktreeCleanup returns the task's worktree cleanup policy
+func (t *Task) EffectiveWorktreeCleanup() string {
+	if t.WorktreeCleanup == "" {
+		return WorktreeRemove
+	}
+	return t.WorktreeCleanup
+}
+
+// ParseIsolation validates an isolation mode. An empty value selects the
+// default.
+func ParseIsolation(value string) (string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	switch value {
+	case "":
+		return "", nil
+	case IsolationNone, IsolationWorktree:
+		return value, nil
+	}
+	return "", fmt.Errorf("unknown isolation %q (use %s)", value, strings.Join(IsolationModes, ", "))
+}
+
+// ParseWorktreeCleanup validates a worktree cleanup policy. An empty value
+// selects the default.
+func ParseWorktreeCleanup(value string) (string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	switch value {
+	case "":
+		return "", nil
+	case WorktreeRemove, WorktreeKeep, WorktreeKeepOnFailure:
+		return value, nil
+	}
+	return "", fmt.Errorf("unknown worktree cleanup %q (use %s)", value, strings.Join(WorktreeCleanupPolicies, ", "))
+}
+
+// Budget periods a task's budget applies to
+const (
+	BudgetDay   = "day"
+	BudgetWeek  = "week" // Starting Monday
+	BudgetMonth = "month"
+)
+
+// BudgetPeriods lists the supported budget_period values
+var BudgetPeriods = []string{BudgetDay, BudgetWeek, BudgetMonth}
+
+// HasBudget reports whether the task caps its cost or tokens
+func (t *Task) HasBudget() bool {
+	return t.BudgetUSD > 0 || t.BudgetTokens > 0
+}
+
+// EffectiveBudgetPeriod returns the period the task's budget applies to
+func (t *Task) EffectiveBudgetPeriod() string {
+	if t.BudgetPeriod == "" {
+		return BudgetMonth
+	}
+	return t.BudgetPeriod
+}
+
+// ParseBudgetPeriod validates a budget period. An empty value selects the
+// default and "daily", "weekly" and "monthly" are accepted as aliases.
+func ParseBudgetPeriod(value string) (string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	switch value {
+	case "":
+		return "", nil
+	case BudgetDay, "daily":
+		return BudgetDay, nil
+	case BudgetWeek, "weekly":
+		return BudgetWeek, nil
+	case BudgetMonth, "monthly":
+		return BudgetMonth, nil
+	}
+	return "", fmt.Errorf("unknown budget period %q (use %s)", value, strings.Join(BudgetPeriods, ", "))
+}
+
+// ParseBudgetUSD parses a dollar budget such as "5" or "$2.50". An empty
+// value means no budget and is returned as zero.
+func ParseBudgetUSD(value string) (float64, error) {
+	value = strings.TrimPrefix(strings.TrimSpace(value), "$")
+	if value == "" {
+		return 0, nil
+	}
+	usd, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(usd) || math.IsInf(usd, 0) {
+		return 0, fmt.Errorf("invalid budget %q (use a dollar amount like 5 or 2.50)", value)
+	}
+	if usd < 0 {
+		return 0, fmt.Errorf("budget must not be negative")
+	}
+	return usd, nil
+}
+
+// ParseTokenBudget parses a token budget such as "500000", "500k" or "2m".
+// An empty value means no budget and is returned as zero.
+func ParseTokenBudget(value string) (int64, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return 0, nil
+	}
+	number, multiplier := value, 1.0
+	switch {
+	case strings.HasSuffix(value, "k"):
+		number, multiplier = strings.TrimSuffix(value, "k"), 1e3
+	case strings.HasSuffix(value, "m"):
+		number, multiplier = strings.TrimSuffix(value, "m"), 1e6
+	}
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || math.IsNaN(n) || math.IsInf(n, 0) || n*multiplier > math.MaxInt64/2 {
+		return 0, fmt.Errorf("invalid token budget %q (use a count like 500000, 500k or 2m)", value)
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("token budget must not be negative")
+	}
+	return int64(n * multiplier), nil
+}
+
+// TaskTrigger starts a run of TargetTaskID when a run of TaskID finishes
+// with a status matching Condition
+type TaskTrigger struct {
+	ID             int64     `json:"id"`
+	TaskID         int64     `json:"task_id"`
+	TaskName       string    `json:"task_name,omitempty"`
+	TargetTaskID   int64     `json:"target_task_id"`
+	TargetTaskName string    `json:"target_task_name,omitempty"`
+	Condition      string    `json:"condition"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// Trigger conditions
+const (
+	TriggerOnSuccess  = "on_success"  // The run completed
+	TriggerOnFailure  = "on_failure"  // The run failed, timed out or failed an assertion
+	TriggerOnComplete = "on_complete" // Either of the above
+)
+
+// TriggerConditions lists the supported trigger conditions
+var TriggerConditions = []string{TriggerOnSuccess, TriggerOnFailure, TriggerOnComplete}
+
+// ParseTriggerCondition validates a trigger condition
+func ParseTriggerCondition(value string) (string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	for _, c := range TriggerConditions {
+		if value == c {
+			return value, nil
+		}
+	}
+	return "", fmt.Errorf("unknown trigger condition %q (use %s)", value, strings.Join(TriggerConditions, ", "))
+}
+
+// TriggerMatches reports whether a run that finished with status fires a
+// trigger with the given condition. Cancelled and skipped runs fire nothing.
+func TriggerMatches(condition string, status RunStatus) bool {
+	succeeded := status == RunStatusCompleted
+	failed := status == RunStatusFailed || status == RunStatusTimedOut || status == RunStatusAssertionFailed
+	switch condition {
+	case TriggerOnSuccess:
+		return succeeded
+	case TriggerOnFailure:
+		return failed
+	case TriggerOnComplete:
+		return succeeded || failed
+	}
+	return false
+}
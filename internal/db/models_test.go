@@ -0,0 +1,445 @@
+package db
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestParseTimeout(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{input: "", want: 0},
+		{input: "5m", want: 5 * time.Minute},
+		{input: " 2h ", want: 2 * time.Hour},
+		{input: "90.5s", want: 90 * time.Second},
+		{input: "500ms", wantErr: true},
+		{input: "25h", wantErr: true},
+		{input: "soon", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseTimeout(tt.input)
+		if tt.wantErr {
+			if err == nil {
+				t.Fatalf("expected error for %q", tt.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("parse %q: %v", tt.input, err)
+		}
+		if got != tt.want {
+			t.Fatalf("parse %q: expected %s, got %s", tt.input, tt.want, got)
+		}
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		2 * time.Hour:             "2h",
+		30 * time.Minute:          "30m",
+		90 * time.Minute:          "1h30m",
+		45 * time.Second:          "45s",
+		time.Hour + 5*time.Second: "1h0m5s",
+	} {
+		if got := FormatDuration(d); got != want {
+			t.Fatalf("format %s: expected %q, got %q", d, want, got)
+		}
+	}
+}
+
+func TestParseRetryOn(t *testing.T) {
+	got, err := ParseRetryOn(" timeout, exit_error ,")
+	if err != nil {
+		t.Fatalf("parse retry_on: %v", err)
+	}
+	if len(got) != 2 || got[0] != RetryOnTimeout || got[1] != RetryOnExitError {
+		t.Fatalf("unexpected conditions: %v", got)
+	}
+
+	if got, err := ParseRetryOn(""); err != nil || got != nil {
+		t.Fatalf("expected no conditions for empty value, got %v (err %v)", got, err)
+	}
+	if _, err := ParseRetryOn("timeout,crash"); err == nil {
+		t.Fatal("expected error for unknown condition")
+	}
+}
+
+func TestTaskRetryPolicy(t *testing.T) {
+	task := &Task{MaxRetries: 3, RetryBackoff: 30 * time.Second, RetryOn: []string{RetryOnTimeout}}
+
+	if !task.RetriesOn(RetryOnTimeout) || task.RetriesOn(RetryOnExitError) {
+		t.Fatal("expected only timeouts to be retried")
+	}
+	task.RetryOn = nil
+	if !task.RetriesOn(RetryOnPreflight) {
+		t.Fatal("expected an empty retry_on to retry every failure kind")
+	}
+	if (&Task{}).RetriesOn(RetryOnExitError) {
+		t.Fatal("expected no retries without max_retries")
+	}
+
+	for attempt, want := range map[int]time.Duration{1: 30 * time.Second, 2: time.Minute, 3: 2 * time.Minute} {
+		if got := task.RetryDelay(attempt); got != want {
+			t.Fatalf("attempt %d: expected delay %s, got %s", attempt, want, got)
+		}
+	}
+	if got := task.RetryDelay(40); got != MaxRetryDelay {
+		t.Fatalf("expected delay capped at %s, got %s", MaxRetryDelay, got)
+	}
+	if got := (&Task{}).RetryDelay(1); got != DefaultRetryBackoff {
+		t.Fatalf("expected default backoff %s, got %s", DefaultRetryBackoff, got)
+	}
+}
+
+func TestParseConcurrencyPolicy(t *testing.T) {
+	tests := map[string]string{
+		"":        "",
+		"allow":   ConcurrencyAllow,
+		" Queue ": ConcurrencyQueue,
+		"forbid":  ConcurrencyForbid,
+		"skip":    ConcurrencyForbid,
+	}
+	for input, want := range tests {
+		got, err := ParseConcurrencyPolicy(input)
+		if err != nil {
+			t.Fatalf("parse %q: %v", input, err)
+		}
+		if got != want {
+			t.Fatalf("parse %q: expected %q, got %q", input, want, got)
+		}
+	}
+	if _, err := ParseConcurrencyPolicy("parallel"); err == nil {
+		t.Fatal("expected error for unknown policy")
+	}
+	if got := (&Task{}).EffectiveConcurrencyPolicy(); got != ConcurrencyAllow {
+		t.Fatalf("expected default policy %q, got %q", ConcurrencyAllow, got)
+	}
+}
+
+func TestParseTimezoneAndCronSpec(t *testing.T) {
+	got, err := ParseTimezone(" America/New_York ")
+	if err != nil || got != "America/New_York" {
+		t.Fatalf("expected America/New_York, got %q (%v)", got, err)
+	}
+	if got, err := ParseTimezone(""); err != nil || got != "" {
+		t.Fatalf("expected empty timezone, got %q (%v)", got, err)
+	}
+	for _, bad := range []string{"Mars/Olympus", "Local"} {
+		if _, err := ParseTimezone(bad); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+
+	task := &Task{CronExpr: "0 0 9 * * 1-5", Timezone: "America/New_York"}
+	if got := task.CronSpec(); got != "CRON_TZ=America/New_York 0 0 9 * * 1-5" {
+		t.Fatalf("unexpected cron spec %q", got)
+	}
+	if got := task.Location().String(); got != "America/New_York" {
+		t.Fatalf("unexpected location %q", got)
+	}
+	task.CronExpr = "CRON_TZ=UTC 0 0 9 * * *"
+	if got := task.CronSpec(); got != task.CronExpr {
+		t.Fatalf("expected explicit CRON_TZ to be kept, got %q", got)
+	}
+	if got := (&Task{CronExpr: "0 * * * * *"}).CronSpec(); got != "0 * * * * *" {
+		t.Fatalf("expected expression without zone unchanged, got %q", got)
+	}
+	if (&Task{}).Location() != time.Local {
+		t.Fatal("expected local zone without a timezone")
+	}
+}
+
+func TestParseBudget(t *testing.T) {
+	usdTests := map[string]float64{"": 0, "5": 5, " $2.50 ": 2.5}
+	for input, want := range usdTests {
+		got, err := ParseBudgetUSD(input)
+		if err != nil || got != want {
+			t.Fatalf("parse budget %q: got %v, %v; want %v", input, got, err, want)
+		}
+	}
+	for _, input := range []string{"-1", "five", "NaN"} {
+		if _, err := ParseBudgetUSD(input); err == nil {
+			t.Fatalf("expected error for budget %q", input)
+		}
+	}
+
+	tokenTests := map[string]int64{"": 0, "500000": 500000, "500k": 500000, "1.5M": 1500000}
+	for input, want := range tokenTests {
+		got, err := ParseTokenBudget(input)
+		if err != nil || got != want {
+			t.Fatalf("parse token budget %q: got %v, %v; want %v", input, got, err, want)
+		}
+	}
+	for _, input := range []string{"-5k", "lots", "k"} {
+		if _, err := ParseTokenBudget(input); err == nil {
+			t.Fatalf("expected error for token budget %q", input)
+		}
+	}
+
+	periodTests := map[string]string{"": "", "day": BudgetDay, " Weekly ": BudgetWeek, "monthly": BudgetMonth}
+	for input, want := range periodTests {
+		got, err := ParseBudgetPeriod(input)
+		if err != nil || got != want {
+			t.Fatalf("parse budget period %q: got %q, %v; want %q", input, got, err, want)
+		}
+	}
+	if _, err := ParseBudgetPeriod("hourly"); err == nil {
+		t.Fatal("expected error for unknown budget period")
+	}
+	if got := (&Task{}).EffectiveBudgetPeriod(); got != BudgetMonth {
+		t.Fatalf("expected default budget period %q, got %q", BudgetMonth, got)
+	}
+}
+
+func TestParseUsageLimitPolicy(t *testing.T) {
+	tests := map[string]string{
+		"":                  "",
+		"skip":              UsageLimitSkip,
+		" Defer ":           UsageLimitDefer,
+		"defer_until_reset": UsageLimitDefer,
+		"run_anyway":        UsageLimitRunAnyway,
+	}
+	for input, want := range tests {
+		got, err := ParseUsageLimitPolicy(input)
+		if err != nil {
+			t.Fatalf("parse %q: %v", input, err)
+		}
+		if got != want {
+			t.Fatalf("parse %q: expected %q, got %q", input, want, got)
+		}
+	}
+	if _, err := ParseUsageLimitPolicy("wait"); err == nil {
+		t.Fatal("expected error for unknown policy")
+	}
+	if got := (&Task{}).EffectiveUsageLimitPolicy(); got != UsageLimitSkip {
+		t.Fatalf("expected default policy %q, got %q", UsageLimitSkip, got)
+	}
+}
+
+func TestParsePriority(t *testing.T) {
+	tests := map[string]string{
+		"":         "",
+		"low":      PriorityLow,
+		" Normal ": PriorityNormal,
+		"CRITICAL": PriorityCritical,
+	}
+	for input, want := range tests {
+		got, err := ParsePriority(input)
+		if err != nil {
+			t.Fatalf("parse %q: %v", input, err)
+		}
+		if got != want {
+			t.Fatalf("parse %q: expected %q, got %q", input, want, got)
+		}
+	}
+	if _, err := ParsePriority("urgent"); err == nil {
+		t.Fatal("expected error for unknown priority")
+	}
+	if got := (&Task{}).EffectivePriority(); got != PriorityNormal {
+		t.Fatalf("expected default priority %q, got %q", PriorityNormal, got)
+	}
+}
+
+func TestParseProfile(t *testing.T) {
+	if got, err := ParseProfileName(" Work_2 "); err != nil || got != "work_2" {
+		t.Fatalf("parse profile name: got %q, %v", got, err)
+	}
+	for _, input := range []string{"", "default", "-work", "has space", "this-name-is-far-too-long-to-be-a-profile"} {
+		if _, err := ParseProfileName(input); err == nil {
+			t.Fatalf("expected error for profile name %q", input)
+		}
+	}
+
+	if got, err := ParseConfigDir("/srv/claude/work/"); err != nil || got != "/srv/claude/work" {
+		t.Fatalf("parse config dir: got %q, %v", got, err)
+	}
+	if _, err := ParseConfigDir("relative/dir"); err == nil {
+		t.Fatal("expected error for a relative config dir")
+	}
+
+	priority := UsageThresholds{FiveHour: 95, SevenDay: 60}
+	if got := (&Profile{UsageThreshold: 70}).CapThresholds(priority); got != (UsageThresholds{FiveHour: 70, SevenDay: 60}) {
+		t.Fatalf("expected the profile threshold to cap the priority thresholds, got %+v", got)
+	}
+	var noProfile *Profile
+	if got := noProfile.CapThresholds(priority); got != priority {
+		t.Fatalf("expected the default account to keep the priority thresholds, got %+v", got)
+	}
+}
+
+func TestValidateEnvAndExpandSecretRefs(t *testing.T) {
+	if err := ValidateEnv(map[string]string{"GITHUB_TOKEN": "${secret:GH_TOKEN}", "_LEVEL": "debug"}); err != nil {
+		t.Fatalf("validate env: %v", err)
+	}
+	for _, env := range []map[string]string{
+		{"1BAD": "x"},
+		{"HAS SPACE": "x"},
+		{"TOKEN": "${secret:not valid}"},
+	} {
+		if err := ValidateEnv(env); err == nil {
+			t.Fatalf("expected error for env %v", env)
+		}
+	}
+
+	lookup := func(name string) (string, error) {
+		if name == "PASS" {
+			return "hunter2", nil
+		}
+		return "", fmt.Errorf("no secret %s", name)
+	}
+	got, err := ExpandSecretRefs("postgres://app:${secret:PASS}@db/${secret:PASS}", lookup)
+	if err != nil || got != "postgres://app:hunter2@db/hunter2" {
+		t.Fatalf("expand secret refs: got %q, %v", got, err)
+	}
+	if _, err := ExpandSecretRefs("${secret:MISSING}", lookup); err == nil {
+		t.Fatal("expected error for a missing secret")
+	}
+
+	task := &Task{WorkingDir: "/srv/app", EnvFile: "config/.env"}
+	if got, err := task.ResolveEnvFile(); err != nil || got != "/srv/app/config/.env" {
+		t.Fatalf("resolve env file: got %q, %v", got, err)
+	}
+}
+
+func TestParseToolListAndMaxTurns(t *testing.T) {
+	got, err := ParseToolList(" Read, Bash(git diff:*), Bash(npm run a, b), mcp__github__create_issue ,")
+	if err != nil {
+		t.Fatalf("parse tool list: %v", err)
+	}
+	want := []string{"Read", "Bash(git diff:*)", "Bash(npm run a, b)", "mcp__github__create_issue"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+	if tools, err := ParseToolList(""); err != nil || tools != nil {
+		t.Fatalf("expected no tools for blank input, got %q, %v", tools, err)
+	}
+	for _, bad := range []string{"Bash(unclosed", "has space", "9tool", "Bash(a)(b)"} {
+		if _, err := ParseToolList(bad); err == nil {
+			t.Fatalf("expected error for tool list %q", bad)
+		}
+	}
+
+	if turns, err := ParseMaxTurns(" 25 "); err != nil || turns != 25 {
+		t.Fatalf("parse max turns: got %d, %v", turns, err)
+	}
+	if turns, err := ParseMaxTurns(""); err != nil || turns != 0 {
+		t.Fatalf("expected blank max turns to be unlimited, got %d, %v", turns, err)
+	}
+	for _, bad := range []string{"-1", "1001", "ten"} {
+		if _, err := ParseMaxTurns(bad); err == nil {
+			t.Fatalf("expected error for max turns %q", bad)
+		}
+	}
+}
+
+func TestParseSessionMode(t *testing.T) {
+	for input, want := range map[string]string{
+		"":              "",
+		"fresh":         SessionFresh,
+		" Continue ":    SessionContinueLast,
+		"fork":          SessionForkLast,
+		"continue_last": SessionContinueLast,
+	} {
+		if got, err := ParseSessionMode(input); err != nil || got != want {
+			t.Fatalf("ParseSessionMode(%q) = %q, %v; want %q", input, got, err, want)
+		}
+	}
+	if _, err := ParseSessionMode("resume"); err == nil {
+		t.Fatal("expected error for unknown session mode")
+	}
+
+	task := &Task{}
+	if task.EffectiveSessionMode() != SessionFresh || task.EffectiveMaxSessionRuns() != DefaultMaxSessionRuns {
+		t.Fatalf("unexpected session defaults %q %d", task.EffectiveSessionMode(), task.EffectiveMaxSessionRuns())
+	}
+	if _, err := ParseMaxSessionRuns("1001"); err == nil {
+		t.Fatal("expected error for max session runs above the limit")
+	}
+}
+
+func TestParseIsolationAndWorktreeCleanup(t *testing.T) {
+	if got, err := ParseIsolation(" Worktree "); err != nil || got != IsolationWorktree {
+		t.Fatalf("ParseIsolation = %q, %v", got, err)
+	}
+	if _, err := ParseIsolation("container"); err == nil {
+		t.Fatal("expected error for unknown isolation")
+	}
+	if got, err := ParseWorktreeCleanup("keep_on_failure"); err != nil || got != WorktreeKeepOnFailure {
+		t.Fatalf("ParseWorktreeCleanup = %q, %v", got, err)
+	}
+	if _, err := ParseWorktreeCleanup("never"); err == nil {
+		t.Fatal("expected error for unknown worktree cleanup")
+	}
+
+	task := &Task{}
+	if task.EffectiveIsolation() != IsolationNone || task.EffectiveWorktreeCleanup() != WorktreeRemove {
+		t.Fatalf("unexpected defaults %q %q", task.EffectiveIsolation(), task.EffectiveWorktreeCleanup())
+	}
+	if (&RunWorktree{BaseCommit: "abc", Commit: "abc"}).Changed() {
+		t.Fatal("expected a worktree at its base commit to be unchanged")
+	}
+}
+
+func TestParseHook(t *testing.T) {
+	hook, err := ParseHook(" go test ./... ", "10m")
+	if err != nil || hook.Command != "go test ./..." || hook.EffectiveTimeout() != 10*time.Minute {
+		t.Fatalf("ParseHook = %+v, %v", hook, err)
+	}
+	if hook, err := ParseHook("git pull", ""); err != nil || hook.EffectiveTimeout() != DefaultHookTimeout {
+		t.Fatalf("expected the default timeout, got %+v, %v", hook, err)
+	}
+	for _, bad := range [][2]string{{" ", ""}, {"make", "soon"}} {
+		if _, err := ParseHook(bad[0], bad[1]); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestParseAssertion(t *testing.T) {
+	a, err := ParseAssertion(Assertion{Type: " JSON_Schema ", Schema: []byte("{\n  \"type\": \"object\"\n}")})
+	if err != nil || a.Type != AssertJSONSchema || string(a.Schema) != `{"type":"object"}` || a.String() != "json_schema" {
+		t.Fatalf("ParseAssertion = %+v, %v", a, err)
+	}
+	if a, err := ParseAssertion(Assertion{Type: "not_matches", Pattern: "(?i)error", Path: "ignored"}); err != nil || a.Path != "" || a.String() != `not_matches "(?i)error"` {
+		t.Fatalf("ParseAssertion = %+v, %v", a, err)
+	}
+	for _, bad := range []Assertion{
+		{Type: "contains", Pattern: "x"},
+		{Type: AssertMatches},
+		{Type: AssertMatches, Pattern: "("},
+		{Type: AssertJSONSchema, Schema: []byte(`{"minItems": "two"}`)},
+		{Type: AssertJSONSchema, Schema: []byte(`{"$ref": "#"}`)},
+		{Type: AssertFileExists, Path: "[report"},
+	} {
+		if _, err := ParseAssertion(bad); err == nil {
+			t.Fatalf("expected error for %+v", bad)
+		}
+	}
+
+	run := &TaskRun{Assertions: []AssertionResult{{Assertion: "a", Passed: true}, {Assertion: "b"}}}
+	if failed := run.FailedAssertions(); len(failed) != 1 || failed[0].Assertion != "b" {
+		t.Fatalf("unexpected failed assertions %+v", failed)
+	}
+}
+
+func TestParseSchema(t *testing.T) {
+	for _, empty := range []string{"", "  ", "null"} {
+		if schema, err := ParseSchema([]byte(empty)); err != nil || schema != nil {
+			t.Fatalf("ParseSchema(%q) = %s, %v", empty, schema, err)
+		}
+	}
+	schema, err := ParseSchema([]byte("{\n  \"type\": \"object\",\n  \"required\": [\"ok\"]\n}"))
+	if err != nil || string(schema) != `{"type":"object","required":["ok"]}` {
+		t.Fatalf("ParseSchema = %s, %v", schema, err)
+	}
+	for _, bad := range []string{`{"type": "objekt"}`, `{"type": "object"`, `[]`, `{"$ref": "#"}`, `{"$defs": {"a": {"allOf": [{"$ref": "#/$defs/b"}]}, "b": {"$ref": "#/$defs/a"}}, "$ref": "#/$defs/a"}`} {
+		if _, err := ParseSchema([]byte(bad)); err == nil {
+			t.Fatalf("expected error for %s", bad)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrProfileExists is returned when a profile with the name exists
+	ErrProfileExists = errors.New("profile already exists")
+	// ErrProfileInUse is returned when deleting a profile tasks still use
+	ErrProfileInUse = errors.New("profile is used by tasks")
+)
+
+const profileColumns = `id, name, config_dir, usage_threshold, created_at`
+
+func scanProfile(row rowScanner) (*Profile, error) {
+	p := &Profile{}
+	if err := row.Scan(&p.ID, &p.Name, &p.ConfigDir, &p.UsageThreshold, &p.CreatedAt); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// CreateProfile adds a Claude account profile
+func (db *DB) CreateProfile(profile *Profile) error {
+	profile.CreatedAt = time.Now()
+	result, err := db.conn.Exec(`
+		INSERT INTO profiles (name, config_dir, usage_threshold, created_at) VALUES (?, ?, ?, ?)
+	`, profile.Name, profile.ConfigDir, profile.UsageThreshold, profile.CreatedAt)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return ErrProfileExists
+		}
+		return fmt.Errorf("insert profile: %w", err)
+	}
+	if profile.ID, err = result.LastInsertId(); err != nil {
+		return fmt.Errorf("insert profile: %w", err)
+	}
+	return nil
+}
+
+// GetProfile retrieves a profile by name. Returns sql.ErrNoRows if there is
+// no such profile.
+func (db *DB) GetProfile(name string) (*Profile, error) {
+	return scanProfile(db.conn.QueryRow(`SELECT `+profileColumns+` FROM profiles WHERE name = ?`, name))
+}
+
+// ListProfiles returns every profile by name
+func (db *DB) ListProfiles() ([]*Profile, error) {
+	rows, err := db.conn.Query(`SELECT ` + profileColumns + ` FROM profiles ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("list profiles: %w", err)
+	}
+	defer rows.Close()
+
+	var profiles []*Profile
+	for rows.Next() {
+		p, err := scanProfile(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan profile: %w", err)
+		}
+		profiles = append(profiles, p)
+	}
+	return profiles, rows.Err()
+}
+
+// UpdateProfile changes a profile's config dir and usage threshold. Returns
+// false if there is no profile with its name.
+func (db *DB) UpdateProfile(profile *Profile) (bool, error) {
+	result, err := db.conn.Exec(`UPDATE profiles SET config_dir = ?, usage_threshold = ? WHERE name = ?`,
+		profile.ConfigDir, profile.UsageThreshold, profile.Name)
+	if err != nil {
+		return false, fmt.Errorf("update profile: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("update profile: %w", err)
+	}
+	return n > 0, nil
+}
+
+// DeleteProfile removes a profile no task uses. Returns false if there is
+// no such profile.
+func (db *DB) DeleteProfile(name string) (bool, error) {
+	result, err := db.conn.Exec(`
+		DELETE FROM profiles WHERE name = ? AND NOT EXISTS (SELECT 1 FROM tasks WHERE profile = ?)
+	`, name, name)
+	if err != nil {
+		return false, fmt.Errorf("delete profile: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("delete profile: %w", err)
+	}
+	if n > 0 {
+		return true, nil
+	}
+	if _, err := db.GetProfile(name); errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("get profile: %w", err)
+	}
+	return false, ErrProfileInUse
+}
+
+// GetTaskProfile returns the profile a task runs as, or nil for the default
+// account
+func (db *DB) GetTaskProfile(task *Task) (*Profile, error) {
+	if task.Profile == "" {
+		return nil, nil
+	}
+	profile, err := db.GetProfile(task.Profile)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("profile %q not found", task.Profile)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get profile %q: %w", task.Profile, err)
+	}
+	return profile, nil
+}
@@ -0,0 +1,102 @@
+package db_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ASRagab/claude-tasks/internal/db"
+)
+
+func TestProfilesCreateUpdateAndDelete(t *testing.T) {
+	database := newLeaseTestDB(t)
+
+	work := &db.Profile{Name: "work", ConfigDir: "/home/me/.claude-work", UsageThreshold: 70}
+	if err := database.CreateProfile(work); err != nil {
+		t.Fatalf("create profile: %v", err)
+	}
+	if err := database.CreateProfile(&db.Profile{Name: "personal", ConfigDir: "/home/me/.claude"}); err != nil {
+		t.Fatalf("create profile: %v", err)
+	}
+	if err := database.CreateProfile(&db.Profile{Name: "work", ConfigDir: "/tmp"}); !errors.Is(err, db.ErrProfileExists) {
+		t.Fatalf("expected ErrProfileExists, got %v", err)
+	}
+
+	profiles, err := database.ListProfiles()
+	if err != nil {
+		t.Fatalf("list profiles: %v", err)
+	}
+	if len(profiles) != 2 || profiles[0].Name != "personal" || profiles[1].UsageThreshold != 70 {
+		t.Fatalf("unexpected profiles %+v", profiles)
+	}
+
+	work.ConfigDir = "/srv/claude-work"
+	work.UsageThreshold = 0
+	if updated, err := database.UpdateProfile(work); err != nil || !updated {
+		t.Fatalf("update profile: updated=%v err=%v", updated, err)
+	}
+	got, err := database.GetProfile("work")
+	if err != nil {
+		t.Fatalf("get profile: %v", err)
+	}
+	if got.ConfigDir != "/srv/claude-work" || got.UsageThreshold != 0 {
+		t.Fatalf("unexpected updated profile %+v", got)
+	}
+
+	task := createTriggerTestTask(t, database, "digest")
+	task.Profile = "work"
+	if err := database.UpdateTask(task); err != nil {
+		t.Fatalf("update task: %v", err)
+	}
+	taskProfile, err := database.GetTaskProfile(task)
+	if err != nil || taskProfile == nil || taskProfile.Name != "work" {
+		t.Fatalf("expected the task's profile, got %+v, %v", taskProfile, err)
+	}
+	if _, err := database.DeleteProfile("work"); !errors.Is(err, db.ErrProfileInUse) {
+		t.Fatalf("expected ErrProfileInUse, got %v", err)
+	}
+
+	task.Profile = ""
+	if err := database.UpdateTask(task); err != nil {
+		t.Fatalf("update task: %v", err)
+	}
+	if deleted, err := database.DeleteProfile("work"); err != nil || !deleted {
+		t.Fatalf("delete profile: deleted=%v err=%v", deleted, err)
+	}
+	if deleted, err := database.DeleteProfile("work"); err != nil || deleted {
+		t.Fatalf("expected a second delete to find nothing, got deleted=%v err=%v", deleted, err)
+	}
+	if p, err := database.GetTaskProfile(task); err != nil || p != nil {
+		t.Fatalf("expected no profile for the default account, got %+v, %v", p, err)
+	}
+}
+
+func TestUsageSamplesAreKeptPerProfile(t *testing.T) {
+	database := newLeaseTestDB(t)
+	now := time.Now()
+
+	for _, sample := range []*db.UsageSample{
+		{SampledAt: now, FiveHour: 10},
+		{Profile: "work", SampledAt: now, FiveHour: 80},
+	} {
+		// Samples of different profiles do not throttle each other
+		if stored, err := database.RecordUsageSample(sample); err != nil || !stored {
+			t.Fatalf("record sample: stored=%v err=%v", stored, err)
+		}
+	}
+
+	work, err := database.ListUsageSamples("work", now.Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("list samples: %v", err)
+	}
+	if len(work) != 1 || work[0].FiveHour != 80 || work[0].Profile != "work" {
+		t.Fatalf("unexpected work samples %+v", work)
+	}
+	defaults, err := database.ListUsageSamples("", now.Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("list samples: %v", err)
+	}
+	if len(defaults) != 1 || defaults[0].FiveHour != 10 {
+		t.Fatalf("unexpected default samples %+v", defaults)
+	}
+}
@@ -0,0 +1,28 @@
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/ASRagab/claude-tasks/internal/jsonschema"
+)
+
+// OutputSchemaAssertion names the check of a run's structured output
+// against its task's output schema among the run's assertion results
+const OutputSchemaAssertion = "output_schema"
+
+// ParseSchema validates a JSON Schema and returns it compacted. An empty or
+// null schema is returned as nil.
+func ParseSchema(schema json.RawMessage) (json.RawMessage, error) {
+	if trimmed := bytes.TrimSpace(schema); len(trimmed) == 0 || string(trimmed) == "null" {
+		return nil, nil
+	}
+	if _, err := jsonschema.Parse(schema); err != nil {
+		return nil, err
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, schema); err != nil {
+		return nil, err
+	}
+	return compact.Bytes(), nil
+}
@@ -0,0 +1,64 @@
+package db
+
+import (
+	"fmt"
+	"time"
+)
+
+// usageTotalsColumns sums run usage. Run timestamps are stored as text with
+// their UTC offset, so the queries below compare them through julianday
+// rather than as strings.
+const usageTotalsColumns = `COUNT(*), COALESCE(SUM(cost_usd), 0), COALESCE(SUM(input_tokens), 0), COALESCE(SUM(output_tokens), 0),
+	COALESCE(SUM(cache_creation_tokens), 0), COALESCE(SUM(cache_read_tokens), 0), COALESCE(SUM(num_turns), 0)`
+
+func scanUsageTotals(row rowScanner, dest ...any) (*UsageTotals, error) {
+	totals := &UsageTotals{}
+	dest = append(dest, &totals.Runs, &totals.CostUSD, &totals.InputTokens, &totals.OutputTokens,
+		&totals.CacheCreationTokens, &totals.CacheReadTokens, &totals.NumTurns)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	return totals, nil
+}
+
+// GetUsageTotals sums the usage of every task's runs started at or after
+// since, keyed by task ID. Tasks without runs in that window are absent.
+func (db *DB) GetUsageTotals(since time.Time) (map[int64]*UsageTotals, error) {
+	rows, err := db.conn.Query(`SELECT task_id, `+usageTotalsColumns+` FROM task_runs
+		WHERE julianday(started_at) >= julianday(?) GROUP BY task_id`, since)
+	if err != nil {
+		return nil, fmt.Errorf("query usage totals: %w", err)
+	}
+	defer rows.Close()
+
+	totals := make(map[int64]*UsageTotals)
+	for rows.Next() {
+		var taskID int64
+		taskTotals, err := scanUsageTotals(rows, &taskID)
+		if err != nil {
+			return nil, fmt.Errorf("scan usage totals: %w", err)
+		}
+		totals[taskID] = taskTotals
+	}
+	return totals, rows.Err()
+}
+
+// GetTaskUsageTotals sums the usage of a task's runs started at or after since
+func (db *DB) GetTaskUsageTotals(taskID int64, since time.Time) (*UsageTotals, error) {
+	totals, err := scanUsageTotals(db.conn.QueryRow(`SELECT `+usageTotalsColumns+` FROM task_runs
+		WHERE task_id = ? AND julianday(started_at) >= julianday(?)`, taskID, since))
+	if err != nil {
+		return nil, fmt.Errorf("query task usage totals: %w", err)
+	}
+	return totals, nil
+}
+
+// GetTotalUsageTotals sums the usage of all runs started at or after since
+func (db *DB) GetTotalUsageTotals(since time.Time) (*UsageTotals, error) {
+	totals, err := scanUsageTotals(db.conn.QueryRow(`SELECT `+usageTotalsColumns+` FROM task_runs
+		WHERE julianday(started_at) >= julianday(?)`, since))
+	if err != nil {
+		return nil, fmt.Errorf("query total usage totals: %w", err)
+	}
+	return totals, nil
+}
@@ -0,0 +1,62 @@
+package db_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ASRagab/claude-tasks/internal/db"
+)
+
+func TestUsageTotalsSumRunsInWindow(t *testing.T) {
+	database := newLeaseTestDB(t)
+	first := createTriggerTestTask(t, database, "first")
+	second := createTriggerTestTask(t, database, "second")
+
+	addRun := func(task *db.Task, startedAt time.Time, usage db.RunUsage) {
+		run := &db.TaskRun{TaskID: task.ID, StartedAt: startedAt, Status: db.RunStatusCompleted}
+		if err := database.CreateTaskRun(run); err != nil {
+			t.Fatalf("create run: %v", err)
+		}
+		run.Usage = usage
+		if err := database.UpdateTaskRun(run); err != nil {
+			t.Fatalf("update run: %v", err)
+		}
+	}
+	now := time.Now()
+	// A run stored with a far-east offset reads as more recent when
+	// compared as text
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatalf("load zone: %v", err)
+	}
+	addRun(first, now.Add(-30*time.Hour).In(tokyo), db.RunUsage{CostUSD: 1, InputTokens: 100, OutputTokens: 10, NumTurns: 2})
+	addRun(first, now.Add(-time.Hour), db.RunUsage{CostUSD: 0.25, OutputTokens: 5, CacheReadTokens: 40, NumTurns: 1})
+	addRun(second, now.Add(-time.Minute), db.RunUsage{CostUSD: 0.5})
+
+	all, err := database.GetTaskUsageTotals(first.ID, time.Time{})
+	if err != nil {
+		t.Fatalf("task totals: %v", err)
+	}
+	if all.Runs != 2 || all.CostUSD != 1.25 || all.OutputTokens != 15 || all.TotalInputTokens() != 140 || all.NumTurns != 3 {
+		t.Fatalf("unexpected all-time totals %+v", all)
+	}
+
+	recent, err := database.GetUsageTotals(now.Add(-24 * time.Hour))
+	if err != nil {
+		t.Fatalf("usage totals: %v", err)
+	}
+	if got := recent[first.ID]; got == nil || got.Runs != 1 || got.CostUSD != 0.25 {
+		t.Fatalf("unexpected recent totals for first task %+v", got)
+	}
+	if got := recent[second.ID]; got == nil || got.CostUSD != 0.5 {
+		t.Fatalf("unexpected recent totals for second task %+v", got)
+	}
+
+	none, err := database.GetTaskUsageTotals(first.ID, now)
+	if err != nil {
+		t.Fatalf("empty window: %v", err)
+	}
+	if none.Runs != 0 || none.CostUSD != 0 {
+		t.Fatalf("expected empty totals, got %+v", none)
+	}
+}
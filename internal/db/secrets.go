@@ -0,0 +1,170 @@
+package db
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+)
+
+// EnvSecretKey overrides the key secrets are encrypted with; it holds 32
+// base64-encoded bytes
+const EnvSecretKey = "CLAUDE_TASKS_SECRET_KEY"
+
+// Secret is a named value stored encrypted; listing secrets never returns
+// their values
+type Secret struct {
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SetSecret stores a secret, replacing any previous value of the name
+func (db *DB) SetSecret(name, value string) error {
+	name, err := ParseSecretName(name)
+	if err != nil {
+		return err
+	}
+	aead, err := db.secretCipher(true)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("generate nonce: %w", err)
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(value), []byte(name))
+
+	now := time.Now()
+	_, err = db.conn.Exec(`
+		INSERT INTO secrets (name, value, created_at, updated_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at
+	`, name, sealed, now, now)
+	if err != nil {
+		return fmt.Errorf("store secret %s: %w", name, err)
+	}
+	return nil
+}
+
+// GetSecretValue decrypts a secret. Returns sql.ErrNoRows if there is no
+// such secret.
+func (db *DB) GetSecretValue(name string) (string, error) {
+	var sealed []byte
+	if err := db.conn.QueryRow(`SELECT value FROM secrets WHERE name = ?`, name).Scan(&sealed); err != nil {
+		return "", err
+	}
+	aead, err := db.secretCipher(false)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("secret %s is corrupt", name)
+	}
+	value, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(name))
+	if err != nil {
+		return "", fmt.Errorf("decrypt secret %s (was the secret key changed?): %w", name, err)
+	}
+	return string(value), nil
+}
+
+// SecretExists reports whether a secret with the name is stored
+func (db *DB) SecretExists(name string) (bool, error) {
+	var exists bool
+	if err := db.conn.QueryRow(`SELECT EXISTS (SELECT 1 FROM secrets WHERE name = ?)`, name).Scan(&exists); err != nil {
+		return false, fmt.Errorf("check secret %s: %w", name, err)
+	}
+	return exists, nil
+}
+
+// ListSecrets returns every secret by name, without values
+func (db *DB) ListSecrets() ([]*Secret, error) {
+	rows, err := db.conn.Query(`SELECT name, created_at, updated_at FROM secrets ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("list secrets: %w", err)
+	}
+	defer rows.Close()
+
+	var secrets []*Secret
+	for rows.Next() {
+		secret := &Secret{}
+		if err := rows.Scan(&secret.Name, &secret.CreatedAt, &secret.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("scan secret: %w", err)
+		}
+		secrets = append(secrets, secret)
+	}
+	return secrets, rows.Err()
+}
+
+// DeleteSecret removes a secret and reports whether it existed
+func (db *DB) DeleteSecret(name string) (bool, error) {
+	result, err := db.conn.Exec(`DELETE FROM secrets WHERE name = ?`, name)
+	if err != nil {
+		return false, fmt.Errorf("delete secret %s: %w", name, err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("delete secret %s: %w", name, err)
+	}
+	return deleted > 0, nil
+}
+
+// secretCipher returns the cipher secrets are sealed with. The key comes
+// from EnvSecretKey, or else the secret.key file in the data directory,
+// which is generated when create is set and it does not exist yet.
+func (db *DB) secretCipher(create bool) (cipher.AEAD, error) {
+	key, err := db.secretKey(create)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("secret key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+func (db *DB) secretKey(create bool) ([]byte, error) {
+	if encoded := strings.TrimSpace(os.Getenv(EnvSecretKey)); encoded != "" {
+		return decodeSecretKey(encoded, EnvSecretKey)
+	}
+
+	data, err := os.ReadFile(db.secretKeyPath)
+	if err == nil {
+		return decodeSecretKey(strings.TrimSpace(string(data)), db.secretKeyPath)
+	}
+	if !errors.Is(err, fs.ErrNotExist) || !create {
+		return nil, fmt.Errorf("read secret key: %w", err)
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("generate secret key: %w", err)
+	}
+	f, err := os.OpenFile(db.secretKeyPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if errors.Is(err, fs.ErrExist) {
+		// Another process created it first
+		return db.secretKey(false)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("create secret key: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(base64.StdEncoding.EncodeToString(key) + "\n"); err != nil {
+		return nil, fmt.Errorf("write secret key: %w", err)
+	}
+	return key, nil
+}
+
+func decodeSecretKey(encoded, source string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("secret key from %s must be 32 base64-encoded bytes", source)
+	}
+	return key, nil
+}
@@ -0,0 +1,72 @@
+package db_test
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ASRagab/claude-tasks/internal/db"
+)
+
+func TestSecretsAreStoredEncrypted(t *testing.T) {
+	t.Setenv(db.EnvSecretKey, "")
+	dir := t.TempDir()
+	database, err := db.New(filepath.Join(dir, "tasks.db"))
+	if err != nil {
+		t.Fatalf("create test db: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+
+	if err := database.SetSecret("GH_TOKEN", "ghp_first"); err != nil {
+		t.Fatalf("set secret: %v", err)
+	}
+	if err := database.SetSecret("GH_TOKEN", "ghp_second"); err != nil {
+		t.Fatalf("replace secret: %v", err)
+	}
+	if err := database.SetSecret("bad name", "x"); err == nil {
+		t.Fatal("expected error for an invalid secret name")
+	}
+
+	info, err := os.Stat(filepath.Join(dir, "secret.key"))
+	if err != nil {
+		t.Fatalf("expected a generated secret key: %v", err)
+	}
+	if info.Mode().Perm()&0o077 != 0 {
+		t.Fatalf("expected the secret key to be private, got %v", info.Mode().Perm())
+	}
+	dbFile, err := os.ReadFile(filepath.Join(dir, "tasks.db"))
+	if err != nil {
+		t.Fatalf("read db file: %v", err)
+	}
+	if bytes.Contains(dbFile, []byte("ghp_second")) {
+		t.Fatal("expected the secret value not to be stored in plain text")
+	}
+
+	value, err := database.GetSecretValue("GH_TOKEN")
+	if err != nil || value != "ghp_second" {
+		t.Fatalf("get secret: got %q, %v", value, err)
+	}
+	if _, err := database.GetSecretValue("MISSING"); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected sql.ErrNoRows for a missing secret, got %v", err)
+	}
+	secrets, err := database.ListSecrets()
+	if err != nil || len(secrets) != 1 || secrets[0].Name != "GH_TOKEN" {
+		t.Fatalf("list secrets: %+v, %v", secrets, err)
+	}
+
+	// A different key cannot decrypt the secret
+	t.Setenv(db.EnvSecretKey, "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=")
+	if _, err := database.GetSecretValue("GH_TOKEN"); err == nil {
+		t.Fatal("expected an error decrypting with another key")
+	}
+
+	if deleted, err := database.DeleteSecret("GH_TOKEN"); err != nil || !deleted {
+		t.Fatalf("delete secret: deleted=%v err=%v", deleted, err)
+	}
+	if exists, err := database.SecretExists("GH_TOKEN"); err != nil || exists {
+		t.Fatalf("expected the secret to be gone: exists=%v err=%v", exists, err)
+	}
+}
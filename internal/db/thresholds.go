@@ -0,0 +1,96 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// defaultPriorityThresholds are the usage thresholds of low and critical
+// priority tasks until they are configured. Normal priority defaults to the
+// single usage threshold.
+var defaultPriorityThresholds = map[string]float64{
+	PriorityLow:      60,
+	PriorityCritical: 95,
+}
+
+func usageThresholdSetting(priority, bucket string) string {
+	return "usage_threshold_" + priority + "_" + bucket
+}
+
+// GetUsageThresholds retrieves the five-hour and seven-day usage thresholds
+// of a task priority
+func (db *DB) GetUsageThresholds(priority string) (UsageThresholds, error) {
+	priority, err := ParsePriority(priority)
+	if err != nil {
+		return UsageThresholds{}, err
+	}
+	if priority == "" {
+		priority = PriorityNormal
+	}
+	fallback, ok := defaultPriorityThresholds[priority]
+	if !ok {
+		fallback = db.legacyUsageThreshold()
+	}
+
+	fiveHour, err := db.getThresholdSetting(usageThresholdSetting(priority, "5h"), fallback)
+	if err != nil {
+		return UsageThresholds{}, err
+	}
+	sevenDay, err := db.getThresholdSetting(usageThresholdSetting(priority, "7d"), fallback)
+	if err != nil {
+		return UsageThresholds{}, err
+	}
+	return UsageThresholds{FiveHour: fiveHour, SevenDay: sevenDay}, nil
+}
+
+// GetAllUsageThresholds retrieves the usage thresholds of every priority
+func (db *DB) GetAllUsageThresholds() (map[string]UsageThresholds, error) {
+	all := make(map[string]UsageThresholds, len(Priorities))
+	for _, priority := range Priorities {
+		thresholds, err := db.GetUsageThresholds(priority)
+		if err != nil {
+			return nil, err
+		}
+		all[priority] = thresholds
+	}
+	return all, nil
+}
+
+// SetUsageThresholds sets the five-hour and seven-day usage thresholds of a
+// task priority
+func (db *DB) SetUsageThresholds(priority string, thresholds UsageThresholds) error {
+	priority, err := ParsePriority(priority)
+	if err != nil {
+		return err
+	}
+	if priority == "" {
+		priority = PriorityNormal
+	}
+	if err := thresholds.Validate(); err != nil {
+		return err
+	}
+	if err := db.SetSetting(usageThresholdSetting(priority, "5h"), strconv.FormatFloat(thresholds.FiveHour, 'f', -1, 64)); err != nil {
+		return fmt.Errorf("set %s five-hour threshold: %w", priority, err)
+	}
+	if err := db.SetSetting(usageThresholdSetting(priority, "7d"), strconv.FormatFloat(thresholds.SevenDay, 'f', -1, 64)); err != nil {
+		return fmt.Errorf("set %s seven-day threshold: %w", priority, err)
+	}
+	return nil
+}
+
+func (db *DB) getThresholdSetting(key string, fallback float64) (float64, error) {
+	val, err := db.GetSetting(key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fallback, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("get %s: %w", key, err)
+	}
+	threshold, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse %s %q: %w", key, val, err)
+	}
+	return threshold, nil
+}
@@ -0,0 +1,64 @@
+package db_test
+
+import (
+	"testing"
+
+	"github.com/ASRagab/claude-tasks/internal/db"
+)
+
+func TestUsageThresholdsDefaultByPriority(t *testing.T) {
+	database := newLeaseTestDB(t)
+
+	all, err := database.GetAllUsageThresholds()
+	if err != nil {
+		t.Fatalf("get thresholds: %v", err)
+	}
+	expected := map[string]db.UsageThresholds{
+		db.PriorityLow:      {FiveHour: 60, SevenDay: 60},
+		db.PriorityNormal:   {FiveHour: 80, SevenDay: 80},
+		db.PriorityCritical: {FiveHour: 95, SevenDay: 95},
+	}
+	for priority, want := range expected {
+		if all[priority] != want {
+			t.Fatalf("expected %s thresholds %+v, got %+v", priority, want, all[priority])
+		}
+	}
+	if _, err := database.GetUsageThresholds("urgent"); err == nil {
+		t.Fatal("expected error for unknown priority")
+	}
+}
+
+func TestSetUsageThresholds(t *testing.T) {
+	database := newLeaseTestDB(t)
+
+	// The single threshold sets both windows of normal priority
+	if err := database.SetUsageThreshold(70); err != nil {
+		t.Fatalf("set threshold: %v", err)
+	}
+	if got, _ := database.GetUsageThresholds(db.PriorityNormal); got != (db.UsageThresholds{FiveHour: 70, SevenDay: 70}) {
+		t.Fatalf("unexpected normal thresholds %+v", got)
+	}
+
+	if err := database.SetUsageThresholds(db.PriorityNormal, db.UsageThresholds{FiveHour: 85, SevenDay: 65}); err != nil {
+		t.Fatalf("set normal thresholds: %v", err)
+	}
+	if err := database.SetUsageThresholds(db.PriorityCritical, db.UsageThresholds{FiveHour: 99, SevenDay: 97.5}); err != nil {
+		t.Fatalf("set critical thresholds: %v", err)
+	}
+	if got, _ := database.GetUsageThresholds(""); got != (db.UsageThresholds{FiveHour: 85, SevenDay: 65}) {
+		t.Fatalf("expected empty priority to read normal thresholds, got %+v", got)
+	}
+	if got, _ := database.GetUsageThresholds(db.PriorityCritical); got != (db.UsageThresholds{FiveHour: 99, SevenDay: 97.5}) {
+		t.Fatalf("unexpected critical thresholds %+v", got)
+	}
+	if got, _ := database.GetUsageThresholds(db.PriorityLow); got != (db.UsageThresholds{FiveHour: 60, SevenDay: 60}) {
+		t.Fatalf("expected low thresholds to keep their defaults, got %+v", got)
+	}
+	if threshold, err := database.GetUsageThreshold(); err != nil || threshold != 65 {
+		t.Fatalf("expected the lower normal threshold 65, got %v (err %v)", threshold, err)
+	}
+
+	if err := database.SetUsageThresholds(db.PriorityLow, db.UsageThresholds{FiveHour: 120, SevenDay: 50}); err == nil {
+		t.Fatal("expected error for a threshold over 100")
+	}
+}
@@ -0,0 +1,162 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrTriggerCycle is returned when a trigger would make a task start
+	// itself, directly or through other tasks
+	ErrTriggerCycle = errors.New("trigger would create a cycle")
+	// ErrTriggerExists is returned when the same trigger is already defined
+	ErrTriggerExists = errors.New("trigger already exists")
+)
+
+const taskTriggerSelect = `
+	SELECT tt.id, tt.task_id, t.name, tt.target_task_id, tgt.name, tt.condition, tt.created_at
+	FROM task_triggers tt
+	JOIN tasks t ON t.id = tt.task_id
+	JOIN tasks tgt ON tgt.id = tt.target_task_id`
+
+// CreateTaskTrigger adds a trigger after checking that the task graph stays
+// acyclic
+func (db *DB) CreateTaskTrigger(trigger *TaskTrigger) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("begin trigger transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var exists int
+	err = tx.QueryRow(`
+		SELECT COUNT(*) FROM task_triggers WHERE task_id = ? AND target_task_id = ? AND condition = ?
+	`, trigger.TaskID, trigger.TargetTaskID, trigger.Condition).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("check existing trigger: %w", err)
+	}
+	if exists > 0 {
+		return ErrTriggerExists
+	}
+
+	rows, err := tx.Query(`SELECT task_id, target_task_id FROM task_triggers`)
+	if err != nil {
+		return fmt.Errorf("load triggers: %w", err)
+	}
+	edges := make(map[int64][]int64)
+	for rows.Next() {
+		var from, to int64
+		if err := rows.Scan(&from, &to); err != nil {
+			rows.Close()
+			return fmt.Errorf("load triggers: %w", err)
+		}
+		edges[from] = append(edges[from], to)
+	}
+	if err := rows.Close(); err != nil {
+		return fmt.Errorf("load triggers: %w", err)
+	}
+	if reaches(edges, trigger.TargetTaskID, trigger.TaskID) {
+		return ErrTriggerCycle
+	}
+
+	trigger.CreatedAt = time.Now()
+	result, err := tx.Exec(`
+		INSERT INTO task_triggers (task_id, target_task_id, condition, created_at) VALUES (?, ?, ?, ?)
+	`, trigger.TaskID, trigger.TargetTaskID, trigger.Condition, trigger.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("insert trigger: %w", err)
+	}
+	if trigger.ID, err = result.LastInsertId(); err != nil {
+		return fmt.Errorf("insert trigger: %w", err)
+	}
+	return tx.Commit()
+}
+
+// reaches reports whether to can be reached from from by following edges
+func reaches(edges map[int64][]int64, from, to int64) bool {
+	seen := make(map[int64]bool)
+	stack := []int64{from}
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if id == to {
+			return true
+		}
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		stack = append(stack, edges[id]...)
+	}
+	return false
+}
+
+// ListTaskTriggers returns the triggers fired by a task's runs
+func (db *DB) ListTaskTriggers(taskID int64) ([]*TaskTrigger, error) {
+	return db.queryTaskTriggers(taskTriggerSelect+` WHERE tt.task_id = ? ORDER BY tt.id`, taskID)
+}
+
+// ListTaskTriggersTargeting returns the triggers that start a task
+func (db *DB) ListTaskTriggersTargeting(taskID int64) ([]*TaskTrigger, error) {
+	return db.queryTaskTriggers(taskTriggerSelect+` WHERE tt.target_task_id = ? ORDER BY tt.id`, taskID)
+}
+
+// ListAllTaskTriggers returns every trigger
+func (db *DB) ListAllTaskTriggers() ([]*TaskTrigger, error) {
+	return db.queryTaskTriggers(taskTriggerSelect + ` ORDER BY tt.id`)
+}
+
+func (db *DB) queryTaskTriggers(query string, args ...any) ([]*TaskTrigger, error) {
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query triggers: %w", err)
+	}
+	defer rows.Close()
+
+	var triggers []*TaskTrigger
+	for rows.Next() {
+		tr := &TaskTrigger{}
+		if err := rows.Scan(&tr.ID, &tr.TaskID, &tr.TaskName, &tr.TargetTaskID, &tr.TargetTaskName, &tr.Condition, &tr.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan trigger: %w", err)
+		}
+		triggers = append(triggers, tr)
+	}
+	return triggers, rows.Err()
+}
+
+// DeleteTaskTrigger removes one of a task's triggers. Returns false if the
+// task has no such trigger.
+func (db *DB) DeleteTaskTrigger(taskID, triggerID int64) (bool, error) {
+	result, err := db.conn.Exec(`DELETE FROM task_triggers WHERE id = ? AND task_id = ?`, triggerID, taskID)
+	if err != nil {
+		return false, fmt.Errorf("delete trigger: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("delete trigger: %w", err)
+	}
+	return n > 0, nil
+}
+
+// EnqueueTriggeredRun queues a pending run of an enabled task on behalf of
+// an upstream run. A task keeps at most one pending run, so it returns false
+// when one is already waiting or the task is disabled.
+func (db *DB) EnqueueTriggeredRun(taskID, triggeredByRunID int64) (bool, error) {
+	result, err := db.conn.Exec(`
+		INSERT INTO task_runs (task_id, started_at, status, output, error, session_id, attempt, triggered_by_run_id)
+		SELECT ?, ?, ?, '', '', '', 1, ?
+		WHERE EXISTS (SELECT 1 FROM tasks WHERE id = ? AND enabled = 1)
+			AND NOT EXISTS (SELECT 1 FROM task_runs WHERE task_id = ? AND status = ?)
+	`, taskID, time.Now(), RunStatusPending, triggeredByRunID, taskID, taskID, RunStatusPending)
+	if err != nil {
+		return false, fmt.Errorf("queue triggered run: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("queue triggered run: %w", err)
+	}
+	return n > 0, nil
+}
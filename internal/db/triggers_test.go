@@ -0,0 +1,130 @@
+package db_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ASRagab/claude-tasks/internal/db"
+)
+
+func createTriggerTestTask(t *testing.T, database *db.DB, name string) *db.Task {
+	t.Helper()
+	task := &db.Task{Name: name, Prompt: "hi", CronExpr: "0 0 * * * *", WorkingDir: ".", Enabled: true}
+	if err := database.CreateTask(task); err != nil {
+		t.Fatalf("create task: %v", err)
+	}
+	return task
+}
+
+func TestCreateTaskTriggerRejectsCyclesAndDuplicates(t *testing.T) {
+	database := newLeaseTestDB(t)
+	collect := createTriggerTestTask(t, database, "collect")
+	analyze := createTriggerTestTask(t, database, "analyze")
+	report := createTriggerTestTask(t, database, "report")
+
+	addTrigger := func(from, to *db.Task, condition string) error {
+		return database.CreateTaskTrigger(&db.TaskTrigger{TaskID: from.ID, TargetTaskID: to.ID, Condition: condition})
+	}
+	if err := addTrigger(collect, analyze, db.TriggerOnSuccess); err != nil {
+		t.Fatalf("add collect -> analyze: %v", err)
+	}
+	if err := addTrigger(analyze, report, db.TriggerOnComplete); err != nil {
+		t.Fatalf("add analyze -> report: %v", err)
+	}
+
+	if err := addTrigger(report, collect, db.TriggerOnSuccess); !errors.Is(err, db.ErrTriggerCycle) {
+		t.Fatalf("expected cycle error for report -> collect, got %v", err)
+	}
+	if err := addTrigger(report, report, db.TriggerOnFailure); !errors.Is(err, db.ErrTriggerCycle) {
+		t.Fatalf("expected cycle error for a self trigger, got %v", err)
+	}
+	if err := addTrigger(collect, analyze, db.TriggerOnSuccess); !errors.Is(err, db.ErrTriggerExists) {
+		t.Fatalf("expected duplicate error, got %v", err)
+	}
+	// A second path to the same task is not a cycle
+	if err := addTrigger(collect, report, db.TriggerOnFailure); err != nil {
+		t.Fatalf("add collect -> report: %v", err)
+	}
+
+	outgoing, err := database.ListTaskTriggers(collect.ID)
+	if err != nil {
+		t.Fatalf("list triggers: %v", err)
+	}
+	if len(outgoing) != 2 || outgoing[0].TargetTaskName != "analyze" || outgoing[0].TaskName != "collect" {
+		t.Fatalf("unexpected outgoing triggers: %+v", outgoing)
+	}
+	incoming, err := database.ListTaskTriggersTargeting(report.ID)
+	if err != nil {
+		t.Fatalf("list incoming triggers: %v", err)
+	}
+	if len(incoming) != 2 {
+		t.Fatalf("expected two triggers starting report, got %d", len(incoming))
+	}
+
+	if ok, err := database.DeleteTaskTrigger(analyze.ID, outgoing[0].ID); err != nil || ok {
+		t.Fatalf("expected no delete through another task, got ok=%v err=%v", ok, err)
+	}
+	if ok, err := database.DeleteTaskTrigger(collect.ID, outgoing[0].ID); err != nil || !ok {
+		t.Fatalf("delete trigger: ok=%v err=%v", ok, err)
+	}
+
+	// Deleting a task removes its triggers
+	if err := database.DeleteTask(report.ID); err != nil {
+		t.Fatalf("delete task: %v", err)
+	}
+	all, err := database.ListAllTaskTriggers()
+	if err != nil {
+		t.Fatalf("list all triggers: %v", err)
+	}
+	if len(all) != 0 {
+		t.Fatalf("expected triggers of a deleted task to be removed, got %+v", all)
+	}
+}
+
+func TestEnqueueTriggeredRunKeepsOnePendingRun(t *testing.T) {
+	database := newLeaseTestDB(t)
+	task := createTriggerTestTask(t, database, "analyze")
+
+	if ok, err := database.EnqueueTriggeredRun(task.ID, 7); err != nil || !ok {
+		t.Fatalf("enqueue: ok=%v err=%v", ok, err)
+	}
+	if ok, err := database.EnqueueTriggeredRun(task.ID, 8); err != nil || ok {
+		t.Fatalf("expected second enqueue to coalesce, got ok=%v err=%v", ok, err)
+	}
+
+	run, err := database.ClaimQueuedTaskRun(task.ID, db.RunOwner{ID: "test"})
+	if err != nil || run == nil {
+		t.Fatalf("claim queued run: run=%v err=%v", run, err)
+	}
+	if run.TriggeredByRunID == nil || *run.TriggeredByRunID != 7 {
+		t.Fatalf("expected run triggered by run 7, got %v", run.TriggeredByRunID)
+	}
+
+	if err := database.ToggleTask(task.ID); err != nil {
+		t.Fatalf("disable task: %v", err)
+	}
+	if ok, err := database.EnqueueTriggeredRun(task.ID, 9); err != nil || ok {
+		t.Fatalf("expected disabled task not to be queued, got ok=%v err=%v", ok, err)
+	}
+}
+
+func TestTriggerMatches(t *testing.T) {
+	tests := []struct {
+		condition string
+		status    db.RunStatus
+		want      bool
+	}{
+		{db.TriggerOnSuccess, db.RunStatusCompleted, true},
+		{db.TriggerOnSuccess, db.RunStatusFailed, false},
+		{db.TriggerOnFailure, db.RunStatusTimedOut, true},
+		{db.TriggerOnFailure, db.RunStatusAssertionFailed, true},
+		{db.TriggerOnFailure, db.RunStatusCancelled, false},
+		{db.TriggerOnComplete, db.RunStatusFailed, true},
+		{db.TriggerOnComplete, db.RunStatusSkipped, false},
+	}
+	for _, tt := range tests {
+		if got := db.TriggerMatches(tt.condition, tt.status); got != tt.want {
+			t.Fatalf("TriggerMatches(%s, %s) = %v, want %v", tt.condition, tt.status, got, tt.want)
+		}
+	}
+}
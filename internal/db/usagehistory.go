@@ -0,0 +1,153 @@
+package db
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// UsageSampleInterval is the minimum time between recorded usage
+	// samples; fetches in between are not recorded
+	UsageSampleInterval = time.Minute
+	// UsageSampleRetention is how long usage samples are kept
+	UsageSampleRetention = 30 * 24 * time.Hour
+)
+
+// UsageSample is the utilization of a profile's usage buckets at one point
+// in time
+type UsageSample struct {
+	ID               int64     `json:"id"`
+	Profile          string    `json:"profile,omitempty"` // Empty for the default account
+	SampledAt        time.Time `json:"sampled_at"`
+	FiveHour         float64   `json:"five_hour"`
+	SevenDay         float64   `json:"seven_day"`
+	FiveHourResetsAt string    `json:"five_hour_resets_at,omitempty"`
+	SevenDayResetsAt string    `json:"seven_day_resets_at,omitempty"`
+}
+
+// UsageRun is a run shown against usage history
+type UsageRun struct {
+	RunID     int64      `json:"run_id"`
+	TaskID    int64      `json:"task_id"`
+	TaskName  string     `json:"task_name"`
+	Status    RunStatus  `json:"status"`
+	StartedAt time.Time  `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+	CostUSD   float64    `json:"cost_usd"`
+}
+
+// RecordUsageSample stores a usage sample unless another was recorded for
+// the profile less than UsageSampleInterval earlier, and drops samples older
+// than UsageSampleRetention. Reports whether the sample was stored.
+func (db *DB) RecordUsageSample(sample *UsageSample) (bool, error) {
+	if sample.SampledAt.IsZero() {
+		sample.SampledAt = time.Now()
+	}
+	result, err := db.conn.Exec(`
+		INSERT INTO usage_samples (profile, sampled_at, five_hour, seven_day, five_hour_resets_at, seven_day_resets_at)
+		SELECT ?, ?, ?, ?, ?, ?
+		WHERE NOT EXISTS (SELECT 1 FROM usage_samples WHERE profile = ? AND julianday(sampled_at) > julianday(?))
+	`, sample.Profile, sample.SampledAt, sample.FiveHour, sample.SevenDay, sample.FiveHourResetsAt, sample.SevenDayResetsAt,
+		sample.Profile, sample.SampledAt.Add(-UsageSampleInterval))
+	if err != nil {
+		return false, fmt.Errorf("record usage sample: %w", err)
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("record usage sample: %w", err)
+	}
+	if inserted == 0 {
+		return false, nil
+	}
+	sample.ID, err = result.LastInsertId()
+	if err != nil {
+		return false, fmt.Errorf("record usage sample: %w", err)
+	}
+
+	if _, err := db.conn.Exec(`DELETE FROM usage_samples WHERE julianday(sampled_at) < julianday(?)`,
+		sample.SampledAt.Add(-UsageSampleRetention)); err != nil {
+		return true, fmt.Errorf("prune usage samples: %w", err)
+	}
+	return true, nil
+}
+
+// ListUsageSamples returns a profile's usage samples recorded since the
+// given time, oldest first. The default account's profile is empty.
+func (db *DB) ListUsageSamples(profile string, since time.Time) ([]*UsageSample, error) {
+	rows, err := db.conn.Query(`
+		SELECT id, profile, sampled_at, five_hour, seven_day, five_hour_resets_at, seven_day_resets_at
+		FROM usage_samples
+		WHERE profile = ? AND julianday(sampled_at) >= julianday(?)
+		ORDER BY sampled_at ASC, id ASC
+	`, profile, since)
+	if err != nil {
+		return nil, fmt.Errorf("list usage samples: %w", err)
+	}
+	defer rows.Close()
+
+	var samples []*UsageSample
+	for rows.Next() {
+		sample := &UsageSample{}
+		if err := rows.Scan(&sample.ID, &sample.Profile, &sample.SampledAt, &sample.FiveHour, &sample.SevenDay, &sample.FiveHourResetsAt, &sample.SevenDayResetsAt); err != nil {
+			return nil, fmt.Errorf("scan usage sample: %w", err)
+		}
+		samples = append(samples, sample)
+	}
+	return samples, rows.Err()
+}
+
+// ListUsageRuns returns the runs of a profile's tasks that started since the
+// given time with their task names, oldest first. Runs that never started
+// claude, such as skipped, deferred or still queued runs, are left out.
+func (db *DB) ListUsageRuns(profile string, since time.Time) ([]*UsageRun, error) {
+	rows, err := db.conn.Query(`
+		SELECT r.id, r.task_id, COALESCE(t.name, ''), r.status, r.started_at, r.ended_at, r.cost_usd
+		FROM task_runs r
+		LEFT JOIN tasks t ON t.id = r.task_id
+		WHERE COALESCE(t.profile, '') = ? AND julianday(r.started_at) >= julianday(?) AND r.status NOT IN (?, ?, ?)
+		ORDER BY r.started_at ASC, r.id ASC
+	`, profile, since, RunStatusSkipped, RunStatusDeferred, RunStatusPending)
+	if err != nil {
+		return nil, fmt.Errorf("list usage runs: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []*UsageRun
+	for rows.Next() {
+		run := &UsageRun{}
+		if err := rows.Scan(&run.RunID, &run.TaskID, &run.TaskName, &run.Status, &run.StartedAt, &run.EndedAt, &run.CostUSD); err != nil {
+			return nil, fmt.Errorf("scan usage run: %w", err)
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// ParseUsageRange parses a usage history range such as 6h, 7d or 30d. An
+// empty value selects 7 days; ranges are capped at UsageSampleRetention.
+func ParseUsageRange(value string) (time.Duration, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return 7 * 24 * time.Hour, nil
+	}
+	var d time.Duration
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n > 366 {
+			return 0, fmt.Errorf("invalid range %q (use e.g. 6h, 7d or 30d)", value)
+		}
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return 0, fmt.Errorf("invalid range %q (use e.g. 6h, 7d or 30d)", value)
+		}
+		d = parsed
+	}
+	if d < time.Hour || d > UsageSampleRetention {
+		return 0, fmt.Errorf("range must be between 1h and 30d")
+	}
+	return d, nil
+}
@@ -0,0 +1,94 @@
+package db_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ASRagab/claude-tasks/internal/db"
+)
+
+func TestRecordUsageSampleThrottlesAndPrunes(t *testing.T) {
+	database := newLeaseTestDB(t)
+	now := time.Now()
+
+	old := &db.UsageSample{SampledAt: now.Add(-db.UsageSampleRetention - time.Hour), FiveHour: 10, SevenDay: 5}
+	if stored, err := database.RecordUsageSample(old); err != nil || !stored {
+		t.Fatalf("record old sample: stored=%v err=%v", stored, err)
+	}
+	first := &db.UsageSample{SampledAt: now.Add(-2 * time.Minute), FiveHour: 40, SevenDay: 20}
+	if stored, err := database.RecordUsageSample(first); err != nil || !stored {
+		t.Fatalf("record sample: stored=%v err=%v", stored, err)
+	}
+	// Within the sample interval of the previous one
+	if stored, err := database.RecordUsageSample(&db.UsageSample{SampledAt: now.Add(-90 * time.Second), FiveHour: 41}); err != nil || stored {
+		t.Fatalf("expected a throttled sample, got stored=%v err=%v", stored, err)
+	}
+	if stored, err := database.RecordUsageSample(&db.UsageSample{SampledAt: now, FiveHour: 55, SevenDay: 21, FiveHourResetsAt: "2026-01-01T00:00:00Z"}); err != nil || !stored {
+		t.Fatalf("record sample: stored=%v err=%v", stored, err)
+	}
+
+	samples, err := database.ListUsageSamples("", now.Add(-2*db.UsageSampleRetention))
+	if err != nil {
+		t.Fatalf("list samples: %v", err)
+	}
+	if len(samples) != 2 {
+		t.Fatalf("expected the old sample pruned and two kept, got %d", len(samples))
+	}
+	if samples[0].FiveHour != 40 || samples[1].FiveHour != 55 || samples[1].FiveHourResetsAt != "2026-01-01T00:00:00Z" {
+		t.Fatalf("unexpected samples %+v, %+v", samples[0], samples[1])
+	}
+	if recent, _ := database.ListUsageSamples("", now.Add(-time.Minute)); len(recent) != 1 {
+		t.Fatalf("expected one sample in the last minute, got %d", len(recent))
+	}
+}
+
+func TestListUsageRunsSkipsRunsThatNeverStarted(t *testing.T) {
+	database := newLeaseTestDB(t)
+	task := createTriggerTestTask(t, database, "digest")
+	now := time.Now()
+
+	for _, run := range []*db.TaskRun{
+		{TaskID: task.ID, StartedAt: now.Add(-48 * time.Hour), Status: db.RunStatusCompleted},
+		{TaskID: task.ID, StartedAt: now.Add(-time.Hour), Status: db.RunStatusCompleted},
+		{TaskID: task.ID, StartedAt: now.Add(-30 * time.Minute), Status: db.RunStatusSkipped},
+		{TaskID: task.ID, StartedAt: now.Add(-10 * time.Minute), Status: db.RunStatusFailed},
+	} {
+		if err := database.CreateTaskRun(run); err != nil {
+			t.Fatalf("create run: %v", err)
+		}
+	}
+
+	runs, err := database.ListUsageRuns("", now.Add(-24*time.Hour))
+	if err != nil {
+		t.Fatalf("list usage runs: %v", err)
+	}
+	if len(runs) != 2 || runs[0].Status != db.RunStatusCompleted || runs[1].Status != db.RunStatusFailed {
+		t.Fatalf("expected the completed and failed runs of the last day, got %+v", runs)
+	}
+	if runs[0].TaskName != "digest" {
+		t.Fatalf("expected the task name, got %q", runs[0].TaskName)
+	}
+}
+
+func TestParseUsageRange(t *testing.T) {
+	tests := map[string]time.Duration{
+		"":    7 * 24 * time.Hour,
+		"6h":  6 * time.Hour,
+		"7d":  7 * 24 * time.Hour,
+		"30D": 30 * 24 * time.Hour,
+	}
+	for input, want := range tests {
+		got, err := db.ParseUsageRange(input)
+		if err != nil {
+			t.Fatalf("parse %q: %v", input, err)
+		}
+		if got != want {
+			t.Fatalf("parse %q: expected %s, got %s", input, want, got)
+		}
+	}
+	for _, input := range []string{"week", "30m", "31d", "-1d"} {
+		if _, err := db.ParseUsageRange(input); err == nil {
+			t.Fatalf("expected error for %q", input)
+		}
+	}
+}
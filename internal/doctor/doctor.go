@@ -65,6 +65,9 @@ func (r Runner) Run() Report {
 	if database != nil {
 		defer database.Close()
 		report.add(checkSchedulerLeaseVisibility(database))
+		for _, result := range checkProfileCredentials(database) {
+			report.add(result)
+		}
 	}
 
 	return report
@@ -104,13 +107,42 @@ func (r Runner) checkUsageCredentials() CheckResult {
 			Name:   "usage_credentials",
 			Status: StatusFail,
 			Detail: fmt.Sprintf("usage credentials unavailable: %v", err),
-			Hint:   "Login Claude CLI or set CLAUDE_TASKS_DISABLE_USAGE_CHECK=1",
+			Hint:   "Login Claude CLI, set CLAUDE_TASKS_OAUTH_TOKEN or CLAUDE_TASKS_CREDENTIALS_PATH, or set CLAUDE_TASKS_DISABLE_USAGE_CHECK=1",
 		}
 	}
 
 	return CheckResult{Name: "usage_credentials", Status: StatusPass, Detail: "credentials available"}
 }
 
+// checkProfileCredentials checks that each account profile has credentials
+// for its usage checks
+func checkProfileCredentials(database *db.DB) []CheckResult {
+	profiles, err := database.ListProfiles()
+	if err != nil {
+		return []CheckResult{{Name: "profiles", Status: StatusWarn, Detail: fmt.Sprintf("unable to list profiles: %v", err)}}
+	}
+
+	var results []CheckResult
+	for _, profile := range profiles {
+		name := "profile_credentials:" + profile.Name
+		if isTruthy(os.Getenv("CLAUDE_TASKS_DISABLE_USAGE_CHECK")) {
+			results = append(results, CheckResult{Name: name, Status: StatusPass, Detail: "usage check disabled via CLAUDE_TASKS_DISABLE_USAGE_CHECK"})
+			continue
+		}
+		if _, err := usage.NewClientWithConfig(usage.ConfigForDir(profile.ConfigDir)); err != nil {
+			results = append(results, CheckResult{
+				Name:   name,
+				Status: StatusFail,
+				Detail: fmt.Sprintf("usage credentials unavailable: %v", err),
+				Hint:   fmt.Sprintf("Run CLAUDE_CONFIG_DIR=%s claude and log in", profile.ConfigDir),
+			})
+			continue
+		}
+		results = append(results, CheckResult{Name: name, Status: StatusPass, Detail: "credentials available in " + profile.ConfigDir})
+	}
+	return results
+}
+
 func (r Runner) checkDataDirWritable() CheckResult {
 	if err := os.MkdirAll(r.DataDir, 0o755); err != nil {
 		return CheckResult{
@@ -0,0 +1,104 @@
+package executor
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/ASRagab/claude-tasks/internal/db"
+)
+
+// TaskArgs returns the claude CLI options a task sets that apply to both
+// scheduled runs and resumed sessions: permission mode, model, tools,
+// system prompt, MCP config and extra directories.
+func TaskArgs(task *db.Task) []string {
+	var args []string
+
+	permMode := task.PermissionMode
+	if permMode == "" {
+		permMode = db.DefaultPermissionMode
+	}
+	if permMode == "bypassPermissions" {
+		args = append(args, "--dangerously-skip-permissions")
+	} else if permMode != "default" {
+		args = append(args, "--permission-mode", permMode)
+	}
+
+	if task.Model != "" {
+		args = append(args, "--model", task.Model)
+	}
+	if len(task.AllowedTools) > 0 {
+		args = append(args, "--allowedTools", strings.Join(task.AllowedTools, ","))
+	}
+	if len(task.DisallowedTools) > 0 {
+		args = append(args, "--disallowedTools", strings.Join(task.DisallowedTools, ","))
+	}
+	if task.AppendSystemPrompt != "" {
+		args = append(args, "--append-system-prompt", task.AppendSystemPrompt)
+	}
+	if mcpConfig := task.ResolveMCPConfig(); mcpConfig != "" {
+		args = append(args, "--mcp-config", mcpConfig)
+	}
+	for _, dir := range task.AddDirs {
+		args = append(args, "--add-dir", dir)
+	}
+	return args
+}
+
+// Session is the claude session a run starts in
+type Session struct {
+	// ID is the run's session ID; it equals ResumeID when a session is
+	// continued
+	ID string
+	// ResumeID is the session that is resumed, empty for a new session
+	ResumeID string
+	// Fork resumes a copy of ResumeID under ID, leaving the original as is
+	Fork bool
+}
+
+// RunArgs returns the claude CLI arguments of a scheduled run. The session
+// options follow the task's options, so list options such as --add-dir
+// cannot take the prompt as another value.
+func RunArgs(task *db.Task, session Session, prompt string) []string {
+	args := []string{"-p", "--output-format", "stream-json", "--verbose"}
+	args = append(args, TaskArgs(task)...)
+	if task.MaxTurns > 0 {
+		args = append(args, "--max-turns", strconv.Itoa(task.MaxTurns))
+	}
+	if len(task.OutputSchema) > 0 {
+		args = append(args, "--json-schema", string(task.OutputSchema))
+	}
+	switch {
+	case session.ResumeID == "":
+		args = append(args, "--session-id", session.ID)
+	case session.Fork:
+		args = append(args, "--resume", session.ResumeID, "--fork-session", "--session-id", session.ID)
+	default:
+		args = append(args, "--resume", session.ResumeID)
+	}
+	return append(args, prompt)
+}
+
+// ResumeArgs returns the claude CLI arguments that resume a run's session
+// interactively with the task's options
+func ResumeArgs(task *db.Task, sessionID string) []string {
+	return append(TaskArgs(task), "--resume", sessionID)
+}
+
+// ShellCommand formats a command for a POSIX shell, quoting the words that
+// need it
+func ShellCommand(words ...string) string {
+	quoted := make([]string, len(words))
+	for i, word := range words {
+		quoted[i] = shellQuote(word)
+	}
+	return strings.Join(quoted, " ")
+}
+
+func shellQuote(arg string) string {
+	if arg != "" && strings.IndexFunc(arg, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./:=,@%+", r))
+	}) < 0 {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
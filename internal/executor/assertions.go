@@ -0,0 +1,95 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/ASRagab/claude-tasks/internal/db"
+	"github.com/ASRagab/claude-tasks/internal/jsonschema"
+)
+
+// checkAssertions evaluates the task's assertions for a run claude
+// completed, recording each result on the run. It returns an error listing
+// the assertions that failed.
+func checkAssertions(run *db.TaskRun, assertions []db.Assertion, dir string) error {
+	var failures []string
+	for _, assertion := range assertions {
+		result := db.AssertionResult{Assertion: assertion.String(), Passed: true}
+		if err := checkAssertion(assertion, run.Output, dir); err != nil {
+			result.Passed = false
+			result.Message = err.Error()
+			failures = append(failures, fmt.Sprintf("%s: %s", result.Assertion, result.Message))
+		}
+		run.Assertions = append(run.Assertions, result)
+	}
+	if len(failures) == 0 {
+		return nil
+	}
+	return fmt.Errorf("assertion failed: %s", strings.Join(failures, "\nassertion failed: "))
+}
+
+func checkAssertion(assertion db.Assertion, output, dir string) error {
+	switch assertion.Type {
+	case db.AssertMatches, db.AssertNotMatches:
+		re, err := regexp.Compile(assertion.Pattern)
+		if err != nil {
+			return err
+		}
+		matched := re.MatchString(output)
+		if assertion.Type == db.AssertMatches && !matched {
+			return errors.New("output does not match")
+		}
+		if assertion.Type == db.AssertNotMatches && matched {
+			return fmt.Errorf("output matches at %q", truncateMatch(re.FindString(output)))
+		}
+	case db.AssertJSONSchema:
+		schema, err := jsonschema.Parse(assertion.Schema)
+		if err != nil {
+			return err
+		}
+		return schema.ValidateJSON([]byte(extractJSON(output)))
+	case db.AssertFileExists:
+		pattern := assertion.Path
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return err
+		}
+		if len(matches) == 0 {
+			return errors.New("no such file")
+		}
+	default:
+		return fmt.Errorf("unknown assertion type %q", assertion.Type)
+	}
+	return nil
+}
+
+// extractJSON returns the JSON document in claude's output, which may be
+// wrapped in a fenced code block
+func extractJSON(output string) string {
+	output = strings.TrimSpace(output)
+	if !strings.HasPrefix(output, "```") {
+		return output
+	}
+	// Drop the opening fence with its language tag, and the closing fence
+	if newline := strings.IndexByte(output, '\n'); newline >= 0 {
+		output = output[newline+1:]
+	} else {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(output), "```"))
+}
+
+// truncateMatch shortens a regex match quoted in an assertion failure
+func truncateMatch(match string) string {
+	const maxMatchLen = 80
+	if len(match) > maxMatchLen {
+		return match[:maxMatchLen] + "..."
+	}
+	return match
+}
@@ -0,0 +1,48 @@
+package executor
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ASRagab/claude-tasks/internal/db"
+)
+
+// budgetSkipReason checks the monthly budget shared by all tasks and then
+// the task's own budget. It returns why the run must be skipped, or an empty
+// string if it may start.
+func (e *Executor) budgetSkipReason(task *db.Task, now time.Time) (string, error) {
+	global, err := e.db.GetGlobalBudgetStatus(now)
+	if err != nil {
+		return "", err
+	}
+	if global != nil && global.Exhausted() {
+		return fmt.Sprintf("Monthly budget exhausted: all tasks spent %s. Resets %s",
+			describeBudgetSpend(global), global.ResetsAt.Format(budgetResetLayout)), nil
+	}
+
+	budget, err := e.db.GetTaskBudgetStatus(task, now)
+	if err != nil {
+		return "", err
+	}
+	if budget != nil && budget.Exhausted() {
+		return fmt.Sprintf("Task budget exhausted: spent %s this %s. Resets %s",
+			describeBudgetSpend(budget), budget.Period, budget.ResetsAt.Format(budgetResetLayout)), nil
+	}
+	return "", nil
+}
+
+// budgetResetLayout formats when an exhausted budget resets
+const budgetResetLayout = "Mon Jan 2 15:04 MST"
+
+// describeBudgetSpend renders spending against each cap of a budget
+func describeBudgetSpend(budget *db.BudgetStatus) string {
+	var parts []string
+	if budget.LimitUSD > 0 {
+		parts = append(parts, fmt.Sprintf("$%.2f of $%.2f", budget.Spent.CostUSD, budget.LimitUSD))
+	}
+	if budget.LimitTokens > 0 {
+		parts = append(parts, fmt.Sprintf("%d of %d tokens", budget.Spent.TotalTokens(), budget.LimitTokens))
+	}
+	return strings.Join(parts, " and ")
+}
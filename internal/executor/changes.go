@@ -0,0 +1,187 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ASRagab/claude-tasks/internal/db"
+)
+
+// maxPatchBytes caps the patch stored with a run's changes
+const maxPatchBytes = 256 * 1024
+
+// changeSnapshot is the state of a git working dir before a run, which the
+// run's changes are diffed against
+type changeSnapshot struct {
+	dir   string
+	head  string // Empty in a repository without commits
+	tree  string // The working tree, uncommitted and untracked files included
+	dirty bool
+
+	// scratch holds the index and object store the working tree is written
+	// to, reading the repository's objects as an alternate, so hashing
+	// untracked files does not grow the repository's .git. It is removed
+	// with the snapshot.
+	scratch string
+	env     []string // Points git at scratch
+}
+
+// snapshotChanges records the state of dir before a run. It returns nil
+// when dir is not inside a git work tree. The snapshot must be removed
+// once the run's changes are recorded.
+func snapshotChanges(dir string) (*changeSnapshot, error) {
+	if inside, err := git(dir, nil, "rev-parse", "--is-inside-work-tree"); err != nil || inside != "true" {
+		return nil, nil
+	}
+	objects, err := git(dir, nil, "rev-parse", "--git-path", "objects")
+	if err != nil {
+		return nil, err
+	}
+	if !filepath.IsAbs(objects) {
+		objects = filepath.Join(dir, objects)
+	}
+	scratch, err := os.MkdirTemp("", "claude-tasks-snapshot-")
+	if err == nil {
+		// git expects the object directory to exist
+		if err = os.Mkdir(filepath.Join(scratch, "objects"), 0700); err != nil {
+			os.RemoveAll(scratch)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("create snapshot dir: %w", err)
+	}
+	s := &changeSnapshot{dir: dir, scratch: scratch, env: []string{
+		"GIT_INDEX_FILE=" + filepath.Join(scratch, "index"),
+		"GIT_OBJECT_DIRECTORY=" + filepath.Join(scratch, "objects"),
+		"GIT_ALTERNATE_OBJECT_DIRECTORIES=" + objects,
+	}}
+	if s.tree, err = s.workTree(); err != nil {
+		s.remove()
+		return nil, err
+	}
+	status, err := git(dir, nil, "status", "--porcelain")
+	if err != nil {
+		s.remove()
+		return nil, fmt.Errorf("git status: %w", err)
+	}
+	s.head, s.dirty = headCommit(dir), status != ""
+	return s, nil
+}
+
+// remove deletes the snapshot's scratch index and objects
+func (s *changeSnapshot) remove() {
+	if s != nil {
+		os.RemoveAll(s.scratch)
+	}
+}
+
+// changes diffs the working tree against the snapshot. Secret values are
+// redacted from the patch.
+func (s *changeSnapshot) changes(secrets *redactor) (*db.RunChanges, error) {
+	tree, err := s.workTree()
+	if err != nil {
+		return nil, err
+	}
+	changes := &db.RunChanges{HeadBefore: s.head, HeadAfter: headCommit(s.dir), DirtyBefore: s.dirty, Files: []db.ChangedFile{}}
+	if tree == s.tree {
+		return changes, nil
+	}
+
+	numstat, err := git(s.dir, s.env, "diff", "--no-renames", "--numstat", s.tree, tree)
+	if err != nil {
+		return nil, fmt.Errorf("diff working tree: %w", err)
+	}
+	for _, line := range strings.Split(numstat, "\n") {
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		file := db.ChangedFile{Path: fields[2], Binary: fields[0] == "-"}
+		file.Insertions, _ = strconv.Atoi(fields[0])
+		file.Deletions, _ = strconv.Atoi(fields[1])
+		changes.Files = append(changes.Files, file)
+		changes.Insertions += file.Insertions
+		changes.Deletions += file.Deletions
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), gitTimeout)
+	defer cancel()
+	patch := newCappedBuffer(maxPatchBytes)
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", "diff", "--no-renames", "--no-color", "--no-ext-diff", s.tree, tree)
+	cmd.Dir = s.dir
+	cmd.Env = append(os.Environ(), s.env...)
+	cmd.Stdout = patch
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("git diff: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	changes.Patch = secrets.Redact(patch.buf.String())
+	changes.PatchTruncated = patch.truncated
+	return changes, nil
+}
+
+// recordChanges stores what a run changed since the snapshot and sets it on
+// the run
+func (e *Executor) recordChanges(run *db.TaskRun, snapshot *changeSnapshot, secrets *redactor) error {
+	changes, err := snapshot.changes(secrets)
+	if err != nil {
+		return err
+	}
+	changes.RunID = run.ID
+	if err := e.db.SaveRunChanges(changes); err != nil {
+		return err
+	}
+	run.Changes = changes
+	return nil
+}
+
+// headCommit returns the commit checked out in dir, or empty if there is
+// none yet
+func headCommit(dir string) string {
+	head, err := git(dir, nil, "rev-parse", "--verify", "-q", "HEAD")
+	if err != nil {
+		return ""
+	}
+	return head
+}
+
+// workTree writes the work tree, as `git add -A` would stage it, to a tree
+// object in the scratch store and returns its hash. It stages into a copy
+// of the index, so the repository's own index is left alone.
+func (s *changeSnapshot) workTree() (string, error) {
+	// Starting from the real index spares rehashing unchanged files
+	indexPath, err := git(s.dir, nil, "rev-parse", "--git-path", "index")
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(indexPath) {
+		indexPath = filepath.Join(s.dir, indexPath)
+	}
+	data, err := os.ReadFile(indexPath)
+	if err == nil {
+		err = os.WriteFile(filepath.Join(s.scratch, "index"), data, 0600)
+	} else if errors.Is(err, fs.ErrNotExist) {
+		err = os.Remove(filepath.Join(s.scratch, "index"))
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("copy index: %w", err)
+	}
+
+	if _, err := git(s.dir, s.env, "add", "-A"); err != nil {
+		return "", fmt.Errorf("stage work tree: %w", err)
+	}
+	tree, err := git(s.dir, s.env, "write-tree")
+	if err != nil {
+		return "", fmt.Errorf("write work tree: %w", err)
+	}
+	return tree, nil
+}
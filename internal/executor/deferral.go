@@ -0,0 +1,66 @@
+package executor
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ASRagab/claude-tasks/internal/db"
+	"github.com/ASRagab/claude-tasks/internal/usage"
+)
+
+const (
+	// deferResetSlack is added to a usage reset time so a deferred run
+	// starts once the reset has taken effect
+	deferResetSlack = time.Minute
+	// deferFallbackDelay applies when the reset time is unknown
+	deferFallbackDelay = 15 * time.Minute
+)
+
+// deferDelay returns how long to defer a run until every usage bucket over
+// its threshold has reset
+func deferDelay(usageData *usage.Response, thresholds db.UsageThresholds) time.Duration {
+	wait := usageData.TimeUntilBelow(thresholds.FiveHour, thresholds.SevenDay)
+	if wait <= 0 {
+		return deferFallbackDelay
+	}
+	return wait + deferResetSlack
+}
+
+// deferRun records a run deferred by the task's usage limit policy. The
+// scheduler queues it once its planned time has passed. A task keeps one
+// deferred run; later runs are skipped while it waits.
+func (e *Executor) deferRun(task *db.Task, opts RunOptions, startedAt time.Time, reason string, wait time.Duration) *Result {
+	var runID int64
+	if opts.queuedRun != nil {
+		runID = opts.queuedRun.ID
+	}
+	waiting, err := e.db.HasDeferredTaskRun(task.ID, runID)
+	if err != nil {
+		return e.failPreflight(task, opts, startedAt, fmt.Errorf("failed to defer run: %w", err))
+	}
+	if waiting {
+		return e.skipRun(task, opts, startedAt, reason+". A deferred run of this task is already waiting")
+	}
+
+	deferredUntil := startedAt.Add(wait)
+	run := opts.newRun(task, startedAt, db.RunStatusDeferred)
+	run.DeferredUntil = &deferredUntil
+	run.Error = fmt.Sprintf("%s. Deferred until %s", reason, deferredUntil.Format("2006-01-02 15:04:05"))
+	if err := e.saveRun(run); err != nil {
+		return &Result{Error: fmt.Errorf("failed to create deferred run record: %w", err)}
+	}
+
+	var logErr error
+	if e.logger != nil {
+		logErr = e.logger.WriteRunLog(task, run)
+	}
+
+	return &Result{
+		RunID:      run.ID,
+		Status:     run.Status,
+		Skipped:    true,
+		SkipReason: run.Error,
+		Duration:   time.Since(startedAt),
+		Error:      logErr,
+	}
+}
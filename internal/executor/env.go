@@ -0,0 +1,153 @@
+package executor
+
+import (
+	"bufio"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ASRagab/claude-tasks/internal/db"
+)
+
+// redactedValue replaces secret values in run output, errors and logs
+const redactedValue = "[REDACTED]"
+
+// minRedactedLength is the length below which a value is not redacted;
+// shorter values would mangle unrelated output
+const minRedactedLength = 4
+
+// redactor hides secret values in text; a nil redactor leaves text as is
+type redactor struct {
+	replacer *strings.Replacer
+}
+
+func newRedactor(secrets []string) *redactor {
+	var values []string
+	for _, secret := range secrets {
+		if len(secret) >= minRedactedLength {
+			values = append(values, secret)
+		}
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	// Longer secrets first, so a secret containing another is redacted whole
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+	pairs := make([]string, 0, 2*len(values))
+	for _, value := range values {
+		pairs = append(pairs, value, redactedValue)
+	}
+	return &redactor{replacer: strings.NewReplacer(pairs...)}
+}
+
+// Redact replaces every secret value in text
+func (r *redactor) Redact(text string) string {
+	if r == nil {
+		return text
+	}
+	return r.replacer.Replace(text)
+}
+
+// RedactSecrets replaces the values of a task's secrets, those its env
+// file sets and its env references, in text
+func (e *Executor) RedactSecrets(task *db.Task, text string) (string, error) {
+	_, secrets, err := e.taskEnv(task, nil)
+	if err != nil {
+		return "", err
+	}
+	return secrets.Redact(text), nil
+}
+
+// taskEnv returns the environment claude runs with and a redactor for the
+// secret values in it. The environment is nil, inheriting the executor's,
+// when the task sets nothing. Variables from the env file come first, then
+// the task's own, then the profile's config dir. Values from the env file
+// and referenced secrets are treated as secret.
+func (e *Executor) taskEnv(task *db.Task, profile *db.Profile) ([]string, *redactor, error) {
+	if len(task.Env) == 0 && task.EnvFile == "" && profile == nil {
+		return nil, nil, nil
+	}
+
+	env := os.Environ()
+	var secrets []string
+	if task.EnvFile != "" {
+		path, err := task.ResolveEnvFile()
+		if err != nil {
+			return nil, nil, err
+		}
+		fileEnv, err := readEnvFile(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, kv := range fileEnv {
+			env = append(env, kv[0]+"="+kv[1])
+			secrets = append(secrets, kv[1])
+		}
+	}
+
+	names := make([]string, 0, len(task.Env))
+	for name := range task.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value, err := db.ExpandSecretRefs(task.Env[name], func(secret string) (string, error) {
+			value, err := e.db.GetSecretValue(secret)
+			if errors.Is(err, sql.ErrNoRows) {
+				return "", fmt.Errorf("env %s references unknown secret %q", name, secret)
+			}
+			if err != nil {
+				return "", fmt.Errorf("env %s: %w", name, err)
+			}
+			secrets = append(secrets, value)
+			return value, nil
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		env = append(env, name+"="+value)
+	}
+
+	if profile != nil {
+		env = append(env, "CLAUDE_CONFIG_DIR="+profile.ConfigDir)
+	}
+	return env, newRedactor(secrets), nil
+}
+
+// readEnvFile parses a .env file of KEY=VALUE lines. Blank lines and lines
+// starting with # are skipped, an "export " prefix is allowed and values
+// may be wrapped in single or double quotes.
+func readEnvFile(path string) ([][2]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("read env file: %w", err)
+	}
+	defer f.Close()
+
+	var vars [][2]string
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		name, value, ok := strings.Cut(line, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("env file %s line %d: expected KEY=VALUE", path, lineNo)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		vars = append(vars, [2]string{name, value})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read env file: %w", err)
+	}
+	return vars, nil
+}
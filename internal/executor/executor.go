@@ -8,7 +8,9 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ASRagab/claude-tasks/internal/db"
@@ -23,13 +25,59 @@ type Executor struct {
 	logger            *logger.RunLogger
 	discord           *webhook.Discord
 	slack             *webhook.Slack
-	usageClient       *usage.Client
+	usageClient       *usage.Client // Usage of the default account
 	usageClientErr    error
+	profileUsage      *usage.Profiles // Usage of the account profiles
 	disableUsageCheck bool
+
+	// In-flight runs owned by this executor, keyed by run ID
+	runsMu             sync.Mutex
+	runs               map[int64]context.CancelCauseFunc
+	cancelPollInterval time.Duration
+
+	// Time between SIGTERM and SIGKILL when stopping a run's process group
+	killGrace time.Duration
+
+	// Identity recorded on runs this executor owns, kept alive by heartbeats
+	owner             db.RunOwner
+	heartbeatInterval time.Duration
+	orphanAfter       time.Duration
+
+	// startQueuedRuns starts runs queued by triggers; nil starts them here
+	startQueuedRuns func(taskID int64)
+
+	// worktreeDir holds the git worktrees of runs isolated in one
+	worktreeDir string
 }
 
 const maxCapturedOutputBytes = 256 * 1024
 
+// defaultCancelPollInterval controls how often a running task checks the
+// database for a cancellation request made by another process.
+const defaultCancelPollInterval = time.Second
+
+// defaultKillGrace is how long a stopped run's processes get to exit after
+// SIGTERM before they are killed.
+const defaultKillGrace = 10 * time.Second
+
+const (
+	// defaultHeartbeatInterval controls how often a running task records
+	// that its owner is still alive.
+	defaultHeartbeatInterval = 10 * time.Second
+	// defaultOrphanAfter is how long a run may go without a heartbeat
+	// before it is considered orphaned.
+	defaultOrphanAfter = 6 * defaultHeartbeatInterval
+)
+
+var (
+	// ErrRunCancelled is the cancellation cause for runs stopped on request
+	ErrRunCancelled = errors.New("run cancelled")
+	// ErrRunNotActive is returned when cancelling a run that is not running
+	ErrRunNotActive = errors.New("run is not running")
+	// ErrRunTimedOut is the cancellation cause for runs exceeding their timeout
+	ErrRunTimedOut = errors.New("run timed out")
+)
+
 type cappedBuffer struct {
 	buf       bytes.Buffer
 	limit     int
@@ -83,6 +131,9 @@ func New(database *db.DB, dataDir string) *Executor {
 	if !disableUsageCheck {
 		usageClient, usageClientErr = usage.NewClient()
 	}
+	if usageClient != nil {
+		usageClient.RecordSamples(database, "")
+	}
 
 	return &Executor{
 		db:                database,
@@ -91,17 +142,107 @@ func New(database *db.DB, dataDir string) *Executor {
 		slack:             webhook.NewSlack(),
 		usageClient:       usageClient,
 		usageClientErr:    usageClientErr,
+		profileUsage:      usage.NewProfiles(database),
 		disableUsageCheck: disableUsageCheck,
+		runs:              make(map[int64]context.CancelCauseFunc),
+		killGrace:         defaultKillGrace,
+		owner:             newRunOwner(),
+		heartbeatInterval: defaultHeartbeatInterval,
+		orphanAfter:       defaultOrphanAfter,
+		worktreeDir:       filepath.Join(dataDir, "worktrees"),
+	}
+}
+
+// usageClientFor returns the usage client of a task's profile; a nil
+// profile is the default account
+func (e *Executor) usageClientFor(profile *db.Profile) (*usage.Client, error) {
+	if profile == nil {
+		return e.usageClient, e.usageClientErr
+	}
+	if e.profileUsage == nil {
+		return nil, fmt.Errorf("no usage client for profile %s", profile.Name)
+	}
+	client, err := e.profileUsage.Client(profile)
+	if err != nil {
+		return nil, fmt.Errorf("profile %s: %w", profile.Name, err)
+	}
+	return client, nil
+}
+
+// newRunOwner identifies this executor on the runs it starts
+func newRunOwner() db.RunOwner {
+	host, _ := os.Hostname()
+	pid := os.Getpid()
+	return db.RunOwner{
+		ID:   fmt.Sprintf("executor-%d-%d", pid, time.Now().UnixNano()),
+		Host: host,
+		PID:  pid,
 	}
 }
 
 // Result represents the result of a task execution
 type Result struct {
+	RunID      int64 // Zero when no run record was created
+	Status     db.RunStatus
 	Output     string
 	Error      error
 	Duration   time.Duration
 	Skipped    bool
 	SkipReason string
+	Preflight  bool // The run could not start, before any hook or claude ran
+}
+
+// FailureKind classifies a failed run for the task's retry policy. It
+// returns an empty string for runs that succeeded, were skipped or were
+// cancelled on request.
+func (r *Result) FailureKind() string {
+	if r.Skipped {
+		return ""
+	}
+	if r.Preflight {
+		return db.RetryOnPreflight
+	}
+	switch r.Status {
+	case db.RunStatusTimedOut:
+		return db.RetryOnTimeout
+	case db.RunStatusFailed:
+		return db.RetryOnExitError
+	case db.RunStatusAssertionFailed:
+		return db.RetryOnAssertion
+	}
+	return ""
+}
+
+// RunOptions describe how a run relates to earlier attempts of the same
+// scheduled execution
+type RunOptions struct {
+	Attempt      int        // 1-based; zero means a first attempt
+	ParentRunID  *int64     // The first attempt's run, set for retries
+	ScheduledFor *time.Time // The cron fire time the run is for, if any
+
+	// TriggeredByRunID is the upstream run that queued this one, if any
+	TriggeredByRunID *int64
+
+	// queuedRun is the pending run record being started, if any
+	queuedRun *db.TaskRun
+}
+
+// newRun returns the record for a run, reusing the queued run being started
+func (o RunOptions) newRun(task *db.Task, startedAt time.Time, status db.RunStatus) *db.TaskRun {
+	if o.queuedRun != nil {
+		o.queuedRun.Status = status
+		return o.queuedRun
+	}
+	return &db.TaskRun{
+		TaskID:       task.ID,
+		StartedAt:    startedAt,
+		Status:       status,
+		Attempt:      o.Attempt,
+		ParentRunID:  o.ParentRunID,
+		ScheduledFor: o.ScheduledFor,
+
+		TriggeredByRunID: o.TriggeredByRunID,
+	}
 }
 
 func generateUUID() (string, error) {
@@ -123,20 +264,99 @@ func isTruthy(value string) bool {
 	}
 }
 
-func (e *Executor) failPreflight(task *db.Task, startedAt time.Time, preflightErr error) *Result {
-	endTime := time.Now()
-	run := &db.TaskRun{
-		TaskID:    task.ID,
-		StartedAt: startedAt,
-		EndedAt:   &endTime,
-		Status:    db.RunStatusFailed,
-		Error:     preflightErr.Error(),
+// CancelRun requests cancellation of an in-flight run. The request is
+// persisted so that whichever process owns the run observes it; runs owned
+// by this executor are cancelled immediately.
+func (e *Executor) CancelRun(runID int64) error {
+	requested, err := e.db.RequestTaskRunCancel(runID)
+	if err != nil {
+		return err
+	}
+	if !requested {
+		return ErrRunNotActive
+	}
+
+	e.runsMu.Lock()
+	cancel := e.runs[runID]
+	e.runsMu.Unlock()
+	if cancel != nil {
+		cancel(ErrRunCancelled)
+	}
+	return nil
+}
+
+func (e *Executor) registerRun(runID int64, cancel context.CancelCauseFunc) {
+	e.runsMu.Lock()
+	defer e.runsMu.Unlock()
+	if e.runs == nil {
+		e.runs = make(map[int64]context.CancelCauseFunc)
+	}
+	e.runs[runID] = cancel
+}
+
+func (e *Executor) unregisterRun(runID int64) {
+	e.runsMu.Lock()
+	defer e.runsMu.Unlock()
+	delete(e.runs, runID)
+}
+
+// watchRun polls the database for cancellation requests and refreshes the
+// run's heartbeat until the returned stop function is called.
+func (e *Executor) watchRun(runID int64, cancel context.CancelCauseFunc) (stop func()) {
+	interval := e.cancelPollInterval
+	if interval <= 0 {
+		interval = defaultCancelPollInterval
 	}
+	heartbeatInterval := e.heartbeatInterval
+	if heartbeatInterval <= 0 {
+		heartbeatInterval = defaultHeartbeatInterval
+	}
+
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		heartbeat := time.NewTicker(heartbeatInterval)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-heartbeat.C:
+				_ = e.db.HeartbeatTaskRun(runID)
+			case <-ticker.C:
+				requested, err := e.db.IsTaskRunCancelRequested(runID)
+				if err != nil {
+					continue
+				}
+				if requested {
+					cancel(ErrRunCancelled)
+					return
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-finished
+	}
+}
 
-	if err := e.db.CreateTaskRun(run); err != nil {
+func (e *Executor) failPreflight(task *db.Task, opts RunOptions, startedAt time.Time, preflightErr error) *Result {
+	endTime := time.Now()
+	run := opts.newRun(task, startedAt, db.RunStatusFailed)
+	run.EndedAt = &endTime
+	run.Error = preflightErr.Error()
+
+	if err := e.saveRun(run); err != nil {
 		return &Result{
-			Error:    errors.Join(preflightErr, fmt.Errorf("failed to create preflight run record: %w", err)),
-			Duration: endTime.Sub(startedAt),
+			Status:    db.RunStatusFailed,
+			Error:     errors.Join(preflightErr, fmt.Errorf("failed to create preflight run record: %w", err)),
+			Duration:  endTime.Sub(startedAt),
+			Preflight: true,
 		}
 	}
 
@@ -146,129 +366,345 @@ func (e *Executor) failPreflight(task *db.Task, startedAt time.Time, preflightEr
 	}
 
 	return &Result{
-		Error:    errors.Join(preflightErr, logErr),
-		Duration: endTime.Sub(startedAt),
+		RunID:     run.ID,
+		Status:    run.Status,
+		Error:     errors.Join(preflightErr, logErr),
+		Duration:  endTime.Sub(startedAt),
+		Preflight: true,
+	}
+}
+
+// saveRun persists a finished run record created by RunOptions.newRun
+func (e *Executor) saveRun(run *db.TaskRun) error {
+	if run.ID != 0 {
+		return e.db.UpdateTaskRun(run)
+	}
+	return e.db.CreateTaskRun(run)
+}
+
+// skipRun records a skipped run that was not started because of a
+// preflight check, such as the usage thresholds or a budget
+func (e *Executor) skipRun(task *db.Task, opts RunOptions, startedAt time.Time, skipReason string) *Result {
+	run := opts.newRun(task, startedAt, db.RunStatusSkipped)
+	run.Error = skipReason
+	endTime := time.Now()
+	run.EndedAt = &endTime
+	if err := e.saveRun(run); err != nil {
+		return &Result{Error: fmt.Errorf("failed to create skipped run record: %w", err)}
+	}
+
+	var logErr error
+	if e.logger != nil {
+		logErr = e.logger.WriteRunLog(task, run)
+	}
+
+	return &Result{
+		RunID:      run.ID,
+		Status:     run.Status,
+		Skipped:    true,
+		SkipReason: skipReason,
+		Duration:   time.Since(startedAt),
+		Error:      logErr,
+	}
+}
+
+// skipConcurrent completes a run skipped by the task's concurrency policy
+func (e *Executor) skipConcurrent(task *db.Task, run *db.TaskRun) *Result {
+	var logErr error
+	if e.logger != nil {
+		logErr = e.logger.WriteRunLog(task, run)
+	}
+	return &Result{
+		RunID:      run.ID,
+		Status:     run.Status,
+		Skipped:    true,
+		SkipReason: run.Error,
+		Error:      logErr,
+	}
+}
+
+// StartQueued starts the queued runs of a task one at a time until none are
+// left. Each queued run is claimed through the database, so only one process
+// starts it, and only once no other run of the task is active. done, if not
+// nil, receives the result of every run started.
+func (e *Executor) StartQueued(ctx context.Context, taskID int64, done func(*db.Task, RunOptions, *Result)) error {
+	for {
+		queued, err := e.db.ClaimQueuedTaskRun(taskID, e.owner)
+		if err != nil {
+			return err
+		}
+		if queued == nil {
+			return nil
+		}
+
+		task, err := e.db.GetTask(taskID)
+		if err != nil {
+			endTime := time.Now()
+			queued.Status = db.RunStatusFailed
+			queued.EndedAt = &endTime
+			queued.Error = fmt.Sprintf("Queued run could not start: %v", err)
+			return errors.Join(fmt.Errorf("load task %d for queued run: %w", taskID, err), e.db.UpdateTaskRun(queued))
+		}
+
+		opts := RunOptions{Attempt: queued.Attempt, ParentRunID: queued.ParentRunID, ScheduledFor: queued.ScheduledFor,
+			TriggeredByRunID: queued.TriggeredByRunID, queuedRun: queued}
+		result := e.ExecuteWithOptions(ctx, task, opts)
+		if done != nil {
+			done(task, opts, result)
+		}
 	}
 }
 
 // Execute runs a Claude CLI command for the given task
 func (e *Executor) Execute(ctx context.Context, task *db.Task) *Result {
+	return e.ExecuteWithOptions(ctx, task, RunOptions{})
+}
+
+// ExecuteWithOptions runs a task as a specific attempt of a scheduled
+// execution
+func (e *Executor) ExecuteWithOptions(ctx context.Context, task *db.Task, opts RunOptions) *Result {
 	startTime := time.Now()
 
+	profile, err := e.db.GetTaskProfile(task)
+	if err != nil {
+		return e.failPreflight(task, opts, startTime, err)
+	}
+
 	if !e.disableUsageCheck {
 		// Check usage threshold before running
-		if e.usageClient == nil {
+		usageClient, usageClientErr := e.usageClientFor(profile)
+		if usageClient == nil {
 			preflightErr := fmt.Errorf("usage threshold enforcement unavailable")
-			if e.usageClientErr != nil {
-				preflightErr = fmt.Errorf("usage threshold enforcement unavailable: %w", e.usageClientErr)
+			if usageClientErr != nil {
+				preflightErr = fmt.Errorf("usage threshold enforcement unavailable: %w", usageClientErr)
 			}
-			return e.failPreflight(task, startTime, preflightErr)
+			return e.failPreflight(task, opts, startTime, preflightErr)
 		}
 
-		threshold, thresholdErr := e.db.GetUsageThreshold()
+		thresholds, thresholdErr := e.db.GetUsageThresholds(task.EffectivePriority())
 		if thresholdErr != nil {
-			return e.failPreflight(task, startTime, fmt.Errorf("failed to enforce usage threshold: %w", thresholdErr))
+			return e.failPreflight(task, opts, startTime, fmt.Errorf("failed to enforce usage threshold: %w", thresholdErr))
 		}
+		thresholds = profile.CapThresholds(thresholds)
 
-		ok, usageData, checkErr := e.usageClient.CheckThreshold(threshold)
+		ok, usageData, checkErr := usageClient.CheckThresholds(thresholds.FiveHour, thresholds.SevenDay)
 		if checkErr != nil {
-			return e.failPreflight(task, startTime, fmt.Errorf("failed to enforce usage threshold: %w", checkErr))
+			return e.failPreflight(task, opts, startTime, fmt.Errorf("failed to enforce usage threshold: %w", checkErr))
 		}
 
-		if !ok {
-			// Usage is above threshold, skip the task
-			skipReason := fmt.Sprintf("Usage above threshold (%.0f%%): 5h=%.0f%%, 7d=%.0f%%. Resets in %s",
-				threshold,
+		if !ok && task.EffectiveUsageLimitPolicy() != db.UsageLimitRunAnyway {
+			// Usage is above threshold, skip or defer the task
+			skipReason := fmt.Sprintf("Usage above %s priority threshold (5h %.0f%%, 7d %.0f%%): 5h=%.0f%%, 7d=%.0f%%. Resets in %s",
+				task.EffectivePriority(),
+				thresholds.FiveHour,
+				thresholds.SevenDay,
 				usageData.FiveHour.Utilization,
 				usageData.SevenDay.Utilization,
 				usageData.FormatTimeUntilReset())
-
-			// Create a skipped run record
-			run := &db.TaskRun{
-				TaskID:    task.ID,
-				StartedAt: startTime,
-				Status:    db.RunStatusFailed,
-				Error:     skipReason,
-			}
-			endTime := time.Now()
-			run.EndedAt = &endTime
-			if err := e.db.CreateTaskRun(run); err != nil {
-				return &Result{Error: fmt.Errorf("failed to create skipped run record: %w", err)}
+			if profile != nil {
+				skipReason += fmt.Sprintf(" (profile %s)", profile.Name)
 			}
 
-			var logErr error
-			if e.logger != nil {
-				logErr = e.logger.WriteRunLog(task, run)
-			}
-
-			return &Result{
-				Skipped:    true,
-				SkipReason: skipReason,
-				Duration:   time.Since(startTime),
-				Error:      logErr,
+			if task.EffectiveUsageLimitPolicy() == db.UsageLimitDefer {
+				return e.deferRun(task, opts, startTime, skipReason, deferDelay(usageData, thresholds))
 			}
+			return e.skipRun(task, opts, startTime, skipReason)
 		}
 	}
 
-	// Generate session ID and build CLI args
-	sessionID, err := generateUUID()
+	// Budgets are enforced from recorded run costs, even when the usage
+	// check is disabled
+	skipReason, err := e.budgetSkipReason(task, startTime)
 	if err != nil {
-		return &Result{Error: err}
+		return e.failPreflight(task, opts, startTime, fmt.Errorf("failed to enforce budget: %w", err))
 	}
-	args := []string{"-p"}
-
-	permMode := task.PermissionMode
-	if permMode == "" {
-		permMode = db.DefaultPermissionMode
+	if skipReason != "" {
+		return e.skipRun(task, opts, startTime, skipReason)
 	}
-	if permMode == "bypassPermissions" {
-		args = append(args, "--dangerously-skip-permissions")
-	} else if permMode != "default" {
-		args = append(args, "--permission-mode", permMode)
+
+	renderedPrompt, err := e.renderPrompt(task, opts, startTime)
+	if err != nil {
+		return e.failPreflight(task, opts, startTime, fmt.Errorf("failed to render prompt: %w", err))
 	}
 
-	if task.Model != "" {
-		args = append(args, "--model", task.Model)
+	env, secrets, err := e.taskEnv(task, profile)
+	if err != nil {
+		return e.failPreflight(task, opts, startTime, fmt.Errorf("failed to set up environment: %w", err))
 	}
 
-	args = append(args, "--session-id", sessionID)
-	args = append(args, task.Prompt)
+	// Pick the session and build CLI args. A queued run picks its session
+	// when it starts, since the run it resumes may have only just finished.
+	session, resumed, err := e.runSession(task, opts)
+	if err != nil {
+		return e.failPreflight(task, opts, startTime, err)
+	}
+	args := RunArgs(task, session, renderedPrompt)
 
 	// Create task run record
-	run := &db.TaskRun{
-		TaskID:    task.ID,
-		StartedAt: startTime,
-		Status:    db.RunStatusRunning,
-		SessionID: sessionID,
+	var postRunErrs []error
+	run := opts.newRun(task, startTime, db.RunStatusRunning)
+	setThread(run, session, resumed)
+	run.RenderedPrompt = secrets.Redact(renderedPrompt)
+	if run.ID == 0 {
+		run.Owner = e.owner
+		run.HeartbeatAt = &startTime
+		if err := e.db.StartTaskRun(run, task.EffectiveConcurrencyPolicy()); err != nil {
+			return &Result{Error: fmt.Errorf("failed to create run record: %w", err)}
+		}
+		switch run.Status {
+		case db.RunStatusSkipped:
+			return e.skipConcurrent(task, run)
+		case db.RunStatusPending:
+			// Started by whichever process finishes the active run
+			return &Result{RunID: run.ID, Status: run.Status}
+		}
+	} else if err := e.db.SetTaskRunSession(run); err != nil {
+		// Recorded again when the run finishes
+		postRunErrs = append(postRunErrs, err)
 	}
-	if err := e.db.CreateTaskRun(run); err != nil {
-		return &Result{Error: fmt.Errorf("failed to create run record: %w", err)}
+
+	// An isolated run gets its own worktree and branch, named after the run
+	workDir := task.WorkingDir
+	var wt *worktree
+	if task.EffectiveIsolation() == db.IsolationWorktree {
+		if wt, err = e.createWorktree(task, run); err != nil {
+			// Fail the run record created above
+			opts.queuedRun = run
+			return e.failPreflight(task, opts, startTime, err)
+		}
+		workDir = wt.dir
+		if err := e.db.SetTaskRunWorktree(run); err != nil {
+			postRunErrs = append(postRunErrs, err)
+		}
 	}
 
+	runCtx, cancelRun := context.WithCancelCause(ctx)
+	defer cancelRun(nil)
+	e.registerRun(run.ID, cancelRun)
+	defer e.unregisterRun(run.ID)
+	stopWatch := e.watchRun(run.ID, cancelRun)
+
+	// Pre-hooks run first; the first that fails aborts the run before
+	// claude starts
+	hooksEnv := hookEnv(env, task, run)
+	preHookErr := e.runHooks(runCtx, run, db.HookPre, task.PreHooks, workDir, hooksEnv, secrets)
+
+	// Snapshot a git working dir so what the run changes can be recorded;
+	// taken after the pre-hooks, so a git pull is not counted as the run's
+	var snapshot *changeSnapshot
+	if preHookErr == nil {
+		if snapshot, err = snapshotChanges(workDir); err != nil {
+			postRunErrs = append(postRunErrs, fmt.Errorf("failed to snapshot working dir: %w", err))
+		}
+	}
+	defer snapshot.remove()
+
+	timeout := task.EffectiveTimeout()
+	claudeCtx, cancelTimeout := context.WithTimeoutCause(runCtx, timeout, ErrRunTimedOut)
+	defer cancelTimeout()
+
 	// Build and execute command
-	cmd := exec.CommandContext(ctx, "claude", args...)
-	cmd.Dir = task.WorkingDir
+	cmd := exec.CommandContext(claudeCtx, "claude", args...)
+	cmd.Dir = workDir
+	cmd.Env = env
+	killGrace := e.killGrace
+	if killGrace <= 0 {
+		killGrace = defaultKillGrace
+	}
+	cleanupProcesses := configureProcessGroup(cmd, killGrace)
 
-	stdout := newCappedBuffer(maxCapturedOutputBytes)
+	// Output is persisted in chunks as it streams so it can be followed live
+	stdout := newStreamRecorder(run.ID, e.db.AppendTaskRunChunk)
+	stdout.redactor = secrets
 	stderr := newCappedBuffer(maxCapturedOutputBytes)
 	cmd.Stdout = stdout
 	cmd.Stderr = stderr
 
-	execErr := cmd.Run()
-	endTime := time.Now()
-	duration := endTime.Sub(startTime)
+	var execErr error
+	if preHookErr == nil {
+		execErr = cmd.Run()
+	}
+	cleanupProcesses()
+	streamErr := stdout.Close()
+	duration := time.Since(startTime)
 
 	// Update run record
-	run.EndedAt = &endTime
-	run.Output = stdout.String()
-	if execErr != nil {
+	run.Output = stdout.Output()
+	run.Usage = stdout.Usage()
+	switch {
+	case errors.Is(context.Cause(claudeCtx), ErrRunCancelled):
+		run.Status = db.RunStatusCancelled
+		run.Error = "Run cancelled on request"
+		execErr = ErrRunCancelled
+	case errors.Is(context.Cause(claudeCtx), ErrRunTimedOut):
+		run.Status = db.RunStatusTimedOut
+		run.Error = fmt.Sprintf("Run timed out after %s (timeout %s)",
+			duration.Round(time.Second), db.FormatDuration(timeout))
+		execErr = fmt.Errorf("%w after %s", ErrRunTimedOut, duration.Round(time.Second))
+	case preHookErr != nil:
+		run.Status = db.RunStatusFailed
+		run.Error = preHookErr.Error()
+	case execErr != nil:
 		run.Status = db.RunStatusFailed
-		run.Error = fmt.Sprintf("%s\n%s", execErr.Error(), stderr.String())
-	} else {
+		run.Error = secrets.Redact(fmt.Sprintf("%s\n%s", execErr.Error(), stderr.String()))
+	default:
 		run.Status = db.RunStatusCompleted
 	}
 
-	var postRunErrs []error
+	// The structured result and the assertions check that the output of a
+	// completed run is what the task expects; before the post-hooks, so
+	// they see the final status
+	var assertErr error
+	if run.Status == db.RunStatusCompleted {
+		assertErr = errors.Join(
+			checkResult(run, task.OutputSchema, stdout.StructuredOutput(), secrets),
+			checkAssertions(run, task.Assertions, workDir))
+		if assertErr != nil {
+			run.Status = db.RunStatusAssertionFailed
+			run.Error = assertErr.Error()
+		}
+	}
+
+	if streamErr != nil {
+		postRunErrs = append(postRunErrs, fmt.Errorf("failed to persist streamed output: %w", streamErr))
+	}
+	// Before the post-hooks, so the changes are claude's, and before the
+	// worktree is committed and possibly removed
+	if snapshot != nil {
+		if err := e.recordChanges(run, snapshot, secrets); err != nil {
+			postRunErrs = append(postRunErrs, fmt.Errorf("failed to record changes: %w", err))
+		}
+	}
+
+	// Post-hooks run after claude unless the run was aborted or cancelled;
+	// the first that fails fails the run
+	var postHookErr error
+	if preHookErr == nil && run.Status != db.RunStatusCancelled && len(task.PostHooks) > 0 {
+		postEnv := append(hooksEnv[:len(hooksEnv):len(hooksEnv)], "CLAUDE_TASKS_RUN_STATUS="+string(run.Status))
+		postHookErr = e.runHooks(runCtx, run, db.HookPost, task.PostHooks, workDir, postEnv, secrets)
+		switch {
+		case postHookErr == nil:
+		case errors.Is(context.Cause(runCtx), ErrRunCancelled):
+			run.Status = db.RunStatusCancelled
+			run.Error = "Run cancelled on request"
+			execErr = ErrRunCancelled
+		default:
+			if run.Status == db.RunStatusCompleted {
+				run.Status = db.RunStatusFailed
+			}
+			run.Error = strings.TrimSpace(run.Error + "\n" + postHookErr.Error())
+		}
+	}
+	stopWatch()
+	endTime := time.Now()
+	duration = endTime.Sub(startTime)
+	run.EndedAt = &endTime
+
+	if wt != nil {
+		if err := e.finishWorktree(task, run, wt); err != nil {
+			postRunErrs = append(postRunErrs, fmt.Errorf("failed to finish worktree: %w", err))
+		}
+	}
 	if err := e.db.UpdateTaskRun(run); err != nil {
 		postRunErrs = append(postRunErrs, fmt.Errorf("failed to update run record: %w", err))
 	}
@@ -297,14 +733,34 @@ func (e *Executor) Execute(ctx context.Context, task *db.Task) *Result {
 		}
 	}
 
+	// Queue the tasks this run triggers
+	if err := e.queueDependents(task, run); err != nil {
+		postRunErrs = append(postRunErrs, err)
+	}
+
+	// A failing pre-hook is a failed command, like a failing post-hook, so
+	// it counts as an exit error for retries rather than a preflight failure
 	result := &Result{
-		Output:   stdout.String(),
+		RunID:    run.ID,
+		Status:   run.Status,
+		Output:   run.Output,
 		Duration: duration,
 	}
 
 	var resultErrs []error
-	if execErr != nil {
-		resultErrs = append(resultErrs, fmt.Errorf("%s: %s", execErr.Error(), stderr.String()))
+	if errors.Is(execErr, ErrRunCancelled) || errors.Is(execErr, ErrRunTimedOut) {
+		resultErrs = append(resultErrs, execErr)
+	} else if execErr != nil {
+		resultErrs = append(resultErrs, errors.New(secrets.Redact(fmt.Sprintf("%s: %s", execErr.Error(), stderr.String()))))
+	}
+	if preHookErr != nil && execErr == nil {
+		resultErrs = append(resultErrs, preHookErr)
+	}
+	if assertErr != nil {
+		resultErrs = append(resultErrs, assertErr)
+	}
+	if postHookErr != nil && !errors.Is(execErr, ErrRunCancelled) {
+		resultErrs = append(resultErrs, postHookErr)
 	}
 	resultErrs = append(resultErrs, postRunErrs...)
 	result.Error = errors.Join(resultErrs...)
@@ -312,14 +768,14 @@ func (e *Executor) Execute(ctx context.Context, task *db.Task) *Result {
 	return result
 }
 
-// ExecuteAsync runs a task asynchronously
+// ExecuteAsync runs a task asynchronously. The run is bounded by the task's
+// own timeout. Runs queued behind it are started once it finishes.
 func (e *Executor) ExecuteAsync(task *db.Task) <-chan *Result {
 	ch := make(chan *Result, 1)
 	go func() {
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
-		defer cancel()
-		ch <- e.Execute(ctx, task)
+		ch <- e.Execute(context.Background(), task)
 		close(ch)
+		_ = e.StartQueued(context.Background(), task.ID, nil)
 	}()
 	return ch
 }
@@ -2,16 +2,25 @@ package executor
 
 import (
 	"context"
+	"database/sql"
 	"errors"
+	"fmt"
 	"github.com/ASRagab/claude-tasks/internal/db"
 	"github.com/ASRagab/claude-tasks/internal/logger"
 	"github.com/ASRagab/claude-tasks/internal/testutil"
+	"github.com/ASRagab/claude-tasks/internal/usage"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	osexec "os/exec"
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"slices"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 var uuidRE = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
@@ -107,6 +116,13 @@ func createTaskForExecutorTest(t *testing.T, database *db.DB, workingDir string)
 
 func installFakeClaude(t *testing.T) {
 	t.Helper()
+	installFakeClaudeScript(t, "exit 0")
+}
+
+// installFakeClaudeScript puts a fake claude binary on PATH whose body runs
+// the given shell script on Unix. Windows always gets a no-op batch file.
+func installFakeClaudeScript(t *testing.T, script string) {
+	t.Helper()
 
 	binDir := t.TempDir()
 	originalPath := os.Getenv("PATH")
@@ -121,7 +137,7 @@ func installFakeClaude(t *testing.T) {
 		content = "@echo off\r\nexit /b 0\r\n"
 	} else {
 		binaryName = "claude"
-		content = "#!/bin/sh\nexit 0\n"
+		content = "#!/bin/sh\n" + script + "\n"
 	}
 
 	binaryPath := filepath.Join(binDir, binaryName)
@@ -207,3 +223,1300 @@ func TestExecuteAllowsRunWhenUsageCheckDisabled(t *testing.T) {
 		t.Fatalf("expected failed status, got %s", runs[0].Status)
 	}
 }
+
+func waitForRunningRun(t *testing.T, database *db.DB, taskID int64) *db.TaskRun {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		runs, err := database.GetTaskRuns(taskID, 1)
+		if err != nil {
+			t.Fatalf("get task runs: %v", err)
+		}
+		if len(runs) == 1 && runs[0].Status == db.RunStatusRunning {
+			return runs[0]
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for run to start")
+	return nil
+}
+
+func TestCancelRunStopsInFlightExecution(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake claude script requires a POSIX shell")
+	}
+	t.Setenv("CLAUDE_TASKS_DISABLE_USAGE_CHECK", "1")
+
+	database, dataDir := testutil.NewTestDB(t)
+	task := createTaskForExecutorTest(t, database, t.TempDir())
+	installFakeClaudeScript(t, "exec sleep 30")
+
+	exec := New(database, dataDir)
+	results := make(chan *Result, 1)
+	go func() { results <- exec.Execute(context.Background(), task) }()
+
+	run := waitForRunningRun(t, database, task.ID)
+	if err := exec.CancelRun(run.ID); err != nil {
+		t.Fatalf("cancel run: %v", err)
+	}
+
+	select {
+	case result := <-results:
+		if !errors.Is(result.Error, ErrRunCancelled) {
+			t.Fatalf("expected cancelled error, got %v", result.Error)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("run did not stop after cancellation")
+	}
+
+	stored, err := database.GetTaskRunByID(run.ID)
+	if err != nil {
+		t.Fatalf("get run: %v", err)
+	}
+	if stored.Status != db.RunStatusCancelled {
+		t.Fatalf("expected cancelled status, got %s", stored.Status)
+	}
+
+	if err := exec.CancelRun(run.ID); !errors.Is(err, ErrRunNotActive) {
+		t.Fatalf("expected ErrRunNotActive for finished run, got %v", err)
+	}
+}
+
+func TestCancelRunFromAnotherProcessIsObserved(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake claude script requires a POSIX shell")
+	}
+	t.Setenv("CLAUDE_TASKS_DISABLE_USAGE_CHECK", "1")
+
+	database, dataDir := testutil.NewTestDB(t)
+	task := createTaskForExecutorTest(t, database, t.TempDir())
+	installFakeClaudeScript(t, "exec sleep 30")
+
+	exec := New(database, dataDir)
+	exec.cancelPollInterval = 20 * time.Millisecond
+	results := make(chan *Result, 1)
+	go func() { results <- exec.Execute(context.Background(), task) }()
+
+	run := waitForRunningRun(t, database, task.ID)
+	// Simulate the CLI or a separate daemon: only the database flag is set.
+	requested, err := database.RequestTaskRunCancel(run.ID)
+	if err != nil {
+		t.Fatalf("request cancel: %v", err)
+	}
+	if !requested {
+		t.Fatalf("expected cancellation request to be recorded")
+	}
+
+	select {
+	case result := <-results:
+		if !errors.Is(result.Error, ErrRunCancelled) {
+			t.Fatalf("expected cancelled error, got %v", result.Error)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("run did not observe database cancellation request")
+	}
+}
+
+func TestStreamRecorderPersistsEventsAcrossPartialWrites(t *testing.T) {
+	var chunks []*db.TaskRunChunk
+	recorder := newStreamRecorder(7, func(chunk *db.TaskRunChunk) error {
+		chunks = append(chunks, chunk)
+		return nil
+	})
+
+	stream := strings.Join([]string{
+		`{"type":"system","subtype":"init","session_id":"abc"}`,
+		`{"type":"assistant","message":{"content":[{"type":"text","text":"Looking at the repo"},{"type":"tool_use","name":"Bash","input":{"command":"ls"}}]}}`,
+		`{"type":"user","message":{"content":[{"type":"tool_result","content":[{"type":"text","text":"README.md"}]}]}}`,
+		`not json`,
+		`{"type":"result","subtype":"success","is_error":false,"result":"All done"}`,
+	}, "\n") + "\n"
+
+	// Split writes mid-line to exercise line buffering
+	for i := 0; i < len(stream); i += 17 {
+		end := i + 17
+		if end > len(stream) {
+			end = len(stream)
+		}
+		if _, err := recorder.Write([]byte(stream[i:end])); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	wantKinds := []db.RunChunkKind{db.RunChunkText, db.RunChunkToolUse, db.RunChunkToolResult, db.RunChunkText, db.RunChunkResult}
+	if len(chunks) != len(wantKinds) {
+		t.Fatalf("expected %d chunks, got %d", len(wantKinds), len(chunks))
+	}
+	for i, chunk := range chunks {
+		if chunk.Kind != wantKinds[i] {
+			t.Fatalf("chunk %d: expected kind %s, got %s", i, wantKinds[i], chunk.Kind)
+		}
+		if chunk.Seq != int64(i+1) || chunk.RunID != 7 {
+			t.Fatalf("chunk %d: unexpected seq/run %d/%d", i, chunk.Seq, chunk.RunID)
+		}
+	}
+	if chunks[1].Content != `Bash {"command":"ls"}` {
+		t.Fatalf("unexpected tool use summary %q", chunks[1].Content)
+	}
+	if chunks[2].Content != "README.md" {
+		t.Fatalf("unexpected tool result %q", chunks[2].Content)
+	}
+	if recorder.Output() != "All done" {
+		t.Fatalf("expected result text as output, got %q", recorder.Output())
+	}
+}
+
+func TestStreamRecorderFallsBackToTextWithoutResult(t *testing.T) {
+	recorder := newStreamRecorder(1, nil)
+	_, _ = recorder.Write([]byte("plain output\nsecond line"))
+	if err := recorder.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if got := recorder.Output(); got != "plain output\nsecond line" {
+		t.Fatalf("unexpected fallback output %q", got)
+	}
+}
+
+func TestExecuteStreamsOutputChunks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake claude script requires a POSIX shell")
+	}
+	t.Setenv("CLAUDE_TASKS_DISABLE_USAGE_CHECK", "1")
+
+	database, dataDir := testutil.NewTestDB(t)
+	task := createTaskForExecutorTest(t, database, t.TempDir())
+	installFakeClaudeScript(t, `echo '{"type":"assistant","message":{"content":[{"type":"text","text":"working"}]}}'
+echo '{"type":"result","subtype":"success","is_error":false,"result":"finished"}'`)
+
+	result := New(database, dataDir).Execute(context.Background(), task)
+	if result.Error != nil {
+		t.Fatalf("execute: %v", result.Error)
+	}
+	if result.Output != "finished" {
+		t.Fatalf("expected result output, got %q", result.Output)
+	}
+
+	runs, err := database.GetTaskRuns(task.ID, 1)
+	if err != nil || len(runs) != 1 {
+		t.Fatalf("get runs: %v (%d)", err, len(runs))
+	}
+	chunks, err := database.GetTaskRunChunks(runs[0].ID, 0, 10)
+	if err != nil {
+		t.Fatalf("get chunks: %v", err)
+	}
+	if len(chunks) != 2 || chunks[0].Content != "working" || chunks[1].Kind != db.RunChunkResult {
+		t.Fatalf("unexpected chunks: %+v", chunks)
+	}
+}
+
+func TestExecuteTimesOutAndKillsProcessGroup(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("process groups are not supported on windows")
+	}
+	t.Setenv("CLAUDE_TASKS_DISABLE_USAGE_CHECK", "1")
+
+	database, dataDir := testutil.NewTestDB(t)
+	task := createTaskForExecutorTest(t, database, t.TempDir())
+	task.Timeout = 300 * time.Millisecond
+	// The background child keeps stdout open, so the run only finishes
+	// promptly if the whole process group is signalled.
+	installFakeClaudeScript(t, "sleep 30 &\nwait")
+
+	exec := New(database, dataDir)
+	exec.killGrace = 5 * time.Second
+
+	start := time.Now()
+	result := exec.Execute(context.Background(), task)
+	elapsed := time.Since(start)
+
+	if !errors.Is(result.Error, ErrRunTimedOut) {
+		t.Fatalf("expected timeout error, got %v", result.Error)
+	}
+	if elapsed > 3*time.Second {
+		t.Fatalf("expected process group to stop on SIGTERM, took %s", elapsed)
+	}
+
+	runs, err := database.GetTaskRuns(task.ID, 1)
+	if err != nil || len(runs) != 1 {
+		t.Fatalf("get runs: %v (%d)", err, len(runs))
+	}
+	if runs[0].Status != db.RunStatusTimedOut {
+		t.Fatalf("expected timed_out status, got %s", runs[0].Status)
+	}
+	if !strings.Contains(runs[0].Error, "timed out after") {
+		t.Fatalf("expected elapsed time in run error, got %q", runs[0].Error)
+	}
+}
+
+func TestResultFailureKind(t *testing.T) {
+	tests := []struct {
+		name   string
+		result Result
+		want   string
+	}{
+		{name: "completed", result: Result{Status: db.RunStatusCompleted}},
+		{name: "exit error", result: Result{Status: db.RunStatusFailed}, want: db.RetryOnExitError},
+		{name: "timed out", result: Result{Status: db.RunStatusTimedOut}, want: db.RetryOnTimeout},
+		{name: "assertion failed", result: Result{Status: db.RunStatusAssertionFailed}, want: db.RetryOnAssertion},
+		{name: "preflight", result: Result{Status: db.RunStatusFailed, Preflight: true}, want: db.RetryOnPreflight},
+		{name: "cancelled", result: Result{Status: db.RunStatusCancelled}},
+		{name: "skipped", result: Result{Status: db.RunStatusFailed, Skipped: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.result.FailureKind(); got != tt.want {
+				t.Fatalf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestQueuePolicyRunsOnePendingRunAfterActiveRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake claude script requires a POSIX shell")
+	}
+	t.Setenv("CLAUDE_TASKS_DISABLE_USAGE_CHECK", "1")
+
+	database, dataDir := testutil.NewTestDB(t)
+	task := createTaskForExecutorTest(t, database, t.TempDir())
+	task.ConcurrencyPolicy = db.ConcurrencyQueue
+	if err := database.UpdateTask(task); err != nil {
+		t.Fatalf("update task: %v", err)
+	}
+	release := filepath.Join(t.TempDir(), "release")
+	installFakeClaudeScript(t, fmt.Sprintf("while [ ! -f %q ]; do sleep 0.05; done", release))
+
+	exec := New(database, dataDir)
+	results := make(chan *Result, 1)
+	go func() { results <- exec.Execute(context.Background(), task) }()
+	active := waitForRunningRun(t, database, task.ID)
+
+	queued := exec.Execute(context.Background(), task)
+	if queued.Status != db.RunStatusPending || queued.RunID == 0 {
+		t.Fatalf("expected a queued run, got status %q", queued.Status)
+	}
+	skipped := exec.Execute(context.Background(), task)
+	if !skipped.Skipped || skipped.Status != db.RunStatusSkipped {
+		t.Fatalf("expected the second overlapping run to be skipped, got status %q", skipped.Status)
+	}
+
+	if err := os.WriteFile(release, nil, 0o644); err != nil {
+		t.Fatalf("release fake claude: %v", err)
+	}
+	select {
+	case result := <-results:
+		if result.RunID != active.ID || result.Status != db.RunStatusCompleted {
+			t.Fatalf("unexpected active run result: run %d status %q err %v", result.RunID, result.Status, result.Error)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("active run did not finish")
+	}
+
+	var started []*Result
+	err := exec.StartQueued(context.Background(), task.ID, func(_ *db.Task, _ RunOptions, result *Result) {
+		started = append(started, result)
+	})
+	if err != nil {
+		t.Fatalf("start queued runs: %v", err)
+	}
+	if len(started) != 1 || started[0].RunID != queued.RunID || started[0].Status != db.RunStatusCompleted {
+		t.Fatalf("expected queued run %d to complete, got %+v", queued.RunID, started)
+	}
+}
+
+func TestReconcileOrphanedRuns(t *testing.T) {
+	database, dataDir := testutil.NewTestDB(t)
+	task := createTaskForExecutorTest(t, database, t.TempDir())
+	exec := New(database, dataDir)
+	exec.orphanAfter = time.Minute
+
+	// The PID of a process that has already exited
+	exited := osexec.Command(os.Args[0], "-test.run=^$")
+	if err := exited.Run(); err != nil {
+		t.Fatalf("run short-lived process: %v", err)
+	}
+	done := exited.Process.Pid
+
+	now := time.Now()
+	old := now.Add(-5 * time.Minute)
+	createRun := func(owner db.RunOwner, heartbeat time.Time) *db.TaskRun {
+		t.Helper()
+		run := &db.TaskRun{TaskID: task.ID, StartedAt: old, Status: db.RunStatusRunning, Owner: owner, HeartbeatAt: &heartbeat}
+		if err := database.CreateTaskRun(run); err != nil {
+			t.Fatalf("create run: %v", err)
+		}
+		return run
+	}
+
+	host := exec.owner.Host
+	deadOwner := createRun(db.RunOwner{ID: "dead", Host: host, PID: done}, now)
+	silent := createRun(db.RunOwner{ID: "silent", Host: "elsewhere", PID: 1}, old)
+	alive := createRun(db.RunOwner{ID: "alive", Host: "elsewhere", PID: 1}, now)
+	own := createRun(exec.owner, old)
+
+	orphaned, err := exec.ReconcileOrphanedRuns()
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	got := map[int64]bool{}
+	for _, run := range orphaned {
+		got[run.ID] = true
+	}
+	if len(orphaned) != 2 || !got[deadOwner.ID] || !got[silent.ID] {
+		t.Fatalf("expected runs %d and %d to be orphaned, got %v", deadOwner.ID, silent.ID, got)
+	}
+
+	for _, run := range []*db.TaskRun{alive, own} {
+		stored, err := database.GetTaskRunByID(run.ID)
+		if err != nil {
+			t.Fatalf("get run: %v", err)
+		}
+		if stored.Status != db.RunStatusRunning {
+			t.Fatalf("expected run %d to keep running, got %s", run.ID, stored.Status)
+		}
+	}
+}
+
+func TestSuccessfulRunQueuesTriggeredTask(t *testing.T) {
+	t.Setenv("CLAUDE_TASKS_DISABLE_USAGE_CHECK", "1")
+	installFakeClaude(t)
+
+	database, dataDir := testutil.NewTestDB(t)
+	upstream := createTaskForExecutorTest(t, database, t.TempDir())
+	onSuccess := createTaskForExecutorTest(t, database, t.TempDir())
+	onFailure := createTaskForExecutorTest(t, database, t.TempDir())
+	for target, condition := range map[*db.Task]string{onSuccess: db.TriggerOnSuccess, onFailure: db.TriggerOnFailure} {
+		trigger := &db.TaskTrigger{TaskID: upstream.ID, TargetTaskID: target.ID, Condition: condition}
+		if err := database.CreateTaskTrigger(trigger); err != nil {
+			t.Fatalf("create trigger: %v", err)
+		}
+	}
+
+	exec := New(database, dataDir)
+	started := make(chan int64, 2)
+	exec.SetQueuedRunStarter(func(taskID int64) { started <- taskID })
+
+	result := exec.Execute(context.Background(), upstream)
+	if result.Status != db.RunStatusCompleted {
+		t.Fatalf("expected upstream run to complete, got %q: %v", result.Status, result.Error)
+	}
+
+	select {
+	case taskID := <-started:
+		if taskID != onSuccess.ID {
+			t.Fatalf("expected task %d to be started, got %d", onSuccess.ID, taskID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("triggered task was not started")
+	}
+	select {
+	case taskID := <-started:
+		t.Fatalf("unexpected start of task %d", taskID)
+	default:
+	}
+
+	var runs []*Result
+	if err := exec.StartQueued(context.Background(), onSuccess.ID, func(_ *db.Task, _ RunOptions, result *Result) {
+		runs = append(runs, result)
+	}); err != nil {
+		t.Fatalf("start queued runs: %v", err)
+	}
+	if len(runs) != 1 || runs[0].Status != db.RunStatusCompleted {
+		t.Fatalf("expected the triggered run to complete, got %+v", runs)
+	}
+	run, err := database.GetTaskRun(onSuccess.ID, runs[0].RunID)
+	if err != nil {
+		t.Fatalf("get triggered run: %v", err)
+	}
+	if run.TriggeredByRunID == nil || *run.TriggeredByRunID != result.RunID {
+		t.Fatalf("expected run triggered by %d, got %v", result.RunID, run.TriggeredByRunID)
+	}
+}
+
+func TestExecuteRendersPromptTemplate(t *testing.T) {
+	t.Setenv("CLAUDE_TASKS_DISABLE_USAGE_CHECK", "1")
+	installFakeClaude(t)
+
+	database, dataDir := testutil.NewTestDB(t)
+	task := createTaskForExecutorTest(t, database, t.TempDir())
+	task.Prompt = "Review {{.Vars.repo}} (last run: {{.LastRun.Status | default \"none\"}})"
+	task.PromptVars = map[string]string{"repo": "api"}
+	if err := database.UpdateTask(task); err != nil {
+		t.Fatalf("update task: %v", err)
+	}
+
+	exec := New(database, dataDir)
+	first := exec.Execute(context.Background(), task)
+	second := exec.Execute(context.Background(), task)
+	if first.Status != db.RunStatusCompleted || second.Status != db.RunStatusCompleted {
+		t.Fatalf("expected both runs to complete, got %q and %q", first.Status, second.Status)
+	}
+
+	for runID, want := range map[int64]string{
+		first.RunID:  "Review api (last run: none)",
+		second.RunID: "Review api (last run: completed)",
+	} {
+		run, err := database.GetTaskRun(task.ID, runID)
+		if err != nil {
+			t.Fatalf("get run: %v", err)
+		}
+		if run.RenderedPrompt != want {
+			t.Fatalf("run %d rendered %q, want %q", runID, run.RenderedPrompt, want)
+		}
+	}
+
+	task.Prompt = "Review {{.Vars.branch}}"
+	result := exec.Execute(context.Background(), task)
+	if !result.Preflight || result.Status != db.RunStatusFailed {
+		t.Fatalf("expected a template error to fail the run before start, got status %q", result.Status)
+	}
+}
+
+func TestExecuteRecordsRunUsage(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake claude script requires a POSIX shell")
+	}
+	t.Setenv("CLAUDE_TASKS_DISABLE_USAGE_CHECK", "1")
+
+	database, dataDir := testutil.NewTestDB(t)
+	task := createTaskForExecutorTest(t, database, t.TempDir())
+	installFakeClaudeScript(t, `echo '{"type":"system","subtype":"init","model":"claude-sonnet-4-5"}'
+echo '{"type":"result","subtype":"success","is_error":false,"result":"done","num_turns":3,"total_cost_usd":0.0421,"usage":{"input_tokens":12,"output_tokens":340,"cache_creation_input_tokens":1500,"cache_read_input_tokens":9000}}'`)
+
+	result := New(database, dataDir).Execute(context.Background(), task)
+	if result.Error != nil {
+		t.Fatalf("execute: %v", result.Error)
+	}
+
+	run, err := database.GetTaskRun(task.ID, result.RunID)
+	if err != nil {
+		t.Fatalf("get run: %v", err)
+	}
+	want := db.RunUsage{
+		Model:               "claude-sonnet-4-5",
+		CostUSD:             0.0421,
+		InputTokens:         12,
+		OutputTokens:        340,
+		CacheCreationTokens: 1500,
+		CacheReadTokens:     9000,
+		NumTurns:            3,
+	}
+	if run.Usage != want {
+		t.Fatalf("unexpected usage %+v, want %+v", run.Usage, want)
+	}
+}
+
+func TestExecuteSkipsWhenBudgetExhausted(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake claude script requires a POSIX shell")
+	}
+	t.Setenv("CLAUDE_TASKS_DISABLE_USAGE_CHECK", "1")
+
+	database, dataDir := testutil.NewTestDB(t)
+	task := createTaskForExecutorTest(t, database, t.TempDir())
+	marker := filepath.Join(t.TempDir(), "ran")
+	installFakeClaudeScript(t, "touch "+marker)
+
+	spent := &db.TaskRun{TaskID: task.ID, StartedAt: time.Now(), Status: db.RunStatusCompleted}
+	if err := database.CreateTaskRun(spent); err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+	spent.Usage.CostUSD = 2
+	if err := database.UpdateTaskRun(spent); err != nil {
+		t.Fatalf("update run: %v", err)
+	}
+
+	task.BudgetUSD = 2
+	task.BudgetPeriod = db.BudgetDay
+	exec := New(database, dataDir)
+	result := exec.Execute(context.Background(), task)
+	if result.Error != nil || !result.Skipped || result.Status != db.RunStatusSkipped {
+		t.Fatalf("expected a skipped run, got %+v", result)
+	}
+	if !strings.Contains(result.SkipReason, "Task budget exhausted: spent $2.00 of $2.00 this day") {
+		t.Fatalf("unexpected skip reason %q", result.SkipReason)
+	}
+	run, err := database.GetTaskRun(task.ID, result.RunID)
+	if err != nil {
+		t.Fatalf("get run: %v", err)
+	}
+	if run.Status != db.RunStatusSkipped || run.Error != result.SkipReason || run.EndedAt == nil {
+		t.Fatalf("unexpected skipped run %+v", run)
+	}
+
+	// The monthly budget applies to tasks without one of their own
+	task.BudgetUSD = 0
+	if err := database.SetMonthlyBudget(1); err != nil {
+		t.Fatalf("set monthly budget: %v", err)
+	}
+	result = exec.Execute(context.Background(), task)
+	if !result.Skipped || !strings.Contains(result.SkipReason, "Monthly budget exhausted: all tasks spent $2.00 of $1.00") {
+		t.Fatalf("expected the monthly budget to skip the run, got %+v", result)
+	}
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Fatalf("claude ran despite an exhausted budget: %v", err)
+	}
+
+	if err := database.SetMonthlyBudget(0); err != nil {
+		t.Fatalf("clear monthly budget: %v", err)
+	}
+	if result = exec.Execute(context.Background(), task); result.Error != nil || result.Skipped {
+		t.Fatalf("expected the run to start without budgets, got %+v", result)
+	}
+	if _, err := os.Stat(marker); err != nil {
+		t.Fatalf("expected claude to run: %v", err)
+	}
+}
+
+func TestStreamRecorderUsageFallbacks(t *testing.T) {
+	recorder := newStreamRecorder(1, nil)
+	_, _ = recorder.Write([]byte(`{"type":"result","result":"ok","cost_usd":0.5,"modelUsage":{"claude-haiku-4-5":{"costUSD":0.01},"claude-opus-4-1":{"costUSD":0.49}}}` + "\n"))
+	if err := recorder.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	usage := recorder.Usage()
+	if usage.CostUSD != 0.5 || usage.Model != "claude-opus-4-1" {
+		t.Fatalf("unexpected usage %+v", usage)
+	}
+}
+
+func TestDeferRunKeepsOneDeferredRunPerTask(t *testing.T) {
+	database, dataDir := testutil.NewTestDB(t)
+	task := createTaskForExecutorTest(t, database, t.TempDir())
+	exec := New(database, dataDir)
+
+	startedAt := time.Now()
+	result := exec.deferRun(task, RunOptions{}, startedAt, "Usage at 90%", time.Hour)
+	if result.Error != nil || !result.Skipped || result.Status != db.RunStatusDeferred {
+		t.Fatalf("expected a deferred run, got %+v", result)
+	}
+	run, err := database.GetTaskRun(task.ID, result.RunID)
+	if err != nil {
+		t.Fatalf("get run: %v", err)
+	}
+	if run.Status != db.RunStatusDeferred || run.DeferredUntil == nil || !run.DeferredUntil.Equal(startedAt.Add(time.Hour)) {
+		t.Fatalf("unexpected deferred run %+v", run)
+	}
+	if !strings.HasPrefix(run.Error, "Usage at 90%. Deferred until ") {
+		t.Fatalf("unexpected deferral reason %q", run.Error)
+	}
+
+	second := exec.deferRun(task, RunOptions{}, time.Now(), "Usage at 90%", time.Hour)
+	if !second.Skipped || second.Status != db.RunStatusSkipped || !strings.Contains(second.SkipReason, "already waiting") {
+		t.Fatalf("expected the second run to be skipped while one waits, got %+v", second)
+	}
+}
+
+func TestDeferDelayWaitsForBucketsOverThreshold(t *testing.T) {
+	now := time.Now()
+	usageData := &usage.Response{
+		FiveHour: usage.Bucket{Utilization: 95, ResetsAt: now.Add(2 * time.Hour).Format(time.RFC3339)},
+		SevenDay: usage.Bucket{Utilization: 50, ResetsAt: now.Add(72 * time.Hour).Format(time.RFC3339)},
+	}
+	thresholds := db.UsageThresholds{FiveHour: 80, SevenDay: 90}
+	if got := deferDelay(usageData, thresholds); got < 2*time.Hour || got > 2*time.Hour+deferResetSlack {
+		t.Fatalf("expected to wait for the five-hour reset, got %s", got)
+	}
+
+	usageData.SevenDay.Utilization = 85
+	if got := deferDelay(usageData, thresholds); got > 2*time.Hour+deferResetSlack {
+		t.Fatalf("expected the seven-day bucket below its own threshold to be ignored, got %s", got)
+	}
+
+	usageData.SevenDay.Utilization = 92
+	if got := deferDelay(usageData, thresholds); got < 72*time.Hour || got > 72*time.Hour+deferResetSlack {
+		t.Fatalf("expected to wait for the seven-day reset, got %s", got)
+	}
+
+	usageData.SevenDay.ResetsAt = ""
+	if got := deferDelay(usageData, thresholds); got != deferFallbackDelay {
+		t.Fatalf("expected the fallback delay without a reset time, got %s", got)
+	}
+}
+
+func TestExecuteSkipsWhenStubUsageIsOverThreshold(t *testing.T) {
+	var gotAuth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		_, _ = w.Write([]byte(`{"five_hour":{"utilization":97},"seven_day":{"utilization":10}}`))
+	}))
+	defer srv.Close()
+	t.Setenv(usage.EnvAPIURL, srv.URL)
+	t.Setenv(usage.EnvOAuthToken, "stub-token")
+
+	database, dataDir := testutil.NewTestDB(t)
+	task := createTaskForExecutorTest(t, database, t.TempDir())
+
+	exec := New(database, dataDir)
+	if exec.usageClientErr != nil {
+		t.Fatalf("expected a usage client from the environment, got %v", exec.usageClientErr)
+	}
+
+	result := exec.Execute(context.Background(), task)
+	if result == nil || !result.Skipped {
+		t.Fatalf("expected the run to be skipped, got %#v", result)
+	}
+	if !strings.Contains(result.SkipReason, "5h=97%") {
+		t.Fatalf("expected the stub usage in the skip reason, got %q", result.SkipReason)
+	}
+	if gotAuth != "Bearer stub-token" {
+		t.Fatalf("expected the env token to be sent, got %q", gotAuth)
+	}
+
+	samples, err := database.ListUsageSamples("", time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("list usage samples: %v", err)
+	}
+	if len(samples) != 1 || samples[0].FiveHour != 97 {
+		t.Fatalf("expected the stub usage to be recorded, got %+v", samples)
+	}
+}
+
+func TestExecuteRunsTaskAsItsProfile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake claude script requires a POSIX shell")
+	}
+	var fiveHour atomic.Value
+	fiveHour.Store("75")
+	var gotAuth atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth.Store(r.Header.Get("Authorization"))
+		_, _ = w.Write([]byte(`{"five_hour":{"utilization":` + fiveHour.Load().(string) + `},"seven_day":{"utilization":10}}`))
+	}))
+	defer srv.Close()
+	t.Setenv(usage.EnvAPIURL, srv.URL)
+	t.Setenv(usage.EnvOAuthToken, "default-token")
+
+	configDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(configDir, ".credentials.json"), []byte(`{"claudeAiOauth":{"accessToken":"work-token"}}`), 0o600); err != nil {
+		t.Fatalf("write credentials: %v", err)
+	}
+	database, dataDir := testutil.NewTestDB(t)
+	if err := database.CreateProfile(&db.Profile{Name: "work", ConfigDir: configDir, UsageThreshold: 70}); err != nil {
+		t.Fatalf("create profile: %v", err)
+	}
+	workingDir := t.TempDir()
+	task := createTaskForExecutorTest(t, database, workingDir)
+	task.Profile = "work"
+	if err := database.UpdateTask(task); err != nil {
+		t.Fatalf("update task: %v", err)
+	}
+	installFakeClaudeScript(t, `printf '%s' "$CLAUDE_CONFIG_DIR" > config-dir.txt`)
+
+	// 75% is under the normal threshold but over the profile's 70%
+	result := New(database, dataDir).Execute(context.Background(), task)
+	if result == nil || !result.Skipped || !strings.Contains(result.SkipReason, "profile work") {
+		t.Fatalf("expected the profile threshold to skip the run, got %#v", result)
+	}
+	if auth, _ := gotAuth.Load().(string); auth != "Bearer work-token" {
+		t.Fatalf("expected the profile's token, got %q", auth)
+	}
+
+	fiveHour.Store("20")
+	result = New(database, dataDir).Execute(context.Background(), task)
+	if result.Error != nil {
+		t.Fatalf("execute: %v", result.Error)
+	}
+	got, err := os.ReadFile(filepath.Join(workingDir, "config-dir.txt"))
+	if err != nil {
+		t.Fatalf("read config dir written by claude: %v", err)
+	}
+	if string(got) != configDir {
+		t.Fatalf("expected CLAUDE_CONFIG_DIR %q, got %q", configDir, got)
+	}
+
+	samples, err := database.ListUsageSamples("work", time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("list usage samples: %v", err)
+	}
+	if len(samples) == 0 || samples[0].FiveHour != 75 {
+		t.Fatalf("expected the profile's usage to be recorded, got %+v", samples)
+	}
+}
+
+func TestExecuteSetsTaskEnvAndRedactsSecrets(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake claude script requires a POSIX shell")
+	}
+	t.Setenv("CLAUDE_TASKS_DISABLE_USAGE_CHECK", "1")
+
+	database, dataDir := testutil.NewTestDB(t)
+	if err := database.SetSecret("API_TOKEN", "tok-from-secret"); err != nil {
+		t.Fatalf("set secret: %v", err)
+	}
+	workingDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(workingDir, ".env"), []byte("# comment\nexport DB_PASSWORD='pw-from-file'\n"), 0o600); err != nil {
+		t.Fatalf("write env file: %v", err)
+	}
+	task := createTaskForExecutorTest(t, database, workingDir)
+	task.Env = map[string]string{"API_TOKEN": "Bearer ${secret:API_TOKEN}", "LOG_LEVEL": "debug"}
+	task.EnvFile = ".env"
+	task.Prompt = `Log at {{env "LOG_LEVEL"}} with {{env "API_TOKEN"}} and {{.Vars.password}}`
+	task.PromptVars = map[string]string{"password": "pw-from-file"}
+	if err := database.UpdateTask(task); err != nil {
+		t.Fatalf("update task: %v", err)
+	}
+	installFakeClaudeScript(t, `printf '%s|%s|%s' "$API_TOKEN" "$DB_PASSWORD" "$LOG_LEVEL" > env.txt
+echo "token $API_TOKEN and $DB_PASSWORD"
+echo "failed with $API_TOKEN" >&2
+exit 1`)
+
+	result := New(database, dataDir).Execute(context.Background(), task)
+	got, err := os.ReadFile(filepath.Join(workingDir, "env.txt"))
+	if err != nil {
+		t.Fatalf("read env written by claude: %v", err)
+	}
+	if string(got) != "Bearer tok-from-secret|pw-from-file|debug" {
+		t.Fatalf("unexpected env %q", got)
+	}
+
+	run, err := database.GetTaskRun(task.ID, result.RunID)
+	if err != nil {
+		t.Fatalf("get run: %v", err)
+	}
+	chunks, err := database.GetTaskRunChunks(run.ID, 0, 100)
+	if err != nil {
+		t.Fatalf("get chunks: %v", err)
+	}
+	texts := []string{run.Output, run.Error, run.RenderedPrompt, result.Error.Error()}
+	for _, chunk := range chunks {
+		texts = append(texts, chunk.Content)
+	}
+	for _, text := range texts {
+		if strings.Contains(text, "tok-from-secret") || strings.Contains(text, "pw-from-file") {
+			t.Fatalf("expected secrets to be redacted, got %q", text)
+		}
+	}
+	if !strings.Contains(run.Output, "token Bearer [REDACTED] and [REDACTED]") {
+		t.Fatalf("expected redacted output, got %q", run.Output)
+	}
+	if run.RenderedPrompt != "Log at debug with Bearer ${secret:API_TOKEN} and [REDACTED]" {
+		t.Fatalf("expected a redacted prompt with secret references unexpanded, got %q", run.RenderedPrompt)
+	}
+
+	// A reference to a missing secret fails the run before claude starts
+	task.Env = map[string]string{"API_TOKEN": "${secret:MISSING}"}
+	result = New(database, dataDir).Execute(context.Background(), task)
+	if result.Error == nil || !strings.Contains(result.Error.Error(), `unknown secret "MISSING"`) {
+		t.Fatalf("expected an unknown secret error, got %v", result.Error)
+	}
+}
+
+func TestExecuteContinuesLastSession(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake claude script requires a POSIX shell")
+	}
+	t.Setenv("CLAUDE_TASKS_DISABLE_USAGE_CHECK", "1")
+
+	database, dataDir := testutil.NewTestDB(t)
+	workingDir := t.TempDir()
+	task := createTaskForExecutorTest(t, database, workingDir)
+	task.SessionMode = db.SessionContinueLast
+	task.MaxSessionRuns = 2
+	if err := database.UpdateTask(task); err != nil {
+		t.Fatalf("update task: %v", err)
+	}
+	installFakeClaudeScript(t, `echo "$*" >> args.txt`)
+
+	exec := New(database, dataDir)
+	execute := func() *db.TaskRun {
+		t.Helper()
+		result := exec.Execute(context.Background(), task)
+		if result.Error != nil {
+			t.Fatalf("execute: %v", result.Error)
+		}
+		run, err := database.GetTaskRun(task.ID, result.RunID)
+		if err != nil {
+			t.Fatalf("get run: %v", err)
+		}
+		// Keep the runs apart so the latest one is unambiguous
+		time.Sleep(10 * time.Millisecond)
+		return run
+	}
+
+	first := execute()
+	if first.ResumedFromRunID != nil || first.ThreadRunID != nil || first.ThreadDepth != 1 {
+		t.Fatalf("expected the first run to start a thread, got %+v", first)
+	}
+	second := execute()
+	if second.SessionID != first.SessionID || second.ResumedFromRunID == nil || *second.ResumedFromRunID != first.ID ||
+		second.ThreadID() != first.ID || second.ThreadDepth != 2 {
+		t.Fatalf("expected the second run to continue the first, got %+v", second)
+	}
+	// The thread is at its cap, so the third run starts over
+	third := execute()
+	if third.SessionID == first.SessionID || third.ResumedFromRunID != nil || third.ThreadDepth != 1 {
+		t.Fatalf("expected the third run to start a new thread, got %+v", third)
+	}
+
+	task.SessionMode = db.SessionForkLast
+	fourth := execute()
+	if fourth.SessionID == third.SessionID || fourth.ThreadID() != third.ID || fourth.ThreadDepth != 2 {
+		t.Fatalf("expected the fourth run to fork the third, got %+v", fourth)
+	}
+
+	data, err := os.ReadFile(filepath.Join(workingDir, "args.txt"))
+	if err != nil {
+		t.Fatalf("read args: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	want := []string{
+		"--session-id " + first.SessionID,
+		"--resume " + first.SessionID + " echo test",
+		"--session-id " + third.SessionID,
+		"--resume " + third.SessionID + " --fork-session --session-id " + fourth.SessionID,
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("expected %d claude invocations, got %q", len(want), lines)
+	}
+	for i, line := range lines {
+		if !strings.Contains(line, want[i]) {
+			t.Fatalf("expected run %d args to contain %q, got %q", i+1, want[i], line)
+		}
+	}
+}
+
+func TestRunAndResumeArgs(t *testing.T) {
+	workingDir := t.TempDir()
+	task := &db.Task{
+		WorkingDir:         workingDir,
+		Model:              "sonnet",
+		PermissionMode:     "acceptEdits",
+		AllowedTools:       []string{"Read", "Bash(git diff:*)"},
+		DisallowedTools:    []string{"WebFetch"},
+		MaxTurns:           12,
+		AppendSystemPrompt: "Never push to main.",
+		MCPConfig:          ".mcp.json",
+		AddDirs:            []string{"../shared", "/srv/docs"},
+		OutputSchema:       []byte(`{"type":"object"}`),
+	}
+
+	got := RunArgs(task, Session{ID: "session-1"}, "do the thing")
+	want := []string{
+		"-p", "--output-format", "stream-json", "--verbose",
+		"--permission-mode", "acceptEdits",
+		"--model", "sonnet",
+		"--allowedTools", "Read,Bash(git diff:*)",
+		"--disallowedTools", "WebFetch",
+		"--append-system-prompt", "Never push to main.",
+		"--mcp-config", filepath.Join(workingDir, ".mcp.json"),
+		"--add-dir", "../shared", "--add-dir", "/srv/docs",
+		"--max-turns", "12",
+		"--json-schema", `{"type":"object"}`,
+		"--session-id", "session-1", "do the thing",
+	}
+	if strings.Join(got, "\x00") != strings.Join(want, "\x00") {
+		t.Fatalf("unexpected run args\n got %q\nwant %q", got, want)
+	}
+
+	resume := ResumeArgs(task, "session-1")
+	if slices.Contains(resume, "--max-turns") || slices.Contains(resume, "-p") {
+		t.Fatalf("expected resume args without print-mode options, got %q", resume)
+	}
+	if resume[len(resume)-2] != "--resume" || resume[len(resume)-1] != "session-1" {
+		t.Fatalf("expected resume args to end with the session, got %q", resume)
+	}
+
+	if got := RunArgs(&db.Task{}, Session{ID: "s"}, "p"); strings.Join(got, " ") != "-p --output-format stream-json --verbose --dangerously-skip-permissions --session-id s p" {
+		t.Fatalf("unexpected default run args %q", got)
+	}
+	if got := RunArgs(&db.Task{}, Session{ID: "s", ResumeID: "s"}, "p"); strings.Join(got, " ") != "-p --output-format stream-json --verbose --dangerously-skip-permissions --resume s p" {
+		t.Fatalf("unexpected continued run args %q", got)
+	}
+	if got := RunArgs(&db.Task{}, Session{ID: "new", ResumeID: "old", Fork: true}, "p"); strings.Join(got, " ") != "-p --output-format stream-json --verbose --dangerously-skip-permissions --resume old --fork-session --session-id new p" {
+		t.Fatalf("unexpected forked run args %q", got)
+	}
+
+	command := ShellCommand(append([]string{"claude"}, ResumeArgs(task, "session-1")...)...)
+	if !strings.Contains(command, `--allowedTools 'Read,Bash(git diff:*)'`) || !strings.Contains(command, `--append-system-prompt 'Never push to main.'`) {
+		t.Fatalf("expected shell-quoted options, got %s", command)
+	}
+	if got := ShellCommand("it's"); got != `'it'\''s'` {
+		t.Fatalf("unexpected quoting %s", got)
+	}
+}
+
+// initGitRepo creates a git repository with one commit and returns its path
+func initGitRepo(t *testing.T) string {
+	t.Helper()
+	repo := t.TempDir()
+	if _, err := git(repo, nil, "--version"); err != nil {
+		t.Skip("git is not available")
+	}
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "--allow-empty", "-m", "initial"},
+	} {
+		if _, err := git(repo, nil, args...); err != nil {
+			t.Fatalf("set up repo: %v", err)
+		}
+	}
+	return repo
+}
+
+func TestExecuteRunsIsolatedTaskInWorktree(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake claude script requires a POSIX shell")
+	}
+	t.Setenv("CLAUDE_TASKS_DISABLE_USAGE_CHECK", "1")
+
+	database, dataDir := testutil.NewTestDB(t)
+	repo := initGitRepo(t)
+	task := createTaskForExecutorTest(t, database, repo)
+	task.Name = "Nightly Refactor!"
+	task.Isolation = db.IsolationWorktree
+	if err := database.UpdateTask(task); err != nil {
+		t.Fatalf("update task: %v", err)
+	}
+	installFakeClaudeScript(t, `pwd > "$PWD_FILE"; echo changed > result.txt`)
+	pwdFile := filepath.Join(t.TempDir(), "pwd.txt")
+	t.Setenv("PWD_FILE", pwdFile)
+
+	exec := New(database, dataDir)
+	result := exec.Execute(context.Background(), task)
+	if result.Error != nil {
+		t.Fatalf("execute: %v", result.Error)
+	}
+	run, err := database.GetTaskRun(task.ID, result.RunID)
+	if err != nil {
+		t.Fatalf("get run: %v", err)
+	}
+	wt := run.Worktree
+	if wt == nil || wt.Branch != fmt.Sprintf("claude-tasks/nightly-refactor/%d", run.ID) {
+		t.Fatalf("unexpected worktree %+v", wt)
+	}
+	if !wt.Changed() || !strings.Contains(wt.DiffStat, "1 file changed") || wt.Path != "" {
+		t.Fatalf("expected a removed worktree with one changed file, got %+v", wt)
+	}
+	ranIn, err := os.ReadFile(pwdFile)
+	if err != nil {
+		t.Fatalf("read pwd: %v", err)
+	}
+	if !strings.HasPrefix(strings.TrimSpace(string(ranIn)), filepath.Join(dataDir, "worktrees")) {
+		t.Fatalf("expected claude to run in a worktree, ran in %s", ranIn)
+	}
+	if _, err := os.Stat(filepath.Join(repo, "result.txt")); !os.IsNotExist(err) {
+		t.Fatalf("expected the working dir to be untouched, got %v", err)
+	}
+	if files, err := git(repo, nil, "show", "--name-only", "--format=", wt.Branch); err != nil || files != "result.txt" {
+		t.Fatalf("expected the branch to hold the change, got %q, %v", files, err)
+	}
+
+	// A run that changes nothing leaves no branch behind; keep leaves the
+	// worktree in place
+	installFakeClaudeScript(t, "exit 0")
+	task.WorktreeCleanup = db.WorktreeKeep
+	result = exec.Execute(context.Background(), task)
+	run, err = database.GetTaskRun(task.ID, result.RunID)
+	if err != nil {
+		t.Fatalf("get run: %v", err)
+	}
+	if run.Worktree.Changed() || run.Worktree.Path == "" {
+		t.Fatalf("expected a kept worktree without changes, got %+v", run.Worktree)
+	}
+	task.WorktreeCleanup = db.WorktreeRemove
+	result = exec.Execute(context.Background(), task)
+	run, err = database.GetTaskRun(task.ID, result.RunID)
+	if err != nil {
+		t.Fatalf("get run: %v", err)
+	}
+	if _, err := git(repo, nil, "rev-parse", "--verify", "--quiet", run.Worktree.Branch); err == nil {
+		t.Fatalf("expected unchanged branch %s to be deleted", run.Worktree.Branch)
+	}
+
+	// Outside a git repository the run fails before claude starts
+	task.WorkingDir = t.TempDir()
+	result = exec.Execute(context.Background(), task)
+	if !result.Preflight || result.Error == nil || !strings.Contains(result.Error.Error(), "git repository") {
+		t.Fatalf("expected a preflight failure outside a repository, got %+v", result)
+	}
+}
+
+func TestExecuteResolvesMCPConfigAgainstWorkingDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake claude script requires a POSIX shell")
+	}
+	t.Setenv("CLAUDE_TASKS_DISABLE_USAGE_CHECK", "1")
+
+	database, dataDir := testutil.NewTestDB(t)
+	repo := initGitRepo(t)
+	// Untracked, so the worktree has no copy of it
+	mcpConfig := filepath.Join(repo, ".mcp.json")
+	if err := os.WriteFile(mcpConfig, []byte(`{"mcpServers": {}}`), 0o600); err != nil {
+		t.Fatalf("write mcp config: %v", err)
+	}
+	task := createTaskForExecutorTest(t, database, repo)
+	task.MCPConfig = ".mcp.json"
+	task.Isolation = db.IsolationWorktree
+	if err := database.UpdateTask(task); err != nil {
+		t.Fatalf("update task: %v", err)
+	}
+	argFile := filepath.Join(t.TempDir(), "mcp.txt")
+	t.Setenv("ARG_FILE", argFile)
+	installFakeClaudeScript(t, `while [ $# -gt 0 ]; do
+  if [ "$1" = --mcp-config ]; then test -f "$2" || exit 3; echo "$2" > "$ARG_FILE"; fi
+  shift
+done`)
+
+	exec := New(database, dataDir)
+	result := exec.Execute(context.Background(), task)
+	if result.Status != db.RunStatusCompleted || result.Error != nil {
+		t.Fatalf("expected claude to find the MCP config, got %+v", result)
+	}
+	passed, err := os.ReadFile(argFile)
+	if err != nil || strings.TrimSpace(string(passed)) != mcpConfig {
+		t.Fatalf("expected --mcp-config %s, got %q, %v", mcpConfig, passed, err)
+	}
+}
+
+func TestExecuteRecordsRunChanges(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake claude script requires a POSIX shell")
+	}
+	t.Setenv("CLAUDE_TASKS_DISABLE_USAGE_CHECK", "1")
+
+	database, dataDir := testutil.NewTestDB(t)
+	repo := initGitRepo(t)
+	if err := os.WriteFile(filepath.Join(repo, "notes.txt"), []byte("left by the user\n"), 0644); err != nil {
+		t.Fatalf("write notes: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, "main.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatalf("write main.go: %v", err)
+	}
+	if _, err := git(repo, nil, "add", "main.go"); err != nil {
+		t.Fatalf("stage main.go: %v", err)
+	}
+	task := createTaskForExecutorTest(t, database, repo)
+	installFakeClaudeScript(t, `printf 'package main\n\nfunc main() {}\n' > main.go; echo new > added.txt`)
+	tmpDir := t.TempDir()
+	t.Setenv("TMPDIR", tmpDir)
+
+	exec := New(database, dataDir)
+	result := exec.Execute(context.Background(), task)
+	if result.Error != nil {
+		t.Fatalf("execute: %v", result.Error)
+	}
+	changes, err := database.GetRunChanges(result.RunID)
+	if err != nil {
+		t.Fatalf("get changes: %v", err)
+	}
+	// The uncommitted notes.txt predates the run and is not part of its diff
+	if !changes.DirtyBefore || changes.HeadBefore == "" || changes.HeadAfter != changes.HeadBefore {
+		t.Fatalf("unexpected snapshot %+v", changes)
+	}
+	if len(changes.Files) != 2 || changes.Files[0].Path != "added.txt" || changes.Files[1].Path != "main.go" {
+		t.Fatalf("unexpected changed files %+v", changes.Files)
+	}
+	if changes.Insertions != 3 || changes.Deletions != 0 || changes.Summary() != "2 files changed, +3 -0" {
+		t.Fatalf("unexpected totals %+v", changes)
+	}
+	if !strings.Contains(changes.Patch, "+func main() {}") || strings.Contains(changes.Patch, "notes.txt") {
+		t.Fatalf("unexpected patch %q", changes.Patch)
+	}
+	// The repository's own index is left as it was
+	if staged, err := git(repo, nil, "diff", "--cached", "--name-only"); err != nil || staged != "main.go" {
+		t.Fatalf("expected only main.go staged, got %q, %v", staged, err)
+	}
+	// and so is its object store: untracked files are hashed into a
+	// scratch store, removed after the run
+	for _, name := range []string{"notes.txt", "added.txt"} {
+		blob, err := git(repo, nil, "hash-object", name)
+		if err != nil {
+			t.Fatalf("hash %s: %v", name, err)
+		}
+		if _, err := git(repo, nil, "cat-file", "-e", blob); err == nil {
+			t.Fatalf("expected %s not to be written to the repository's objects", name)
+		}
+	}
+	if entries, err := os.ReadDir(tmpDir); err != nil || len(entries) != 0 {
+		t.Fatalf("expected the snapshot's scratch dir to be removed, got %v, %v", entries, err)
+	}
+
+	// Runs outside a git repository record no changes
+	task.WorkingDir = t.TempDir()
+	result = exec.Execute(context.Background(), task)
+	if _, err := database.GetRunChanges(result.RunID); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected no changes outside a repository, got %v", err)
+	}
+}
+
+func TestExecuteRunsHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake claude script requires a POSIX shell")
+	}
+	t.Setenv("CLAUDE_TASKS_DISABLE_USAGE_CHECK", "1")
+
+	database, dataDir := testutil.NewTestDB(t)
+	workingDir := t.TempDir()
+	task := createTaskForExecutorTest(t, database, workingDir)
+	task.PreHooks = []db.Hook{{Command: `echo "pre $CLAUDE_TASKS_RUN_ID" > pre.txt`}}
+	task.PostHooks = []db.Hook{
+		{Command: `echo "$CLAUDE_TASKS_RUN_STATUS"`},
+		{Command: "echo tests failed >&2; exit 3"},
+		{Command: "touch never.txt"},
+	}
+	if err := database.UpdateTask(task); err != nil {
+		t.Fatalf("update task: %v", err)
+	}
+	installFakeClaudeScript(t, `cat pre.txt > claude.txt`)
+
+	exec := New(database, dataDir)
+	result := exec.Execute(context.Background(), task)
+	run, err := database.GetTaskRun(task.ID, result.RunID)
+	if err != nil {
+		t.Fatalf("get run: %v", err)
+	}
+	// claude ran after the pre-hook, and the failing post-hook failed the run
+	got, err := os.ReadFile(filepath.Join(workingDir, "claude.txt"))
+	if err != nil || strings.TrimSpace(string(got)) != fmt.Sprintf("pre %d", run.ID) {
+		t.Fatalf("expected claude to see the pre-hook's file, got %q, %v", got, err)
+	}
+	if run.Status != db.RunStatusFailed || !strings.Contains(run.Error, "post-hook 2 (echo tests failed >&2; exit 3) exited with code 3") {
+		t.Fatalf("expected the post-hook to fail the run, got %s: %q", run.Status, run.Error)
+	}
+	if len(run.Steps) != 3 {
+		t.Fatalf("expected 3 steps, got %+v", run.Steps)
+	}
+	if run.Steps[0].Phase != db.HookPre || run.Steps[1].Phase != db.HookPost || strings.TrimSpace(run.Steps[1].Stdout) != string(db.RunStatusCompleted) {
+		t.Fatalf("unexpected steps %+v", run.Steps)
+	}
+	if !run.Steps[2].Failed() || run.Steps[2].ExitCode != 3 || strings.TrimSpace(run.Steps[2].Stderr) != "tests failed" {
+		t.Fatalf("unexpected failed step %+v", run.Steps[2])
+	}
+	if _, err := os.Stat(filepath.Join(workingDir, "never.txt")); !os.IsNotExist(err) {
+		t.Fatalf("expected hooks after the failing one to be skipped, got %v", err)
+	}
+
+	// A failing pre-hook aborts the run before claude starts
+	if err := os.Remove(filepath.Join(workingDir, "claude.txt")); err != nil {
+		t.Fatalf("remove claude output: %v", err)
+	}
+	task.PreHooks = []db.Hook{{Command: "sleep 5", TimeoutSeconds: 1}}
+	task.PostHooks = []db.Hook{{Command: "touch post.txt"}}
+	result = exec.Execute(context.Background(), task)
+	if result.Error == nil || !strings.Contains(result.Error.Error(), "pre-hook 1 (sleep 5) timed out after 1s") {
+		t.Fatalf("expected a pre-hook timeout, got %+v", result)
+	}
+	if result.Preflight || result.FailureKind() != db.RetryOnExitError {
+		t.Fatalf("expected a failed pre-hook to retry as an exit error, got %q", result.FailureKind())
+	}
+	run, err = database.GetTaskRun(task.ID, result.RunID)
+	if err != nil {
+		t.Fatalf("get run: %v", err)
+	}
+	if run.Status != db.RunStatusFailed || len(run.Steps) != 1 || run.Steps[0].ExitCode != -1 {
+		t.Fatalf("unexpected run %s with steps %+v", run.Status, run.Steps)
+	}
+	for _, name := range []string{"claude.txt", "post.txt"} {
+		if _, err := os.Stat(filepath.Join(workingDir, name)); !os.IsNotExist(err) {
+			t.Fatalf("expected %s not to be written after the pre-hook failed, got %v", name, err)
+		}
+	}
+}
+
+func TestExecuteChecksAssertions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake claude script requires a POSIX shell")
+	}
+	t.Setenv("CLAUDE_TASKS_DISABLE_USAGE_CHECK", "1")
+
+	database, dataDir := testutil.NewTestDB(t)
+	workingDir := t.TempDir()
+	task := createTaskForExecutorTest(t, database, workingDir)
+	task.Assertions = []db.Assertion{
+		{Type: db.AssertNotMatches, Pattern: `(?i)couldn't access`},
+		{Type: db.AssertFileExists, Path: "reports/*.md"},
+		{Type: db.AssertJSONSchema, Schema: []byte(`{"type": "object", "required": ["status"]}`)},
+	}
+	task.PostHooks = []db.Hook{{Command: `echo "$CLAUDE_TASKS_RUN_STATUS"`}}
+	if err := database.UpdateTask(task); err != nil {
+		t.Fatalf("update task: %v", err)
+	}
+	installFakeClaudeScript(t, `mkdir -p reports && touch reports/cves.md; echo "I couldn't access the repository"`)
+
+	exec := New(database, dataDir)
+	result := exec.Execute(context.Background(), task)
+	if result.Status != db.RunStatusAssertionFailed || result.FailureKind() != db.RetryOnAssertion || result.Error == nil {
+		t.Fatalf("expected an assertion failure, got %+v", result)
+	}
+	run, err := database.GetTaskRun(task.ID, result.RunID)
+	if err != nil {
+		t.Fatalf("get run: %v", err)
+	}
+	if run.Status != db.RunStatusAssertionFailed || len(run.Assertions) != 3 {
+		t.Fatalf("unexpected run %s with assertions %+v", run.Status, run.Assertions)
+	}
+	if run.Assertions[0].Passed || !strings.Contains(run.Assertions[0].Message, "couldn't access") ||
+		!run.Assertions[1].Passed || run.Assertions[2].Passed || !strings.Contains(run.Assertions[2].Message, "invalid JSON") {
+		t.Fatalf("unexpected assertion results %+v", run.Assertions)
+	}
+	if !strings.Contains(run.Error, `assertion failed: not_matches "(?i)couldn't access"`) {
+		t.Fatalf("expected the failed assertions in the error, got %q", run.Error)
+	}
+	// Post-hooks see the assertion outcome
+	if len(run.Steps) != 1 || strings.TrimSpace(run.Steps[0].Stdout) != string(db.RunStatusAssertionFailed) {
+		t.Fatalf("unexpected post-hook steps %+v", run.Steps)
+	}
+
+	// JSON output in a fenced block passes the schema
+	installFakeClaudeScript(t, "printf '```json\\n{\"status\": \"ok\"}\\n```\\n'")
+	task.Assertions = task.Assertions[2:]
+	result = exec.Execute(context.Background(), task)
+	if result.Status != db.RunStatusCompleted || result.Error != nil {
+		t.Fatalf("expected the run to pass its assertions, got %+v", result)
+	}
+}
+
+func TestExecuteRecordsStructuredResult(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake claude script requires a POSIX shell")
+	}
+	t.Setenv("CLAUDE_TASKS_DISABLE_USAGE_CHECK", "1")
+
+	database, dataDir := testutil.NewTestDB(t)
+	task := createTaskForExecutorTest(t, database, t.TempDir())
+	task.OutputSchema = []byte(`{"type":"object","required":["vulnerable"],"properties":{"vulnerable":{"type":"boolean"}}}`)
+	if err := database.UpdateTask(task); err != nil {
+		t.Fatalf("update task: %v", err)
+	}
+	installFakeClaudeScript(t, `case "$*" in *--json-schema*) ;; *) exit 1 ;; esac
+echo '{"type":"result","subtype":"success","is_error":false,"result":"Found 2 issues","structured_output":{"vulnerable": true, "count": 2}}'`)
+
+	exec := New(database, dataDir)
+	result := exec.Execute(context.Background(), task)
+	if result.Status != db.RunStatusCompleted || result.Error != nil {
+		t.Fatalf("expected the run to complete, got %+v", result)
+	}
+	run, err := database.GetTaskRun(task.ID, result.RunID)
+	if err != nil {
+		t.Fatalf("get run: %v", err)
+	}
+	if string(run.ResultJSON) != `{"vulnerable":true,"count":2}` {
+		t.Fatalf("unexpected result %s", run.ResultJSON)
+	}
+	if len(run.Assertions) != 1 || run.Assertions[0].Assertion != db.OutputSchemaAssertion || !run.Assertions[0].Passed {
+		t.Fatalf("unexpected assertion results %+v", run.Assertions)
+	}
+
+	// Without structured output the output text is taken as the result
+	installFakeClaudeScript(t, `echo '{"vulnerable": "maybe"}'`)
+	result = exec.Execute(context.Background(), task)
+	if result.Status != db.RunStatusAssertionFailed || result.FailureKind() != db.RetryOnAssertion {
+		t.Fatalf("expected an assertion failure, got %+v", result)
+	}
+	run, err = database.GetTaskRun(task.ID, result.RunID)
+	if err != nil {
+		t.Fatalf("get run: %v", err)
+	}
+	if len(run.ResultJSON) != 0 || len(run.Assertions) != 1 || run.Assertions[0].Passed {
+		t.Fatalf("expected a failed output_schema check without a result, got %s %+v", run.ResultJSON, run.Assertions)
+	}
+	if !strings.Contains(run.Error, "assertion failed: output_schema: ") {
+		t.Fatalf("expected the schema failure in the error, got %q", run.Error)
+	}
+}
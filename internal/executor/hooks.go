@@ -0,0 +1,99 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ASRagab/claude-tasks/internal/db"
+)
+
+// maxHookOutputBytes caps the stdout and the stderr kept of each hook
+const maxHookOutputBytes = 64 * 1024
+
+// errHookTimedOut is the cancellation cause for hooks exceeding their timeout
+var errHookTimedOut = errors.New("hook timed out")
+
+// hookEnv returns the environment hooks run with: the run's, plus the task
+// and run IDs
+func hookEnv(env []string, task *db.Task, run *db.TaskRun) []string {
+	if env == nil {
+		env = os.Environ()
+	}
+	return append(env[:len(env):len(env)],
+		"CLAUDE_TASKS_TASK_ID="+strconv.FormatInt(task.ID, 10),
+		"CLAUDE_TASKS_RUN_ID="+strconv.FormatInt(run.ID, 10))
+}
+
+// runHooks runs hooks of one phase in order, recording each as a step of
+// the run. It stops at the first hook that fails and returns why it failed.
+func (e *Executor) runHooks(ctx context.Context, run *db.TaskRun, phase string, hooks []db.Hook, dir string, env []string, secrets *redactor) error {
+	for i, hook := range hooks {
+		step := e.runHook(ctx, hook, dir, env, secrets)
+		step.Phase = phase
+		run.Steps = append(run.Steps, step)
+		if !step.Failed() {
+			continue
+		}
+		reason := step.Error
+		if reason == "" {
+			reason = fmt.Sprintf("exited with code %d", step.ExitCode)
+		}
+		err := fmt.Sprintf("%s-hook %d (%s) %s", phase, i+1, hook.Command, reason)
+		if stderr := strings.TrimSpace(step.Stderr); stderr != "" {
+			err += "\n" + stderr
+		}
+		return errors.New(err)
+	}
+	return nil
+}
+
+// runHook runs a hook with the POSIX shell, or cmd.exe on Windows, bounded
+// by its timeout
+func (e *Executor) runHook(ctx context.Context, hook db.Hook, dir string, env []string, secrets *redactor) db.RunStep {
+	timeout := hook.EffectiveTimeout()
+	hookCtx, cancel := context.WithTimeoutCause(ctx, timeout, errHookTimedOut)
+	defer cancel()
+
+	cmd := hookCommand(hookCtx, hook.Command)
+	cmd.Dir = dir
+	cmd.Env = env
+	killGrace := e.killGrace
+	if killGrace <= 0 {
+		killGrace = defaultKillGrace
+	}
+	cleanupProcesses := configureProcessGroup(cmd, killGrace)
+	stdout := newCappedBuffer(maxHookOutputBytes)
+	stderr := newCappedBuffer(maxHookOutputBytes)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	step := db.RunStep{Command: hook.Command, StartedAt: time.Now()}
+	err := cmd.Run()
+	cleanupProcesses()
+	step.EndedAt = time.Now()
+	step.Stdout = secrets.Redact(stdout.String())
+	step.Stderr = secrets.Redact(stderr.String())
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+	case errors.Is(context.Cause(hookCtx), errHookTimedOut):
+		step.ExitCode = -1
+		step.Error = "timed out after " + db.FormatDuration(timeout)
+	case ctx.Err() != nil:
+		step.ExitCode = -1
+		step.Error = "stopped: " + context.Cause(ctx).Error()
+	case errors.As(err, &exitErr) && exitErr.ExitCode() >= 0:
+		step.ExitCode = exitErr.ExitCode()
+	default:
+		step.ExitCode = -1
+		step.Error = secrets.Redact(err.Error())
+	}
+	return step
+}
@@ -0,0 +1,67 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ASRagab/claude-tasks/internal/db"
+)
+
+// ReconcileOrphanedRuns marks running runs whose owner has gone away as
+// failed and returns them. A run is orphaned when its owner process ran on
+// this host and no longer exists, or when it stopped refreshing the run's
+// heartbeat. Runs owned by this executor are never touched.
+func (e *Executor) ReconcileOrphanedRuns() ([]*db.TaskRun, error) {
+	runs, err := e.db.ListRunningTaskRuns()
+	if err != nil {
+		return nil, err
+	}
+
+	orphanAfter := e.orphanAfter
+	if orphanAfter <= 0 {
+		orphanAfter = defaultOrphanAfter
+	}
+	host, _ := os.Hostname()
+	now := time.Now()
+
+	var orphaned []*db.TaskRun
+	var errs []error
+	for _, run := range runs {
+		if run.Owner.ID == e.owner.ID {
+			continue
+		}
+		reason := orphanReason(run, host, now, orphanAfter)
+		if reason == "" {
+			continue
+		}
+		ok, err := e.db.FailOrphanedTaskRun(run, reason)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if ok {
+			orphaned = append(orphaned, run)
+		}
+	}
+	return orphaned, errors.Join(errs...)
+}
+
+// orphanReason explains why a running run is orphaned, or returns an empty
+// string while its owner may still be alive.
+func orphanReason(run *db.TaskRun, host string, now time.Time, orphanAfter time.Duration) string {
+	owner := run.Owner
+	if owner.PID > 0 && owner.Host != "" && owner.Host == host && owner.PID != os.Getpid() && !processAlive(owner.PID) {
+		return fmt.Sprintf("Orphaned: owner process %d on %s exited while the run was in progress", owner.PID, owner.Host)
+	}
+
+	lastSeen := run.StartedAt
+	if run.HeartbeatAt != nil {
+		lastSeen = *run.HeartbeatAt
+	}
+	if now.Sub(lastSeen) > orphanAfter {
+		return fmt.Sprintf("Orphaned: no heartbeat from the owning process since %s", lastSeen.Format("2006-01-02 15:04:05"))
+	}
+	return ""
+}
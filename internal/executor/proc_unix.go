@@ -0,0 +1,72 @@
+//go:build !windows
+
+package executor
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// configureProcessGroup starts cmd in its own process group so cancellation
+// reaches every tool claude spawns. When the command's context is done the
+// group receives SIGTERM, then SIGKILL once grace has elapsed. The returned
+// cleanup must be called after the command exits; it kills any stragglers
+// left in the group of a cancelled command.
+func configureProcessGroup(cmd *exec.Cmd, grace time.Duration) (cleanup func()) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	var (
+		mu        sync.Mutex
+		cancelled bool
+		killTimer *time.Timer
+	)
+	killGroup := func(sig syscall.Signal) error {
+		return syscall.Kill(-cmd.Process.Pid, sig)
+	}
+
+	cmd.Cancel = func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		cancelled = true
+		killTimer = time.AfterFunc(grace, func() {
+			_ = killGroup(syscall.SIGKILL)
+		})
+		if err := killGroup(syscall.SIGTERM); err != nil {
+			if errors.Is(err, syscall.ESRCH) {
+				return os.ErrProcessDone
+			}
+			return err
+		}
+		return nil
+	}
+	// Stop waiting on output pipes held open by stragglers after the grace period
+	cmd.WaitDelay = grace + time.Second
+
+	return func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if !cancelled {
+			return
+		}
+		if killTimer != nil {
+			killTimer.Stop()
+		}
+		_ = killGroup(syscall.SIGKILL)
+	}
+}
+
+// processAlive reports whether a process with the given PID exists
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// hookCommand runs a hook's command line with the POSIX shell
+func hookCommand(ctx context.Context, command string) *exec.Cmd {
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
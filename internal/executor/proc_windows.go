@@ -0,0 +1,33 @@
+//go:build windows
+
+package executor
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// configureProcessGroup kills the claude process when the command's context
+// is done. Windows has no process groups to signal, so child tools are left
+// to exit once their parent is gone.
+func configureProcessGroup(cmd *exec.Cmd, grace time.Duration) (cleanup func()) {
+	cmd.WaitDelay = grace + time.Second
+	return func() {}
+}
+
+// processAlive reports whether a process with the given PID exists
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	_ = p.Release()
+	return true
+}
+
+// hookCommand runs a hook's command line with cmd.exe
+func hookCommand(ctx context.Context, command string) *exec.Cmd {
+	return exec.CommandContext(ctx, "cmd", "/C", command)
+}
@@ -0,0 +1,20 @@
+package executor
+
+import (
+	"time"
+
+	"github.com/ASRagab/claude-tasks/internal/db"
+	"github.com/ASRagab/claude-tasks/internal/prompt"
+)
+
+// renderPrompt renders the task's prompt template for a run starting now
+func (e *Executor) renderPrompt(task *db.Task, opts RunOptions, now time.Time) (string, error) {
+	if !prompt.IsTemplate(task.Prompt) {
+		return task.Prompt, nil
+	}
+	data, err := prompt.Load(e.db, task, opts.TriggeredByRunID, now)
+	if err != nil {
+		return "", err
+	}
+	return prompt.Render(task.Prompt, data)
+}
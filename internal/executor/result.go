@@ -0,0 +1,44 @@
+package executor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ASRagab/claude-tasks/internal/db"
+	"github.com/ASRagab/claude-tasks/internal/jsonschema"
+)
+
+// checkResult validates the structured output of a run claude completed
+// against the task's output schema and keeps it as the run's result. claude
+// reports it on the result event; without one, the output text is taken
+// as the result. The check is recorded among the run's assertion results.
+func checkResult(run *db.TaskRun, outputSchema, structured json.RawMessage, secrets *redactor) error {
+	if len(outputSchema) == 0 {
+		return nil
+	}
+	data := []byte(structured)
+	if len(data) == 0 {
+		data = []byte(extractJSON(run.Output))
+	}
+	result := db.AssertionResult{Assertion: db.OutputSchemaAssertion, Passed: true}
+	var compact bytes.Buffer
+	schema, err := jsonschema.Parse(outputSchema)
+	if err == nil {
+		err = schema.ValidateJSON(data)
+	}
+	if err == nil {
+		err = json.Compact(&compact, data)
+	}
+	if err != nil {
+		result.Passed = false
+		result.Message = secrets.Redact(err.Error())
+	} else {
+		run.ResultJSON = json.RawMessage(secrets.Redact(compact.String()))
+	}
+	run.Assertions = append(run.Assertions, result)
+	if !result.Passed {
+		return fmt.Errorf("assertion failed: %s: %s", result.Assertion, result.Message)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package executor
+
+import (
+	"fmt"
+
+	"github.com/ASRagab/claude-tasks/internal/db"
+)
+
+// runSession picks the claude session a run starts in and returns the run
+// it resumes, if any. Under continue_last and fork_last the session of the
+// task's latest completed run is resumed, unless that run's thread already
+// has as many runs as the task allows, in which case a new thread starts.
+func (e *Executor) runSession(task *db.Task, opts RunOptions) (Session, *db.TaskRun, error) {
+	var session Session
+	var resumed *db.TaskRun
+	if mode := task.EffectiveSessionMode(); mode != db.SessionFresh {
+		last, err := e.db.GetLatestSessionRun(task.ID)
+		if err != nil {
+			return Session{}, nil, fmt.Errorf("find session to resume: %w", err)
+		}
+		if last != nil && max(last.ThreadDepth, 1) < task.EffectiveMaxSessionRuns() {
+			resumed = last
+			session.ResumeID = last.SessionID
+			session.Fork = mode == db.SessionForkLast
+		}
+	}
+	if session.ResumeID != "" && !session.Fork {
+		session.ID = session.ResumeID
+		return session, resumed, nil
+	}
+
+	// A queued run keeps the new session ID it was given when it was queued
+	if queued := opts.queuedRun; queued != nil && queued.SessionID != "" && queued.ResumedFromRunID == nil {
+		session.ID = queued.SessionID
+		return session, resumed, nil
+	}
+	id, err := generateUUID()
+	if err != nil {
+		return Session{}, nil, err
+	}
+	session.ID = id
+	return session, resumed, nil
+}
+
+// setThread records the session a run starts in and the thread it joins
+// by resuming the resumed run's session; a nil resumed run starts a thread
+func setThread(run *db.TaskRun, session Session, resumed *db.TaskRun) {
+	run.SessionID = session.ID
+	run.ResumedFromRunID = nil
+	run.ThreadRunID = nil
+	run.ThreadDepth = 1
+	if resumed != nil {
+		resumedID, threadID := resumed.ID, resumed.ThreadID()
+		run.ResumedFromRunID = &resumedID
+		run.ThreadRunID = &threadID
+		run.ThreadDepth = max(resumed.ThreadDepth, 1) + 1
+	}
+}
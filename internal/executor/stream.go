@@ -0,0 +1,305 @@
+package executor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ASRagab/claude-tasks/internal/db"
+)
+
+const (
+	// maxStreamLineBytes bounds a single buffered stream-json line
+	maxStreamLineBytes = 4 * 1024 * 1024
+	// maxChunkContentBytes bounds the content stored for a single chunk
+	maxChunkContentBytes = 16 * 1024
+	// maxStreamedBytes bounds the total chunk content persisted for a run
+	maxStreamedBytes = 2 * 1024 * 1024
+)
+
+// streamEvent is the subset of a claude stream-json event used by the executor
+type streamEvent struct {
+	Type    string `json:"type"`
+	Subtype string `json:"subtype"`
+	Message *struct {
+		Content []streamContentBlock `json:"content"`
+	} `json:"message"`
+	Result  string `json:"result"`
+	IsError bool   `json:"is_error"`
+
+	// Set on the system init event
+	Model string `json:"model"`
+
+	// Set on the result event; older claude versions report cost_usd
+	TotalCostUSD *float64 `json:"total_cost_usd"`
+	CostUSD      *float64 `json:"cost_usd"`
+	NumTurns     int      `json:"num_turns"`
+	Usage        *struct {
+		InputTokens              int64 `json:"input_tokens"`
+		OutputTokens             int64 `json:"output_tokens"`
+		CacheCreationInputTokens int64 `json:"cache_creation_input_tokens"`
+		CacheReadInputTokens     int64 `json:"cache_read_input_tokens"`
+	} `json:"usage"`
+	ModelUsage map[string]struct {
+		CostUSD float64 `json:"costUSD"`
+	} `json:"modelUsage"`
+
+	// Set on the result event when claude ran with --json-schema
+	StructuredOutput json.RawMessage `json:"structured_output"`
+}
+
+type streamContentBlock struct {
+	Type    string          `json:"type"`
+	Text    string          `json:"text"`
+	Name    string          `json:"name"`
+	Input   json.RawMessage `json:"input"`
+	Content json.RawMessage `json:"content"`
+	IsError bool            `json:"is_error"`
+}
+
+// streamRecorder consumes claude's stream-json stdout line by line and
+// persists each event as run output chunks as soon as it arrives. Lines
+// that are not JSON are recorded as plain text.
+type streamRecorder struct {
+	runID    int64
+	persist  func(*db.TaskRunChunk) error
+	redactor *redactor // Hides secret values before output is stored
+
+	pending    []byte
+	discarding bool
+
+	seq       int64
+	persisted int
+	truncated bool
+	err       error
+
+	transcript    *cappedBuffer
+	result        string
+	hasResult     bool
+	resultIsError bool
+	structured    json.RawMessage
+	usage         db.RunUsage
+}
+
+func newStreamRecorder(runID int64, persist func(*db.TaskRunChunk) error) *streamRecorder {
+	return &streamRecorder{
+		runID:      runID,
+		persist:    persist,
+		transcript: newCappedBuffer(maxCapturedOutputBytes),
+	}
+}
+
+func (s *streamRecorder) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		idx := bytes.IndexByte(p, '\n')
+		if idx < 0 {
+			s.buffer(p)
+			break
+		}
+		s.buffer(p[:idx])
+		if !s.discarding {
+			s.handleLine(s.pending)
+		}
+		s.pending = s.pending[:0]
+		s.discarding = false
+		p = p[idx+1:]
+	}
+	return n, nil
+}
+
+func (s *streamRecorder) buffer(p []byte) {
+	if s.discarding {
+		return
+	}
+	if len(s.pending)+len(p) > maxStreamLineBytes {
+		s.pending = s.pending[:0]
+		s.discarding = true
+		s.emit(db.RunChunkText, "...[line too long, skipped]")
+		return
+	}
+	s.pending = append(s.pending, p...)
+}
+
+// Close handles a trailing line that was not newline-terminated
+func (s *streamRecorder) Close() error {
+	if len(s.pending) > 0 && !s.discarding {
+		s.handleLine(s.pending)
+	}
+	s.pending = nil
+	return s.err
+}
+
+func (s *streamRecorder) handleLine(line []byte) {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 {
+		return
+	}
+
+	var event streamEvent
+	if line[0] != '{' || json.Unmarshal(line, &event) != nil || event.Type == "" {
+		s.appendText(string(line))
+		return
+	}
+
+	switch event.Type {
+	case "system":
+		if event.Subtype == "init" && event.Model != "" {
+			s.usage.Model = event.Model
+		}
+	case "assistant":
+		if event.Message == nil {
+			return
+		}
+		for _, block := range event.Message.Content {
+			switch block.Type {
+			case "text":
+				s.appendText(block.Text)
+			case "tool_use":
+				s.emit(db.RunChunkToolUse, formatToolUse(block))
+			}
+		}
+	case "user":
+		if event.Message == nil {
+			return
+		}
+		for _, block := range event.Message.Content {
+			if block.Type == "tool_result" {
+				s.emit(db.RunChunkToolResult, toolResultText(block.Content))
+			}
+		}
+	case "result":
+		s.result = event.Result
+		s.hasResult = true
+		s.resultIsError = event.IsError
+		if len(event.StructuredOutput) > 0 && string(event.StructuredOutput) != "null" {
+			s.structured = event.StructuredOutput
+		}
+		s.recordUsage(&event)
+		s.emit(db.RunChunkResult, event.Result)
+	}
+}
+
+func (s *streamRecorder) appendText(text string) {
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+	if s.transcript.buf.Len() > 0 {
+		_, _ = s.transcript.Write([]byte("\n"))
+	}
+	_, _ = s.transcript.Write([]byte(text))
+	s.emit(db.RunChunkText, text)
+}
+
+func (s *streamRecorder) emit(kind db.RunChunkKind, content string) {
+	if s.persist == nil || s.truncated {
+		return
+	}
+	content = s.redactor.Redact(content)
+	if len(content) > maxChunkContentBytes {
+		content = content[:maxChunkContentBytes] + "\n...[truncated]"
+	}
+	if s.persisted+len(content) > maxStreamedBytes {
+		s.truncated = true
+		kind = db.RunChunkText
+		content = "...[streamed output truncated]"
+	}
+	s.persisted += len(content)
+	s.seq++
+
+	err := s.persist(&db.TaskRunChunk{
+		RunID:   s.runID,
+		Seq:     s.seq,
+		Kind:    kind,
+		Content: content,
+	})
+	if err != nil && s.err == nil {
+		s.err = err
+	}
+}
+
+// recordUsage keeps the cost and token counts of a result event
+func (s *streamRecorder) recordUsage(event *streamEvent) {
+	switch {
+	case event.TotalCostUSD != nil:
+		s.usage.CostUSD = *event.TotalCostUSD
+	case event.CostUSD != nil:
+		s.usage.CostUSD = *event.CostUSD
+	}
+	s.usage.NumTurns = event.NumTurns
+	if event.Usage != nil {
+		s.usage.InputTokens = event.Usage.InputTokens
+		s.usage.OutputTokens = event.Usage.OutputTokens
+		s.usage.CacheCreationTokens = event.Usage.CacheCreationInputTokens
+		s.usage.CacheReadTokens = event.Usage.CacheReadInputTokens
+	}
+	// Without an init event, take the model that cost the most
+	if s.usage.Model == "" {
+		var topCost float64
+		for model, usage := range event.ModelUsage {
+			if s.usage.Model == "" || usage.CostUSD > topCost {
+				s.usage.Model, topCost = model, usage.CostUSD
+			}
+		}
+	}
+}
+
+// Usage returns the usage reported by the result event; it is zero when
+// the stream ended without one
+func (s *streamRecorder) Usage() db.RunUsage {
+	return s.usage
+}
+
+// StructuredOutput returns the structured output of the result event, or
+// nil when claude reported none
+func (s *streamRecorder) StructuredOutput() json.RawMessage {
+	return s.structured
+}
+
+// Output returns the final result text, falling back to the collected
+// assistant text when the stream ended without a result event.
+func (s *streamRecorder) Output() string {
+	if s.hasResult && s.result != "" {
+		return s.redactor.Redact(s.result)
+	}
+	return s.redactor.Redact(s.transcript.String())
+}
+
+func formatToolUse(block streamContentBlock) string {
+	input := strings.TrimSpace(string(block.Input))
+	if input == "" || input == "{}" || input == "null" {
+		return block.Name
+	}
+	const maxInputSummary = 500
+	if len(input) > maxInputSummary {
+		input = input[:maxInputSummary] + "..."
+	}
+	return fmt.Sprintf("%s %s", block.Name, input)
+}
+
+// toolResultText extracts text from a tool_result content field, which is
+// either a plain string or a list of typed content blocks.
+func toolResultText(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text
+	}
+
+	var blocks []streamContentBlock
+	if err := json.Unmarshal(raw, &blocks); err == nil {
+		var parts []string
+		for _, block := range blocks {
+			if block.Type == "text" && block.Text != "" {
+				parts = append(parts, block.Text)
+			}
+		}
+		return strings.Join(parts, "\n")
+	}
+
+	return string(raw)
+}
@@ -0,0 +1,74 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ASRagab/claude-tasks/internal/db"
+)
+
+// SetQueuedRunStarter sets how runs queued by triggers are started. By
+// default the executor starts them itself; the scheduler routes them through
+// its own queue handling so triggered runs are retried like any other.
+func (e *Executor) SetQueuedRunStarter(start func(taskID int64)) {
+	e.startQueuedRuns = start
+}
+
+// queueDependents queues a run of every task triggered by a finished run and
+// starts them. A failed run only fires its triggers once no retry follows.
+func (e *Executor) queueDependents(task *db.Task, run *db.TaskRun) error {
+	if willRetry(task, run) {
+		return nil
+	}
+
+	triggers, err := e.db.ListTaskTriggers(task.ID)
+	if err != nil {
+		return fmt.Errorf("failed to load triggers: %w", err)
+	}
+
+	var errs []error
+	queued := make(map[int64]bool)
+	for _, trigger := range triggers {
+		if queued[trigger.TargetTaskID] || !db.TriggerMatches(trigger.Condition, run.Status) {
+			continue
+		}
+		ok, err := e.db.EnqueueTriggeredRun(trigger.TargetTaskID, run.ID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to trigger task %d: %w", trigger.TargetTaskID, err))
+			continue
+		}
+		if !ok {
+			continue
+		}
+		queued[trigger.TargetTaskID] = true
+		if e.startQueuedRuns != nil {
+			e.startQueuedRuns(trigger.TargetTaskID)
+		} else {
+			go func(taskID int64) {
+				_ = e.StartQueued(context.Background(), taskID, nil)
+			}(trigger.TargetTaskID)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// willRetry reports whether the task's retry policy covers a failed run
+func willRetry(task *db.Task, run *db.TaskRun) bool {
+	var kind string
+	switch run.Status {
+	case db.RunStatusFailed:
+		kind = db.RetryOnExitError
+	case db.RunStatusTimedOut:
+		kind = db.RetryOnTimeout
+	case db.RunStatusAssertionFailed:
+		kind = db.RetryOnAssertion
+	default:
+		return false
+	}
+	attempt := run.Attempt
+	if attempt < 1 {
+		attempt = 1
+	}
+	return task.RetriesOn(kind) && attempt <= task.MaxRetries
+}
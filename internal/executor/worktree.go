@@ -0,0 +1,155 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ASRagab/claude-tasks/internal/db"
+)
+
+// gitTimeout bounds each git command that manages a run's worktree
+const gitTimeout = time.Minute
+
+// worktreeIdentity is who commits the changes claude leaves uncommitted in
+// a worktree
+var worktreeIdentity = []string{
+	"GIT_AUTHOR_NAME=claude-tasks", "GIT_AUTHOR_EMAIL=claude-tasks@localhost",
+	"GIT_COMMITTER_NAME=claude-tasks", "GIT_COMMITTER_EMAIL=claude-tasks@localhost",
+}
+
+// worktree is the git worktree an isolated run executes in
+type worktree struct {
+	repo string // Top level of the working dir's repository
+	dir  string // The working dir's counterpart inside the worktree
+}
+
+// WorktreeBranch returns the branch a run of a worktree-isolated task works
+// on, such as claude-tasks/nightly-refactor/42
+func WorktreeBranch(task *db.Task, runID int64) string {
+	return fmt.Sprintf("claude-tasks/%s/%d", branchSlug(task), runID)
+}
+
+// branchSlug turns a task name into a branch name component
+func branchSlug(task *db.Task) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(task.Name) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	slug := strings.TrimSuffix(b.String(), "-")
+	if len(slug) > 40 {
+		slug = strings.TrimSuffix(slug[:40], "-")
+	}
+	if slug == "" {
+		slug = "task-" + strconv.FormatInt(task.ID, 10)
+	}
+	return slug
+}
+
+// createWorktree checks out the HEAD of the task's repository into a new
+// worktree on the run's own branch and records it on the run
+func (e *Executor) createWorktree(task *db.Task, run *db.TaskRun) (*worktree, error) {
+	repo, err := git(task.WorkingDir, nil, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, fmt.Errorf("worktree isolation needs a git repository: %w", err)
+	}
+	// The working dir relative to the top level, so claude runs in the same
+	// subdirectory of the worktree
+	prefix, err := git(task.WorkingDir, nil, "rev-parse", "--show-prefix")
+	if err != nil {
+		return nil, err
+	}
+	base, err := git(repo, nil, "rev-parse", "HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("worktree isolation needs a commit to start from: %w", err)
+	}
+
+	path := filepath.Join(e.worktreeDir, strconv.FormatInt(task.ID, 10), strconv.FormatInt(run.ID, 10))
+	branch := WorktreeBranch(task, run.ID)
+	if _, err := git(repo, nil, "worktree", "add", "-b", branch, path, base); err != nil {
+		return nil, fmt.Errorf("create worktree: %w", err)
+	}
+	run.Worktree = &db.RunWorktree{Branch: branch, Path: path, BaseCommit: base}
+	return &worktree{repo: repo, dir: filepath.Join(path, filepath.FromSlash(prefix))}, nil
+}
+
+// finishWorktree commits what claude left uncommitted to the run's branch,
+// records the branch's commit and diffstat, and removes the worktree unless
+// the task's cleanup policy keeps it. A branch without changes is deleted
+// along with its worktree.
+func (e *Executor) finishWorktree(task *db.Task, run *db.TaskRun, wt *worktree) error {
+	info := run.Worktree
+	status, err := git(info.Path, nil, "status", "--porcelain")
+	if err != nil {
+		return fmt.Errorf("worktree status: %w", err)
+	}
+	if status != "" {
+		if _, err := git(info.Path, nil, "add", "-A"); err != nil {
+			return fmt.Errorf("stage worktree changes: %w", err)
+		}
+		message := fmt.Sprintf("claude-tasks: %s run %d", task.Name, run.ID)
+		if _, err := git(info.Path, worktreeIdentity, "commit", "--no-verify", "-q", "-m", message); err != nil {
+			return fmt.Errorf("commit worktree changes: %w", err)
+		}
+	}
+	if info.Commit, err = git(info.Path, nil, "rev-parse", "HEAD"); err != nil {
+		return err
+	}
+	if info.Changed() {
+		if info.DiffStat, err = git(info.Path, nil, "diff", "--shortstat", info.BaseCommit, info.Commit); err != nil {
+			return fmt.Errorf("worktree diffstat: %w", err)
+		}
+	}
+
+	switch task.EffectiveWorktreeCleanup() {
+	case db.WorktreeKeep:
+		return nil
+	case db.WorktreeKeepOnFailure:
+		if run.Status != db.RunStatusCompleted {
+			return nil
+		}
+	}
+	if _, err := git(wt.repo, nil, "worktree", "remove", "--force", info.Path); err != nil {
+		return fmt.Errorf("remove worktree: %w", err)
+	}
+	info.Path = ""
+	if !info.Changed() {
+		if _, err := git(wt.repo, nil, "branch", "-D", info.Branch); err != nil {
+			return fmt.Errorf("delete unchanged branch: %w", err)
+		}
+	}
+	return nil
+}
+
+// git runs a git command in dir and returns its trimmed output; env is
+// added to the executor's environment
+func git(dir string, env []string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), gitTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
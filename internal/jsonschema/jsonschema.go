@@ -0,0 +1,679 @@
+// Package jsonschema validates JSON documents against a JSON Schema. It
+// supports the keywords task output schemas use in practice: type, enum,
+// const, the object, array, string and number constraints, the allOf,
+// anyOf, oneOf and not combinators, and $ref to definitions in the same
+// schema. Other keywords, such as format, are accepted and ignored.
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxReportedProblems caps the problems a validation error lists
+const maxReportedProblems = 5
+
+// Schema is a parsed JSON Schema
+type Schema struct {
+	root *node
+}
+
+// node is a parsed schema or subschema
+type node struct {
+	path   string // Where the schema is, for errors
+	always *bool  // Set for the boolean schemas true and false
+
+	types    []string
+	enum     []any
+	constant any
+	hasConst bool
+
+	properties           map[string]*node
+	required             []string
+	additionalProperties *node
+	minProperties        *int
+	maxProperties        *int
+
+	items    *node
+	minItems *int
+	maxItems *int
+
+	minLength *int
+	maxLength *int
+	pattern   *regexp.Regexp
+
+	minimum          *float64
+	maximum          *float64
+	exclusiveMinimum *float64
+	exclusiveMaximum *float64
+
+	allOf []*node
+	anyOf []*node
+	oneOf []*node
+	not   *node
+
+	ref *node // The definition a $ref points to
+}
+
+var types = []string{"object", "array", "string", "number", "integer", "boolean", "null"}
+
+// Parse parses a JSON Schema document. Schemas whose references loop back
+// without descending into the value, such as {"$ref": "#"}, are rejected.
+func Parse(data []byte) (*Schema, error) {
+	doc, err := Decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema JSON: %w", err)
+	}
+	c := &compiler{doc: doc, refs: map[string]*node{}}
+	root, err := c.compile(doc, "#")
+	if err != nil {
+		return nil, err
+	}
+	if err := checkCycles(root); err != nil {
+		return nil, err
+	}
+	return &Schema{root: root}, nil
+}
+
+// Decode decodes a JSON document, keeping numbers exact
+func Decode(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var value any
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return nil, errors.New("unexpected data after the JSON value")
+	}
+	return value, nil
+}
+
+// ValidationError lists where a document does not match its schema
+type ValidationError struct {
+	Problems []string // Each names the location, as a JSON pointer, and the problem
+}
+
+func (e *ValidationError) Error() string {
+	problems := e.Problems
+	if len(problems) > maxReportedProblems {
+		problems = append(problems[:maxReportedProblems:maxReportedProblems], fmt.Sprintf("and %d more", len(e.Problems)-maxReportedProblems))
+	}
+	return strings.Join(problems, "; ")
+}
+
+// Validate checks a decoded document, as returned by Decode, against the
+// schema. It returns a *ValidationError if the document does not match.
+func (s *Schema) Validate(value any) error {
+	var problems []string
+	s.root.validate(value, "", &problems)
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// ValidateJSON decodes a JSON document and validates it against the schema
+func (s *Schema) ValidateJSON(data []byte) error {
+	value, err := Decode(data)
+	if err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	return s.Validate(value)
+}
+
+type compiler struct {
+	doc  any
+	refs map[string]*node
+}
+
+func (c *compiler) compile(value any, path string) (*node, error) {
+	if b, ok := value.(bool); ok {
+		return &node{path: path, always: &b}, nil
+	}
+	obj, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s: a schema must be an object or a boolean", path)
+	}
+	n := &node{path: path}
+
+	if ref, ok := obj["$ref"]; ok {
+		target, ok := ref.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s/$ref: must be a string", path)
+		}
+		resolved, err := c.resolve(target)
+		if err != nil {
+			return nil, fmt.Errorf("%s/$ref: %w", path, err)
+		}
+		n.ref = resolved
+	}
+
+	if t, ok := obj["type"]; ok {
+		switch t := t.(type) {
+		case string:
+			n.types = []string{t}
+		case []any:
+			for _, item := range t {
+				s, ok := item.(string)
+				if !ok {
+					return nil, fmt.Errorf("%s/type: must be a string or a list of strings", path)
+				}
+				n.types = append(n.types, s)
+			}
+		default:
+			return nil, fmt.Errorf("%s/type: must be a string or a list of strings", path)
+		}
+		for _, name := range n.types {
+			if !slices.Contains(types, name) {
+				return nil, fmt.Errorf("%s/type: unknown type %q (use %s)", path, name, strings.Join(types, ", "))
+			}
+		}
+	}
+	if enum, ok := obj["enum"]; ok {
+		values, ok := enum.([]any)
+		if !ok {
+			return nil, fmt.Errorf("%s/enum: must be a list", path)
+		}
+		n.enum = values
+	}
+	if constant, ok := obj["const"]; ok {
+		n.constant, n.hasConst = constant, true
+	}
+
+	if props, ok := obj["properties"]; ok {
+		propObj, ok := props.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%s/properties: must be an object", path)
+		}
+		n.properties = make(map[string]*node, len(propObj))
+		for name, sub := range propObj {
+			compiled, err := c.compile(sub, path+"/properties/"+escapePointer(name))
+			if err != nil {
+				return nil, err
+			}
+			n.properties[name] = compiled
+		}
+	}
+	if required, ok := obj["required"]; ok {
+		list, ok := required.([]any)
+		if !ok {
+			return nil, fmt.Errorf("%s/required: must be a list of strings", path)
+		}
+		for _, item := range list {
+			name, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s/required: must be a list of strings", path)
+			}
+			n.required = append(n.required, name)
+		}
+	}
+	var err error
+	if n.additionalProperties, err = c.subschema(obj, "additionalProperties", path); err != nil {
+		return nil, err
+	}
+	if n.items, err = c.subschema(obj, "items", path); err != nil {
+		return nil, err
+	}
+	if n.not, err = c.subschema(obj, "not", path); err != nil {
+		return nil, err
+	}
+	for _, combinator := range []struct {
+		keyword string
+		dest    *[]*node
+	}{{"allOf", &n.allOf}, {"anyOf", &n.anyOf}, {"oneOf", &n.oneOf}} {
+		value, ok := obj[combinator.keyword]
+		if !ok {
+			continue
+		}
+		list, ok := value.([]any)
+		if !ok || len(list) == 0 {
+			return nil, fmt.Errorf("%s/%s: must be a non-empty list of schemas", path, combinator.keyword)
+		}
+		for i, sub := range list {
+			compiled, err := c.compile(sub, fmt.Sprintf("%s/%s/%d", path, combinator.keyword, i))
+			if err != nil {
+				return nil, err
+			}
+			*combinator.dest = append(*combinator.dest, compiled)
+		}
+	}
+
+	for _, count := range []struct {
+		keyword string
+		dest    **int
+	}{
+		{"minProperties", &n.minProperties}, {"maxProperties", &n.maxProperties},
+		{"minItems", &n.minItems}, {"maxItems", &n.maxItems},
+		{"minLength", &n.minLength}, {"maxLength", &n.maxLength},
+	} {
+		value, ok := obj[count.keyword]
+		if !ok {
+			continue
+		}
+		number, ok := value.(json.Number)
+		i, err := strconv.Atoi(string(number))
+		if !ok || err != nil || i < 0 {
+			return nil, fmt.Errorf("%s/%s: must be a non-negative integer", path, count.keyword)
+		}
+		*count.dest = &i
+	}
+	for _, limit := range []struct {
+		keyword string
+		dest    **float64
+	}{
+		{"minimum", &n.minimum}, {"maximum", &n.maximum},
+		{"exclusiveMinimum", &n.exclusiveMinimum}, {"exclusiveMaximum", &n.exclusiveMaximum},
+	} {
+		value, ok := obj[limit.keyword]
+		if !ok {
+			continue
+		}
+		f, ok := toFloat(value)
+		if !ok {
+			return nil, fmt.Errorf("%s/%s: must be a number", path, limit.keyword)
+		}
+		*limit.dest = &f
+	}
+	if pattern, ok := obj["pattern"]; ok {
+		s, ok := pattern.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s/pattern: must be a string", path)
+		}
+		if n.pattern, err = regexp.Compile(s); err != nil {
+			return nil, fmt.Errorf("%s/pattern: %w", path, err)
+		}
+	}
+	return n, nil
+}
+
+// subschema compiles the schema under keyword, if present
+func (c *compiler) subschema(obj map[string]any, keyword, path string) (*node, error) {
+	value, ok := obj[keyword]
+	if !ok {
+		return nil, nil
+	}
+	return c.compile(value, path+"/"+keyword)
+}
+
+// resolve compiles the definition a $ref points to. Only references into
+// the same document, such as "#/$defs/item", are supported.
+func (c *compiler) resolve(ref string) (*node, error) {
+	if n, ok := c.refs[ref]; ok {
+		return n, nil
+	}
+	if ref != "#" && !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("unsupported reference %q (only references within the schema, like #/$defs/name, are supported)", ref)
+	}
+	target := c.doc
+	if ref != "#" {
+		for _, token := range strings.Split(ref[2:], "/") {
+			token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+			switch value := target.(type) {
+			case map[string]any:
+				var ok bool
+				if target, ok = value[token]; !ok {
+					return nil, fmt.Errorf("reference %q not found", ref)
+				}
+			case []any:
+				i, err := strconv.Atoi(token)
+				if err != nil || i < 0 || i >= len(value) {
+					return nil, fmt.Errorf("reference %q not found", ref)
+				}
+				target = value[i]
+			default:
+				return nil, fmt.Errorf("reference %q not found", ref)
+			}
+		}
+	}
+	// Register the node before compiling it, so recursive references end
+	// at it
+	n := &node{}
+	c.refs[ref] = n
+	compiled, err := c.compile(target, ref)
+	if err != nil {
+		return nil, err
+	}
+	*n = *compiled
+	return n, nil
+}
+
+// sameValue returns the schemas that apply to the same value as n: its
+// $ref and the schemas of its combinators
+func (n *node) sameValue() []*node {
+	var nodes []*node
+	if n.ref != nil {
+		nodes = append(nodes, n.ref)
+	}
+	nodes = append(nodes, n.allOf...)
+	nodes = append(nodes, n.anyOf...)
+	nodes = append(nodes, n.oneOf...)
+	if n.not != nil {
+		nodes = append(nodes, n.not)
+	}
+	return nodes
+}
+
+// nested returns the schemas that apply to the properties or items of the
+// value n applies to
+func (n *node) nested() []*node {
+	var nodes []*node
+	for _, name := range sortedKeys(n.properties) {
+		nodes = append(nodes, n.properties[name])
+	}
+	if n.additionalProperties != nil {
+		nodes = append(nodes, n.additionalProperties)
+	}
+	if n.items != nil {
+		nodes = append(nodes, n.items)
+	}
+	return nodes
+}
+
+// checkCycles rejects a schema whose references loop back to a schema
+// without descending into a property or item on the way, such as
+// {"$ref": "#"}. Validating against it would recurse forever.
+func checkCycles(root *node) error {
+	// Every schema, reached through any keyword
+	var all []*node
+	seen := map[*node]bool{root: true}
+	for queue := []*node{root}; len(queue) > 0; queue = queue[1:] {
+		n := queue[0]
+		all = append(all, n)
+		for _, next := range append(n.sameValue(), n.nested()...) {
+			if !seen[next] {
+				seen[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+
+	// A cycle among the schemas applying to the same value
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := map[*node]int{}
+	var visit func(n *node) error
+	visit = func(n *node) error {
+		switch state[n] {
+		case visiting:
+			return fmt.Errorf("%s: $ref cycle that never descends into the value", n.path)
+		case visited:
+			return nil
+		}
+		state[n] = visiting
+		for _, next := range n.sameValue() {
+			if err := visit(next); err != nil {
+				return err
+			}
+		}
+		state[n] = visited
+		return nil
+	}
+	for _, n := range all {
+		if err := visit(n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]*node) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (n *node) validate(value any, path string, problems *[]string) {
+	if n.always != nil {
+		if !*n.always {
+			addProblem(problems, path, "no value is allowed here")
+		}
+		return
+	}
+	if n.ref != nil {
+		n.ref.validate(value, path, problems)
+	}
+
+	if len(n.types) > 0 {
+		matched := false
+		for _, t := range n.types {
+			if hasType(value, t) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			addProblem(problems, path, fmt.Sprintf("expected %s, got %s", strings.Join(n.types, " or "), typeOf(value)))
+			return
+		}
+	}
+	if n.enum != nil {
+		matched := false
+		for _, allowed := range n.enum {
+			if equal(value, allowed) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			addProblem(problems, path, fmt.Sprintf("must be one of %s", formatValues(n.enum)))
+		}
+	}
+	if n.hasConst && !equal(value, n.constant) {
+		addProblem(problems, path, fmt.Sprintf("must be %s", formatValues([]any{n.constant})))
+	}
+
+	switch value := value.(type) {
+	case map[string]any:
+		n.validateObject(value, path, problems)
+	case []any:
+		if n.minItems != nil && len(value) < *n.minItems {
+			addProblem(problems, path, fmt.Sprintf("must have at least %d items", *n.minItems))
+		}
+		if n.maxItems != nil && len(value) > *n.maxItems {
+			addProblem(problems, path, fmt.Sprintf("must have at most %d items", *n.maxItems))
+		}
+		if n.items != nil {
+			for i, item := range value {
+				n.items.validate(item, path+"/"+strconv.Itoa(i), problems)
+			}
+		}
+	case string:
+		length := len([]rune(value))
+		if n.minLength != nil && length < *n.minLength {
+			addProblem(problems, path, fmt.Sprintf("must be at least %d characters", *n.minLength))
+		}
+		if n.maxLength != nil && length > *n.maxLength {
+			addProblem(problems, path, fmt.Sprintf("must be at most %d characters", *n.maxLength))
+		}
+		if n.pattern != nil && !n.pattern.MatchString(value) {
+			addProblem(problems, path, fmt.Sprintf("must match %q", n.pattern.String()))
+		}
+	case json.Number:
+		f, _ := value.Float64()
+		if n.minimum != nil && f < *n.minimum {
+			addProblem(problems, path, fmt.Sprintf("must be at least %v", *n.minimum))
+		}
+		if n.maximum != nil && f > *n.maximum {
+			addProblem(problems, path, fmt.Sprintf("must be at most %v", *n.maximum))
+		}
+		if n.exclusiveMinimum != nil && f <= *n.exclusiveMinimum {
+			addProblem(problems, path, fmt.Sprintf("must be greater than %v", *n.exclusiveMinimum))
+		}
+		if n.exclusiveMaximum != nil && f >= *n.exclusiveMaximum {
+			addProblem(problems, path, fmt.Sprintf("must be less than %v", *n.exclusiveMaximum))
+		}
+	}
+
+	for _, sub := range n.allOf {
+		sub.validate(value, path, problems)
+	}
+	if len(n.anyOf) > 0 && countMatches(n.anyOf, value) == 0 {
+		addProblem(problems, path, "must match at least one schema of anyOf")
+	}
+	if len(n.oneOf) > 0 {
+		if matches := countMatches(n.oneOf, value); matches != 1 {
+			addProblem(problems, path, fmt.Sprintf("must match exactly one schema of oneOf, matched %d", matches))
+		}
+	}
+	if n.not != nil && countMatches([]*node{n.not}, value) == 1 {
+		addProblem(problems, path, "must not match the schema of not")
+	}
+}
+
+func (n *node) validateObject(value map[string]any, path string, problems *[]string) {
+	for _, name := range n.required {
+		if _, ok := value[name]; !ok {
+			addProblem(problems, path, fmt.Sprintf("missing required property %q", name))
+		}
+	}
+	if n.minProperties != nil && len(value) < *n.minProperties {
+		addProblem(problems, path, fmt.Sprintf("must have at least %d properties", *n.minProperties))
+	}
+	if n.maxProperties != nil && len(value) > *n.maxProperties {
+		addProblem(problems, path, fmt.Sprintf("must have at most %d properties", *n.maxProperties))
+	}
+	// Sorted, so problems are reported in a stable order
+	names := make([]string, 0, len(value))
+	for name := range value {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		propPath := path + "/" + escapePointer(name)
+		if sub, ok := n.properties[name]; ok {
+			sub.validate(value[name], propPath, problems)
+		} else if n.additionalProperties != nil {
+			if n.additionalProperties.always != nil && !*n.additionalProperties.always {
+				addProblem(problems, path, fmt.Sprintf("unexpected property %q", name))
+				continue
+			}
+			n.additionalProperties.validate(value[name], propPath, problems)
+		}
+	}
+}
+
+// countMatches returns how many of the schemas the value matches
+func countMatches(schemas []*node, value any) int {
+	matches := 0
+	for _, sub := range schemas {
+		var problems []string
+		sub.validate(value, "", &problems)
+		if len(problems) == 0 {
+			matches++
+		}
+	}
+	return matches
+}
+
+func addProblem(problems *[]string, path, problem string) {
+	if path == "" {
+		path = "/"
+	}
+	*problems = append(*problems, path+": "+problem)
+}
+
+func hasType(value any, t string) bool {
+	switch t {
+	case "integer":
+		n, ok := value.(json.Number)
+		if !ok {
+			return false
+		}
+		f, err := n.Float64()
+		return err == nil && f == math.Trunc(f) && !math.IsInf(f, 0)
+	case "number":
+		_, ok := value.(json.Number)
+		return ok
+	}
+	return typeOf(value) == t
+}
+
+func typeOf(value any) string {
+	switch value.(type) {
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case json.Number, float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case nil:
+		return "null"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// equal compares decoded JSON values, numbers by value
+func equal(a, b any) bool {
+	if fa, ok := toFloat(a); ok {
+		fb, ok := toFloat(b)
+		return ok && fa == fb
+	}
+	switch a := a.(type) {
+	case map[string]any:
+		b, ok := b.(map[string]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for k, v := range a {
+			if w, ok := b[k]; !ok || !equal(v, w) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		b, ok := b.([]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+func toFloat(value any) (float64, bool) {
+	switch n := value.(type) {
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+func formatValues(values []any) string {
+	formatted := make([]string, len(values))
+	for i, value := range values {
+		data, _ := json.Marshal(value)
+		formatted[i] = string(data)
+	}
+	return strings.Join(formatted, ", ")
+}
+
+func escapePointer(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
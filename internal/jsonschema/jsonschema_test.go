@@ -0,0 +1,337 @@
+package jsonschema
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	schema, err := Parse([]byte(`{
+		"type": "object",
+		"required": ["status", "cves"],
+		"additionalProperties": false,
+		"properties": {
+			"status": {"enum": ["ok", "degraded"]},
+			"count": {"type": "integer", "minimum": 0},
+			"cves": {"type": "array", "maxItems": 2, "items": {"$ref": "#/$defs/cve"}}
+		},
+		"$defs": {
+			"cve": {
+				"type": "object",
+				"required": ["id"],
+				"properties": {
+					"id": {"type": "string", "pattern": "^CVE-\\d{4}-\\d+$"},
+					"score": {"type": "number", "exclusiveMaximum": 10},
+					"related": {"type": "array", "items": {"$ref": "#/$defs/cve"}}
+				}
+			}
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+
+	valid := `{"status": "ok", "count": 2, "cves": [{"id": "CVE-2024-1", "score": 9.8, "related": [{"id": "CVE-2023-7"}]}]}`
+	if err := schema.ValidateJSON([]byte(valid)); err != nil {
+		t.Fatalf("expected a valid document, got %v", err)
+	}
+
+	for doc, want := range map[string]string{
+		`{"status": "ok"}`:                                                  `/: missing required property "cves"`,
+		`{"status": "down", "cves": []}`:                                    `/status: must be one of "ok", "degraded"`,
+		`{"status": "ok", "cves": [], "count": 1.5}`:                        `/count: expected integer, got number`,
+		`{"status": "ok", "cves": [], "extra": true}`:                       `/: unexpected property "extra"`,
+		`{"status": "ok", "cves": [{"id": "nope"}]}`:                        `/cves/0/id: must match`,
+		`{"status": "ok", "cves": [{"id": "CVE-2024-1", "related": [{}]}]}`: `/cves/0/related/0: missing required property "id"`,
+		`{"status": "ok", "cves": [{}, {}, {}]}`:                            `/cves: must have at most 2 items`,
+		`[1, 2]`:                                                            `/: expected object, got array`,
+	} {
+		err := schema.ValidateJSON([]byte(doc))
+		var validationErr *ValidationError
+		if !errors.As(err, &validationErr) || !strings.Contains(err.Error(), want) {
+			t.Fatalf("validate %s: expected %q, got %v", doc, want, err)
+		}
+	}
+	if err := schema.ValidateJSON([]byte(`{"status": "ok"} trailing`)); err == nil || !strings.Contains(err.Error(), "invalid JSON") {
+		t.Fatalf("expected invalid JSON, got %v", err)
+	}
+}
+
+func TestValidateCombinators(t *testing.T) {
+	schema, err := Parse([]byte(`{
+		"oneOf": [{"type": "string", "minLength": 2}, {"type": "integer"}],
+		"not": {"const": "no"}
+	}`))
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	for doc, valid := range map[string]bool{`"yes"`: true, `7`: true, `"no"`: false, `"x"`: false, `1.5`: false, `null`: false} {
+		if err := schema.ValidateJSON([]byte(doc)); (err == nil) != valid {
+			t.Fatalf("validate %s: expected valid=%v, got %v", doc, valid, err)
+		}
+	}
+}
+
+func TestParseRejectsInvalidSchemas(t *testing.T) {
+	for _, schema := range []string{
+		`not json`,
+		`[]`,
+		`{"type": "date"}`,
+		`{"minItems": -1}`,
+		`{"pattern": "("}`,
+		`{"$ref": "https://example.com/schema.json"}`,
+		`{"$ref": "#/$defs/missing"}`,
+		`{"anyOf": []}`,
+	} {
+		if _, err := Parse([]byte(schema)); err == nil {
+			t.Fatalf("expected an error for %s", schema)
+		}
+	}
+}
+
+func TestParseRejectsRefCycles(t *testing.T) {
+	for _, schema := range []string{
+		`{"$ref": "#"}`,
+		`{"$defs": {"a": {"$ref": "#/$defs/a"}}, "$ref": "#/$defs/a"}`,
+		`{"$defs": {"a": {"$ref": "#/$defs/b"}, "b": {"$ref": "#/$defs/a"}}, "$ref": "#/$defs/a"}`,
+		`{"$defs": {"a": {"allOf": [{"$ref": "#/$defs/b"}]}, "b": {"anyOf": [{"type": "null"}, {"$ref": "#/$defs/a"}]}}, "$ref": "#/$defs/a"}`,
+		`{"oneOf": [{"type": "string"}, {"not": {"$ref": "#"}}]}`,
+		// A cycle is rejected even where a document could not reach it
+		`{"properties": {"a": {"$ref": "#/properties/a"}}}`,
+	} {
+		_, err := Parse([]byte(schema))
+		if err == nil || !strings.Contains(err.Error(), "$ref cycle") {
+			t.Fatalf("expected a $ref cycle error for %s, got %v", schema, err)
+		}
+	}
+}
+
+func TestValidateRecursiveRefs(t *testing.T) {
+	// References back to an enclosing schema are fine when they descend
+	// into a property or item on the way
+	schema, err := Parse([]byte(`{
+		"$defs": {
+			"tree": {
+				"type": "object",
+				"required": ["name"],
+				"properties": {
+					"name": {"type": "string"},
+					"children": {"type": "array", "items": {"$ref": "#/$defs/tree"}},
+					"parent": {"anyOf": [{"type": "null"}, {"$ref": "#/$defs/tree"}]}
+				}
+			}
+		},
+		"allOf": [{"$ref": "#/$defs/tree"}]
+	}`))
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	valid := `{"name": "root", "parent": null, "children": [{"name": "a", "children": [{"name": "b", "parent": {"name": "x"}}]}]}`
+	if err := schema.ValidateJSON([]byte(valid)); err != nil {
+		t.Fatalf("expected a valid document, got %v", err)
+	}
+	invalid := `{"name": "root", "children": [{"name": "a", "children": [{"children": []}]}]}`
+	if err := schema.ValidateJSON([]byte(invalid)); err == nil || !strings.Contains(err.Error(), `/children/0/children/0: missing required property "name"`) {
+		t.Fatalf("expected the nested child to be missing its name, got %v", err)
+	}
+
+	list, err := Parse([]byte(`{"type": "array", "items": {"$ref": "#"}}`))
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	if err := list.ValidateJSON([]byte(`[[], [[[]]]]`)); err != nil {
+		t.Fatalf("expected nested lists to be valid, got %v", err)
+	}
+	if err := list.ValidateJSON([]byte(`[[], [[1]]]`)); err == nil || !strings.Contains(err.Error(), "/1/0/0: expected array, got number") {
+		t.Fatalf("expected the number to be rejected, got %v", err)
+	}
+}
+
+func TestValidateRefResolution(t *testing.T) {
+	schema, err := Parse([]byte(`{
+		"definitions": {"a/b": {"type": "string"}, "t~n": {"minLength": 3}},
+		"$defs": {"anything": true, "nothing": false, "list": [{"type": "integer"}]},
+		"properties": {
+			"slash": {"$ref": "#/definitions/a~1b"},
+			"tilde": {"$ref": "#/definitions/t~0n", "type": "string"},
+			"again": {"$ref": "#/properties/slash"},
+			"indexed": {"$ref": "#/$defs/list/0"},
+			"any": {"$ref": "#/$defs/anything"},
+			"none": {"$ref": "#/$defs/nothing"}
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	if err := schema.ValidateJSON([]byte(`{"slash": "x", "tilde": "abc", "again": "y", "indexed": 4, "any": {"deep": [1]}}`)); err != nil {
+		t.Fatalf("expected a valid document, got %v", err)
+	}
+	for doc, want := range map[string]string{
+		`{"slash": 1}`:     "/slash: expected string, got number",
+		`{"tilde": "ab"}`:  "/tilde: must be at least 3 characters",
+		`{"tilde": 1234}`:  "/tilde: expected string, got number",
+		`{"again": true}`:  "/again: expected string, got boolean",
+		`{"indexed": 1.5}`: "/indexed: expected integer, got number",
+		`{"none": null}`:   "/none: no value is allowed here",
+	} {
+		if err := schema.ValidateJSON([]byte(doc)); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("validate %s: expected %q, got %v", doc, want, err)
+		}
+	}
+}
+
+func TestValidateAllOfAnyOf(t *testing.T) {
+	schema, err := Parse([]byte(`{
+		"allOf": [{"type": "object", "required": ["id"]}, {"required": ["name"]}],
+		"anyOf": [{"properties": {"kind": {"const": "a"}}, "required": ["kind"]}, {"required": ["fallback"]}]
+	}`))
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	for doc, want := range map[string]string{
+		`{"id": 1, "name": "x", "kind": "a"}`:      "",
+		`{"id": 1, "name": "x", "fallback": true}`: "",
+		`{"kind": "a"}`:                       `/: missing required property "id"; /: missing required property "name"`,
+		`{"id": 1, "name": "x", "kind": "b"}`: "/: must match at least one schema of anyOf",
+		`{"id": 1, "name": "x"}`:              "/: must match at least one schema of anyOf",
+	} {
+		err := schema.ValidateJSON([]byte(doc))
+		if want == "" {
+			if err != nil {
+				t.Fatalf("validate %s: expected valid, got %v", doc, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("validate %s: expected %q, got %v", doc, want, err)
+		}
+	}
+
+	oneOf, err := Parse([]byte(`{"oneOf": [{"type": "integer"}, {"type": "number", "maximum": 10}]}`))
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	for doc, want := range map[string]string{
+		`20`:  "",
+		`2.5`: "",
+		`3`:   "matched 2",
+		`"x"`: "matched 0",
+	} {
+		err := oneOf.ValidateJSON([]byte(doc))
+		if (want == "") != (err == nil) || (err != nil && !strings.Contains(err.Error(), want)) {
+			t.Fatalf("validate %s: expected %q, got %v", doc, want, err)
+		}
+	}
+}
+
+func TestValidateObjects(t *testing.T) {
+	schema, err := Parse([]byte(`{
+		"properties": {"name": {"type": "string"}},
+		"additionalProperties": {"type": "integer", "minimum": 0},
+		"minProperties": 1,
+		"maxProperties": 3
+	}`))
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	if err := schema.ValidateJSON([]byte(`{"name": "x", "a/b": 1, "c": 2}`)); err != nil {
+		t.Fatalf("expected a valid document, got %v", err)
+	}
+	for doc, want := range map[string]string{
+		`{}`:                               "/: must have at least 1 properties",
+		`{"a": 1, "b": 2, "c": 3, "d": 4}`: "/: must have at most 3 properties",
+		`{"a/b": -1}`:                      "/a~1b: must be at least 0",
+		`{"name": 1, "count": "two"}`:      "/count: expected integer, got string; /name: expected string, got number",
+	} {
+		if err := schema.ValidateJSON([]byte(doc)); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("validate %s: expected %q, got %v", doc, want, err)
+		}
+	}
+
+	open, err := Parse([]byte(`{"properties": {"a": {"type": "string"}}, "additionalProperties": true}`))
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	if err := open.ValidateJSON([]byte(`{"a": "x", "b": [null]}`)); err != nil {
+		t.Fatalf("expected additional properties to be allowed, got %v", err)
+	}
+}
+
+func TestValidateScalars(t *testing.T) {
+	schema, err := Parse([]byte(`{
+		"properties": {
+			"name": {"type": "string", "minLength": 2, "maxLength": 3},
+			"ratio": {"type": "number", "minimum": 0, "maximum": 1},
+			"port": {"type": "integer", "exclusiveMinimum": 0, "exclusiveMaximum": 65536},
+			"tag": {"type": ["string", "null"]},
+			"level": {"enum": [1, "high", null]},
+			"point": {"const": {"x": 1, "y": [2]}},
+			"list": {"type": "array", "minItems": 1}
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	if err := schema.ValidateJSON([]byte(`{"name": "日本", "ratio": 1, "port": 8080.0, "tag": null, "level": 1.0, "point": {"y": [2.0], "x": 1}, "list": [0]}`)); err != nil {
+		t.Fatalf("expected a valid document, got %v", err)
+	}
+	for doc, want := range map[string]string{
+		`{"name": "x"}`:       "/name: must be at least 2 characters",
+		`{"name": "abcd"}`:    "/name: must be at most 3 characters",
+		`{"ratio": -0.5}`:     "/ratio: must be at least 0",
+		`{"ratio": 1.5}`:      "/ratio: must be at most 1",
+		`{"port": 0}`:         "/port: must be greater than 0",
+		`{"port": 65536}`:     "/port: must be less than 65536",
+		`{"tag": 1}`:          "/tag: expected string or null, got number",
+		`{"level": "low"}`:    `/level: must be one of 1, "high", null`,
+		`{"point": {"x": 1}}`: `/point: must be {"x":1,"y":[2]}`,
+		`{"list": []}`:        "/list: must have at least 1 items",
+	} {
+		if err := schema.ValidateJSON([]byte(doc)); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("validate %s: expected %q, got %v", doc, want, err)
+		}
+	}
+}
+
+func TestValidationErrorCapsProblems(t *testing.T) {
+	schema, err := Parse([]byte(`{"type": "array", "items": {"type": "string"}}`))
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	err = schema.ValidateJSON([]byte(`[1, 2, 3, 4, 5, 6, 7]`))
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || len(validationErr.Problems) != 7 {
+		t.Fatalf("expected 7 problems, got %v", err)
+	}
+	if !strings.HasSuffix(err.Error(), "/4: expected string, got number; and 2 more") {
+		t.Fatalf("expected the error to list 5 problems, got %q", err.Error())
+	}
+}
+
+func TestParseReportsWhereSchemasAreInvalid(t *testing.T) {
+	for schema, want := range map[string]string{
+		`{"type": 5}`:                                "#/type: must be a string or a list of strings",
+		`{"type": ["string", 1]}`:                    "#/type: must be a string or a list of strings",
+		`{"enum": 1}`:                                "#/enum: must be a list",
+		`{"properties": []}`:                         "#/properties: must be an object",
+		`{"properties": {"a/b": "string"}}`:          "#/properties/a~1b: a schema must be an object or a boolean",
+		`{"required": "id"}`:                         "#/required: must be a list of strings",
+		`{"required": [1]}`:                          "#/required: must be a list of strings",
+		`{"items": {"maxItems": 1.5}}`:               "#/items/maxItems: must be a non-negative integer",
+		`{"minimum": "0"}`:                           "#/minimum: must be a number",
+		`{"pattern": 1}`:                             "#/pattern: must be a string",
+		`{"$ref": 1}`:                                "#/$ref: must be a string",
+		`{"allOf": {}}`:                              "#/allOf: must be a non-empty list of schemas",
+		`{"oneOf": [true, 1]}`:                       "#/oneOf/1: a schema must be an object or a boolean",
+		`{"not": {"additionalProperties": null}}`:    "#/not/additionalProperties: a schema must be an object or a boolean",
+		`{"$defs": {"a": 1}, "$ref": "#/$defs/a"}`:   "#/$ref: #/$defs/a: a schema must be an object or a boolean",
+		`{"$defs": {"a": 1}, "$ref": "#/$defs/a/b"}`: `#/$ref: reference "#/$defs/a/b" not found`,
+		`{"allOf": [true], "$ref": "#/allOf/1"}`:     `#/$ref: reference "#/allOf/1" not found`,
+	} {
+		_, err := Parse([]byte(schema))
+		if err == nil || err.Error() != want {
+			t.Fatalf("parse %s: expected %q, got %v", schema, want, err)
+		}
+	}
+}
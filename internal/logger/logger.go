@@ -27,6 +27,42 @@ type RunLog struct {
 	Model          string `json:"model,omitempty"`
 	PermissionMode string `json:"permission_mode,omitempty"`
 	SessionID      string `json:"session_id,omitempty"`
+	TimeoutSeconds int64  `json:"timeout_seconds"`
+	Attempt        int    `json:"attempt"`
+	ParentRunID    *int64 `json:"parent_run_id,omitempty"`
+	ScheduledFor   *time.Time `json:"scheduled_for,omitempty"`
+	RenderedPrompt string     `json:"rendered_prompt,omitempty"`
+	Usage          db.RunUsage `json:"usage"`
+
+	// The conversation thread the run belongs to
+	ResumedFromRunID *int64 `json:"resumed_from_run_id,omitempty"`
+	ThreadRunID      *int64 `json:"thread_run_id,omitempty"`
+	ThreadDepth      int    `json:"thread_depth,omitempty"`
+
+	// The git worktree an isolated run ran in
+	Worktree *db.RunWorktree `json:"worktree,omitempty"`
+
+	// The files the run changed in its git working dir; the patch is kept
+	// in the database
+	ChangedFiles []db.ChangedFile `json:"changed_files,omitempty"`
+
+	// The hooks the task ran with and how each went
+	PreHooks  []db.Hook    `json:"pre_hooks,omitempty"`
+	PostHooks []db.Hook    `json:"post_hooks,omitempty"`
+	Steps     []db.RunStep `json:"steps,omitempty"`
+
+	// How the run fared on the task's assertions
+	Assertions []db.AssertionResult `json:"assertions,omitempty"`
+	// The run's structured output, validated against the task's schema
+	Result json.RawMessage `json:"result,omitempty"`
+
+	// Claude CLI options the task ran with
+	AllowedTools       []string `json:"allowed_tools,omitempty"`
+	DisallowedTools    []string `json:"disallowed_tools,omitempty"`
+	MaxTurns           int      `json:"max_turns,omitempty"`
+	AppendSystemPrompt string   `json:"append_system_prompt,omitempty"`
+	MCPConfig          string   `json:"mcp_config,omitempty"`
+	AddDirs            []string `json:"add_dirs,omitempty"`
 }
 
 // RunLogger writes structured JSON log files for task runs
@@ -74,7 +110,35 @@ func (l *RunLogger) WriteRunLog(task *db.Task, run *db.TaskRun) error {
 		Model:          task.Model,
 		PermissionMode: task.PermissionMode,
 		SessionID:      run.SessionID,
+		TimeoutSeconds: int64(task.EffectiveTimeout() / time.Second),
+		Attempt:        run.Attempt,
+		ParentRunID:    run.ParentRunID,
+		ScheduledFor:   run.ScheduledFor,
+		RenderedPrompt: run.RenderedPrompt,
+		Usage:          run.Usage,
 
+		ResumedFromRunID: run.ResumedFromRunID,
+		ThreadRunID:      run.ThreadRunID,
+		ThreadDepth:      run.ThreadDepth,
+
+		Worktree: run.Worktree,
+
+		PreHooks:  task.PreHooks,
+		PostHooks: task.PostHooks,
+		Steps:     run.Steps,
+
+		Assertions: run.Assertions,
+		Result:     run.ResultJSON,
+
+		AllowedTools:       task.AllowedTools,
+		DisallowedTools:    task.DisallowedTools,
+		MaxTurns:           task.MaxTurns,
+		AppendSystemPrompt: task.AppendSystemPrompt,
+		MCPConfig:          task.MCPConfig,
+		AddDirs:            task.AddDirs,
+	}
+	if run.Changes != nil {
+		logEntry.ChangedFiles = run.Changes.Files
 	}
 
 	data, err := json.MarshalIndent(logEntry, "", "  ")
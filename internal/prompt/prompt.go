@@ -0,0 +1,234 @@
+// Package prompt renders task prompts as Go text/template templates, so a
+// prompt can refer to the time, earlier runs, the run that triggered it and
+// task-level variables.
+package prompt
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/ASRagab/claude-tasks/internal/db"
+)
+
+// MaxRenderedBytes bounds a rendered prompt, which is passed to claude as a
+// single argument
+const MaxRenderedBytes = 100 * 1024
+
+// Data is what a prompt template can refer to
+type Data struct {
+	Now           time.Time  // In the task's timezone
+	Task          Task       // The task being run
+	LastRun       Run        // The task's latest finished run; empty before the first
+	LastSuccessAt *time.Time // When the task last completed; nil if it never has
+	Upstream      Run        // The run that triggered this one; empty unless triggered
+
+	// Vars are the task's custom variables
+	Vars map[string]string
+	// Env is the task's env setting, read by the env function. Secret
+	// references are left as written, so a prompt never holds their values.
+	Env map[string]string
+}
+
+// Task describes the task being run
+type Task struct {
+	ID         int64
+	Name       string
+	WorkingDir string
+}
+
+// Run describes an earlier run. ID is zero when there is no such run.
+type Run struct {
+	ID        int64
+	TaskID    int64
+	TaskName  string
+	Status    string
+	Output    string
+	Error     string
+	StartedAt time.Time
+	EndedAt   *time.Time
+
+	// Result is the run's structured output, decoded from JSON, so fields
+	// can be referred to as .Upstream.Result.name; nil if it has none
+	Result any
+}
+
+var funcs = template.FuncMap{
+	// env is bound to the rendered Data's Env; see Render
+	"env": func(name string) string { return "" },
+	"default": func(fallback, value string) string {
+		if value == "" {
+			return fallback
+		}
+		return value
+	},
+	"truncate": func(limit int, value string) string {
+		runes := []rune(value)
+		if limit < 0 || len(runes) <= limit {
+			return value
+		}
+		return string(runes[:limit]) + "..."
+	},
+	// json encodes a value, such as a field of a structured result, as JSON
+	"json": func(value any) (string, error) {
+		data, err := json.Marshal(value)
+		return string(data), err
+	},
+	"tail": func(lines int, value string) string {
+		split := strings.Split(strings.TrimRight(value, "\n"), "\n")
+		if lines < 0 || len(split) <= lines {
+			return value
+		}
+		return strings.Join(split[len(split)-lines:], "\n")
+	},
+}
+
+var varNameRE = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// IsTemplate reports whether text uses any template actions. Prompts without
+// them are sent as written.
+func IsTemplate(text string) bool {
+	return strings.Contains(text, "{{")
+}
+
+func parse(text string) (*template.Template, error) {
+	return template.New("prompt").Funcs(funcs).Option("missingkey=error").Parse(text)
+}
+
+// Validate checks that text is a valid prompt template
+func Validate(text string) error {
+	if !IsTemplate(text) {
+		return nil
+	}
+	_, err := parse(text)
+	return err
+}
+
+// ValidateVars checks that every variable name can be used as .Vars.name
+func ValidateVars(vars map[string]string) error {
+	for name := range vars {
+		if !varNameRE.MatchString(name) {
+			return fmt.Errorf("invalid variable name %q (use letters, digits and underscores)", name)
+		}
+	}
+	return nil
+}
+
+// Render executes text as a prompt template with the given data
+func Render(text string, data *Data) (string, error) {
+	if !IsTemplate(text) {
+		return text, nil
+	}
+	tmpl, err := parse(text)
+	if err != nil {
+		return "", err
+	}
+	// env reads only the task's own variables, never the scheduler's
+	// environment, which holds its secret key and account tokens
+	tmpl.Funcs(template.FuncMap{"env": func(name string) string {
+		if data == nil {
+			return ""
+		}
+		return data.Env[name]
+	}})
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	if b.Len() > MaxRenderedBytes {
+		return "", fmt.Errorf("rendered prompt is %d bytes, over the %d byte limit (use truncate or tail on long output)", b.Len(), MaxRenderedBytes)
+	}
+	return b.String(), nil
+}
+
+// Load gathers the data for rendering a task's prompt. upstreamRunID is the
+// run that triggered this one, if any.
+func Load(database *db.DB, task *db.Task, upstreamRunID *int64, now time.Time) (*Data, error) {
+	data := &Data{
+		Now:  now.In(task.Location()),
+		Task: Task{ID: task.ID, Name: task.Name, WorkingDir: task.WorkingDir},
+		Vars: task.PromptVars,
+		Env:  task.Env,
+	}
+	if data.Vars == nil {
+		data.Vars = map[string]string{}
+	}
+	if task.ID == 0 {
+		return data, nil
+	}
+
+	lastRun, err := database.GetLatestFinishedTaskRun(task.ID)
+	if err != nil {
+		return nil, fmt.Errorf("load last run: %w", err)
+	}
+	if lastRun != nil {
+		data.LastRun = newRun(lastRun, task.Name)
+	}
+	if data.LastSuccessAt, err = database.GetLastSuccessAt(task.ID); err != nil {
+		return nil, fmt.Errorf("load last success: %w", err)
+	}
+
+	if upstreamRunID != nil {
+		upstream, err := database.GetTaskRunByID(*upstreamRunID)
+		if err != nil {
+			return nil, fmt.Errorf("load upstream run %d: %w", *upstreamRunID, err)
+		}
+		var taskName string
+		if upstreamTask, err := database.GetTask(upstream.TaskID); err == nil {
+			taskName = upstreamTask.Name
+		}
+		data.Upstream = newRun(upstream, taskName)
+	}
+	return data, nil
+}
+
+// SampleUpstreamRunID returns the latest finished run of a task that
+// triggers the given one, so previews can show what .Upstream would hold.
+// Returns nil if no upstream task has finished a run.
+func SampleUpstreamRunID(database *db.DB, taskID int64) (*int64, error) {
+	triggers, err := database.ListTaskTriggersTargeting(taskID)
+	if err != nil {
+		return nil, fmt.Errorf("load triggers: %w", err)
+	}
+	var latest *db.TaskRun
+	for _, trigger := range triggers {
+		run, err := database.GetLatestFinishedTaskRun(trigger.TaskID)
+		if err != nil {
+			return nil, fmt.Errorf("load upstream run: %w", err)
+		}
+		if run != nil && (latest == nil || run.StartedAt.After(latest.StartedAt)) {
+			latest = run
+		}
+	}
+	if latest == nil {
+		return nil, nil
+	}
+	return &latest.ID, nil
+}
+
+func newRun(run *db.TaskRun, taskName string) Run {
+	var result any
+	if len(run.ResultJSON) > 0 {
+		// Numbers are kept as written rather than turned into floats
+		dec := json.NewDecoder(bytes.NewReader(run.ResultJSON))
+		dec.UseNumber()
+		if err := dec.Decode(&result); err != nil {
+			result = nil
+		}
+	}
+	return Run{
+		ID:        run.ID,
+		TaskID:    run.TaskID,
+		TaskName:  taskName,
+		Status:    string(run.Status),
+		Output:    run.Output,
+		Error:     run.Error,
+		StartedAt: run.StartedAt,
+		EndedAt:   run.EndedAt,
+		Result:    result,
+	}
+}
@@ -0,0 +1,117 @@
+package prompt
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ASRagab/claude-tasks/internal/db"
+	"github.com/ASRagab/claude-tasks/internal/testutil"
+)
+
+func TestRenderTemplateData(t *testing.T) {
+	t.Setenv("PROMPT_TEST_DAEMON", "secret")
+	endedAt := time.Date(2026, 3, 1, 9, 30, 0, 0, time.UTC)
+	data := &Data{
+		Now:           time.Date(2026, 3, 2, 8, 0, 0, 0, time.UTC),
+		Task:          Task{ID: 1, Name: "digest"},
+		LastRun:       Run{ID: 4, Status: "completed", Output: "line 1\nline 2\nline 3\n"},
+		LastSuccessAt: &endedAt,
+		Vars:          map[string]string{"team": "platform"},
+		Env:           map[string]string{"PROMPT_TEST_REPO": "claude-tasks"},
+	}
+
+	rendered, err := Render(`{{.Now.Format "2006-01-02"}} {{.Vars.team}} {{env "PROMPT_TEST_REPO"}} {{.LastRun.Output | tail 1}}
+{{with .LastSuccessAt}}since {{.Format "15:04"}}{{end}}{{if .Upstream.ID}} upstream{{end}} {{.Upstream.Output | default "none"}}`, data)
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	want := "2026-03-02 platform claude-tasks line 3\nsince 09:30 none"
+	if rendered != want {
+		t.Fatalf("rendered %q, want %q", rendered, want)
+	}
+
+	if rendered, err := Render(`{{env "PROMPT_TEST_DAEMON" | default "unset"}}`, data); err != nil || rendered != "unset" {
+		t.Fatalf("expected env to ignore the scheduler's environment, got %q, %v", rendered, err)
+	}
+
+	plain := "Summarize {{ literally"
+	if err := Validate(plain); err == nil {
+		t.Fatalf("expected a parse error for %q", plain)
+	}
+	if _, err := Render("{{.Vars.missing}}", data); err == nil {
+		t.Fatalf("expected an error for an unknown variable")
+	}
+	if rendered, err := Render("no actions here", nil); err != nil || rendered != "no actions here" {
+		t.Fatalf("expected plain prompt unchanged, got %q, %v", rendered, err)
+	}
+	if _, err := Render(`{{.LastRun.Output}}`, &Data{LastRun: Run{Output: strings.Repeat("x", MaxRenderedBytes+1)}}); err == nil {
+		t.Fatalf("expected an error for an oversized prompt")
+	}
+	if err := ValidateVars(map[string]string{"not-valid": "x"}); err == nil {
+		t.Fatalf("expected an error for an invalid variable name")
+	}
+}
+
+func TestLoadUsesLastRunAndUpstream(t *testing.T) {
+	database, _ := testutil.NewTestDB(t)
+	newTask := func(name string) *db.Task {
+		task := &db.Task{Name: name, Prompt: "hi", CronExpr: "0 0 * * * *", WorkingDir: ".", Enabled: true, Timezone: "Asia/Tokyo"}
+		if err := database.CreateTask(task); err != nil {
+			t.Fatalf("create task: %v", err)
+		}
+		return task
+	}
+	collect := newTask("collect")
+	report := newTask("report")
+
+	addRun := func(task *db.Task, status db.RunStatus, output string, startedAt time.Time) *db.TaskRun {
+		endedAt := startedAt.Add(time.Minute)
+		run := &db.TaskRun{TaskID: task.ID, StartedAt: startedAt, EndedAt: &endedAt, Status: status, Output: output}
+		if err := database.CreateTaskRun(run); err != nil {
+			t.Fatalf("create run: %v", err)
+		}
+		if err := database.UpdateTaskRun(run); err != nil {
+			t.Fatalf("finish run: %v", err)
+		}
+		return run
+	}
+	base := time.Now().Add(-time.Hour)
+	addRun(report, db.RunStatusCompleted, "first report", base)
+	addRun(report, db.RunStatusFailed, "broken report", base.Add(10*time.Minute))
+	addRun(report, db.RunStatusSkipped, "", base.Add(20*time.Minute))
+	upstream := addRun(collect, db.RunStatusCompleted, "collected 3 items", base.Add(30*time.Minute))
+	upstream.ResultJSON = []byte(`{"count":3,"items":["a","b","c"]}`)
+	if err := database.UpdateTaskRun(upstream); err != nil {
+		t.Fatalf("record upstream result: %v", err)
+	}
+
+	if err := database.CreateTaskTrigger(&db.TaskTrigger{TaskID: collect.ID, TargetTaskID: report.ID, Condition: db.TriggerOnSuccess}); err != nil {
+		t.Fatalf("create trigger: %v", err)
+	}
+	sample, err := SampleUpstreamRunID(database, report.ID)
+	if err != nil || sample == nil || *sample != upstream.ID {
+		t.Fatalf("expected sample upstream run %d, got %v (%v)", upstream.ID, sample, err)
+	}
+
+	data, err := Load(database, report, sample, time.Now())
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if data.LastRun.Output != "broken report" || data.LastRun.Status != string(db.RunStatusFailed) {
+		t.Fatalf("expected the failed run as last run, got %+v", data.LastRun)
+	}
+	if data.LastSuccessAt == nil || !data.LastSuccessAt.Equal(base.Add(time.Minute)) {
+		t.Fatalf("unexpected last success time %v", data.LastSuccessAt)
+	}
+	if data.Upstream.TaskName != "collect" || data.Upstream.Output != "collected 3 items" {
+		t.Fatalf("unexpected upstream run %+v", data.Upstream)
+	}
+	rendered, err := Render(`{{.Upstream.Result.count}} {{json .Upstream.Result.items}}`, data)
+	if err != nil || rendered != `3 ["a","b","c"]` {
+		t.Fatalf("expected the upstream result fields, got %q, %v", rendered, err)
+	}
+	if data.Now.Location().String() != "Asia/Tokyo" {
+		t.Fatalf("expected Now in the task timezone, got %s", data.Now.Location())
+	}
+}
@@ -0,0 +1,93 @@
+package scheduler
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ASRagab/claude-tasks/internal/db"
+	"github.com/ASRagab/claude-tasks/internal/executor"
+	"github.com/robfig/cron/v3"
+)
+
+// specParser parses cron specs the same way cron.WithSeconds does
+var specParser = cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// missedFireTimes returns the fire times of a task's schedule that passed
+// while it was not scheduled: those after its last handled fire time, or its
+// creation if it has none, up to now. Changing the schedule or enabling the
+// task moves the last handled fire time, but other edits and run updates do
+// not. Only the most recent limit are returned; total counts all of them.
+func missedFireTimes(task *db.Task, now time.Time, limit int) (missed []time.Time, total int, err error) {
+	schedule, err := specParser.Parse(task.CronSpec())
+	if err != nil {
+		return nil, 0, fmt.Errorf("parse schedule: %w", err)
+	}
+
+	since := task.CreatedAt
+	if task.LastScheduledAt != nil {
+		since = *task.LastScheduledAt
+	}
+	if since.IsZero() {
+		return nil, 0, nil
+	}
+
+	for at := schedule.Next(since); !at.IsZero() && !at.After(now); at = schedule.Next(at) {
+		total++
+		missed = append(missed, at)
+		if len(missed) > limit {
+			missed = missed[1:]
+		}
+	}
+	return missed, total, nil
+}
+
+// catchUpMisfiresLocked applies a task's misfire policy to the fire times it
+// missed while no scheduler was running it. The latest missed fire time is
+// claimed first, so only one leader catches up.
+func (s *Scheduler) catchUpMisfiresLocked(task *db.Task, now time.Time) {
+	policy := task.EffectiveMisfirePolicy()
+	limit := 1
+	if policy == db.MisfireRunAll {
+		limit = db.MaxMisfireRuns
+	}
+
+	missed, total, err := missedFireTimes(task, now, limit)
+	if err != nil {
+		fmt.Printf("Failed to check missed runs of task %d: %v\n", task.ID, err)
+		return
+	}
+	if total == 0 {
+		return
+	}
+
+	claimed, err := s.db.ClaimScheduledFire(task.ID, missed[len(missed)-1])
+	if err != nil {
+		fmt.Printf("Failed to record missed runs of task %d: %v\n", task.ID, err)
+		return
+	}
+	if !claimed {
+		return
+	}
+
+	if policy == db.MisfireSkip {
+		fmt.Printf("Task %d missed %d scheduled run(s); skipping them (misfire policy %s)\n", task.ID, total, policy)
+		return
+	}
+	fmt.Printf("Task %d missed %d scheduled run(s); running %d (misfire policy %s)\n", task.ID, total, len(missed), policy)
+	go s.runMisfires(task, missed)
+}
+
+// runMisfires runs a task once for each missed fire time, one after another,
+// while this process remains the leader
+func (s *Scheduler) runMisfires(task *db.Task, fireTimes []time.Time) {
+	for _, at := range fireTimes {
+		if !s.IsLeader() {
+			return
+		}
+		scheduledFor := at
+		result := s.executeTask(task, executor.RunOptions{ScheduledFor: &scheduledFor})
+		if result != nil && result.Error != nil {
+			fmt.Printf("Failed to execute missed run of task %d for %s: %v\n", task.ID, at.Format(time.RFC3339), result.Error)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package scheduler
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/ASRagab/claude-tasks/internal/db"
+	"github.com/ASRagab/claude-tasks/internal/testutil"
+)
+
+func TestMissedFireTimes(t *testing.T) {
+	now := time.Date(2026, time.March, 10, 12, 30, 0, 0, time.UTC)
+	lastFire := now.Add(-5 * time.Hour).Truncate(time.Hour)
+	task := &db.Task{
+		CronExpr:        "0 0 * * * *",
+		CreatedAt:       now.Add(-24 * time.Hour),
+		UpdatedAt:       now.Add(-10 * time.Minute),
+		LastScheduledAt: &lastFire,
+	}
+
+	missed, total, err := missedFireTimes(task, now, 3)
+	if err != nil {
+		t.Fatalf("missed fire times: %v", err)
+	}
+	if total != 5 {
+		t.Fatalf("expected 5 missed fire times, got %d", total)
+	}
+	want := []time.Time{now.Add(-150 * time.Minute), now.Add(-90 * time.Minute), now.Add(-30 * time.Minute)}
+	if len(missed) != len(want) {
+		t.Fatalf("expected the %d most recent fire times, got %v", len(want), missed)
+	}
+	for i := range want {
+		if !missed[i].Equal(want[i]) {
+			t.Fatalf("missed[%d] = %s, want %s", i, missed[i], want[i])
+		}
+	}
+
+	// Without a handled fire time the window starts at creation; edits,
+	// which move UpdatedAt, do not shorten it
+	task.LastScheduledAt = nil
+	task.CreatedAt = now.Add(-2 * time.Hour)
+	if _, total, _ := missedFireTimes(task, now, 3); total != 2 {
+		t.Fatalf("expected 2 missed fire times since creation, got %d", total)
+	}
+}
+
+func TestRunAllMisfirePolicyRunsMissedFireTimesOnce(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake claude script requires a POSIX shell")
+	}
+	t.Setenv("CLAUDE_TASKS_DISABLE_USAGE_CHECK", "1")
+	binDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(binDir, "claude"), []byte("#!/bin/sh\nexit 0\n"), 0o755); err != nil {
+		t.Fatalf("write fake claude binary: %v", err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	database, dataDir := testutil.NewTestDB(t)
+	s := New(database, dataDir)
+	if err := s.Start(); err != nil {
+		t.Fatalf("start scheduler: %v", err)
+	}
+	defer s.Stop()
+
+	task := &db.Task{
+		Name:          "hourly",
+		Prompt:        "report",
+		CronExpr:      "0 0 * * * *",
+		WorkingDir:    t.TempDir(),
+		MisfirePolicy: db.MisfireRunAll,
+	}
+	if err := database.CreateTask(task); err != nil {
+		t.Fatalf("create task: %v", err)
+	}
+
+	// The task was created before the scheduler went down three hours ago
+	now := time.Now()
+	task.CreatedAt = now.Add(-3 * time.Hour)
+	s.mu.Lock()
+	s.catchUpMisfiresLocked(task, now)
+	s.catchUpMisfiresLocked(task, now) // a second leader finds them claimed
+	s.mu.Unlock()
+
+	var runs []*db.TaskRun
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		var err error
+		runs, err = database.GetTaskRuns(task.ID, 10)
+		if err != nil {
+			t.Fatalf("get runs: %v", err)
+		}
+		if len(runs) == 3 && runs[0].EndedAt != nil {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if len(runs) != 3 {
+		t.Fatalf("expected one run per missed hour, got %d runs", len(runs))
+	}
+	for _, run := range runs {
+		if run.ScheduledFor == nil || run.ScheduledFor.Minute() != 0 || run.ScheduledFor.Second() != 0 {
+			t.Fatalf("expected run %d to record an on-the-hour fire time, got %v", run.ID, run.ScheduledFor)
+		}
+	}
+
+	stored, err := database.GetTask(task.ID)
+	if err != nil {
+		t.Fatalf("get task: %v", err)
+	}
+	if stored.LastScheduledAt == nil || !stored.LastScheduledAt.Equal(*runs[0].ScheduledFor) {
+		t.Fatalf("expected last scheduled time %v, got %v", runs[0].ScheduledFor, stored.LastScheduledAt)
+	}
+}
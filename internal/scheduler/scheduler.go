@@ -1,6 +1,7 @@
 package scheduler
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"sync"
@@ -17,8 +18,9 @@ type Scheduler struct {
 	db                  *db.DB
 	executor            *executor.Executor
 	jobs                map[int64]cron.EntryID
-	cronExprs           map[int64]string      // Track cron expressions to detect changes
+	cronExprs           map[int64]string      // Track cron specs (expression and zone) to detect changes
 	oneOffTimers        map[int64]*time.Timer // Track one-off task timers
+	retryTimers         map[int64]*time.Timer // Pending retries keyed by the first attempt's run ID
 	mu                  sync.RWMutex
 	running             bool
 	stopSync            chan struct{}
@@ -31,19 +33,24 @@ type Scheduler struct {
 
 // New creates a new scheduler
 func New(database *db.DB, dataDir string) *Scheduler {
-	return &Scheduler{
+	s := &Scheduler{
 		cron:                cron.New(cron.WithSeconds()),
 		db:                  database,
 		executor:            executor.New(database, dataDir),
 		jobs:                make(map[int64]cron.EntryID),
 		cronExprs:           make(map[int64]string),
 		oneOffTimers:        make(map[int64]*time.Timer),
+		retryTimers:         make(map[int64]*time.Timer),
 		stopSync:            make(chan struct{}),
 		leaseHolderID:       fmt.Sprintf("scheduler-%d-%d", os.Getpid(), time.Now().UnixNano()),
 		leaseTTL:            15 * time.Second,
 		leaseRenewInterval:  5 * time.Second,
 		schedulerLeadership: false,
 	}
+	s.executor.SetQueuedRunStarter(func(taskID int64) {
+		go s.startQueued(taskID)
+	})
+	return s
 }
 
 // Start starts the scheduler and leadership maintenance loops.
@@ -83,6 +90,7 @@ func (s *Scheduler) Stop() {
 	holderID := s.leaseHolderID
 	s.schedulerLeadership = false
 	s.clearSchedulesLocked()
+	s.clearRetriesLocked()
 
 	stopSync := s.stopSync
 	syncDone := s.syncDone
@@ -208,7 +216,7 @@ func (s *Scheduler) scheduleTaskLocked(task *db.Task) error {
 	// Create a copy of task ID for the closure
 	taskID := task.ID
 
-	entryID, err := s.cron.AddFunc(task.CronExpr, func() {
+	entryID, err := s.cron.AddFunc(task.CronSpec(), func() {
 		s.mu.RLock()
 		isLeader := s.schedulerLeadership
 		s.mu.RUnlock()
@@ -225,8 +233,17 @@ func (s *Scheduler) scheduleTaskLocked(task *db.Task) error {
 		if !freshTask.Enabled {
 			return
 		}
+
+		// Claim the fire time so a catch-up on another leader does not
+		// run it again
+		fireTime := s.entryPrev(taskID)
+		if claimed, err := s.db.ClaimScheduledFire(taskID, fireTime); err != nil {
+			fmt.Printf("Failed to record fire time for task %d: %v\n", taskID, err)
+		} else if !claimed {
+			return
+		}
 		go func(runTask *db.Task) {
-			result := <-s.executor.ExecuteAsync(runTask)
+			result := s.executeTask(runTask, executor.RunOptions{ScheduledFor: &fireTime})
 			if result != nil && result.Error != nil {
 				fmt.Printf("Failed to execute task %d: %v\n", taskID, result.Error)
 			}
@@ -250,7 +267,7 @@ func (s *Scheduler) scheduleTaskLocked(task *db.Task) error {
 	}
 
 	s.jobs[task.ID] = entryID
-	s.cronExprs[task.ID] = task.CronExpr
+	s.cronExprs[task.ID] = task.CronSpec()
 
 	// Update next run time in DB
 	entry := s.cron.Entry(entryID)
@@ -267,6 +284,18 @@ func (s *Scheduler) scheduleTaskLocked(task *db.Task) error {
 	return nil
 }
 
+// entryPrev returns the fire time of the task's cron job that is running
+func (s *Scheduler) entryPrev(taskID int64) time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if eid, ok := s.jobs[taskID]; ok {
+		if prev := s.cron.Entry(eid).Prev; !prev.IsZero() {
+			return prev
+		}
+	}
+	return time.Now().Truncate(time.Second)
+}
+
 // scheduleOneOffTaskLocked schedules a one-off task
 func (s *Scheduler) scheduleOneOffTaskLocked(task *db.Task) error {
 	// Cancel existing timer if any
@@ -333,7 +362,7 @@ func (s *Scheduler) executeOneOff(taskID int64) {
 	}
 
 	// Execute the task
-	result := <-s.executor.ExecuteAsync(task)
+	result := s.executeTask(task, executor.RunOptions{})
 	if result != nil && result.Error != nil {
 		fmt.Printf("Failed to execute one-off task %d: %v\n", taskID, result.Error)
 	}
@@ -355,7 +384,7 @@ func (s *Scheduler) RunTaskNow(taskID int64) error {
 	}
 
 	go func() {
-		result := <-s.executor.ExecuteAsync(task)
+		result := s.executeTask(task, executor.RunOptions{})
 		if result != nil && result.Error != nil {
 			fmt.Printf("Failed to execute task %d: %v\n", taskID, result.Error)
 		}
@@ -364,6 +393,137 @@ func (s *Scheduler) RunTaskNow(taskID int64) error {
 	return nil
 }
 
+// ExecuteTask runs a task now and waits for the run to finish. Like
+// scheduled runs, a failed run is retried according to the task's retry
+// policy while the scheduler is running.
+func (s *Scheduler) ExecuteTask(task *db.Task) *executor.Result {
+	return s.executeTask(task, executor.RunOptions{})
+}
+
+// executeTask runs a task and, when the run fails in a way covered by the
+// task's retry policy, schedules the next attempt. Runs queued behind it by
+// the task's concurrency policy are started once it finishes.
+func (s *Scheduler) executeTask(task *db.Task, opts executor.RunOptions) *executor.Result {
+	result := s.executor.ExecuteWithOptions(context.Background(), task, opts)
+	s.scheduleRetry(task, opts, result)
+	s.startQueued(task.ID)
+	return result
+}
+
+// startQueued runs the queued runs of a task, applying the retry policy to
+// each of them
+func (s *Scheduler) startQueued(taskID int64) {
+	err := s.executor.StartQueued(context.Background(), taskID, func(task *db.Task, opts executor.RunOptions, result *executor.Result) {
+		if result != nil && result.Error != nil {
+			fmt.Printf("Failed to execute queued run of task %d: %v\n", task.ID, result.Error)
+		}
+		s.scheduleRetry(task, opts, result)
+	})
+	if err != nil {
+		fmt.Printf("Failed to start queued runs of task %d: %v\n", taskID, err)
+	}
+}
+
+// scheduleRetry arms a timer for the next attempt of a failed run. Retries
+// stay with the process that ran the failed attempt and are dropped when
+// the scheduler stops.
+func (s *Scheduler) scheduleRetry(task *db.Task, opts executor.RunOptions, result *executor.Result) {
+	if result == nil || result.RunID == 0 {
+		return
+	}
+	s.scheduleRetryOf(task, opts, result.RunID, result.FailureKind())
+}
+
+// scheduleRetryOf arms the next attempt after a run that failed with the
+// given failure kind
+func (s *Scheduler) scheduleRetryOf(task *db.Task, opts executor.RunOptions, runID int64, kind string) {
+	if kind == "" || !task.RetriesOn(kind) {
+		return
+	}
+
+	attempt := opts.Attempt
+	if attempt < 1 {
+		attempt = 1
+	}
+	if attempt > task.MaxRetries {
+		return
+	}
+
+	parentRunID := runID
+	if opts.ParentRunID != nil {
+		parentRunID = *opts.ParentRunID
+	}
+	next := executor.RunOptions{Attempt: attempt + 1, ParentRunID: &parentRunID, ScheduledFor: opts.ScheduledFor,
+		TriggeredByRunID: opts.TriggeredByRunID}
+	delay := task.RetryDelay(attempt)
+	taskID := task.ID
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.running {
+		return
+	}
+	if timer, ok := s.retryTimers[parentRunID]; ok {
+		timer.Stop()
+	}
+	s.retryTimers[parentRunID] = time.AfterFunc(delay, func() {
+		s.runRetry(taskID, parentRunID, next)
+	})
+	fmt.Printf("Task %d run %d failed (%s), retrying in %s (attempt %d of %d)\n",
+		taskID, runID, kind, delay, next.Attempt, task.MaxRetries+1)
+}
+
+// runRetry executes a scheduled retry attempt
+func (s *Scheduler) runRetry(taskID, parentRunID int64, opts executor.RunOptions) {
+	s.mu.Lock()
+	delete(s.retryTimers, parentRunID)
+	running := s.running
+	s.mu.Unlock()
+	if !running {
+		return
+	}
+
+	// Get fresh task data; a task disabled since the failure is not retried,
+	// except one-off tasks which are disabled after their first attempt
+	task, err := s.db.GetTask(taskID)
+	if err != nil {
+		fmt.Printf("Failed to get task %d for retry: %v\n", taskID, err)
+		return
+	}
+	if !task.Enabled && !task.IsOneOff() {
+		return
+	}
+
+	result := s.executeTask(task, opts)
+	if result != nil && result.Error != nil {
+		fmt.Printf("Failed to execute task %d (attempt %d): %v\n", taskID, opts.Attempt, result.Error)
+	}
+}
+
+// CancelRun requests cancellation of an in-flight run
+func (s *Scheduler) CancelRun(runID int64) error {
+	return s.executor.CancelRun(runID)
+}
+
+// reconcileOrphanedRuns fails runs left "running" by a process that died or
+// stopped heartbeating, and retries them according to the task's policy.
+func (s *Scheduler) reconcileOrphanedRuns() {
+	orphaned, err := s.executor.ReconcileOrphanedRuns()
+	if err != nil {
+		fmt.Printf("Failed to reconcile orphaned runs: %v\n", err)
+	}
+	for _, run := range orphaned {
+		fmt.Printf("Marked orphaned run %d of task %d as failed: %s\n", run.ID, run.TaskID, run.Error)
+		task, err := s.db.GetTask(run.TaskID)
+		if err != nil {
+			continue
+		}
+		opts := executor.RunOptions{Attempt: run.Attempt, ParentRunID: run.ParentRunID, ScheduledFor: run.ScheduledFor,
+			TriggeredByRunID: run.TriggeredByRunID}
+		s.scheduleRetryOf(task, opts, run.ID, db.RetryOnOrphaned)
+	}
+}
+
 // syncLoop periodically renews leadership and syncs tasks from DB.
 func (s *Scheduler) syncLoop(stopSync <-chan struct{}, syncDone chan<- struct{}) {
 	leadershipTicker := time.NewTicker(s.leaseRenewInterval)
@@ -434,6 +594,8 @@ func (s *Scheduler) SyncTasks() {
 		return
 	}
 
+	s.reconcileOrphanedRuns()
+
 	tasks, err := s.db.ListTasks()
 	if err != nil {
 		fmt.Printf("Failed to sync tasks from DB: %v\n", err)
@@ -466,6 +628,20 @@ func (s *Scheduler) SyncTasks() {
 		}
 	}
 
+	// Queue deferred runs whose usage reset has passed; they start below
+	// along with runs left queued by a process that exited before starting
+	// them.
+	if _, err := s.db.ReleaseDueDeferredRuns(time.Now()); err != nil {
+		fmt.Printf("Failed to release deferred runs during sync: %v\n", err)
+	}
+	if queuedTaskIDs, err := s.db.ListTasksWithStartableQueuedRuns(); err != nil {
+		fmt.Printf("Failed to list queued runs during sync: %v\n", err)
+	} else {
+		for _, taskID := range queuedTaskIDs {
+			go s.startQueued(taskID)
+		}
+	}
+
 	// Add/update tasks.
 	for _, task := range tasks {
 		_, hasCronJob := s.jobs[task.ID]
@@ -474,7 +650,11 @@ func (s *Scheduler) SyncTasks() {
 		oldCronExpr := s.cronExprs[task.ID]
 
 		if task.Enabled && !isScheduled {
-			// Task should be scheduled but isn't.
+			// Task should be scheduled but isn't. Fire times missed while
+			// it was not scheduled anywhere are handled first.
+			if !task.IsOneOff() {
+				s.catchUpMisfiresLocked(task, time.Now())
+			}
 			if err := s.scheduleTaskLocked(task); err != nil {
 				fmt.Printf("Failed to schedule task %d during sync: %v\n", task.ID, err)
 			}
@@ -493,8 +673,8 @@ func (s *Scheduler) SyncTasks() {
 			if err := s.scheduleTaskLocked(task); err != nil {
 				fmt.Printf("Failed to reschedule task %d during sync: %v\n", task.ID, err)
 			}
-		} else if task.Enabled && hasCronJob && task.CronExpr != oldCronExpr {
-			// Cron expression changed, reschedule.
+		} else if task.Enabled && hasCronJob && task.CronSpec() != oldCronExpr {
+			// Cron expression or timezone changed, reschedule.
 			if err := s.scheduleTaskLocked(task); err != nil {
 				fmt.Printf("Failed to reschedule task %d during sync: %v\n", task.ID, err)
 			}
@@ -515,6 +695,13 @@ func (s *Scheduler) removeTaskLocked(taskID int64) {
 	}
 }
 
+func (s *Scheduler) clearRetriesLocked() {
+	for runID, timer := range s.retryTimers {
+		timer.Stop()
+		delete(s.retryTimers, runID)
+	}
+}
+
 func (s *Scheduler) clearSchedulesLocked() {
 	for taskID := range s.jobs {
 		s.removeTaskLocked(taskID)
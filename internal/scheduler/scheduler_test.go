@@ -1,6 +1,9 @@
 package scheduler
 
 import (
+	"os"
+	"path/filepath"
+	"runtime"
 	"testing"
 	"time"
 
@@ -86,6 +89,53 @@ func TestAddTaskReturnsErrorWhenPersistingNextRunFails(t *testing.T) {
 	}
 }
 
+func TestCronTaskIsScheduledInTaskTimezone(t *testing.T) {
+	database, dataDir := testutil.NewTestDB(t)
+	s := New(database, dataDir)
+
+	if err := s.Start(); err != nil {
+		t.Fatalf("start scheduler: %v", err)
+	}
+	defer s.Stop()
+
+	task := &db.Task{
+		Name:       "morning",
+		Prompt:     "echo hi",
+		CronExpr:   "0 0 9 * * *",
+		Timezone:   "Asia/Tokyo",
+		WorkingDir: ".",
+		Enabled:    true,
+	}
+	if err := database.CreateTask(task); err != nil {
+		t.Fatalf("create task: %v", err)
+	}
+	if err := s.AddTask(task); err != nil {
+		t.Fatalf("add task: %v", err)
+	}
+
+	next := s.GetNextRunTime(task.ID)
+	if next == nil {
+		t.Fatal("expected a next run time")
+	}
+	if got := next.In(task.Location()); got.Hour() != 9 || got.Minute() != 0 {
+		t.Fatalf("expected 09:00 in %s, got %s", task.Timezone, got)
+	}
+
+	// Changing only the timezone reschedules the task on sync
+	task.Timezone = "America/New_York"
+	if err := database.UpdateTask(task); err != nil {
+		t.Fatalf("update task: %v", err)
+	}
+	s.SyncTasks()
+	next = s.GetNextRunTime(task.ID)
+	if next == nil {
+		t.Fatal("expected a next run time after sync")
+	}
+	if got := next.In(task.Location()); got.Hour() != 9 {
+		t.Fatalf("expected 09:00 in %s after sync, got %s", task.Timezone, got)
+	}
+}
+
 func TestAddAndRemoveOneOffTask(t *testing.T) {
 	database, dataDir := testutil.NewTestDB(t)
 	s := New(database, dataDir)
@@ -215,3 +265,74 @@ func TestSchedulerLeadershipFailoverAfterStop(t *testing.T) {
 		t.Fatalf("expected follower to take leadership after leader stop")
 	}
 }
+
+func TestFailedRunIsRetriedWithAttemptLinkedToFirstRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake claude script requires a POSIX shell")
+	}
+	t.Setenv("CLAUDE_TASKS_DISABLE_USAGE_CHECK", "1")
+	binDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(binDir, "claude"), []byte("#!/bin/sh\nexit 1\n"), 0o755); err != nil {
+		t.Fatalf("write fake claude binary: %v", err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	database, dataDir := testutil.NewTestDB(t)
+	s := New(database, dataDir)
+	if err := s.Start(); err != nil {
+		t.Fatalf("start scheduler: %v", err)
+	}
+	defer s.Stop()
+
+	task := &db.Task{
+		Name:         "flaky",
+		Prompt:       "fail",
+		WorkingDir:   t.TempDir(),
+		MaxRetries:   1,
+		RetryBackoff: time.Second,
+		RetryOn:      []string{db.RetryOnExitError},
+	}
+	if err := database.CreateTask(task); err != nil {
+		t.Fatalf("create task: %v", err)
+	}
+	if err := s.RunTaskNow(task.ID); err != nil {
+		t.Fatalf("run task: %v", err)
+	}
+
+	var runs []*db.TaskRun
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		var err error
+		runs, err = database.GetTaskRuns(task.ID, 10)
+		if err != nil {
+			t.Fatalf("get runs: %v", err)
+		}
+		if len(runs) == 2 && runs[0].EndedAt != nil && runs[1].EndedAt != nil {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if len(runs) != 2 {
+		t.Fatalf("expected first attempt and one retry, got %d runs", len(runs))
+	}
+
+	first, retry := runs[1], runs[0]
+	if first.Attempt != 1 || first.ParentRunID != nil {
+		t.Fatalf("unexpected first attempt: attempt=%d parent=%v", first.Attempt, first.ParentRunID)
+	}
+	if retry.Attempt != 2 || retry.ParentRunID == nil || *retry.ParentRunID != first.ID {
+		t.Fatalf("unexpected retry: attempt=%d parent=%v", retry.Attempt, retry.ParentRunID)
+	}
+	if retry.Status != db.RunStatusFailed {
+		t.Fatalf("expected retry to fail, got %s", retry.Status)
+	}
+
+	// The retry budget is spent, so no further attempts are pending
+	time.Sleep(100 * time.Millisecond)
+	s.mu.RLock()
+	pending := len(s.retryTimers)
+	s.mu.RUnlock()
+	if pending != 0 {
+		t.Fatalf("expected no pending retries, got %d", pending)
+	}
+}
@@ -1,10 +1,12 @@
 package tui
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	osExec "os/exec"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -37,6 +39,10 @@ const (
 	ViewEdit
 	ViewSettings
 	ViewRunHistory
+	ViewTriggers
+	ViewUsage
+	ViewProfiles
+	ViewRunDiff
 )
 
 // KeyMap defines keybindings
@@ -56,6 +62,9 @@ type KeyMap struct {
 	Tab      key.Binding
 	Help     key.Binding
 	Settings key.Binding
+	Triggers key.Binding
+	Usage    key.Binding
+	Profiles key.Binding
 }
 
 var keys = KeyMap{
@@ -74,6 +83,9 @@ var keys = KeyMap{
 	Tab:      key.NewBinding(key.WithKeys("tab"), key.WithHelp("tab", "next field")),
 	Help:     key.NewBinding(key.WithKeys("?"), key.WithHelp("?", "help")),
 	Settings: key.NewBinding(key.WithKeys("s"), key.WithHelp("s", "settings")),
+	Triggers: key.NewBinding(key.WithKeys("g"), key.WithHelp("g", "triggers")),
+	Usage:    key.NewBinding(key.WithKeys("u"), key.WithHelp("u", "usage history")),
+	Profiles: key.NewBinding(key.WithKeys("p"), key.WithHelp("p", "profiles")),
 }
 
 func (k KeyMap) ShortHelp() []key.Binding {
@@ -84,7 +96,7 @@ func (k KeyMap) FullHelp() [][]key.Binding {
 	return [][]key.Binding{
 		{k.Up, k.Down, k.Enter},
 		{k.Add, k.Edit, k.Delete},
-		{k.Toggle, k.Run, k.Quit},
+		{k.Toggle, k.Run, k.Triggers, k.Usage, k.Profiles, k.Quit},
 	}
 }
 
@@ -132,6 +144,11 @@ type Model struct {
 	editingTask    *db.Task
 	formValidation map[int]string // Validation errors per field
 
+	// Rendered prompt preview, shown under the prompt field
+	showPromptPreview bool
+	promptPreview     string
+	promptPreviewErr  error
+
 	// Task type (0 = recurring, 1 = one-off)
 	isOneOff    bool
 	runNow      bool // For one-off: true = run immediately, false = schedule for later
@@ -139,6 +156,15 @@ type Model struct {
 
 	modelIndex          int // index into db.ModelAliases
 	permissionModeIndex int // index into db.PermissionModes
+	concurrencyIndex    int // index into db.ConcurrencyPolicies
+	misfireIndex        int // index into db.MisfirePolicies
+	budgetPeriodIndex   int // index into db.BudgetPeriods
+	usageLimitIndex     int // index into db.UsageLimitPolicies
+	priorityIndex       int // index into db.Priorities
+	sessionModeIndex    int // index into db.SessionModes
+	isolationIndex      int // index into db.IsolationModes
+	worktreeCleanupIdx  int // index into db.WorktreeCleanupPolicies
+	profileIndex        int // index into profileOptions()
 
 	// Cron helper
 	showCronHelper  bool
@@ -156,15 +182,55 @@ type Model struct {
 	runHistoryTable table.Model
 	selectedRun     *db.TaskRun
 	sortedRuns      []*db.TaskRun
+	taskUsage       *db.UsageTotals // All-time usage of the selected task
+	taskBudget      *db.BudgetStatus
+
+	// Live tail of a running run's streamed output
+	liveChunks  []*db.TaskRunChunk
+	liveLastSeq int64
+	liveTailing bool
+	liveFollow  bool
+
+	// Triggers view
+	triggerTask      *db.Task
+	allTriggers      []*db.TaskTrigger
+	triggerCursor    int  // index into the selected task's outgoing triggers
+	triggerAdding    bool // true while the new trigger picker is open
+	triggerTargetIdx int  // index into triggerTargets()
+	triggerCondIdx   int  // index into db.TriggerConditions
+
+	// Usage history view
+	usageRangeIdx   int // index into usageRanges
+	usageProfileIdx int // index into profileOptions()
+	usageSamples    []*db.UsageSample
+	usageRuns       []*db.UsageRun
+
+	// Run diff view
+	diffRun     *db.TaskRun
+	diffChanges *db.RunChanges
+
+	// Account profiles and their usage
+	profiles         []*db.Profile
+	profileClients   *usage.Profiles
+	profileUsage     map[string]*usage.Response
+	profileUsageErrs map[string]error
+	profileCursor    int
+	profileAdding    bool        // true while the profile form is open
+	profileEditing   *db.Profile // nil when adding a profile
+	profileInputs    []textinput.Model
+	profileFocus     int // index into profileInputs
 
 	// Usage tracking
-	usageClient    *usage.Client
-	usageData      *usage.Response
-	usageThreshold float64
-	usageErr       error
+	usageClient     *usage.Client
+	usageData       *usage.Response
+	usageThresholds db.UsageThresholds // Normal priority's, shown in the header
+	usageErr        error
+	globalBudget    *db.BudgetStatus // This month's spending; nil without a monthly budget
 
 	// Settings view
-	thresholdInput textinput.Model
+	thresholdInputs []textinput.Model // Five-hour and seven-day per priority
+	budgetInput     textinput.Model
+	settingsFocus   int // Index into thresholdInputs, then the monthly budget
 
 	// Status
 	statusMsg   string
@@ -189,13 +255,43 @@ type cronPreset struct {
 const (
 	fieldName = iota
 	fieldPrompt
+	fieldPromptVars     // Template variables as key=value pairs
 	fieldTaskType       // "Recurring" or "One-off"
 	fieldModel          // Model alias toggle
 	fieldPermissionMode // Permission mode toggle
 	fieldCron           // Only shown for recurring tasks
 	fieldScheduleMode   // "Run Now" or "Schedule for" - only for one-off
 	fieldScheduledAt    // Datetime input - only for scheduled one-off
+	fieldTimezone       // IANA zone for the schedule, blank for local
+	fieldMisfire        // Misfire policy toggle - only for recurring
 	fieldWorkingDir
+	fieldIsolation       // Isolation toggle
+	fieldWorktreeCleanup // Worktree cleanup toggle - only for worktree isolation
+	fieldEnv             // Environment variables as KEY=value pairs
+	fieldEnvFile         // .env file loaded before the env vars
+	fieldPreHooks        // Commands run before claude
+	fieldPostHooks       // Commands run after claude
+	fieldAssertions      // Checks on the output of completed runs
+	fieldOutputSchema    // JSON Schema for claude's structured output
+	fieldAllowedTools    // Tools claude may use without asking, blank for all
+	fieldDisallowedTools // Tools claude may not use
+	fieldMaxTurns        // Agent turn limit, blank for none
+	fieldSystemPrompt    // Text appended to claude's system prompt
+	fieldMCPConfig       // MCP server config file
+	fieldAddDirs         // Extra directories claude may access
+	fieldSessionMode     // Session mode toggle
+	fieldMaxSessionRuns  // Runs per session thread, blank for the default
+	fieldTimeout         // Run timeout duration, blank for the default
+	fieldConcurrency     // Concurrency policy toggle
+	fieldMaxRetries      // Retries after a failed run, blank for none
+	fieldRetryBackoff    // Delay before the first retry
+	fieldRetryOn         // Failure kinds to retry, blank for all
+	fieldBudgetUSD       // Dollar cap per budget period, blank for none
+	fieldBudgetTokens    // Token cap per budget period, blank for none
+	fieldBudgetPeriod    // Budget period toggle
+	fieldUsageLimit      // Usage limit policy toggle
+	fieldPriority        // Priority toggle
+	fieldProfile         // Account profile toggle
 	fieldDiscordWebhook
 	fieldSlackWebhook
 	fieldCount
@@ -218,6 +314,8 @@ const (
 	uiTickInterval      = time.Second
 	dataRefreshInterval = 5 * time.Second
 	usageRefreshEvery   = 30 * time.Second
+	liveTailInterval    = 500 * time.Millisecond
+	liveTailBatchSize   = 500
 )
 
 // calculateTableColumns returns column definitions sized for the given width
@@ -248,8 +346,8 @@ func calculateTableColumns(width int) []table.Column {
 	if scheduleWidth < 25 {
 		scheduleWidth = 25
 	}
-	if nextWidth < 14 {
-		nextWidth = 14
+	if nextWidth < 22 {
+		nextWidth = 22 // room for the task-zone time
 	}
 	if lastWidth < 14 {
 		lastWidth = 14
@@ -305,18 +403,20 @@ func NewModel(database *db.DB, sched *scheduler.Scheduler, daemonMode bool, data
 		glamour.WithWordWrap(80),
 	)
 
-	// Usage client
+	// Usage client, recording what it fetches for the usage history
 	usageClient, _ := usage.NewClient()
+	if usageClient != nil {
+		usageClient.RecordSamples(database, "")
+	}
 
-	// Load threshold from DB
-	threshold, _ := database.GetUsageThreshold()
+	// Load thresholds from DB
+	thresholds, _ := database.GetUsageThresholds(db.PriorityNormal)
 
-	// Threshold input for settings
-	thresholdInput := textinput.New()
-	thresholdInput.Placeholder = "80"
-	thresholdInput.CharLimit = 3
-	thresholdInput.Width = 10
-	thresholdInput.SetValue(fmt.Sprintf("%.0f", threshold))
+	// Monthly budget input for settings
+	budgetInput := textinput.New()
+	budgetInput.Placeholder = "none"
+	budgetInput.CharLimit = 12
+	budgetInput.Width = 10
 
 	// Search input
 	searchInput := textinput.New()
@@ -364,8 +464,10 @@ func NewModel(database *db.DB, sched *scheduler.Scheduler, daemonMode bool, data
 		viewport:        viewport.New(80, 20),
 		mdRenderer:      renderer,
 		usageClient:     usageClient,
-		usageThreshold:  threshold,
-		thresholdInput:  thresholdInput,
+		usageThresholds: thresholds,
+		profileClients:  usage.NewProfiles(database),
+		thresholdInputs: newThresholdInputs(),
+		budgetInput:     budgetInput,
 		refreshInFlight: true,
 		usageInFlight:   true,
 	}
@@ -393,6 +495,11 @@ func (m *Model) initFormInputs() {
 	m.promptInput.SetHeight(m.getTextareaHeight())
 	m.promptInput.ShowLineNumbers = false
 
+	m.formInputs[fieldPromptVars] = textinput.New()
+	m.formInputs[fieldPromptVars].Placeholder = "repo=api, team=platform"
+	m.formInputs[fieldPromptVars].CharLimit = 1000
+	m.formInputs[fieldPromptVars].Width = inputWidth
+
 	// Task type placeholder (not a real input, just for indexing)
 	m.formInputs[fieldTaskType] = textinput.New()
 	m.formInputs[fieldTaskType].Width = inputWidth
@@ -426,6 +533,13 @@ func (m *Model) initFormInputs() {
 	m.scheduledAt.CharLimit = 20
 	m.scheduledAt.Width = inputWidth
 
+	m.formInputs[fieldTimezone] = textinput.New()
+	m.formInputs[fieldTimezone].Placeholder = "America/New_York"
+	m.formInputs[fieldTimezone].CharLimit = 64
+	m.formInputs[fieldTimezone].Width = inputWidth
+
+	m.formInputs[fieldMisfire] = textinput.New()
+
 	m.formInputs[fieldWorkingDir] = textinput.New()
 	m.formInputs[fieldWorkingDir].Placeholder = "/path/to/project"
 	m.formInputs[fieldWorkingDir].CharLimit = 500
@@ -433,6 +547,111 @@ func (m *Model) initFormInputs() {
 	wd, _ := os.Getwd()
 	m.formInputs[fieldWorkingDir].SetValue(wd)
 
+	m.formInputs[fieldEnv] = textinput.New()
+	m.formInputs[fieldEnv].Placeholder = "GITHUB_TOKEN=${secret:GITHUB_TOKEN}, LOG_LEVEL=debug"
+	m.formInputs[fieldEnv].CharLimit = 2000
+	m.formInputs[fieldEnv].Width = inputWidth
+
+	m.formInputs[fieldEnvFile] = textinput.New()
+	m.formInputs[fieldEnvFile].Placeholder = ".env"
+	m.formInputs[fieldEnvFile].CharLimit = 500
+	m.formInputs[fieldEnvFile].Width = inputWidth
+
+	m.formInputs[fieldPreHooks] = textinput.New()
+	m.formInputs[fieldPreHooks].Placeholder = "git pull ;; [10m] make deps"
+	m.formInputs[fieldPreHooks].CharLimit = 2000
+	m.formInputs[fieldPreHooks].Width = inputWidth
+
+	m.formInputs[fieldPostHooks] = textinput.New()
+	m.formInputs[fieldPostHooks].Placeholder = "go test ./..."
+	m.formInputs[fieldPostHooks].CharLimit = 2000
+	m.formInputs[fieldPostHooks].Width = inputWidth
+
+	m.formInputs[fieldAssertions] = textinput.New()
+	m.formInputs[fieldAssertions].Placeholder = "not_matches: (?i)couldn't access ;; file_exists: report.md"
+	m.formInputs[fieldAssertions].CharLimit = 4000
+	m.formInputs[fieldAssertions].Width = inputWidth
+
+	m.formInputs[fieldOutputSchema] = textinput.New()
+	m.formInputs[fieldOutputSchema].Placeholder = `{"type": "object", "properties": {"cves": {"type": "array"}}}`
+	m.formInputs[fieldOutputSchema].CharLimit = 8000
+	m.formInputs[fieldOutputSchema].Width = inputWidth
+
+	m.formInputs[fieldAllowedTools] = textinput.New()
+	m.formInputs[fieldAllowedTools].Placeholder = "Read, Grep, Bash(git diff:*)"
+	m.formInputs[fieldAllowedTools].CharLimit = 1000
+	m.formInputs[fieldAllowedTools].Width = inputWidth
+
+	m.formInputs[fieldDisallowedTools] = textinput.New()
+	m.formInputs[fieldDisallowedTools].Placeholder = "WebFetch, Bash(rm:*)"
+	m.formInputs[fieldDisallowedTools].CharLimit = 1000
+	m.formInputs[fieldDisallowedTools].Width = inputWidth
+
+	m.formInputs[fieldMaxTurns] = textinput.New()
+	m.formInputs[fieldMaxTurns].Placeholder = "unlimited"
+	m.formInputs[fieldMaxTurns].CharLimit = 4
+	m.formInputs[fieldMaxTurns].Width = inputWidth
+
+	m.formInputs[fieldSystemPrompt] = textinput.New()
+	m.formInputs[fieldSystemPrompt].Placeholder = "Never push to main."
+	m.formInputs[fieldSystemPrompt].CharLimit = 4000
+	m.formInputs[fieldSystemPrompt].Width = inputWidth
+
+	m.formInputs[fieldMCPConfig] = textinput.New()
+	m.formInputs[fieldMCPConfig].Placeholder = ".mcp.json"
+	m.formInputs[fieldMCPConfig].CharLimit = 500
+	m.formInputs[fieldMCPConfig].Width = inputWidth
+
+	m.formInputs[fieldAddDirs] = textinput.New()
+	m.formInputs[fieldAddDirs].Placeholder = "../shared, /srv/docs"
+	m.formInputs[fieldAddDirs].CharLimit = 1000
+	m.formInputs[fieldAddDirs].Width = inputWidth
+
+	m.formInputs[fieldSessionMode] = textinput.New()
+	m.formInputs[fieldIsolation] = textinput.New()
+	m.formInputs[fieldWorktreeCleanup] = textinput.New()
+	m.formInputs[fieldMaxSessionRuns] = textinput.New()
+	m.formInputs[fieldMaxSessionRuns].Placeholder = strconv.Itoa(db.DefaultMaxSessionRuns)
+	m.formInputs[fieldMaxSessionRuns].CharLimit = 4
+	m.formInputs[fieldMaxSessionRuns].Width = inputWidth
+
+	m.formInputs[fieldTimeout] = textinput.New()
+	m.formInputs[fieldTimeout].Placeholder = db.FormatDuration(db.DefaultTimeout)
+	m.formInputs[fieldTimeout].CharLimit = 10
+	m.formInputs[fieldTimeout].Width = inputWidth
+
+	m.formInputs[fieldConcurrency] = textinput.New()
+
+	m.formInputs[fieldMaxRetries] = textinput.New()
+	m.formInputs[fieldMaxRetries].Placeholder = "0"
+	m.formInputs[fieldMaxRetries].CharLimit = 2
+	m.formInputs[fieldMaxRetries].Width = inputWidth
+
+	m.formInputs[fieldRetryBackoff] = textinput.New()
+	m.formInputs[fieldRetryBackoff].Placeholder = db.FormatDuration(db.DefaultRetryBackoff)
+	m.formInputs[fieldRetryBackoff].CharLimit = 10
+	m.formInputs[fieldRetryBackoff].Width = inputWidth
+
+	m.formInputs[fieldRetryOn] = textinput.New()
+	m.formInputs[fieldRetryOn].Placeholder = strings.Join(db.RetryConditions, ",")
+	m.formInputs[fieldRetryOn].CharLimit = 100
+	m.formInputs[fieldRetryOn].Width = inputWidth
+
+	m.formInputs[fieldBudgetUSD] = textinput.New()
+	m.formInputs[fieldBudgetUSD].Placeholder = "5.00"
+	m.formInputs[fieldBudgetUSD].CharLimit = 12
+	m.formInputs[fieldBudgetUSD].Width = inputWidth
+
+	m.formInputs[fieldBudgetTokens] = textinput.New()
+	m.formInputs[fieldBudgetTokens].Placeholder = "500k"
+	m.formInputs[fieldBudgetTokens].CharLimit = 12
+	m.formInputs[fieldBudgetTokens].Width = inputWidth
+
+	m.formInputs[fieldBudgetPeriod] = textinput.New()
+	m.formInputs[fieldUsageLimit] = textinput.New()
+	m.formInputs[fieldPriority] = textinput.New()
+	m.formInputs[fieldProfile] = textinput.New()
+
 	m.formInputs[fieldDiscordWebhook] = textinput.New()
 	m.formInputs[fieldDiscordWebhook].Placeholder = "https://discord.com/api/webhooks/..."
 	m.formInputs[fieldDiscordWebhook].CharLimit = 500
@@ -448,6 +667,18 @@ func (m *Model) initFormInputs() {
 	m.runNow = true
 	m.modelIndex = 0
 	m.permissionModeIndex = 0
+	m.concurrencyIndex = 0
+	m.misfireIndex = 0
+	m.budgetPeriodIndex = len(db.BudgetPeriods) - 1 // month
+	m.usageLimitIndex = 0
+	m.priorityIndex = 1 // normal
+	m.profileIndex = 0  // default account
+	m.sessionModeIndex = 0
+	m.isolationIndex = 0
+	m.worktreeCleanupIdx = 0
+	m.showPromptPreview = false
+	m.promptPreview = ""
+	m.promptPreviewErr = nil
 }
 
 // getFormInputWidth calculates responsive input width
@@ -566,7 +797,10 @@ func (m *Model) getPrevFormField(current int) int {
 // shouldShowField returns true if the field should be shown based on current task type
 func (m *Model) shouldShowField(field int) bool {
 	switch field {
-	case fieldName, fieldPrompt, fieldTaskType, fieldModel, fieldPermissionMode, fieldWorkingDir, fieldDiscordWebhook, fieldSlackWebhook:
+	case fieldName, fieldPrompt, fieldPromptVars, fieldTaskType, fieldModel, fieldPermissionMode, fieldWorkingDir, fieldIsolation, fieldEnv, fieldEnvFile, fieldPreHooks, fieldPostHooks, fieldAssertions, fieldOutputSchema, fieldTimeout,
+		fieldAllowedTools, fieldDisallowedTools, fieldMaxTurns, fieldSystemPrompt, fieldMCPConfig, fieldAddDirs, fieldSessionMode,
+		fieldConcurrency, fieldMaxRetries, fieldRetryBackoff, fieldRetryOn, fieldBudgetUSD, fieldBudgetTokens, fieldBudgetPeriod,
+		fieldUsageLimit, fieldPriority, fieldProfile, fieldDiscordWebhook, fieldSlackWebhook:
 		return true
 	case fieldCron:
 		return !m.isOneOff // Only for recurring tasks
@@ -574,6 +808,14 @@ func (m *Model) shouldShowField(field int) bool {
 		return m.isOneOff // Only for one-off tasks
 	case fieldScheduledAt:
 		return m.isOneOff && !m.runNow // Only for scheduled one-off tasks
+	case fieldMisfire:
+		return !m.isOneOff // Only for recurring tasks
+	case fieldWorktreeCleanup:
+		return db.IsolationModes[m.isolationIndex] == db.IsolationWorktree // Only for worktree isolation
+	case fieldMaxSessionRuns:
+		return db.SessionModes[m.sessionModeIndex] != db.SessionFresh // Only when sessions are resumed
+	case fieldTimezone:
+		return !m.isOneOff || !m.runNow // Only when there is a time to interpret
 	default:
 		return true
 	}
@@ -616,6 +858,18 @@ func (m *Model) updateTable() {
 				statusParts = append(statusParts, "✗")
 			case db.RunStatusRunning:
 				statusParts = append(statusParts, "●")
+			case db.RunStatusCancelled:
+				statusParts = append(statusParts, "⊘")
+			case db.RunStatusTimedOut:
+				statusParts = append(statusParts, "⏱")
+			case db.RunStatusAssertionFailed:
+				statusParts = append(statusParts, "⚠")
+			case db.RunStatusPending:
+				statusParts = append(statusParts, "○")
+			case db.RunStatusSkipped:
+				statusParts = append(statusParts, "↷")
+			case db.RunStatusDeferred:
+				statusParts = append(statusParts, "⏸")
 			}
 		}
 
@@ -632,7 +886,7 @@ func (m *Model) updateTable() {
 
 		nextRun := "-"
 		if next, ok := m.nextRuns[task.ID]; ok {
-			nextRun = formatTime(next)
+			nextRun = formatNextRun(next, task)
 		}
 
 		lastRun := "-"
@@ -646,10 +900,13 @@ func (m *Model) updateTable() {
 			if desc := m.cronToEnglish(task.CronExpr); desc != "" {
 				schedule = desc
 			}
+			if task.Timezone != "" {
+				schedule += " " + time.Now().In(task.Location()).Format("MST")
+			}
 		}
 		if task.IsOneOff() {
 			if task.ScheduledAt != nil {
-				schedule = "Once: " + task.ScheduledAt.Format("Jan 02 15:04")
+				schedule = "Once: " + task.ScheduledAt.In(task.Location()).Format("Jan 02 15:04 MST")
 			} else if task.LastRunAt != nil {
 				schedule = "One-off (ran)"
 			} else {
@@ -668,6 +925,21 @@ func (m *Model) updateTable() {
 	m.table.SetRows(rows)
 }
 
+// formatNextRun renders a next run time in the viewer's zone, adding the
+// wall-clock time in the task's zone when the two differ
+func formatNextRun(next time.Time, task *db.Task) string {
+	local := next.In(time.Local)
+	formatted := formatTime(local)
+	if task.Timezone == "" {
+		return formatted
+	}
+	taskTime := next.In(task.Location())
+	if taskTime.Format("15:04 MST") == local.Format("15:04 MST") {
+		return formatted
+	}
+	return formatted + " (" + taskTime.Format("15:04 MST") + ")"
+}
+
 func formatTime(t time.Time) string {
 	now := time.Now()
 	if t.Before(now) {
@@ -698,6 +970,48 @@ func (m *Model) cronToEnglish(expr string) string {
 	return desc
 }
 
+// formatCost formats a dollar amount, to a tenth of a cent below $1
+func formatCost(usd float64) string {
+	switch {
+	case usd == 0:
+		return "-"
+	case usd < 1:
+		return fmt.Sprintf("$%.3f", usd)
+	default:
+		return fmt.Sprintf("$%.2f", usd)
+	}
+}
+
+// formatTokens formats a token count compactly, e.g. 950, 12.3k or 1.2M
+func formatTokens(n int64) string {
+	switch {
+	case n >= 1_000_000:
+		return fmt.Sprintf("%.1fM", float64(n)/1_000_000)
+	case n >= 1_000:
+		return fmt.Sprintf("%.1fk", float64(n)/1_000)
+	default:
+		return strconv.FormatInt(n, 10)
+	}
+}
+
+// formatRunTokens formats a run's input and output tokens for the run table
+func formatRunTokens(usage db.RunUsage) string {
+	if usage.TotalInputTokens() == 0 && usage.OutputTokens == 0 {
+		return "-"
+	}
+	return formatTokens(usage.TotalInputTokens()) + "/" + formatTokens(usage.OutputTokens)
+}
+
+// formatThread labels the conversation thread of a run as #<first run>·<depth>;
+// empty for a run alone in its thread. threads holds the IDs of the threads
+// that runs have continued.
+func formatThread(run *db.TaskRun, threads map[int64]bool) string {
+	if run.ThreadRunID == nil && !threads[run.ID] {
+		return ""
+	}
+	return fmt.Sprintf("#%d·%d", run.ThreadID(), max(run.ThreadDepth, 1))
+}
+
 func truncate(s string, max int) string {
 	if len(s) <= max {
 		return s
@@ -711,6 +1025,8 @@ type tasksLoadedMsg struct {
 	running  map[int64]bool
 	nextRuns map[int64]time.Time
 	statuses map[int64]db.RunStatus
+	budget   *db.BudgetStatus // Nil without a monthly budget
+	profiles []*db.Profile
 	err      error
 }
 type taskCreatedMsg struct{ task *db.Task }
@@ -719,12 +1035,27 @@ type taskToggledMsg struct {
 	id      int64
 	enabled bool
 }
-type taskRunsLoadedMsg struct{ runs []*db.TaskRun }
+type taskRunsLoadedMsg struct {
+	runs   []*db.TaskRun
+	usage  *db.UsageTotals
+	budget *db.BudgetStatus
+}
 type usageUpdatedMsg struct {
 	data *usage.Response
 	err  error
 }
-type thresholdSavedMsg struct{ threshold float64 }
+type settingsSavedMsg struct {
+	thresholds    db.UsageThresholds
+	monthlyBudget float64
+}
+type runCancelRequestedMsg struct{ runID int64 }
+type runChunksLoadedMsg struct {
+	runID  int64
+	run    *db.TaskRun
+	chunks []*db.TaskRunChunk
+	err    error
+}
+type liveTailTickMsg struct{ runID int64 }
 type errMsg struct{ err error }
 type tickMsg time.Time
 type refreshTickMsg time.Time
@@ -762,6 +1093,12 @@ func refreshTickCmd() tea.Cmd {
 	})
 }
 
+func liveTailTickCmd(runID int64) tea.Cmd {
+	return tea.Tick(liveTailInterval, func(time.Time) tea.Msg {
+		return liveTailTickMsg{runID: runID}
+	})
+}
+
 func usageTickCmd() tea.Cmd {
 	return tea.Tick(usageRefreshEvery, func(t time.Time) tea.Msg {
 		return usageTickMsg(t)
@@ -795,11 +1132,21 @@ func (m *Model) loadTasks() tea.Cmd {
 			}
 		}
 
+		// The header omits the budget if it cannot be loaded
+		budget, _ := m.db.GetGlobalBudgetStatus(time.Now())
+
+		profiles, err := m.db.ListProfiles()
+		if err != nil {
+			return tasksLoadedMsg{err: err}
+		}
+
 		return tasksLoadedMsg{
 			tasks:    tasks,
 			running:  running,
 			nextRuns: nextRuns,
 			statuses: statuses,
+			budget:   budget,
+			profiles: profiles,
 		}
 	}
 }
@@ -842,6 +1189,14 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m.updateRunHistory(msg)
 		case ViewSettings:
 			return m.updateSettings(msg)
+		case ViewTriggers:
+			return m.updateTriggers(msg)
+		case ViewUsage:
+			return m.updateUsageHistory(msg)
+		case ViewProfiles:
+			return m.updateProfiles(msg)
+		case ViewRunDiff:
+			return m.updateRunDiff(msg)
 		}
 
 	case tea.WindowSizeMsg:
@@ -923,6 +1278,9 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if cmd := m.requestUsageRefresh(); cmd != nil {
 			cmds = append(cmds, cmd)
 		}
+		if cmd := m.fetchProfileUsage(); cmd != nil {
+			cmds = append(cmds, cmd)
+		}
 	case tasksLoadedMsg:
 		m.refreshInFlight = false
 		if msg.err != nil {
@@ -932,6 +1290,17 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.nextRuns = msg.nextRuns
 			m.runningTasks = msg.running
 			m.lastRunStatuses = msg.statuses
+			m.globalBudget = msg.budget
+			changed := profilesChanged(m.profiles, msg.profiles)
+			m.profiles = msg.profiles
+			if m.profileCursor >= len(m.profiles) {
+				m.profileCursor = max(len(m.profiles)-1, 0)
+			}
+			if changed {
+				if cmd := m.fetchProfileUsage(); cmd != nil {
+					cmds = append(cmds, cmd)
+				}
+			}
 			m.updateTable()
 		}
 		if m.refreshPending {
@@ -954,10 +1323,18 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				cmds = append(cmds, cmd)
 			}
 		}
-	case thresholdSavedMsg:
-		m.usageThreshold = msg.threshold
-		m.setStatus(fmt.Sprintf("Threshold saved: %.0f%%", msg.threshold), false)
+	case settingsSavedMsg:
+		m.usageThresholds = msg.thresholds
+		status := fmt.Sprintf("Settings saved: normal threshold %s", formatThresholds(msg.thresholds))
+		if msg.monthlyBudget > 0 {
+			status += fmt.Sprintf(", monthly budget $%.2f", msg.monthlyBudget)
+		}
+		m.setStatus(status, false)
 		m.currentView = ViewList
+		// Reload so the header shows the new budget
+		if cmd := m.requestTaskRefresh(); cmd != nil {
+			cmds = append(cmds, cmd)
+		}
 	case taskCreatedMsg:
 		m.setStatus("Task saved: "+msg.task.Name, false)
 		m.currentView = ViewList
@@ -983,8 +1360,49 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			cmds = append(cmds, cmd)
 		}
 
+	case runCancelRequestedMsg:
+		m.setStatus(fmt.Sprintf("Cancellation requested for run #%d", msg.runID), false)
+		if m.selectedTask != nil {
+			cmds = append(cmds, m.loadTaskRuns(m.selectedTask.ID))
+		}
+
+	case liveTailTickMsg:
+		if m.liveTailing && m.currentView == ViewOutput && m.selectedRun != nil && m.selectedRun.ID == msg.runID {
+			cmds = append(cmds, m.loadRunChunks(msg.runID, m.liveLastSeq))
+		}
+
+	case runChunksLoadedMsg:
+		if !m.liveTailing || m.selectedRun == nil || m.selectedRun.ID != msg.runID {
+			break
+		}
+		if msg.err != nil {
+			m.liveTailing = false
+			m.setStatus("Error: "+msg.err.Error(), true)
+			break
+		}
+		m.liveChunks = append(m.liveChunks, msg.chunks...)
+		if n := len(msg.chunks); n > 0 {
+			m.liveLastSeq = msg.chunks[n-1].Seq
+		}
+		m.selectedRun = msg.run
+		switch {
+		case len(msg.chunks) == liveTailBatchSize:
+			// More output is already waiting
+			cmds = append(cmds, m.loadRunChunks(msg.runID, m.liveLastSeq))
+		case msg.run.Status == db.RunStatusRunning || msg.run.Status == db.RunStatusPending:
+			cmds = append(cmds, liveTailTickCmd(msg.runID))
+		default:
+			m.liveTailing = false
+		}
+		m.viewport.SetContent(m.renderSingleRunContent())
+		if m.liveFollow {
+			m.viewport.GotoBottom()
+		}
+
 	case taskRunsLoadedMsg:
 		m.taskRuns = msg.runs
+		m.taskUsage = msg.usage
+		m.taskBudget = msg.budget
 		if m.currentView == ViewRunHistory {
 			m.updateRunHistoryTable()
 		} else if m.currentView == ViewOutput && m.selectedRun != nil {
@@ -995,6 +1413,41 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.viewport.GotoTop()
 		}
 
+	case profileUsageMsg:
+		m.profileUsage = msg.data
+		m.profileUsageErrs = msg.errs
+
+	case profileChangedMsg:
+		m.setStatus(msg.status, false)
+		m.profileAdding = false
+		if cmd := m.requestTaskRefresh(); cmd != nil {
+			cmds = append(cmds, cmd)
+		}
+
+	case usageHistoryLoadedMsg:
+		m.usageSamples = msg.samples
+		m.usageRuns = msg.runs
+
+	case runDiffLoadedMsg:
+		if m.currentView == ViewRunHistory {
+			m.openRunDiff(msg)
+		}
+
+	case triggersLoadedMsg:
+		m.allTriggers = msg.triggers
+		if n := len(m.outgoingTriggers()); m.triggerCursor >= n {
+			m.triggerCursor = max(n-1, 0)
+		}
+
+	case promptPreviewMsg:
+		m.promptPreview = msg.rendered
+		m.promptPreviewErr = msg.err
+
+	case triggerChangedMsg:
+		m.setStatus(msg.status, false)
+		m.triggerAdding = false
+		cmds = append(cmds, m.loadTriggers())
+
 	case errMsg:
 		m.setStatus("Error: "+msg.err.Error(), true)
 	}
@@ -1156,13 +1609,48 @@ func (m *Model) updateList(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 				m.promptInput.SetValue(m.editingTask.Prompt)
 				m.formInputs[fieldCron].SetValue(m.editingTask.CronExpr)
 				m.formInputs[fieldWorkingDir].SetValue(m.editingTask.WorkingDir)
+				m.formInputs[fieldEnv].SetValue(formatPairs(m.editingTask.Env))
+				m.formInputs[fieldEnvFile].SetValue(m.editingTask.EnvFile)
+				m.formInputs[fieldPreHooks].SetValue(formatHooks(m.editingTask.PreHooks))
+				m.formInputs[fieldPostHooks].SetValue(formatHooks(m.editingTask.PostHooks))
+				m.formInputs[fieldAssertions].SetValue(formatAssertions(m.editingTask.Assertions))
+				m.formInputs[fieldOutputSchema].SetValue(string(m.editingTask.OutputSchema))
+				m.formInputs[fieldAllowedTools].SetValue(strings.Join(m.editingTask.AllowedTools, ", "))
+				m.formInputs[fieldDisallowedTools].SetValue(strings.Join(m.editingTask.DisallowedTools, ", "))
+				if m.editingTask.MaxTurns > 0 {
+					m.formInputs[fieldMaxTurns].SetValue(strconv.Itoa(m.editingTask.MaxTurns))
+				}
+				m.formInputs[fieldSystemPrompt].SetValue(m.editingTask.AppendSystemPrompt)
+				m.formInputs[fieldMCPConfig].SetValue(m.editingTask.MCPConfig)
+				m.formInputs[fieldAddDirs].SetValue(strings.Join(m.editingTask.AddDirs, ", "))
+				if m.editingTask.MaxSessionRuns > 0 {
+					m.formInputs[fieldMaxSessionRuns].SetValue(strconv.Itoa(m.editingTask.MaxSessionRuns))
+				}
 				m.formInputs[fieldDiscordWebhook].SetValue(m.editingTask.DiscordWebhook)
 				m.formInputs[fieldSlackWebhook].SetValue(m.editingTask.SlackWebhook)
+				if m.editingTask.Timeout > 0 {
+					m.formInputs[fieldTimeout].SetValue(db.FormatDuration(m.editingTask.Timeout))
+				}
+				if m.editingTask.MaxRetries > 0 {
+					m.formInputs[fieldMaxRetries].SetValue(strconv.Itoa(m.editingTask.MaxRetries))
+				}
+				if m.editingTask.RetryBackoff > 0 {
+					m.formInputs[fieldRetryBackoff].SetValue(db.FormatDuration(m.editingTask.RetryBackoff))
+				}
+				m.formInputs[fieldRetryOn].SetValue(strings.Join(m.editingTask.RetryOn, ","))
+				m.formInputs[fieldTimezone].SetValue(m.editingTask.Timezone)
+				m.formInputs[fieldPromptVars].SetValue(formatPairs(m.editingTask.PromptVars))
+				if m.editingTask.BudgetUSD > 0 {
+					m.formInputs[fieldBudgetUSD].SetValue(strconv.FormatFloat(m.editingTask.BudgetUSD, 'f', -1, 64))
+				}
+				if m.editingTask.BudgetTokens > 0 {
+					m.formInputs[fieldBudgetTokens].SetValue(strconv.FormatInt(m.editingTask.BudgetTokens, 10))
+				}
 				// Set task type state from existing task
 				m.isOneOff = m.editingTask.IsOneOff()
 				if m.isOneOff && m.editingTask.ScheduledAt != nil {
 					m.runNow = false
-					m.scheduledAt.SetValue(m.editingTask.ScheduledAt.Format("2006-01-02 15:04"))
+					m.scheduledAt.SetValue(m.editingTask.ScheduledAt.In(m.editingTask.Location()).Format("2006-01-02 15:04"))
 				} else {
 					m.runNow = true
 				}
@@ -1182,14 +1670,103 @@ func (m *Model) updateList(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 						break
 					}
 				}
+				// Set concurrency policy index
+				m.concurrencyIndex = 0
+				for i, policy := range db.ConcurrencyPolicies {
+					if policy == m.editingTask.EffectiveConcurrencyPolicy() {
+						m.concurrencyIndex = i
+						break
+					}
+				}
+				// Set misfire policy index
+				m.misfireIndex = 0
+				for i, policy := range db.MisfirePolicies {
+					if policy == m.editingTask.EffectiveMisfirePolicy() {
+						m.misfireIndex = i
+						break
+					}
+				}
+				// Set budget period index
+				for i, period := range db.BudgetPeriods {
+					if period == m.editingTask.EffectiveBudgetPeriod() {
+						m.budgetPeriodIndex = i
+						break
+					}
+				}
+				// Set usage limit policy index
+				for i, policy := range db.UsageLimitPolicies {
+					if policy == m.editingTask.EffectiveUsageLimitPolicy() {
+						m.usageLimitIndex = i
+						break
+					}
+				}
+				// Set priority index
+				for i, priority := range db.Priorities {
+					if priority == m.editingTask.EffectivePriority() {
+						m.priorityIndex = i
+						break
+					}
+				}
+				// Set session mode index
+				for i, mode := range db.SessionModes {
+					if mode == m.editingTask.EffectiveSessionMode() {
+						m.sessionModeIndex = i
+						break
+					}
+				}
+				// Set isolation and worktree cleanup indexes
+				for i, mode := range db.IsolationModes {
+					if mode == m.editingTask.EffectiveIsolation() {
+						m.isolationIndex = i
+						break
+					}
+				}
+				for i, policy := range db.WorktreeCleanupPolicies {
+					if policy == m.editingTask.EffectiveWorktreeCleanup() {
+						m.worktreeCleanupIdx = i
+						break
+					}
+				}
+				// Set profile index
+				for i, profile := range m.profileOptions() {
+					if profile == m.editingTask.Profile {
+						m.profileIndex = i
+						break
+					}
+				}
 				m.focusFormField(fieldName)
 				return m, textinput.Blink
 			}
 		}
+	case "g":
+		tasksToUse := m.getDisplayTasks()
+		if len(tasksToUse) > 0 {
+			idx := m.table.Cursor()
+			if idx < len(tasksToUse) {
+				m.triggerTask = tasksToUse[idx]
+				m.triggerCursor = 0
+				m.triggerAdding = false
+				m.currentView = ViewTriggers
+				return m, m.loadTriggers()
+			}
+		}
+	case "u":
+		m.usageRangeIdx = defaultUsageRange
+		m.usageProfileIdx = 0
+		m.currentView = ViewUsage
+		return m, m.loadUsageHistory()
+	case "p":
+		m.profileAdding = false
+		m.currentView = ViewProfiles
+		return m, m.fetchProfileUsage()
 	case "s":
 		m.currentView = ViewSettings
-		m.thresholdInput.SetValue(fmt.Sprintf("%.0f", m.usageThreshold))
-		m.thresholdInput.Focus()
+		m.loadThresholdInputs()
+		m.budgetInput.SetValue("")
+		if monthlyBudget, err := m.db.GetMonthlyBudget(); err == nil && monthlyBudget > 0 {
+			m.budgetInput.SetValue(strconv.FormatFloat(monthlyBudget, 'f', -1, 64))
+		}
+		m.focusSettingsInput(0)
 		return m, textinput.Blink
 	default:
 		// Only forward to table if we have rows
@@ -1228,6 +1805,14 @@ func (m *Model) filterTasks() {
 }
 
 // validateForm validates all form fields and returns true if valid
+// formLocation returns the zone entered on the form, or local if it is blank
+// or invalid
+func (m *Model) formLocation() *time.Location {
+	task := db.Task{}
+	task.Timezone, _ = db.ParseTimezone(m.formInputs[fieldTimezone].Value())
+	return task.Location()
+}
+
 func (m *Model) validateForm() bool {
 	m.formValidation = make(map[int]string)
 	valid := true
@@ -1244,6 +1829,13 @@ func (m *Model) validateForm() bool {
 	if prompt == "" {
 		m.formValidation[fieldPrompt] = "Prompt is required"
 		valid = false
+	} else if err := validatePromptTemplate(prompt); err != nil {
+		m.formValidation[fieldPrompt] = err.Error()
+		valid = false
+	}
+	if _, err := parsePromptVars(m.formInputs[fieldPromptVars].Value()); err != nil {
+		m.formValidation[fieldPromptVars] = err.Error()
+		valid = false
 	}
 
 	// Validation depends on task type
@@ -1256,7 +1848,7 @@ func (m *Model) validateForm() bool {
 				valid = false
 			} else {
 				// Try parsing the datetime
-				_, err := time.ParseInLocation("2006-01-02 15:04", scheduledAtStr, time.Local)
+				_, err := time.ParseInLocation("2006-01-02 15:04", scheduledAtStr, m.formLocation())
 				if err != nil {
 					m.formValidation[fieldScheduledAt] = "Invalid format (use YYYY-MM-DD HH:MM)"
 					valid = false
@@ -1287,6 +1879,79 @@ func (m *Model) validateForm() bool {
 			valid = false
 		}
 	}
+	if _, err := parseEnv(m.formInputs[fieldEnv].Value()); err != nil {
+		m.formValidation[fieldEnv] = err.Error()
+		valid = false
+	}
+	for _, field := range []int{fieldPreHooks, fieldPostHooks} {
+		if _, err := parseHooks(m.formInputs[field].Value()); err != nil {
+			m.formValidation[field] = err.Error()
+			valid = false
+		}
+	}
+	if _, err := parseAssertions(m.formInputs[fieldAssertions].Value()); err != nil {
+		m.formValidation[fieldAssertions] = err.Error()
+		valid = false
+	}
+	if _, err := parseOutputSchema(m.formInputs[fieldOutputSchema].Value()); err != nil {
+		m.formValidation[fieldOutputSchema] = err.Error()
+		valid = false
+	}
+
+	// Validate claude options
+	for _, field := range []int{fieldAllowedTools, fieldDisallowedTools} {
+		if _, err := db.ParseToolList(m.formInputs[field].Value()); err != nil {
+			m.formValidation[field] = err.Error()
+			valid = false
+		}
+	}
+	if _, err := db.ParseMaxTurns(m.formInputs[fieldMaxTurns].Value()); err != nil {
+		m.formValidation[fieldMaxTurns] = err.Error()
+		valid = false
+	}
+	if _, err := db.ParseMaxSessionRuns(m.formInputs[fieldMaxSessionRuns].Value()); err != nil {
+		m.formValidation[fieldMaxSessionRuns] = err.Error()
+		valid = false
+	}
+	if mcpConfig := strings.TrimSpace(m.formInputs[fieldMCPConfig].Value()); mcpConfig != "" {
+		task := &db.Task{WorkingDir: workDir, MCPConfig: mcpConfig}
+		if info, err := os.Stat(task.ResolveMCPConfig()); err != nil || info.IsDir() {
+			m.formValidation[fieldMCPConfig] = "File not found"
+			valid = false
+		}
+	}
+
+	// Validate timeout (blank uses the default)
+	if _, err := db.ParseTimeout(m.formInputs[fieldTimeout].Value()); err != nil {
+		m.formValidation[fieldTimeout] = "Invalid timeout (e.g. 5m, 2h; max 24h)"
+		valid = false
+	}
+
+	// Validate retry policy
+	if _, err := parseMaxRetries(m.formInputs[fieldMaxRetries].Value()); err != nil {
+		m.formValidation[fieldMaxRetries] = fmt.Sprintf("Enter 0-%d", db.MaxRetries)
+		valid = false
+	}
+	if _, err := db.ParseRetryBackoff(m.formInputs[fieldRetryBackoff].Value()); err != nil {
+		m.formValidation[fieldRetryBackoff] = "Invalid backoff (e.g. 30s, 5m; max 6h)"
+		valid = false
+	}
+	if _, err := db.ParseTimezone(m.formInputs[fieldTimezone].Value()); err != nil {
+		m.formValidation[fieldTimezone] = "Unknown timezone (e.g. UTC, America/New_York)"
+		valid = false
+	}
+	if _, err := db.ParseRetryOn(m.formInputs[fieldRetryOn].Value()); err != nil {
+		m.formValidation[fieldRetryOn] = "Use " + strings.Join(db.RetryConditions, ", ")
+		valid = false
+	}
+	if _, err := db.ParseBudgetUSD(m.formInputs[fieldBudgetUSD].Value()); err != nil {
+		m.formValidation[fieldBudgetUSD] = "Invalid budget (e.g. 5 or 2.50)"
+		valid = false
+	}
+	if _, err := db.ParseTokenBudget(m.formInputs[fieldBudgetTokens].Value()); err != nil {
+		m.formValidation[fieldBudgetTokens] = "Invalid token budget (e.g. 500000, 500k, 2m)"
+		valid = false
+	}
 
 	return valid
 }
@@ -1355,6 +2020,79 @@ func (m *Model) updateForm(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			}
 			return m, nil
 		}
+		if m.formFocus == fieldConcurrency {
+			if msg.String() == "right" || msg.String() == "l" {
+				m.concurrencyIndex = (m.concurrencyIndex + 1) % len(db.ConcurrencyPolicies)
+			} else {
+				m.concurrencyIndex = (m.concurrencyIndex - 1 + len(db.ConcurrencyPolicies)) % len(db.ConcurrencyPolicies)
+			}
+			return m, nil
+		}
+		if m.formFocus == fieldMisfire {
+			if msg.String() == "right" || msg.String() == "l" {
+				m.misfireIndex = (m.misfireIndex + 1) % len(db.MisfirePolicies)
+			} else {
+				m.misfireIndex = (m.misfireIndex - 1 + len(db.MisfirePolicies)) % len(db.MisfirePolicies)
+			}
+			return m, nil
+		}
+		if m.formFocus == fieldBudgetPeriod {
+			if msg.String() == "right" || msg.String() == "l" {
+				m.budgetPeriodIndex = (m.budgetPeriodIndex + 1) % len(db.BudgetPeriods)
+			} else {
+				m.budgetPeriodIndex = (m.budgetPeriodIndex - 1 + len(db.BudgetPeriods)) % len(db.BudgetPeriods)
+			}
+			return m, nil
+		}
+		if m.formFocus == fieldUsageLimit {
+			if msg.String() == "right" || msg.String() == "l" {
+				m.usageLimitIndex = (m.usageLimitIndex + 1) % len(db.UsageLimitPolicies)
+			} else {
+				m.usageLimitIndex = (m.usageLimitIndex - 1 + len(db.UsageLimitPolicies)) % len(db.UsageLimitPolicies)
+			}
+			return m, nil
+		}
+		if m.formFocus == fieldPriority {
+			if msg.String() == "right" || msg.String() == "l" {
+				m.priorityIndex = (m.priorityIndex + 1) % len(db.Priorities)
+			} else {
+				m.priorityIndex = (m.priorityIndex - 1 + len(db.Priorities)) % len(db.Priorities)
+			}
+			return m, nil
+		}
+		if m.formFocus == fieldIsolation {
+			if msg.String() == "right" || msg.String() == "l" {
+				m.isolationIndex = (m.isolationIndex + 1) % len(db.IsolationModes)
+			} else {
+				m.isolationIndex = (m.isolationIndex - 1 + len(db.IsolationModes)) % len(db.IsolationModes)
+			}
+			return m, nil
+		}
+		if m.formFocus == fieldWorktreeCleanup {
+			if msg.String() == "right" || msg.String() == "l" {
+				m.worktreeCleanupIdx = (m.worktreeCleanupIdx + 1) % len(db.WorktreeCleanupPolicies)
+			} else {
+				m.worktreeCleanupIdx = (m.worktreeCleanupIdx - 1 + len(db.WorktreeCleanupPolicies)) % len(db.WorktreeCleanupPolicies)
+			}
+			return m, nil
+		}
+		if m.formFocus == fieldSessionMode {
+			if msg.String() == "right" || msg.String() == "l" {
+				m.sessionModeIndex = (m.sessionModeIndex + 1) % len(db.SessionModes)
+			} else {
+				m.sessionModeIndex = (m.sessionModeIndex - 1 + len(db.SessionModes)) % len(db.SessionModes)
+			}
+			return m, nil
+		}
+		if m.formFocus == fieldProfile {
+			options := m.profileOptions()
+			if msg.String() == "right" || msg.String() == "l" {
+				m.profileIndex = (m.profileIndex + 1) % len(options)
+			} else {
+				m.profileIndex = (m.profileIndex - 1 + len(options)) % len(options)
+			}
+			return m, nil
+		}
 		if m.formFocus == fieldScheduleMode && m.isOneOff {
 			m.runNow = !m.runNow
 			m.validateForm()
@@ -1375,6 +2113,9 @@ func (m *Model) updateForm(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			return m, m.saveTask()
 		}
 		return m, nil
+	case "ctrl+p":
+		m.showPromptPreview = true
+		return m, m.previewPrompt()
 	case "enter":
 		// In textarea (prompt), enter adds newline - don't navigate
 		if m.formFocus == fieldPrompt {
@@ -1396,12 +2137,19 @@ func (m *Model) updateForm(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return m, textinput.Blink
 	}
 
-	// Update the focused input
+	// Update the focused input; a shown preview is stale once the
+	// template changes
+	if m.formFocus == fieldPrompt || m.formFocus == fieldPromptVars {
+		m.showPromptPreview = false
+	}
 	if m.formFocus == fieldPrompt {
 		m.promptInput, cmd = m.promptInput.Update(msg)
 	} else if m.formFocus == fieldScheduledAt {
 		m.scheduledAt, cmd = m.scheduledAt.Update(msg)
-	} else if m.formFocus != fieldTaskType && m.formFocus != fieldModel && m.formFocus != fieldPermissionMode && m.formFocus != fieldScheduleMode {
+	} else if m.formFocus != fieldTaskType && m.formFocus != fieldModel && m.formFocus != fieldPermissionMode && m.formFocus != fieldScheduleMode &&
+		m.formFocus != fieldConcurrency && m.formFocus != fieldMisfire && m.formFocus != fieldBudgetPeriod &&
+		m.formFocus != fieldUsageLimit && m.formFocus != fieldPriority && m.formFocus != fieldProfile && m.formFocus != fieldSessionMode &&
+		m.formFocus != fieldIsolation && m.formFocus != fieldWorktreeCleanup {
 		// Don't update toggle fields as text inputs
 		m.formInputs[m.formFocus], cmd = m.formInputs[m.formFocus].Update(msg)
 	}
@@ -1417,6 +2165,7 @@ func (m *Model) updateOutput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 
 	switch msg.String() {
 	case "esc", "q":
+		m.liveTailing = false
 		if m.selectedRun != nil {
 			m.selectedRun = nil
 			m.currentView = ViewRunHistory
@@ -1428,9 +2177,21 @@ func (m *Model) updateOutput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return m, m.loadTaskRuns(m.selectedTask.ID)
 	case "t":
 		return m, m.toggleTask(m.selectedTask.ID)
+	case "f":
+		if m.liveTailing {
+			m.liveFollow = !m.liveFollow
+			if m.liveFollow {
+				m.viewport.GotoBottom()
+			}
+			return m, nil
+		}
 	}
 
 	m.viewport, cmd = m.viewport.Update(msg)
+	// Scrolling away from the bottom stops following new output
+	if m.liveFollow && !m.viewport.AtBottom() {
+		m.liveFollow = false
+	}
 	return m, cmd
 }
 
@@ -1442,28 +2203,57 @@ func (m *Model) updateSettings(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		m.currentView = ViewList
 		return m, nil
 	case "enter", "ctrl+s":
-		return m, m.saveThreshold()
+		return m, m.saveSettings()
+	case "tab", "shift+tab", "up", "down":
+		step := 1
+		if msg.String() == "shift+tab" || msg.String() == "up" {
+			step = m.settingsInputCount() - 1
+		}
+		m.focusSettingsInput((m.settingsFocus + step) % m.settingsInputCount())
+		return m, textinput.Blink
 	}
 
-	m.thresholdInput, cmd = m.thresholdInput.Update(msg)
+	if m.settingsFocus < len(m.thresholdInputs) {
+		m.thresholdInputs[m.settingsFocus], cmd = m.thresholdInputs[m.settingsFocus].Update(msg)
+	} else {
+		m.budgetInput, cmd = m.budgetInput.Update(msg)
+	}
 	return m, cmd
 }
 
-func (m *Model) saveThreshold() tea.Cmd {
+func (m *Model) saveSettings() tea.Cmd {
 	return func() tea.Msg {
-		val := strings.TrimSpace(m.thresholdInput.Value())
-		var threshold float64
-		if _, err := fmt.Sscanf(val, "%f", &threshold); err != nil {
-			return errMsg{fmt.Errorf("invalid threshold value")}
+		thresholds, err := m.parseThresholdInputs()
+		if err != nil {
+			return errMsg{err}
+		}
+		monthlyBudget, err := db.ParseBudgetUSD(m.budgetInput.Value())
+		if err != nil {
+			return errMsg{err}
 		}
-		if threshold < 0 || threshold > 100 {
-			return errMsg{fmt.Errorf("threshold must be between 0 and 100")}
+		for _, priority := range db.Priorities {
+			if err := m.db.SetUsageThresholds(priority, thresholds[priority]); err != nil {
+				return errMsg{err}
+			}
 		}
-		if err := m.db.SetUsageThreshold(threshold); err != nil {
+		if err := m.db.SetMonthlyBudget(monthlyBudget); err != nil {
 			return errMsg{err}
 		}
-		return thresholdSavedMsg{threshold: threshold}
+		return settingsSavedMsg{thresholds: thresholds[db.PriorityNormal], monthlyBudget: monthlyBudget}
+	}
+}
+
+// parseMaxRetries parses the max retries form field; blank means no retries
+func parseMaxRetries(value string) (int, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 || n > db.MaxRetries {
+		return 0, fmt.Errorf("max retries must be a number from 0 to %d", db.MaxRetries)
 	}
+	return n, nil
 }
 
 func (m *Model) saveTask() tea.Cmd {
@@ -1482,55 +2272,160 @@ func (m *Model) saveTask() tea.Cmd {
 			workingDir = "."
 		}
 
-		task := &db.Task{
-			Name:           name,
-			Prompt:         prompt,
-			WorkingDir:     workingDir,
-			DiscordWebhook: discordWebhook,
-			SlackWebhook:   slackWebhook,
-			Model:          db.ModelAliases[m.modelIndex],
-			PermissionMode: db.PermissionModes[m.permissionModeIndex],
-			Enabled:        true,
+		timeout, err := db.ParseTimeout(m.formInputs[fieldTimeout].Value())
+		if err != nil {
+			return errMsg{err}
 		}
-
-		// Handle task type
-		if m.isOneOff {
-			// One-off task: CronExpr is empty
-			task.CronExpr = ""
-			if !m.runNow {
-				// Parse scheduled time
-				scheduledAtStr := strings.TrimSpace(m.scheduledAt.Value())
-				if scheduledAtStr != "" {
-					scheduledAt, err := time.ParseInLocation("2006-01-02 15:04", scheduledAtStr, time.Local)
-					if err != nil {
-						return errMsg{fmt.Errorf("invalid schedule time format")}
-					}
-					task.ScheduledAt = &scheduledAt
-				}
-			}
-			// If runNow, ScheduledAt stays nil (runs immediately)
-		} else {
-			// Recurring task: requires cron expression
-			cronExpr := strings.TrimSpace(m.formInputs[fieldCron].Value())
-			if cronExpr == "" {
-				return errMsg{fmt.Errorf("cron expression is required for recurring tasks")}
-			}
-			task.CronExpr = cronExpr
+		maxRetries, err := parseMaxRetries(m.formInputs[fieldMaxRetries].Value())
+		if err != nil {
+			return errMsg{err}
 		}
-
-		if m.editingTask != nil {
-			task.ID = m.editingTask.ID
-			task.CreatedAt = m.editingTask.CreatedAt
-			task.Enabled = m.editingTask.Enabled
-			if err := m.db.UpdateTask(task); err != nil {
-				return errMsg{err}
-			}
-			if m.scheduler != nil {
-				_ = m.scheduler.UpdateTask(task)
-			}
-		} else {
-			if err := m.db.CreateTask(task); err != nil {
-				return errMsg{err}
+		retryBackoff, err := db.ParseRetryBackoff(m.formInputs[fieldRetryBackoff].Value())
+		if err != nil {
+			return errMsg{err}
+		}
+		retryOn, err := db.ParseRetryOn(m.formInputs[fieldRetryOn].Value())
+		if err != nil {
+			return errMsg{err}
+		}
+		timezone, err := db.ParseTimezone(m.formInputs[fieldTimezone].Value())
+		if err != nil {
+			return errMsg{err}
+		}
+		promptVars, err := parsePromptVars(m.formInputs[fieldPromptVars].Value())
+		if err != nil {
+			return errMsg{err}
+		}
+		env, err := parseEnv(m.formInputs[fieldEnv].Value())
+		if err != nil {
+			return errMsg{err}
+		}
+		preHooks, err := parseHooks(m.formInputs[fieldPreHooks].Value())
+		if err != nil {
+			return errMsg{err}
+		}
+		postHooks, err := parseHooks(m.formInputs[fieldPostHooks].Value())
+		if err != nil {
+			return errMsg{err}
+		}
+		assertions, err := parseAssertions(m.formInputs[fieldAssertions].Value())
+		if err != nil {
+			return errMsg{err}
+		}
+		outputSchema, err := parseOutputSchema(m.formInputs[fieldOutputSchema].Value())
+		if err != nil {
+			return errMsg{err}
+		}
+		allowedTools, err := db.ParseToolList(m.formInputs[fieldAllowedTools].Value())
+		if err != nil {
+			return errMsg{err}
+		}
+		disallowedTools, err := db.ParseToolList(m.formInputs[fieldDisallowedTools].Value())
+		if err != nil {
+			return errMsg{err}
+		}
+		maxTurns, err := db.ParseMaxTurns(m.formInputs[fieldMaxTurns].Value())
+		if err != nil {
+			return errMsg{err}
+		}
+		maxSessionRuns, err := db.ParseMaxSessionRuns(m.formInputs[fieldMaxSessionRuns].Value())
+		if err != nil {
+			return errMsg{err}
+		}
+		budgetUSD, err := db.ParseBudgetUSD(m.formInputs[fieldBudgetUSD].Value())
+		if err != nil {
+			return errMsg{err}
+		}
+		budgetTokens, err := db.ParseTokenBudget(m.formInputs[fieldBudgetTokens].Value())
+		if err != nil {
+			return errMsg{err}
+		}
+
+		task := &db.Task{Enabled: true}
+		if m.editingTask != nil {
+			// Start from the stored task so settings not on the form are kept
+			*task = *m.editingTask
+		}
+		task.Name = name
+		task.Prompt = prompt
+		task.WorkingDir = workingDir
+		task.DiscordWebhook = discordWebhook
+		task.SlackWebhook = slackWebhook
+		task.Model = db.ModelAliases[m.modelIndex]
+		task.PermissionMode = db.PermissionModes[m.permissionModeIndex]
+		task.ConcurrencyPolicy = db.ConcurrencyPolicies[m.concurrencyIndex]
+		task.MisfirePolicy = db.MisfirePolicies[m.misfireIndex]
+		task.Timeout = timeout
+		task.MaxRetries = maxRetries
+		task.RetryBackoff = retryBackoff
+		task.RetryOn = retryOn
+		task.Timezone = timezone
+		task.PromptVars = promptVars
+		task.Env = env
+		task.EnvFile = strings.TrimSpace(m.formInputs[fieldEnvFile].Value())
+		task.PreHooks = preHooks
+		task.PostHooks = postHooks
+		task.Assertions = assertions
+		task.OutputSchema = outputSchema
+		task.AllowedTools = allowedTools
+		task.DisallowedTools = disallowedTools
+		task.MaxTurns = maxTurns
+		task.AppendSystemPrompt = strings.TrimSpace(m.formInputs[fieldSystemPrompt].Value())
+		task.MCPConfig = strings.TrimSpace(m.formInputs[fieldMCPConfig].Value())
+		task.AddDirs = splitDirs(m.formInputs[fieldAddDirs].Value())
+		task.SessionMode = db.SessionModes[m.sessionModeIndex]
+		task.Isolation = db.IsolationModes[m.isolationIndex]
+		task.WorktreeCleanup = db.WorktreeCleanupPolicies[m.worktreeCleanupIdx]
+		task.MaxSessionRuns = maxSessionRuns
+		task.BudgetUSD = budgetUSD
+		task.BudgetTokens = budgetTokens
+		task.BudgetPeriod = ""
+		if task.HasBudget() {
+			task.BudgetPeriod = db.BudgetPeriods[m.budgetPeriodIndex]
+		}
+		task.OnUsageLimit = db.UsageLimitPolicies[m.usageLimitIndex]
+		task.Priority = db.Priorities[m.priorityIndex]
+		if options := m.profileOptions(); m.profileIndex < len(options) {
+			task.Profile = options[m.profileIndex]
+		}
+
+		// Handle task type
+		if m.isOneOff {
+			// One-off task: CronExpr is empty
+			task.CronExpr = ""
+			task.ScheduledAt = nil
+			if !m.runNow {
+				// Parse scheduled time
+				scheduledAtStr := strings.TrimSpace(m.scheduledAt.Value())
+				if scheduledAtStr != "" {
+					scheduledAt, err := time.ParseInLocation("2006-01-02 15:04", scheduledAtStr, task.Location())
+					if err != nil {
+						return errMsg{fmt.Errorf("invalid schedule time format")}
+					}
+					task.ScheduledAt = &scheduledAt
+				}
+			}
+			// If runNow, ScheduledAt stays nil (runs immediately)
+		} else {
+			// Recurring task: requires cron expression
+			cronExpr := strings.TrimSpace(m.formInputs[fieldCron].Value())
+			if cronExpr == "" {
+				return errMsg{fmt.Errorf("cron expression is required for recurring tasks")}
+			}
+			task.CronExpr = cronExpr
+			task.ScheduledAt = nil
+		}
+
+		if m.editingTask != nil {
+			if err := m.db.UpdateTask(task); err != nil {
+				return errMsg{err}
+			}
+			if m.scheduler != nil {
+				_ = m.scheduler.UpdateTask(task)
+			}
+		} else {
+			if err := m.db.CreateTask(task); err != nil {
+				return errMsg{err}
 			}
 			if m.scheduler != nil {
 				_ = m.scheduler.AddTask(task)
@@ -1575,7 +2470,65 @@ func (m *Model) loadTaskRuns(taskID int64) tea.Cmd {
 		if err != nil {
 			return errMsg{err}
 		}
-		return taskRunsLoadedMsg{runs}
+		usage, err := m.db.GetTaskUsageTotals(taskID, time.Time{})
+		if err != nil {
+			return errMsg{err}
+		}
+		var budget *db.BudgetStatus
+		if task, err := m.db.GetTask(taskID); err == nil {
+			if budget, err = m.db.GetTaskBudgetStatus(task, time.Now()); err != nil {
+				return errMsg{err}
+			}
+		}
+		return taskRunsLoadedMsg{runs, usage, budget}
+	}
+}
+
+func (m *Model) cancelRun(runID int64) tea.Cmd {
+	return func() tea.Msg {
+		var err error
+		switch {
+		case m.scheduler != nil:
+			err = m.scheduler.CancelRun(runID)
+		case m.executor != nil:
+			err = m.executor.CancelRun(runID)
+		default:
+			return errMsg{fmt.Errorf("no executor available to cancel run")}
+		}
+		if errors.Is(err, executor.ErrRunNotActive) {
+			return errMsg{fmt.Errorf("run #%d is no longer running", runID)}
+		}
+		if err != nil {
+			return errMsg{err}
+		}
+		return runCancelRequestedMsg{runID: runID}
+	}
+}
+
+// startLiveTail resets the live tail state for the selected run and starts
+// following its streamed output if it is still in flight
+func (m *Model) startLiveTail() tea.Cmd {
+	m.liveChunks = nil
+	m.liveLastSeq = 0
+	m.liveFollow = true
+	m.liveTailing = m.selectedRun != nil &&
+		(m.selectedRun.Status == db.RunStatusRunning || m.selectedRun.Status == db.RunStatusPending)
+	if !m.liveTailing {
+		return nil
+	}
+	return m.loadRunChunks(m.selectedRun.ID, 0)
+}
+
+func (m *Model) loadRunChunks(runID, afterSeq int64) tea.Cmd {
+	return func() tea.Msg {
+		// Read the run before its chunks so a finished status implies
+		// every chunk has already been written
+		run, err := m.db.GetTaskRunByID(runID)
+		if err != nil {
+			return runChunksLoadedMsg{runID: runID, err: err}
+		}
+		chunks, err := m.db.GetTaskRunChunks(runID, afterSeq, liveTailBatchSize)
+		return runChunksLoadedMsg{runID: runID, run: run, chunks: chunks, err: err}
 	}
 }
 
@@ -1605,6 +2558,14 @@ func (m Model) View() string {
 		content = m.renderRunHistory()
 	case ViewSettings:
 		content = m.renderSettings()
+	case ViewTriggers:
+		content = m.renderTriggers()
+	case ViewUsage:
+		content = m.renderUsageHistory()
+	case ViewProfiles:
+		content = m.renderProfiles()
+	case ViewRunDiff:
+		content = m.renderRunDiff()
 	}
 
 	// Render the base content
@@ -1689,8 +2650,7 @@ func (m Model) renderList() string {
 
 	// Header with usage status (right-justified)
 	logo := spriteIcon + " " + logoStyle.Render("Claude Tasks")
-	if m.usageData != nil && m.width > 0 {
-		usageBar := m.renderUsageBar()
+	if usageBar := m.renderHeaderStatus(); usageBar != "" && m.width > 0 {
 		logoWidth := lipgloss.Width(logo)
 		usageWidth := lipgloss.Width(usageBar)
 		padding := m.width - logoWidth - usageWidth - 4 // account for app padding
@@ -1703,7 +2663,14 @@ func (m Model) renderList() string {
 	} else {
 		b.WriteString(logo)
 	}
-	b.WriteString("\n\n")
+	b.WriteString("\n")
+	// Usage of each account profile, right-aligned under the header status
+	if profileUsage := m.renderProfileUsage(); profileUsage != "" && m.width > 0 {
+		padding := max(m.width-lipgloss.Width(profileUsage)-4, 2)
+		b.WriteString(strings.Repeat(" ", padding))
+		b.WriteString(profileUsage)
+	}
+	b.WriteString("\n")
 
 	// Show search bar if in search mode
 	if m.searchMode {
@@ -1782,9 +2749,9 @@ func (m Model) renderUsageBar() string {
 	resetTime := m.usageData.FormatTimeUntilReset()
 
 	// Threshold indicator
-	thresholdStr := fmt.Sprintf("%.0f%%", m.usageThreshold)
+	thresholdStr := formatThresholds(m.usageThresholds)
 	var thresholdStyle lipgloss.Style
-	if fiveHour >= m.usageThreshold || sevenDay >= m.usageThreshold {
+	if fiveHour >= m.usageThresholds.FiveHour || sevenDay >= m.usageThresholds.SevenDay {
 		thresholdStyle = statusFail
 	} else {
 		thresholdStyle = subtitleStyle
@@ -1853,16 +2820,26 @@ func (m Model) renderSettings() string {
 		b.WriteString("\n")
 	}
 
-	// Threshold input
-	b.WriteString(inputLabelStyle.Render("Usage Threshold (%)"))
+	// Threshold inputs
+	b.WriteString(m.renderThresholdSettings())
+	b.WriteString("\n")
+
+	// Monthly budget input
+	b.WriteString(inputLabelStyle.Render("Monthly Budget ($)"))
 	b.WriteString("  ")
-	b.WriteString(subtitleStyle.Render("Tasks skip when usage exceeds this"))
+	b.WriteString(subtitleStyle.Render("Tasks skip once all runs this month cost this much; blank for none"))
+	b.WriteString("\n")
+	b.WriteString(m.settingsInputStyle(len(m.thresholdInputs)).Render(m.budgetInput.View()))
+	b.WriteString("\n")
+	if m.globalBudget != nil {
+		b.WriteString(subtitleStyle.Render(fmt.Sprintf("  Spent this month: $%.2f", m.globalBudget.Spent.CostUSD)))
+		b.WriteString("\n")
+	}
 	b.WriteString("\n")
-	b.WriteString(focusedInputStyle.Render(m.thresholdInput.View()))
-	b.WriteString("\n\n")
 
 	// Help text
-	helpText := helpKeyStyle.Render("enter") + helpDescStyle.Render(" save • ") +
+	helpText := helpKeyStyle.Render("tab") + helpDescStyle.Render(" next • ") +
+		helpKeyStyle.Render("enter") + helpDescStyle.Render(" save • ") +
 		helpKeyStyle.Render("esc") + helpDescStyle.Render(" cancel")
 	b.WriteString(helpText)
 
@@ -1883,28 +2860,36 @@ func (m Model) renderForm(title string) string {
 		return b.String()
 	}
 
+	// Fields are rendered separately so the form can scroll to keep the
+	// focused field visible on short terminals
+	var body strings.Builder
+	focusLine := 0
+
 	// Helper to render a field label with validation
 	renderLabel := func(field int, label, hint string) {
-		b.WriteString(inputLabelStyle.Render(label))
+		if field == m.formFocus {
+			focusLine = strings.Count(body.String(), "\n")
+		}
+		body.WriteString(inputLabelStyle.Render(label))
 		if hint != "" {
-			b.WriteString("  ")
-			b.WriteString(subtitleStyle.Render(hint))
+			body.WriteString("  ")
+			body.WriteString(subtitleStyle.Render(hint))
 		}
 		if errMsg, hasErr := m.formValidation[field]; hasErr {
-			b.WriteString("  ")
-			b.WriteString(errorMsgStyle.Render("✗ " + errMsg))
+			body.WriteString("  ")
+			body.WriteString(errorMsgStyle.Render("✗ " + errMsg))
 		}
-		b.WriteString("\n")
+		body.WriteString("\n")
 	}
 
 	// Helper to render focused/blurred style
 	renderFocused := func(content string, isFocused bool) {
 		if isFocused {
-			b.WriteString(focusedInputStyle.Render(content))
+			body.WriteString(focusedInputStyle.Render(content))
 		} else {
-			b.WriteString(blurredInputStyle.Render(content))
+			body.WriteString(blurredInputStyle.Render(content))
 		}
-		b.WriteString("\n\n")
+		body.WriteString("\n\n")
 	}
 
 	// Name field
@@ -1913,18 +2898,17 @@ func (m Model) renderForm(title string) string {
 
 	// Prompt field (textarea)
 	renderLabel(fieldPrompt, "Prompt", "(multi-line, tab to next field)")
-	if m.formFocus == fieldPrompt {
-		b.WriteString(focusedInputStyle.Render(m.promptInput.View()))
-	} else {
-		b.WriteString(blurredInputStyle.Render(m.promptInput.View()))
+	renderFocused(m.promptInput.View(), m.formFocus == fieldPrompt)
+	if m.showPromptPreview {
+		body.WriteString(m.renderPromptPreview())
 	}
-	b.WriteString("\n\n")
+
+	// Prompt template variables
+	renderLabel(fieldPromptVars, "Prompt Vars", "(key=value, comma-separated; use as {{.Vars.key}})")
+	renderFocused(m.formInputs[fieldPromptVars].View(), m.formFocus == fieldPromptVars)
 
 	// Task Type toggle
-	b.WriteString(inputLabelStyle.Render("Task Type"))
-	b.WriteString("  ")
-	b.WriteString(subtitleStyle.Render("(←/→ to change)"))
-	b.WriteString("\n")
+	renderLabel(fieldTaskType, "Task Type", "(←/→ to change)")
 	{
 		recurringLabel := "Recurring"
 		oneOffLabel := "One-off"
@@ -1938,10 +2922,7 @@ func (m Model) renderForm(title string) string {
 	}
 
 	// Model toggle
-	b.WriteString(inputLabelStyle.Render("Model"))
-	b.WriteString("  ")
-	b.WriteString(subtitleStyle.Render("(←/→ to change)"))
-	b.WriteString("\n")
+	renderLabel(fieldModel, "Model", "(←/→ to change)")
 	{
 		labels := []string{"Default", "Opus", "Sonnet", "Haiku"}
 		var parts []string
@@ -1957,10 +2938,7 @@ func (m Model) renderForm(title string) string {
 	}
 
 	// Permission Mode toggle
-	b.WriteString(inputLabelStyle.Render("Permission Mode"))
-	b.WriteString("  ")
-	b.WriteString(subtitleStyle.Render("(←/→ to change)"))
-	b.WriteString("\n")
+	renderLabel(fieldPermissionMode, "Permission Mode", "(←/→ to change)")
 	{
 		labels := []string{"Bypass", "Default", "Accept Edits", "Plan"}
 		var parts []string
@@ -1978,10 +2956,7 @@ func (m Model) renderForm(title string) string {
 	// Conditional fields based on task type
 	if m.isOneOff {
 		// Schedule Mode toggle for one-off tasks
-		b.WriteString(inputLabelStyle.Render("When to Run"))
-		b.WriteString("  ")
-		b.WriteString(subtitleStyle.Render("(←/→ to change)"))
-		b.WriteString("\n")
+		renderLabel(fieldScheduleMode, "When to Run", "(←/→ to change)")
 		{
 			runNowLabel := "Run Now"
 			scheduleLabel := "Schedule for later"
@@ -2012,10 +2987,205 @@ func (m Model) renderForm(title string) string {
 		renderFocused(m.formInputs[fieldCron].View(), m.formFocus == fieldCron)
 	}
 
+	// Timezone for the cron expression or schedule time
+	if m.shouldShowField(fieldTimezone) {
+		renderLabel(fieldTimezone, "Timezone", "(IANA name; blank for local)")
+		renderFocused(m.formInputs[fieldTimezone].View(), m.formFocus == fieldTimezone)
+	}
+
+	// Misfire policy toggle for recurring tasks
+	if m.shouldShowField(fieldMisfire) {
+		renderLabel(fieldMisfire, "If Missed", "(←/→ to change)")
+		labels := []string{"Skip", "Run once", fmt.Sprintf("Run all (max %d)", db.MaxMisfireRuns)}
+		var parts []string
+		for i, label := range labels {
+			if i == m.misfireIndex {
+				parts = append(parts, "["+label+"]")
+			} else {
+				parts = append(parts, label)
+			}
+		}
+		renderFocused(strings.Join(parts, "  "), m.formFocus == fieldMisfire)
+	}
+
 	// Working Directory
 	renderLabel(fieldWorkingDir, "Working Directory", "")
 	renderFocused(m.formInputs[fieldWorkingDir].View(), m.formFocus == fieldWorkingDir)
 
+	// Isolation toggle
+	renderLabel(fieldIsolation, "Isolation", "(←/→ to change; a worktree runs on its own git branch)")
+	{
+		labels := []string{"Working dir", "Git worktree"}
+		var parts []string
+		for i, label := range labels {
+			if i == m.isolationIndex {
+				parts = append(parts, "["+label+"]")
+			} else {
+				parts = append(parts, label)
+			}
+		}
+		renderFocused(strings.Join(parts, "  "), m.formFocus == fieldIsolation)
+	}
+	if m.shouldShowField(fieldWorktreeCleanup) {
+		renderLabel(fieldWorktreeCleanup, "Afterwards", "(←/→ to change; branches with changes are always kept)")
+		labels := []string{"Remove worktree", "Keep worktree", "Keep if not completed"}
+		var parts []string
+		for i, label := range labels {
+			if i == m.worktreeCleanupIdx {
+				parts = append(parts, "["+label+"]")
+			} else {
+				parts = append(parts, label)
+			}
+		}
+		renderFocused(strings.Join(parts, "  "), m.formFocus == fieldWorktreeCleanup)
+	}
+
+	// Environment
+	renderLabel(fieldEnv, "Env", "(KEY=value, comma-separated; ${secret:NAME} for secrets)")
+	renderFocused(m.formInputs[fieldEnv].View(), m.formFocus == fieldEnv)
+	renderLabel(fieldEnvFile, "Env File", "(.env path, relative to the working dir; blank for none)")
+	renderFocused(m.formInputs[fieldEnvFile].View(), m.formFocus == fieldEnvFile)
+
+	// Hooks
+	renderLabel(fieldPreHooks, "Pre-run Hooks", "(shell commands separated by ;; — [10m] sets a timeout; one failing aborts the run)")
+	renderFocused(m.formInputs[fieldPreHooks].View(), m.formFocus == fieldPreHooks)
+	renderLabel(fieldPostHooks, "Post-run Hooks", "(run after claude; one failing fails the run)")
+	renderFocused(m.formInputs[fieldPostHooks].View(), m.formFocus == fieldPostHooks)
+
+	// Assertions
+	renderLabel(fieldAssertions, "Assertions", "(matches, not_matches, json_schema or file_exists: value, separated by ;;)")
+	renderFocused(m.formInputs[fieldAssertions].View(), m.formFocus == fieldAssertions)
+	renderLabel(fieldOutputSchema, "Output Schema", "(JSON Schema for structured output; runs store the validated result)")
+	renderFocused(m.formInputs[fieldOutputSchema].View(), m.formFocus == fieldOutputSchema)
+
+	// Claude options
+	renderLabel(fieldAllowedTools, "Allowed Tools", "(comma-separated, e.g. Read, Bash(git diff:*); blank for all)")
+	renderFocused(m.formInputs[fieldAllowedTools].View(), m.formFocus == fieldAllowedTools)
+	renderLabel(fieldDisallowedTools, "Disallowed Tools", "(comma-separated; blank for none)")
+	renderFocused(m.formInputs[fieldDisallowedTools].View(), m.formFocus == fieldDisallowedTools)
+	renderLabel(fieldMaxTurns, "Max Turns", "(blank for unlimited)")
+	renderFocused(m.formInputs[fieldMaxTurns].View(), m.formFocus == fieldMaxTurns)
+	renderLabel(fieldSystemPrompt, "Append System Prompt", "(added to claude's system prompt)")
+	renderFocused(m.formInputs[fieldSystemPrompt].View(), m.formFocus == fieldSystemPrompt)
+	renderLabel(fieldMCPConfig, "MCP Config", "(file, relative to the working dir; blank for none)")
+	renderFocused(m.formInputs[fieldMCPConfig].View(), m.formFocus == fieldMCPConfig)
+	renderLabel(fieldAddDirs, "Extra Dirs", "(comma-separated directories claude may also access)")
+	renderFocused(m.formInputs[fieldAddDirs].View(), m.formFocus == fieldAddDirs)
+
+	// Session mode toggle
+	renderLabel(fieldSessionMode, "Session", "(←/→ to change; resuming keeps the conversation across runs)")
+	{
+		labels := []string{"New each run", "Continue last", "Fork last"}
+		var parts []string
+		for i, label := range labels {
+			if i == m.sessionModeIndex {
+				parts = append(parts, "["+label+"]")
+			} else {
+				parts = append(parts, label)
+			}
+		}
+		renderFocused(strings.Join(parts, "  "), m.formFocus == fieldSessionMode)
+	}
+	if m.shouldShowField(fieldMaxSessionRuns) {
+		renderLabel(fieldMaxSessionRuns, "Runs Per Session", fmt.Sprintf("(a new session starts after this many; blank for %d)", db.DefaultMaxSessionRuns))
+		renderFocused(m.formInputs[fieldMaxSessionRuns].View(), m.formFocus == fieldMaxSessionRuns)
+	}
+
+	// Timeout
+	renderLabel(fieldTimeout, "Timeout", "(e.g. 5m, 2h; blank for default)")
+	renderFocused(m.formInputs[fieldTimeout].View(), m.formFocus == fieldTimeout)
+
+	// Concurrency policy toggle
+	renderLabel(fieldConcurrency, "If Still Running", "(←/→ to change)")
+	{
+		labels := []string{"Run in parallel", "Skip", "Queue one"}
+		var parts []string
+		for i, label := range labels {
+			if i == m.concurrencyIndex {
+				parts = append(parts, "["+label+"]")
+			} else {
+				parts = append(parts, label)
+			}
+		}
+		toggleContent := strings.Join(parts, "  ")
+		renderFocused(toggleContent, m.formFocus == fieldConcurrency)
+	}
+
+	// Retry policy
+	renderLabel(fieldMaxRetries, "Max Retries", fmt.Sprintf("(0-%d; blank for none)", db.MaxRetries))
+	renderFocused(m.formInputs[fieldMaxRetries].View(), m.formFocus == fieldMaxRetries)
+	renderLabel(fieldRetryBackoff, "Retry Backoff", "(first delay, doubled per attempt)")
+	renderFocused(m.formInputs[fieldRetryBackoff].View(), m.formFocus == fieldRetryBackoff)
+	renderLabel(fieldRetryOn, "Retry On", "(exit_error, timeout, preflight, orphaned, assertion; blank for all)")
+	renderFocused(m.formInputs[fieldRetryOn].View(), m.formFocus == fieldRetryOn)
+
+	// Budget
+	renderLabel(fieldBudgetUSD, "Budget ($)", "(per period; blank for none)")
+	renderFocused(m.formInputs[fieldBudgetUSD].View(), m.formFocus == fieldBudgetUSD)
+	renderLabel(fieldBudgetTokens, "Token Budget", "(e.g. 500k, 2m; blank for none)")
+	renderFocused(m.formInputs[fieldBudgetTokens].View(), m.formFocus == fieldBudgetTokens)
+	renderLabel(fieldBudgetPeriod, "Budget Period", "(←/→ to change)")
+	{
+		labels := []string{"Day", "Week", "Month"}
+		var parts []string
+		for i, label := range labels {
+			if i == m.budgetPeriodIndex {
+				parts = append(parts, "["+label+"]")
+			} else {
+				parts = append(parts, label)
+			}
+		}
+		renderFocused(strings.Join(parts, "  "), m.formFocus == fieldBudgetPeriod)
+	}
+
+	// Usage limit policy
+	renderLabel(fieldUsageLimit, "If Over Usage Limit", "(←/→ to change)")
+	{
+		labels := []string{"Skip", "Defer Until Reset", "Run Anyway"}
+		var parts []string
+		for i, label := range labels {
+			if i == m.usageLimitIndex {
+				parts = append(parts, "["+label+"]")
+			} else {
+				parts = append(parts, label)
+			}
+		}
+		renderFocused(strings.Join(parts, "  "), m.formFocus == fieldUsageLimit)
+	}
+
+	// Priority
+	renderLabel(fieldPriority, "Priority", "(←/→ to change; selects usage thresholds)")
+	{
+		labels := []string{"Low", "Normal", "Critical"}
+		var parts []string
+		for i, label := range labels {
+			if i == m.priorityIndex {
+				parts = append(parts, "["+label+"]")
+			} else {
+				parts = append(parts, label)
+			}
+		}
+		renderFocused(strings.Join(parts, "  "), m.formFocus == fieldPriority)
+	}
+
+	// Profile
+	renderLabel(fieldProfile, "Profile", "(←/→ to change; the Claude account the task runs as, p on the list to manage)")
+	{
+		var parts []string
+		for i, profile := range m.profileOptions() {
+			label := profile
+			if label == "" {
+				label = "Default"
+			}
+			if i == m.profileIndex {
+				parts = append(parts, "["+label+"]")
+			} else {
+				parts = append(parts, label)
+			}
+		}
+		renderFocused(strings.Join(parts, "  "), m.formFocus == fieldProfile)
+	}
+
 	// Discord Webhook
 	renderLabel(fieldDiscordWebhook, "Discord Webhook (optional)", "")
 	renderFocused(m.formInputs[fieldDiscordWebhook].View(), m.formFocus == fieldDiscordWebhook)
@@ -2024,6 +3194,8 @@ func (m Model) renderForm(title string) string {
 	renderLabel(fieldSlackWebhook, "Slack Webhook (optional)", "")
 	renderFocused(m.formInputs[fieldSlackWebhook].View(), m.formFocus == fieldSlackWebhook)
 
+	b.WriteString(m.scrollFormBody(body.String(), focusLine))
+
 	// Status
 	if m.statusMsg != "" {
 		if m.statusErr {
@@ -2035,6 +3207,7 @@ func (m Model) renderForm(title string) string {
 	// Help
 	helpText := helpKeyStyle.Render("tab") + helpDescStyle.Render(" next • ") +
 		helpKeyStyle.Render("ctrl+s") + helpDescStyle.Render(" save • ") +
+		helpKeyStyle.Render("ctrl+p") + helpDescStyle.Render(" preview prompt • ") +
 		helpKeyStyle.Render("esc") + helpDescStyle.Render(" cancel")
 	b.WriteString("\n")
 	b.WriteString(helpText)
@@ -2049,6 +3222,39 @@ func (m Model) renderForm(title string) string {
 	return b.String()
 }
 
+// scrollFormBody windows the rendered form fields to the terminal height,
+// keeping the focused field's line in view
+func (m Model) scrollFormBody(body string, focusLine int) string {
+	lines := strings.Split(body, "\n")
+	available := m.height - formHeaderHeight - formFooterHeight - 2 // scroll indicators
+	if m.height == 0 || len(lines) <= available+2 || available < 3 {
+		return body
+	}
+
+	// Show a little context above the focused field
+	start := focusLine - available/4
+	if start > len(lines)-available {
+		start = len(lines) - available
+	}
+	if start < 0 {
+		start = 0
+	}
+	end := start + available
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString(dimRowStyle.Render("  ↑ more"))
+	}
+	b.WriteString("\n")
+	b.WriteString(strings.Join(lines[start:end], "\n"))
+	b.WriteString("\n")
+	if end < len(lines) {
+		b.WriteString(dimRowStyle.Render("  ↓ more"))
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
 func (m Model) renderCronHelper() string {
 	var b strings.Builder
 
@@ -2152,6 +3358,19 @@ func (m Model) renderOutputContent() string {
 			statusIcon = statusFail.Render("✗ FAILED")
 		case db.RunStatusRunning:
 			statusIcon = statusRunning.Render("● RUNNING")
+		case db.RunStatusCancelled:
+			statusIcon = statusPending.Render("⊘ CANCELLED")
+		case db.RunStatusTimedOut:
+			statusIcon = statusFail.Render("⏱ TIMED OUT")
+		case db.RunStatusAssertionFailed:
+			statusIcon = statusFail.Render("⚠ ASSERTION FAILED")
+		case db.RunStatusSkipped:
+			statusIcon = statusPending.Render("↷ SKIPPED")
+		case db.RunStatusDeferred:
+			statusIcon = statusPending.Render("⏸ DEFERRED")
+			if run.DeferredUntil != nil {
+				statusIcon += statusPending.Render(" until " + run.DeferredUntil.Local().Format("2006-01-02 15:04"))
+			}
 		default:
 			statusIcon = statusPending.Render("○ PENDING")
 		}
@@ -2218,10 +3437,10 @@ func (m *Model) updateRunHistoryTable() {
 
 	// Calculate responsive column widths — give Session and Preview the remaining space
 	availableWidth := m.width - 8 // table borders/padding
-	if availableWidth < 90 {
-		availableWidth = 90
+	if availableWidth < 110 {
+		availableWidth = 110
 	}
-	fixedWidth := 4 + 6 + 20 + 10 + 12 // #, Status, Started, Duration, column separators
+	fixedWidth := 4 + 7 + 3 + 8 + 20 + 10 + 8 + 11 + 20 // #, Status, Try, Thread, Started, Duration, Cost, Tokens, column separators
 	remaining := availableWidth - fixedWidth
 	// Split remaining: 30% to Session, 70% to Preview
 	sessionWidth := remaining * 30 / 100
@@ -2238,13 +3457,24 @@ func (m *Model) updateRunHistoryTable() {
 
 	columns := []table.Column{
 		{Title: "#", Width: 4},
-		{Title: "Status", Width: 6},
+		{Title: "Status", Width: 7},
+		{Title: "Try", Width: 3},
+		{Title: "Thread", Width: 8},
 		{Title: "Started", Width: 20},
 		{Title: "Duration", Width: 10},
+		{Title: "Cost", Width: 8},
+		{Title: "In/Out", Width: 11},
 		{Title: "Session", Width: sessionWidth},
 		{Title: "Preview", Width: previewWidth},
 	}
 
+	threads := make(map[int64]bool)
+	for _, run := range runs {
+		if run.ThreadRunID != nil {
+			threads[*run.ThreadRunID] = true
+		}
+	}
+
 	rows := make([]table.Row, len(runs))
 	for i, run := range runs {
 		var status string
@@ -2255,6 +3485,16 @@ func (m *Model) updateRunHistoryTable() {
 			status = "FAIL"
 		case db.RunStatusRunning:
 			status = "RUN"
+		case db.RunStatusCancelled:
+			status = "CANCEL"
+		case db.RunStatusTimedOut:
+			status = "TIMEOUT"
+		case db.RunStatusAssertionFailed:
+			status = "ASSERT"
+		case db.RunStatusPending:
+			status = "QUEUED"
+		case db.RunStatusDeferred:
+			status = "DEFER"
 		default:
 			status = "SKIP"
 		}
@@ -2279,8 +3519,12 @@ func (m *Model) updateRunHistoryTable() {
 		rows[i] = table.Row{
 			fmt.Sprintf("%d", i+1),
 			status,
+			strconv.Itoa(max(run.Attempt, 1)),
+			formatThread(run, threads),
 			run.StartedAt.Format("2006-01-02 15:04:05"),
 			duration,
+			formatCost(run.Usage.CostUSD),
+			formatRunTokens(run.Usage),
 			sessionIDShort,
 			preview,
 		}
@@ -2319,36 +3563,47 @@ func (m *Model) updateRunHistory(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		if idx < len(m.sortedRuns) {
 			m.selectedRun = m.sortedRuns[idx]
 			m.currentView = ViewOutput
+			cmd = m.startLiveTail()
 			m.viewport.SetContent(m.renderSingleRunContent())
 			m.viewport.GotoTop()
-			return m, nil
+			return m, cmd
 		}
 	case "esc", "q":
 		m.currentView = ViewList
 		return m, nil
 	case "r":
 		return m, m.loadTaskRuns(m.selectedTask.ID)
+	case "c":
+		idx := m.runHistoryTable.Cursor()
+		if idx < len(m.sortedRuns) {
+			run := m.sortedRuns[idx]
+			if run.Status != db.RunStatusRunning && run.Status != db.RunStatusPending && run.Status != db.RunStatusDeferred {
+				m.setStatus("Only running, queued or deferred runs can be cancelled", true)
+				return m, nil
+			}
+			return m, m.cancelRun(run.ID)
+		}
+		return m, nil
+	case "d":
+		idx := m.runHistoryTable.Cursor()
+		if idx < len(m.sortedRuns) {
+			return m, m.loadRunDiff(m.sortedRuns[idx])
+		}
+		return m, nil
 	case "o":
 		idx := m.runHistoryTable.Cursor()
 		if idx < len(m.sortedRuns) {
 			run := m.sortedRuns[idx]
 			if run.SessionID != "" && run.Status == db.RunStatusRunning {
-				// Build resume command with same permission mode as the task
-				resumeCmd := "claude"
-				permMode := m.selectedTask.PermissionMode
-				if permMode == "" {
-					permMode = db.DefaultPermissionMode
-				}
-				if permMode == "bypassPermissions" {
-					resumeCmd += " --dangerously-skip-permissions"
-				} else if permMode != "default" {
-					resumeCmd += " --permission-mode " + permMode
-				}
-				resumeCmd += " --resume " + run.SessionID
+				resumeCmd := m.resumeCommand(m.selectedTask, run.SessionID)
 
-				// Open in Terminal, cd to task's working directory first
-				script := fmt.Sprintf(`tell application "Terminal" to do script "cd %s && %s"`,
-					m.selectedTask.WorkingDir, resumeCmd)
+				// Open in Terminal, cd to the directory the run is in first
+				dir := m.selectedTask.WorkingDir
+				if run.Worktree != nil && run.Worktree.Path != "" {
+					dir = run.Worktree.Path
+				}
+				script := fmt.Sprintf(`tell application "Terminal" to do script "%s"`,
+					appleScriptEscape(executor.ShellCommand("cd", dir)+" && "+resumeCmd))
 				cmd := osExec.Command("osascript", "-e", script)
 				_ = cmd.Start()
 			}
@@ -2361,6 +3616,32 @@ func (m *Model) updateRunHistory(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	return m, cmd
 }
 
+// resumeCommand returns the shell command that resumes a run's session with
+// the task's claude options and account
+func (m Model) resumeCommand(task *db.Task, sessionID string) string {
+	command := executor.ShellCommand(append([]string{"claude"}, executor.ResumeArgs(task, sessionID)...)...)
+	if configDir := m.profileConfigDir(task.Profile); configDir != "" {
+		command = "CLAUDE_CONFIG_DIR=" + executor.ShellCommand(configDir) + " " + command
+	}
+	return command
+}
+
+// appleScriptEscape escapes text for an AppleScript string literal
+func appleScriptEscape(text string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(text)
+}
+
+// splitDirs parses a comma-separated directory list
+func splitDirs(value string) []string {
+	var dirs []string
+	for _, dir := range strings.Split(value, ",") {
+		if dir = strings.TrimSpace(dir); dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
 // renderRunHistory renders the run history view
 func (m Model) renderRunHistory() string {
 	var b strings.Builder
@@ -2412,6 +3693,13 @@ func (m Model) renderRunHistory() string {
 
 		stats := fmt.Sprintf("Runs: %d  |  Success: %d/%d (%.0f%%)  |  Avg duration: %s",
 			total, successCount, total, successRate, avgDuration)
+		if m.taskUsage != nil && m.taskUsage.Runs > 0 {
+			stats += fmt.Sprintf("  |  Total cost: %s over %d runs (%s tokens)", formatCost(m.taskUsage.CostUSD), m.taskUsage.Runs,
+				formatTokens(m.taskUsage.TotalTokens()))
+		}
+		if m.taskBudget != nil {
+			stats += "  |  Budget: " + formatBudgetRemaining(m.taskBudget) + " this " + m.taskBudget.Period
+		}
 		b.WriteString(subtitleStyle.Render(stats))
 		b.WriteString("\n\n")
 	}
@@ -2430,6 +3718,10 @@ func (m Model) renderRunHistory() string {
 		helpDescStyle.Render(" | ") +
 		helpKeyStyle.Render("o") + helpDescStyle.Render(" observe") +
 		helpDescStyle.Render(" | ") +
+		helpKeyStyle.Render("d") + helpDescStyle.Render(" diff") +
+		helpDescStyle.Render(" | ") +
+		helpKeyStyle.Render("c") + helpDescStyle.Render(" cancel") +
+		helpDescStyle.Render(" | ") +
 		helpKeyStyle.Render("r") + helpDescStyle.Render(" refresh") +
 		helpDescStyle.Render(" | ") +
 		helpKeyStyle.Render("esc") + helpDescStyle.Render(" back")
@@ -2448,18 +3740,7 @@ func (m Model) renderSingleRunContent() string {
 	var b strings.Builder
 
 	// Status badge
-	var statusBadge string
-	switch run.Status {
-	case db.RunStatusCompleted:
-		statusBadge = statusOK.Render("COMPLETED")
-	case db.RunStatusFailed:
-		statusBadge = statusFail.Render("FAILED")
-	case db.RunStatusRunning:
-		statusBadge = statusRunning.Render("RUNNING")
-	default:
-		statusBadge = statusPending.Render("PENDING")
-	}
-	b.WriteString(statusBadge)
+	b.WriteString(runStatusBadge(run.Status))
 	b.WriteString("\n\n")
 
 	// Timestamps
@@ -2478,11 +3759,107 @@ func (m Model) renderSingleRunContent() string {
 		b.WriteString("\n")
 	}
 
+	if run.Attempt > 1 && run.ParentRunID != nil {
+		b.WriteString(inputLabelStyle.Render("Attempt: "))
+		b.WriteString(fmt.Sprintf("%d (retry of run %d)", run.Attempt, *run.ParentRunID))
+		b.WriteString("\n")
+	}
+
+	if run.ScheduledFor != nil {
+		b.WriteString(inputLabelStyle.Render("Scheduled: "))
+		b.WriteString(run.ScheduledFor.Local().Format("2006-01-02 15:04:05"))
+		if run.StartedAt.Sub(*run.ScheduledFor) > time.Minute {
+			b.WriteString(" (started late)")
+		}
+		b.WriteString("\n")
+	}
+
+	if run.DeferredUntil != nil {
+		b.WriteString(inputLabelStyle.Render("Deferred until: "))
+		b.WriteString(run.DeferredUntil.Local().Format("2006-01-02 15:04:05"))
+		b.WriteString("\n")
+	}
+
+	if run.TriggeredByRunID != nil {
+		b.WriteString(inputLabelStyle.Render("Triggered by: "))
+		b.WriteString(fmt.Sprintf("run #%d", *run.TriggeredByRunID))
+		b.WriteString("\n")
+	}
+
+	if run.ResumedFromRunID != nil {
+		b.WriteString(inputLabelStyle.Render("Thread: "))
+		thread := fmt.Sprintf("run %d of the thread started by run #%d, resuming run #%d",
+			max(run.ThreadDepth, 1), run.ThreadID(), *run.ResumedFromRunID)
+		if m.selectedTask != nil {
+			thread += fmt.Sprintf(" (new session after %d runs)", m.selectedTask.EffectiveMaxSessionRuns())
+		}
+		b.WriteString(thread)
+		b.WriteString("\n")
+	}
+
+	if wt := run.Worktree; wt != nil {
+		b.WriteString(inputLabelStyle.Render("Branch: "))
+		b.WriteString(wt.Branch)
+		switch {
+		case wt.Changed():
+			b.WriteString("  " + wt.DiffStat)
+		case wt.Commit != "" && wt.Path == "":
+			b.WriteString(subtitleStyle.Render("  (no changes, branch deleted)"))
+		case wt.Commit != "":
+			b.WriteString(subtitleStyle.Render("  (no changes)"))
+		}
+		b.WriteString("\n")
+		if wt.Path != "" {
+			b.WriteString(subtitleStyle.Render("  Worktree: " + wt.Path))
+			b.WriteString("\n")
+		}
+	}
+
 	if run.SessionID != "" {
 		b.WriteString(inputLabelStyle.Render("Session: "))
 		b.WriteString(run.SessionID)
 		b.WriteString("\n")
-		b.WriteString(subtitleStyle.Render("  Resume: claude --resume " + run.SessionID))
+		resume := "claude --resume " + run.SessionID
+		if m.selectedTask != nil {
+			resume = m.resumeCommand(m.selectedTask, run.SessionID)
+		}
+		b.WriteString(subtitleStyle.Render("  Resume: " + resume))
+		b.WriteString("\n")
+	}
+
+	if run.Usage != (db.RunUsage{}) {
+		b.WriteString(inputLabelStyle.Render("Usage: "))
+		usage := fmt.Sprintf("%s  •  %s in / %s out tokens (%s cached)  •  %d turns",
+			formatCost(run.Usage.CostUSD), formatTokens(run.Usage.TotalInputTokens()), formatTokens(run.Usage.OutputTokens),
+			formatTokens(run.Usage.CacheReadTokens), run.Usage.NumTurns)
+		if run.Usage.Model != "" {
+			usage += "  •  " + run.Usage.Model
+		}
+		b.WriteString(usage)
+		b.WriteString("\n")
+	}
+
+	if len(run.Steps) > 0 {
+		b.WriteString(inputLabelStyle.Render("Hooks:"))
+		b.WriteString("\n")
+		renderRunSteps(&b, run.Steps)
+	}
+	if len(run.Assertions) > 0 {
+		b.WriteString(inputLabelStyle.Render("Assertions:"))
+		b.WriteString("\n")
+		renderAssertionResults(&b, run.Assertions)
+	}
+	if len(run.ResultJSON) > 0 {
+		b.WriteString(inputLabelStyle.Render("Result:"))
+		b.WriteString("\n")
+		renderRunResult(&b, run.ResultJSON)
+	}
+
+	// The prompt as sent, when templating changed it
+	if run.RenderedPrompt != "" && (m.selectedTask == nil || run.RenderedPrompt != m.selectedTask.Prompt) {
+		b.WriteString(inputLabelStyle.Render("Prompt:"))
+		b.WriteString("\n")
+		b.WriteString(subtitleStyle.Render(run.RenderedPrompt))
 		b.WriteString("\n")
 	}
 
@@ -2491,7 +3868,16 @@ func (m Model) renderSingleRunContent() string {
 	b.WriteString("\n\n")
 
 	// Output
-	if run.Output != "" {
+	if m.liveTailing {
+		b.WriteString(statusRunning.Render("● LIVE"))
+		if m.liveFollow {
+			b.WriteString(subtitleStyle.Render("  following output"))
+		}
+		b.WriteString("\n\n")
+	}
+	if len(m.liveChunks) > 0 && (m.liveTailing || run.Output == "") {
+		b.WriteString(renderRunChunks(m.liveChunks))
+	} else if run.Output != "" {
 		if m.mdRenderer != nil {
 			rendered, err := m.mdRenderer.Render(run.Output)
 			if err == nil {
@@ -2517,6 +3903,56 @@ func (m Model) renderSingleRunContent() string {
 	return b.String()
 }
 
+// renderRunChunks renders streamed output chunks as a plain-text transcript
+func renderRunChunks(chunks []*db.TaskRunChunk) string {
+	const maxToolResultLines = 5
+
+	var b strings.Builder
+	for _, chunk := range chunks {
+		switch chunk.Kind {
+		case db.RunChunkResult:
+			// The final result repeats the last assistant message
+			continue
+		case db.RunChunkToolUse:
+			b.WriteString(statusRunning.Render("▸ " + chunk.Content))
+		case db.RunChunkToolResult:
+			lines := strings.Split(strings.TrimRight(chunk.Content, "\n"), "\n")
+			if len(lines) > maxToolResultLines {
+				lines = append(lines[:maxToolResultLines], fmt.Sprintf("… %d more lines", len(lines)-maxToolResultLines))
+			}
+			b.WriteString(helpDescStyle.Render("  " + strings.Join(lines, "\n  ")))
+		default:
+			b.WriteString(chunk.Content)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// runStatusBadge renders the colored, uppercase label for a run status
+func runStatusBadge(status db.RunStatus) string {
+	switch status {
+	case db.RunStatusCompleted:
+		return statusOK.Render("COMPLETED")
+	case db.RunStatusFailed:
+		return statusFail.Render("FAILED")
+	case db.RunStatusRunning:
+		return statusRunning.Render("RUNNING")
+	case db.RunStatusCancelled:
+		return statusPending.Render("CANCELLED")
+	case db.RunStatusTimedOut:
+		return statusFail.Render("TIMED OUT")
+	case db.RunStatusAssertionFailed:
+		return statusFail.Render("ASSERTION FAILED")
+	case db.RunStatusSkipped:
+		return statusPending.Render("SKIPPED")
+	case db.RunStatusDeferred:
+		return statusPending.Render("DEFERRED")
+	default:
+		return statusPending.Render("PENDING")
+	}
+}
+
 // renderSingleRunOutput renders the full output view for a single selected run
 func (m Model) renderSingleRunOutput() string {
 	var b strings.Builder
@@ -2528,16 +3964,7 @@ func (m Model) renderSingleRunOutput() string {
 
 	// Status badge for the selected run
 	if m.selectedRun != nil {
-		switch m.selectedRun.Status {
-		case db.RunStatusCompleted:
-			b.WriteString(statusOK.Render("COMPLETED"))
-		case db.RunStatusFailed:
-			b.WriteString(statusFail.Render("FAILED"))
-		case db.RunStatusRunning:
-			b.WriteString(statusRunning.Render("RUNNING"))
-		default:
-			b.WriteString(statusPending.Render("PENDING"))
-		}
+		b.WriteString(runStatusBadge(m.selectedRun.Status))
 	}
 	b.WriteString("\n")
 	if m.selectedRun != nil {
@@ -2550,8 +3977,12 @@ func (m Model) renderSingleRunOutput() string {
 
 	// Help
 	helpText := helpKeyStyle.Render("↑↓") + helpDescStyle.Render(" scroll") +
-		helpDescStyle.Render(" | ") +
-		helpKeyStyle.Render("esc") + helpDescStyle.Render(" back to runs")
+		helpDescStyle.Render(" | ")
+	if m.liveTailing {
+		helpText += helpKeyStyle.Render("f") + helpDescStyle.Render(" follow") +
+			helpDescStyle.Render(" | ")
+	}
+	helpText += helpKeyStyle.Render("esc") + helpDescStyle.Render(" back to runs")
 	b.WriteString(helpText)
 
 	return b.String()
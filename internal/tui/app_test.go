@@ -1,6 +1,7 @@
 package tui
 
 import (
+	"strings"
 	"testing"
 	"time"
 
@@ -164,3 +165,111 @@ func TestStatusBatchLoadDerivesRunningTasksWithoutPerTaskQueries(t *testing.T) {
 		t.Fatalf("expected next run %v for task %d, got %v (present=%v)", nextRun, taskRunning.ID, got, ok)
 	}
 }
+
+func TestLiveTailAppendsChunksAndStopsWhenRunFinishes(t *testing.T) {
+	m := newTestModel(t)
+	m.currentView = ViewOutput
+	m.selectedTask = &db.Task{ID: 1, Name: "stream"}
+	m.selectedRun = &db.TaskRun{ID: 5, TaskID: 1, Status: db.RunStatusRunning}
+	if cmd := m.startLiveTail(); cmd == nil {
+		t.Fatalf("expected live tail to start for running run")
+	}
+
+	updatedModel, cmd := m.Update(runChunksLoadedMsg{
+		runID:  5,
+		run:    &db.TaskRun{ID: 5, TaskID: 1, Status: db.RunStatusRunning},
+		chunks: []*db.TaskRunChunk{{RunID: 5, Seq: 1, Kind: db.RunChunkText, Content: "partial"}},
+	})
+	updated := updatedModel.(Model)
+	if !updated.liveTailing || cmd == nil {
+		t.Fatalf("expected tailing to continue while run is in flight")
+	}
+	if updated.liveLastSeq != 1 || len(updated.liveChunks) != 1 {
+		t.Fatalf("expected chunk to be appended, got seq=%d chunks=%d", updated.liveLastSeq, len(updated.liveChunks))
+	}
+
+	updatedModel, _ = updated.Update(runChunksLoadedMsg{
+		runID: 5,
+		run:   &db.TaskRun{ID: 5, TaskID: 1, Status: db.RunStatusCompleted, Output: "final"},
+	})
+	updated = updatedModel.(Model)
+	if updated.liveTailing {
+		t.Fatalf("expected tailing to stop once the run finished")
+	}
+	if updated.selectedRun.Status != db.RunStatusCompleted {
+		t.Fatalf("expected selected run to be refreshed, got %s", updated.selectedRun.Status)
+	}
+}
+
+func TestPromptVarsRoundTrip(t *testing.T) {
+	vars, err := parsePromptVars(" team = platform, repo=api ,")
+	if err != nil {
+		t.Fatalf("parse prompt vars: %v", err)
+	}
+	if got := formatPairs(vars); got != "repo=api, team=platform" {
+		t.Fatalf("unexpected formatted vars %q", got)
+	}
+	if vars, err := parsePromptVars(""); err != nil || vars != nil {
+		t.Fatalf("expected no vars for a blank field, got %v, %v", vars, err)
+	}
+	for _, bad := range []string{"repo", "my-repo=api"} {
+		if _, err := parsePromptVars(bad); err == nil {
+			t.Fatalf("expected an error for %q", bad)
+		}
+	}
+}
+
+func TestHooksRoundTrip(t *testing.T) {
+	hooks, err := parseHooks("git pull ;; [10m] make deps ;;")
+	if err != nil {
+		t.Fatalf("parse hooks: %v", err)
+	}
+	if len(hooks) != 2 || hooks[1].Command != "make deps" || hooks[1].TimeoutSeconds != 600 {
+		t.Fatalf("unexpected hooks %+v", hooks)
+	}
+	if got := formatHooks(hooks); got != "git pull ;; [10m] make deps" {
+		t.Fatalf("unexpected formatted hooks %q", got)
+	}
+	for _, bad := range []string{"[10m]", "[soon] make"} {
+		if _, err := parseHooks(bad); err == nil {
+			t.Fatalf("expected an error for %q", bad)
+		}
+	}
+}
+
+func TestAssertionsRoundTrip(t *testing.T) {
+	assertions, err := parseAssertions(`not_matches: (?i)couldn't access ;; json_schema: {"type": "object"} ;; file_exists: report.md`)
+	if err != nil {
+		t.Fatalf("parse assertions: %v", err)
+	}
+	if len(assertions) != 3 || assertions[0].Pattern != "(?i)couldn't access" || string(assertions[1].Schema) != `{"type":"object"}` {
+		t.Fatalf("unexpected assertions %+v", assertions)
+	}
+	if got := formatAssertions(assertions); got != `not_matches: (?i)couldn't access ;; json_schema: {"type":"object"} ;; file_exists: report.md` {
+		t.Fatalf("unexpected formatted assertions %q", got)
+	}
+	for _, bad := range []string{"report.md", "contains: ok", "matches: ("} {
+		if _, err := parseAssertions(bad); err == nil {
+			t.Fatalf("expected an error for %q", bad)
+		}
+	}
+}
+
+func TestOutputSchemaAndResult(t *testing.T) {
+	schema, err := parseOutputSchema(` {"type": "object"} `)
+	if err != nil || string(schema) != `{"type":"object"}` {
+		t.Fatalf("parseOutputSchema = %s, %v", schema, err)
+	}
+	if schema, err := parseOutputSchema(""); err != nil || schema != nil {
+		t.Fatalf("expected no schema for an empty value, got %s, %v", schema, err)
+	}
+	if _, err := parseOutputSchema(`{"type": "objekt"}`); err == nil {
+		t.Fatalf("expected an error for an invalid schema")
+	}
+
+	var b strings.Builder
+	renderRunResult(&b, []byte(`{"ok":true}`))
+	if got := b.String(); got != "  {\n    \"ok\": true\n  }\n" {
+		t.Fatalf("unexpected rendered result %q", got)
+	}
+}
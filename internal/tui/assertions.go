@@ -0,0 +1,75 @@
+package tui
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ASRagab/claude-tasks/internal/db"
+)
+
+// parseAssertions parses "matches: ^OK ;; file_exists: report.md" into
+// assertions; each is a type and its pattern, schema or path, and they are
+// separated like hooks
+func parseAssertions(value string) ([]db.Assertion, error) {
+	var assertions []db.Assertion
+	for _, part := range strings.Split(value, hookSeparator) {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		kind, arg, ok := strings.Cut(part, ":")
+		if !ok {
+			return nil, fmt.Errorf("%q must be type: value (types: %s)", part, strings.Join(db.AssertionTypes, ", "))
+		}
+		arg = strings.TrimSpace(arg)
+		assertion := db.Assertion{Type: kind}
+		switch strings.ToLower(strings.TrimSpace(kind)) {
+		case db.AssertMatches, db.AssertNotMatches:
+			assertion.Pattern = arg
+		case db.AssertJSONSchema:
+			assertion.Schema = json.RawMessage(arg)
+		case db.AssertFileExists:
+			assertion.Path = arg
+		}
+		parsed, err := db.ParseAssertion(assertion)
+		if err != nil {
+			return nil, err
+		}
+		assertions = append(assertions, parsed)
+	}
+	if len(assertions) > db.MaxAssertions {
+		return nil, fmt.Errorf("use at most %d assertions", db.MaxAssertions)
+	}
+	return assertions, nil
+}
+
+// formatAssertions formats assertions for the form
+func formatAssertions(assertions []db.Assertion) string {
+	formatted := make([]string, len(assertions))
+	for i, a := range assertions {
+		arg := a.Path
+		switch a.Type {
+		case db.AssertMatches, db.AssertNotMatches:
+			arg = a.Pattern
+		case db.AssertJSONSchema:
+			arg = string(a.Schema)
+		}
+		formatted[i] = a.Type + ": " + arg
+	}
+	return strings.Join(formatted, " "+hookSeparator+" ")
+}
+
+// renderAssertionResults renders how a run fared on its task's assertions,
+// for the run detail view
+func renderAssertionResults(b *strings.Builder, results []db.AssertionResult) {
+	for _, result := range results {
+		if result.Passed {
+			b.WriteString(fmt.Sprintf("%s %s\n", statusOK.Render("✓"), result.Assertion))
+			continue
+		}
+		b.WriteString(fmt.Sprintf("%s %s\n", statusFail.Render("✗"), result.Assertion))
+		b.WriteString(subtitleStyle.Render(indentLines(result.Message, "    ")))
+		b.WriteString("\n")
+	}
+}
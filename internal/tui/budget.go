@@ -0,0 +1,51 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ASRagab/claude-tasks/internal/db"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// renderHeaderStatus renders the usage bar and the monthly budget for the
+// list header; empty when neither is available
+func (m Model) renderHeaderStatus() string {
+	var parts []string
+	if m.usageData != nil {
+		parts = append(parts, m.renderUsageBar())
+	}
+	if m.globalBudget != nil {
+		parts = append(parts, m.renderBudget())
+	}
+	return strings.Join(parts, " │ ")
+}
+
+// renderBudget renders what is left of the monthly budget
+func (m Model) renderBudget() string {
+	style := subtitleStyle
+	if m.globalBudget.Exhausted() {
+		style = statusFail
+	}
+	return "💰 " + style.Render(formatBudgetRemaining(m.globalBudget))
+}
+
+// formatBudgetRemaining describes what is left of each cap of a budget
+func formatBudgetRemaining(budget *db.BudgetStatus) string {
+	var parts []string
+	if budget.LimitUSD > 0 {
+		parts = append(parts, fmt.Sprintf("$%.2f of $%.2f", budget.RemainingUSD(), budget.LimitUSD))
+	}
+	if budget.LimitTokens > 0 {
+		parts = append(parts, fmt.Sprintf("%s of %s tokens", formatTokens(budget.RemainingTokens()), formatTokens(budget.LimitTokens)))
+	}
+	return strings.Join(parts, ", ") + " left"
+}
+
+// settingsInputStyle styles a settings input by whether it has focus
+func (m Model) settingsInputStyle(index int) lipgloss.Style {
+	if m.settingsFocus == index {
+		return focusedInputStyle
+	}
+	return blurredInputStyle
+}
@@ -0,0 +1,148 @@
+package tui
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ASRagab/claude-tasks/internal/db"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// runDiffLoadedMsg carries the changes of the run the diff screen shows
+type runDiffLoadedMsg struct {
+	run     *db.TaskRun
+	changes *db.RunChanges
+}
+
+func (m *Model) loadRunDiff(run *db.TaskRun) tea.Cmd {
+	return func() tea.Msg {
+		changes, err := m.db.GetRunChanges(run.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return errMsg{fmt.Errorf("no changes recorded for run %d; only runs in a git repository record them", run.ID)}
+		}
+		if err != nil {
+			return errMsg{err}
+		}
+		return runDiffLoadedMsg{run: run, changes: changes}
+	}
+}
+
+// openRunDiff shows the loaded changes in the diff screen
+func (m *Model) openRunDiff(msg runDiffLoadedMsg) {
+	m.diffRun = msg.run
+	m.diffChanges = msg.changes
+	m.currentView = ViewRunDiff
+	m.viewport.SetContent(m.renderRunDiffContent())
+	m.viewport.GotoTop()
+}
+
+func (m *Model) updateRunDiff(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc", "q":
+		m.diffRun = nil
+		m.diffChanges = nil
+		m.currentView = ViewRunHistory
+		return m, nil
+	}
+	var cmd tea.Cmd
+	m.viewport, cmd = m.viewport.Update(msg)
+	return m, cmd
+}
+
+// renderRunDiffContent renders the changed files and the colored patch for
+// the viewport
+func (m Model) renderRunDiffContent() string {
+	changes := m.diffChanges
+	if changes == nil {
+		return ""
+	}
+	var b strings.Builder
+
+	b.WriteString(inputLabelStyle.Render(changes.Summary()))
+	b.WriteString("\n")
+	if changes.HeadBefore != changes.HeadAfter {
+		b.WriteString(subtitleStyle.Render(fmt.Sprintf("HEAD %s → %s", shortCommit(changes.HeadBefore), shortCommit(changes.HeadAfter))))
+		b.WriteString("\n")
+	}
+	if changes.DirtyBefore {
+		b.WriteString(subtitleStyle.Render("The working dir had uncommitted changes before the run; they are not shown"))
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
+
+	for _, file := range changes.Files {
+		if file.Binary {
+			b.WriteString(fmt.Sprintf("  %s  %s\n", subtitleStyle.Render("binary"), file.Path))
+			continue
+		}
+		b.WriteString(fmt.Sprintf("  %s %s  %s\n",
+			statusOK.Render(fmt.Sprintf("%+5d", file.Insertions)),
+			statusFail.Render(fmt.Sprintf("%5s", fmt.Sprintf("-%d", file.Deletions))),
+			file.Path))
+	}
+	if len(changes.Files) > 0 {
+		b.WriteString("\n")
+	}
+
+	for _, line := range strings.Split(strings.TrimRight(changes.Patch, "\n"), "\n") {
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"),
+			strings.HasPrefix(line, "diff "), strings.HasPrefix(line, "index "):
+			b.WriteString(inputLabelStyle.Render(line))
+		case strings.HasPrefix(line, "@@"):
+			b.WriteString(statusRunning.Render(line))
+		case strings.HasPrefix(line, "+"):
+			b.WriteString(statusOK.Render(line))
+		case strings.HasPrefix(line, "-"):
+			b.WriteString(statusFail.Render(line))
+		default:
+			b.WriteString(line)
+		}
+		b.WriteString("\n")
+	}
+	if changes.PatchTruncated {
+		b.WriteString(subtitleStyle.Render("...[patch truncated]"))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// shortCommit abbreviates a commit hash; empty before the first commit
+func shortCommit(commit string) string {
+	if commit == "" {
+		return "(none)"
+	}
+	if len(commit) > 8 {
+		return commit[:8]
+	}
+	return commit
+}
+
+func (m Model) renderRunDiff() string {
+	var b strings.Builder
+
+	b.WriteString(spriteIcon)
+	b.WriteString(" ")
+	b.WriteString(logoStyle.Render(m.selectedTask.Name))
+	b.WriteString("  ")
+	b.WriteString(subtitleStyle.Render("Changes"))
+	if m.diffRun != nil {
+		b.WriteString("  ")
+		b.WriteString(runStatusBadge(m.diffRun.Status))
+		b.WriteString("\n")
+		b.WriteString(subtitleStyle.Render(m.diffRun.StartedAt.Format("2006-01-02 15:04:05")))
+	}
+	b.WriteString("\n\n")
+
+	b.WriteString(m.viewport.View())
+	b.WriteString("\n\n")
+
+	helpText := helpKeyStyle.Render("↑↓") + helpDescStyle.Render(" scroll") +
+		helpDescStyle.Render(" | ") +
+		helpKeyStyle.Render("esc") + helpDescStyle.Render(" back to runs")
+	b.WriteString(helpText)
+
+	return b.String()
+}
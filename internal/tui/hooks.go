@@ -0,0 +1,80 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ASRagab/claude-tasks/internal/db"
+)
+
+// hookSeparator separates the hooks of one phase on the form
+const hookSeparator = ";;"
+
+// parseHooks parses "git pull ;; [10m] make deps" into hooks; a bracketed
+// duration in front of a command sets its timeout
+func parseHooks(value string) ([]db.Hook, error) {
+	var hooks []db.Hook
+	for _, part := range strings.Split(value, hookSeparator) {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		var timeout string
+		if strings.HasPrefix(part, "[") {
+			if end := strings.Index(part, "]"); end > 0 {
+				timeout, part = part[1:end], part[end+1:]
+			}
+		}
+		hook, err := db.ParseHook(part, timeout)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, hook)
+	}
+	if len(hooks) > db.MaxHooks {
+		return nil, fmt.Errorf("use at most %d hooks", db.MaxHooks)
+	}
+	return hooks, nil
+}
+
+// formatHooks formats hooks for the form
+func formatHooks(hooks []db.Hook) string {
+	formatted := make([]string, len(hooks))
+	for i, hook := range hooks {
+		formatted[i] = hook.Command
+		if hook.TimeoutSeconds > 0 {
+			formatted[i] = "[" + db.FormatDuration(time.Duration(hook.TimeoutSeconds)*time.Second) + "] " + hook.Command
+		}
+	}
+	return strings.Join(formatted, " "+hookSeparator+" ")
+}
+
+// renderRunSteps renders the hooks that ran with their exit codes and
+// output, for the run detail view
+func renderRunSteps(b *strings.Builder, steps []db.RunStep) {
+	for _, step := range steps {
+		status := statusOK.Render("✓")
+		result := "exit 0"
+		if step.Failed() {
+			status = statusFail.Render("✗")
+			result = fmt.Sprintf("exit %d", step.ExitCode)
+			if step.Error != "" {
+				result = step.Error
+			}
+		}
+		b.WriteString(fmt.Sprintf("%s %s %s  %s\n", status, inputLabelStyle.Render(step.Phase+"-hook"), step.Command,
+			subtitleStyle.Render(fmt.Sprintf("(%s, %s)", result, step.EndedAt.Sub(step.StartedAt).Round(time.Millisecond)))))
+		for _, output := range []string{step.Stdout, step.Stderr} {
+			if output = strings.TrimRight(output, "\n"); output != "" {
+				b.WriteString(subtitleStyle.Render(indentLines(output, "    ")))
+				b.WriteString("\n")
+			}
+		}
+	}
+}
+
+// indentLines prefixes every line of text
+func indentLines(text, prefix string) string {
+	return prefix + strings.ReplaceAll(text, "\n", "\n"+prefix)
+}
@@ -0,0 +1,359 @@
+package tui
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ASRagab/claude-tasks/internal/db"
+	"github.com/ASRagab/claude-tasks/internal/usage"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Profile form inputs
+const (
+	profileFieldName = iota
+	profileFieldConfigDir
+	profileFieldThreshold
+	profileFieldCount
+)
+
+type profileChangedMsg struct{ status string }
+
+// profileUsageMsg carries the usage of each profile that could be fetched
+type profileUsageMsg struct {
+	data map[string]*usage.Response
+	errs map[string]error
+}
+
+func newProfileInputs() []textinput.Model {
+	inputs := make([]textinput.Model, profileFieldCount)
+	inputs[profileFieldName] = textinput.New()
+	inputs[profileFieldName].Placeholder = "work"
+	inputs[profileFieldName].CharLimit = 32
+	inputs[profileFieldName].Width = 20
+	inputs[profileFieldConfigDir] = textinput.New()
+	inputs[profileFieldConfigDir].Placeholder = "~/.claude-work"
+	inputs[profileFieldConfigDir].CharLimit = 500
+	inputs[profileFieldConfigDir].Width = 40
+	inputs[profileFieldThreshold] = textinput.New()
+	inputs[profileFieldThreshold].Placeholder = "none"
+	inputs[profileFieldThreshold].CharLimit = 3
+	inputs[profileFieldThreshold].Width = 5
+	return inputs
+}
+
+// fetchProfileUsage fetches the usage of every profile
+func (m *Model) fetchProfileUsage() tea.Cmd {
+	profiles := m.profiles
+	clients := m.profileClients
+	if len(profiles) == 0 || clients == nil {
+		return nil
+	}
+	return func() tea.Msg {
+		msg := profileUsageMsg{data: make(map[string]*usage.Response), errs: make(map[string]error)}
+		for _, profile := range profiles {
+			client, err := clients.Client(profile)
+			if err == nil {
+				msg.data[profile.Name], err = client.Fetch()
+			}
+			if err != nil {
+				msg.errs[profile.Name] = err
+			}
+		}
+		return msg
+	}
+}
+
+// profilesChanged reports whether the profiles differ in name or config dir
+func profilesChanged(old, updated []*db.Profile) bool {
+	if len(old) != len(updated) {
+		return true
+	}
+	for i := range old {
+		if old[i].Name != updated[i].Name || old[i].ConfigDir != updated[i].ConfigDir {
+			return true
+		}
+	}
+	return false
+}
+
+// profileOptions returns the profiles a task can select, the default
+// account first. A profile the edited task uses is kept even if it is not
+// loaded, so saving does not drop it.
+func (m Model) profileOptions() []string {
+	options := []string{""}
+	found := false
+	for _, profile := range m.profiles {
+		options = append(options, profile.Name)
+		found = found || (m.editingTask != nil && profile.Name == m.editingTask.Profile)
+	}
+	if m.editingTask != nil && m.editingTask.Profile != "" && !found {
+		options = append(options, m.editingTask.Profile)
+	}
+	return options
+}
+
+// profileConfigDir returns the config dir of a task's profile, or empty for
+// the default account
+func (m Model) profileConfigDir(name string) string {
+	for _, profile := range m.profiles {
+		if profile.Name == name {
+			return profile.ConfigDir
+		}
+	}
+	return ""
+}
+
+func (m *Model) openProfileForm(profile *db.Profile) tea.Cmd {
+	m.profileInputs = newProfileInputs()
+	m.profileEditing = profile
+	m.profileAdding = true
+	m.profileFocus = profileFieldName
+	if profile != nil {
+		m.profileInputs[profileFieldName].SetValue(profile.Name)
+		m.profileInputs[profileFieldConfigDir].SetValue(profile.ConfigDir)
+		if profile.UsageThreshold > 0 {
+			m.profileInputs[profileFieldThreshold].SetValue(fmt.Sprintf("%.0f", profile.UsageThreshold))
+		}
+		// The name identifies the profile and cannot be changed
+		m.profileFocus = profileFieldConfigDir
+	}
+	m.profileInputs[m.profileFocus].Focus()
+	return textinput.Blink
+}
+
+func (m *Model) focusProfileInput(index int) {
+	m.profileFocus = index
+	for i := range m.profileInputs {
+		if i == index {
+			m.profileInputs[i].Focus()
+		} else {
+			m.profileInputs[i].Blur()
+		}
+	}
+}
+
+func (m *Model) saveProfile() tea.Cmd {
+	name := m.profileInputs[profileFieldName].Value()
+	if m.profileEditing != nil {
+		name = m.profileEditing.Name
+	}
+	name, err := db.ParseProfileName(name)
+	if err != nil {
+		m.setStatus(err.Error(), true)
+		return nil
+	}
+	configDir, err := db.ParseConfigDir(m.profileInputs[profileFieldConfigDir].Value())
+	if err != nil {
+		m.setStatus(err.Error(), true)
+		return nil
+	}
+	var threshold float64
+	if val := strings.TrimSpace(m.profileInputs[profileFieldThreshold].Value()); val != "" {
+		if _, err := fmt.Sscanf(val, "%f", &threshold); err != nil || threshold < 0 || threshold > 100 {
+			m.setStatus("Threshold must be between 0 and 100", true)
+			return nil
+		}
+	}
+
+	profile := &db.Profile{Name: name, ConfigDir: configDir, UsageThreshold: threshold}
+	editing := m.profileEditing != nil
+	return func() tea.Msg {
+		if editing {
+			if _, err := m.db.UpdateProfile(profile); err != nil {
+				return errMsg{err}
+			}
+			return profileChangedMsg{status: "Profile updated: " + name}
+		}
+		if err := m.db.CreateProfile(profile); err != nil {
+			if errors.Is(err, db.ErrProfileExists) {
+				return errMsg{fmt.Errorf("profile %s already exists", name)}
+			}
+			return errMsg{err}
+		}
+		return profileChangedMsg{status: "Profile added: " + name}
+	}
+}
+
+func (m *Model) deleteProfile(profile *db.Profile) tea.Cmd {
+	return func() tea.Msg {
+		if _, err := m.db.DeleteProfile(profile.Name); err != nil {
+			if errors.Is(err, db.ErrProfileInUse) {
+				return errMsg{fmt.Errorf("profile %s is used by tasks; move them to another profile first", profile.Name)}
+			}
+			return errMsg{err}
+		}
+		return profileChangedMsg{status: "Profile removed: " + profile.Name}
+	}
+}
+
+func (m *Model) updateProfiles(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.profileAdding {
+		first := profileFieldName
+		if m.profileEditing != nil {
+			first = profileFieldConfigDir
+		}
+		switch msg.String() {
+		case "esc":
+			m.profileAdding = false
+			return m, nil
+		case "tab", "down":
+			next := m.profileFocus + 1
+			if next >= profileFieldCount {
+				next = first
+			}
+			m.focusProfileInput(next)
+			return m, nil
+		case "shift+tab", "up":
+			prev := m.profileFocus - 1
+			if prev < first {
+				prev = profileFieldCount - 1
+			}
+			m.focusProfileInput(prev)
+			return m, nil
+		case "enter", "ctrl+s":
+			return m, m.saveProfile()
+		}
+		var cmd tea.Cmd
+		m.profileInputs[m.profileFocus], cmd = m.profileInputs[m.profileFocus].Update(msg)
+		return m, cmd
+	}
+
+	switch msg.String() {
+	case "esc", "q":
+		m.currentView = ViewList
+	case "up", "k":
+		if m.profileCursor > 0 {
+			m.profileCursor--
+		}
+	case "down", "j":
+		if m.profileCursor < len(m.profiles)-1 {
+			m.profileCursor++
+		}
+	case "a":
+		return m, m.openProfileForm(nil)
+	case "e":
+		if m.profileCursor < len(m.profiles) {
+			return m, m.openProfileForm(m.profiles[m.profileCursor])
+		}
+	case "d":
+		if m.profileCursor < len(m.profiles) {
+			return m, m.deleteProfile(m.profiles[m.profileCursor])
+		}
+	case "r":
+		return m, m.fetchProfileUsage()
+	}
+	return m, nil
+}
+
+// formatProfileUsage formats a profile's utilization, or why it is unknown
+func (m Model) formatProfileUsage(name string) string {
+	if data := m.profileUsage[name]; data != nil {
+		return "5h " + m.formatUsagePct(data.FiveHour.Utilization) + " 7d " + m.formatUsagePct(data.SevenDay.Utilization)
+	}
+	if err := m.profileUsageErrs[name]; err != nil {
+		return statusFail.Render("no usage")
+	}
+	return subtitleStyle.Render("…")
+}
+
+// renderProfileUsage renders the usage of each profile for the list header;
+// empty without profiles
+func (m Model) renderProfileUsage() string {
+	var parts []string
+	for _, profile := range m.profiles {
+		parts = append(parts, profile.Name+" "+m.formatProfileUsage(profile.Name))
+	}
+	return strings.Join(parts, " │ ")
+}
+
+func (m Model) renderProfiles() string {
+	var b strings.Builder
+
+	b.WriteString(spriteIcon)
+	b.WriteString(" ")
+	b.WriteString(logoStyle.Render("Profiles"))
+	b.WriteString("\n\n")
+
+	b.WriteString(subtitleStyle.Render("Each profile is a Claude account with its own config dir. Tasks without a profile use the default account."))
+	b.WriteString("\n\n")
+
+	if m.usageData != nil {
+		b.WriteString(fmt.Sprintf("  %-20s %-40s %-6s 5h %s 7d %s\n", "default", "~/.claude", "",
+			m.formatUsagePct(m.usageData.FiveHour.Utilization), m.formatUsagePct(m.usageData.SevenDay.Utilization)))
+	}
+	for i, profile := range m.profiles {
+		threshold := ""
+		if profile.UsageThreshold > 0 {
+			threshold = fmt.Sprintf("≤%.0f%%", profile.UsageThreshold)
+		}
+		line := fmt.Sprintf("%-20s %-40s %-6s %s", profile.Name, truncate(profile.ConfigDir, 40), threshold, m.formatProfileUsage(profile.Name))
+		if i == m.profileCursor && !m.profileAdding {
+			b.WriteString(focusedInputStyle.Render("> " + line))
+		} else {
+			b.WriteString("  " + line)
+		}
+		b.WriteString("\n")
+		if err := m.profileUsageErrs[profile.Name]; err != nil && i == m.profileCursor {
+			b.WriteString(subtitleStyle.Render("    " + err.Error()))
+			b.WriteString("\n")
+		}
+	}
+	if len(m.profiles) == 0 {
+		b.WriteString(subtitleStyle.Render("  No profiles yet"))
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
+
+	if m.profileAdding {
+		title := "New Profile"
+		if m.profileEditing != nil {
+			title = "Edit Profile: " + m.profileEditing.Name
+		}
+		b.WriteString(inputLabelStyle.Render(title))
+		b.WriteString("\n")
+		labels := []string{"Name", "Config Dir", "Usage Threshold (%)"}
+		for i, label := range labels {
+			if i == profileFieldName && m.profileEditing != nil {
+				continue
+			}
+			b.WriteString(fmt.Sprintf("  %-20s ", label))
+			if i == m.profileFocus {
+				b.WriteString(focusedInputStyle.Render(m.profileInputs[i].View()))
+			} else {
+				b.WriteString(m.profileInputs[i].View())
+			}
+			b.WriteString("\n")
+		}
+		b.WriteString(subtitleStyle.Render("  The threshold caps the priority thresholds of the profile's tasks; blank for none"))
+		b.WriteString("\n\n")
+	}
+
+	// Status message
+	if m.statusMsg != "" {
+		if m.statusErr {
+			b.WriteString(errorMsgStyle.Render("✗ " + m.statusMsg))
+		} else {
+			b.WriteString(successMsgStyle.Render("✓ " + m.statusMsg))
+		}
+		b.WriteString("\n\n")
+	}
+
+	var helpText string
+	if m.profileAdding {
+		helpText = helpKeyStyle.Render("tab") + helpDescStyle.Render(" next field • ") +
+			helpKeyStyle.Render("enter") + helpDescStyle.Render(" save • ") +
+			helpKeyStyle.Render("esc") + helpDescStyle.Render(" cancel")
+	} else {
+		helpText = helpKeyStyle.Render("a") + helpDescStyle.Render(" add • ") +
+			helpKeyStyle.Render("e") + helpDescStyle.Render(" edit • ") +
+			helpKeyStyle.Render("d") + helpDescStyle.Render(" delete • ") +
+			helpKeyStyle.Render("r") + helpDescStyle.Render(" refresh usage • ") +
+			helpKeyStyle.Render("esc") + helpDescStyle.Render(" back")
+	}
+	b.WriteString(helpText)
+
+	return b.String()
+}
@@ -0,0 +1,140 @@
+package tui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ASRagab/claude-tasks/internal/db"
+	"github.com/ASRagab/claude-tasks/internal/prompt"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// maxPromptPreviewLines bounds the preview shown on the form
+const maxPromptPreviewLines = 12
+
+// promptPreviewMsg carries the form's prompt rendered for a run starting now
+type promptPreviewMsg struct {
+	rendered string
+	err      error
+}
+
+// parsePairs parses "key=value, key=value" into a map; empty input gives nil
+func parsePairs(value string) (map[string]string, error) {
+	pairs := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		name, val, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("expected key=value, got %q", pair)
+		}
+		pairs[strings.TrimSpace(name)] = strings.TrimSpace(val)
+	}
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	return pairs, nil
+}
+
+// parsePromptVars parses "key=value, key=value" into prompt variables
+func parsePromptVars(value string) (map[string]string, error) {
+	vars, err := parsePairs(value)
+	if err != nil {
+		return nil, err
+	}
+	if err := prompt.ValidateVars(vars); err != nil {
+		return nil, err
+	}
+	return vars, nil
+}
+
+// parseEnv parses "KEY=value, KEY=value" into task environment variables
+func parseEnv(value string) (map[string]string, error) {
+	env, err := parsePairs(value)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.ValidateEnv(env); err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+// formatPairs formats prompt variables or environment variables for the
+// form, sorted by name
+func formatPairs(pairs map[string]string) string {
+	names := make([]string, 0, len(pairs))
+	for name := range pairs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	formatted := make([]string, len(names))
+	for i, name := range names {
+		formatted[i] = name + "=" + pairs[name]
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// previewPrompt renders the prompt on the form against the task's history
+func (m *Model) previewPrompt() tea.Cmd {
+	task := &db.Task{}
+	if m.editingTask != nil {
+		*task = *m.editingTask
+	}
+	task.Prompt = strings.TrimSpace(m.promptInput.Value())
+	task.Name = strings.TrimSpace(m.formInputs[fieldName].Value())
+	task.WorkingDir = strings.TrimSpace(m.formInputs[fieldWorkingDir].Value())
+	task.Timezone, _ = db.ParseTimezone(m.formInputs[fieldTimezone].Value())
+	vars, varsErr := parsePromptVars(m.formInputs[fieldPromptVars].Value())
+
+	return func() tea.Msg {
+		if varsErr != nil {
+			return promptPreviewMsg{err: varsErr}
+		}
+		task.PromptVars = vars
+		var upstreamRunID *int64
+		if task.ID != 0 {
+			id, err := prompt.SampleUpstreamRunID(m.db, task.ID)
+			if err != nil {
+				return promptPreviewMsg{err: err}
+			}
+			upstreamRunID = id
+		}
+		data, err := prompt.Load(m.db, task, upstreamRunID, time.Now())
+		if err != nil {
+			return promptPreviewMsg{err: err}
+		}
+		rendered, err := prompt.Render(task.Prompt, data)
+		return promptPreviewMsg{rendered: rendered, err: err}
+	}
+}
+
+// renderPromptPreview renders the preview shown under the prompt field
+func (m Model) renderPromptPreview() string {
+	var b strings.Builder
+	b.WriteString(subtitleStyle.Render("Preview (ctrl+p to refresh)"))
+	b.WriteString("\n")
+	if m.promptPreviewErr != nil {
+		b.WriteString(errorMsgStyle.Render("✗ " + m.promptPreviewErr.Error()))
+	} else {
+		preview := m.promptPreview
+		if lines := strings.Split(preview, "\n"); len(lines) > maxPromptPreviewLines {
+			preview = strings.Join(lines[:maxPromptPreviewLines], "\n") +
+				fmt.Sprintf("\n… %d more lines", len(lines)-maxPromptPreviewLines)
+		}
+		b.WriteString(blurredInputStyle.Render(preview))
+	}
+	b.WriteString("\n\n")
+	return b.String()
+}
+
+// validatePromptTemplate checks the prompt's template syntax
+func validatePromptTemplate(text string) error {
+	if err := prompt.Validate(text); err != nil {
+		return fmt.Errorf("invalid template: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package tui
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ASRagab/claude-tasks/internal/db"
+)
+
+// parseOutputSchema validates the output schema entered on the form
+func parseOutputSchema(value string) (json.RawMessage, error) {
+	schema, err := db.ParseSchema(json.RawMessage(value))
+	if err != nil {
+		return nil, fmt.Errorf("invalid output schema: %w", err)
+	}
+	return schema, nil
+}
+
+// renderRunResult renders a run's structured result as indented JSON, for
+// the run detail view
+func renderRunResult(b *strings.Builder, result json.RawMessage) {
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, result, "  ", "  "); err != nil {
+		indented.Write(result)
+	}
+	b.WriteString("  ")
+	b.WriteString(indented.String())
+	b.WriteString("\n")
+}
@@ -0,0 +1,104 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ASRagab/claude-tasks/internal/db"
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// newThresholdInputs creates the settings inputs for usage thresholds: the
+// five-hour then seven-day threshold of each priority in db.Priorities order
+func newThresholdInputs() []textinput.Model {
+	inputs := make([]textinput.Model, 2*len(db.Priorities))
+	for i := range inputs {
+		inputs[i] = textinput.New()
+		inputs[i].Placeholder = "80"
+		inputs[i].CharLimit = 3
+		inputs[i].Width = 5
+	}
+	return inputs
+}
+
+// loadThresholdInputs fills the threshold inputs with the saved thresholds
+func (m *Model) loadThresholdInputs() {
+	all, err := m.db.GetAllUsageThresholds()
+	if err != nil {
+		m.setStatus(fmt.Sprintf("Failed to load usage thresholds: %v", err), true)
+		return
+	}
+	for i, priority := range db.Priorities {
+		m.thresholdInputs[2*i].SetValue(fmt.Sprintf("%.0f", all[priority].FiveHour))
+		m.thresholdInputs[2*i+1].SetValue(fmt.Sprintf("%.0f", all[priority].SevenDay))
+	}
+}
+
+// parseThresholdInputs parses the threshold inputs by priority
+func (m Model) parseThresholdInputs() (map[string]db.UsageThresholds, error) {
+	all := make(map[string]db.UsageThresholds, len(db.Priorities))
+	for i, priority := range db.Priorities {
+		var thresholds db.UsageThresholds
+		for j, dest := range []*float64{&thresholds.FiveHour, &thresholds.SevenDay} {
+			val := strings.TrimSpace(m.thresholdInputs[2*i+j].Value())
+			if _, err := fmt.Sscanf(val, "%f", dest); err != nil {
+				return nil, fmt.Errorf("invalid %s threshold value", priority)
+			}
+		}
+		if err := thresholds.Validate(); err != nil {
+			return nil, err
+		}
+		all[priority] = thresholds
+	}
+	return all, nil
+}
+
+// settingsInputCount is the number of inputs on the settings view; the
+// monthly budget input follows the threshold inputs
+func (m Model) settingsInputCount() int {
+	return len(m.thresholdInputs) + 1
+}
+
+// focusSettingsInput moves the settings focus to the input at index
+func (m *Model) focusSettingsInput(index int) {
+	m.settingsFocus = index
+	for i := range m.thresholdInputs {
+		if i == index {
+			m.thresholdInputs[i].Focus()
+		} else {
+			m.thresholdInputs[i].Blur()
+		}
+	}
+	if index == len(m.thresholdInputs) {
+		m.budgetInput.Focus()
+	} else {
+		m.budgetInput.Blur()
+	}
+}
+
+// renderThresholdSettings renders the threshold inputs as a priority table
+func (m Model) renderThresholdSettings() string {
+	var b strings.Builder
+	b.WriteString(inputLabelStyle.Render("Usage Thresholds (%)"))
+	b.WriteString("  ")
+	b.WriteString(subtitleStyle.Render("Tasks skip when either window reaches its threshold"))
+	b.WriteString("\n")
+	for i, priority := range db.Priorities {
+		b.WriteString(lipgloss.JoinHorizontal(lipgloss.Center,
+			fmt.Sprintf("  %-9s", priority),
+			"5h ", m.settingsInputStyle(2*i).Render(m.thresholdInputs[2*i].View()),
+			"  7d ", m.settingsInputStyle(2*i+1).Render(m.thresholdInputs[2*i+1].View())))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// formatThresholds formats a priority's thresholds for the header, as one
+// percentage when both windows share it
+func formatThresholds(thresholds db.UsageThresholds) string {
+	if thresholds.FiveHour == thresholds.SevenDay {
+		return fmt.Sprintf("%.0f%%", thresholds.FiveHour)
+	}
+	return fmt.Sprintf("%.0f%%/%.0f%%", thresholds.FiveHour, thresholds.SevenDay)
+}
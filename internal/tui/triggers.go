@@ -0,0 +1,241 @@
+package tui
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ASRagab/claude-tasks/internal/db"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+type triggersLoadedMsg struct{ triggers []*db.TaskTrigger }
+type triggerChangedMsg struct{ status string }
+
+// outgoingTriggers returns the triggers fired by the selected task
+func (m Model) outgoingTriggers() []*db.TaskTrigger {
+	var triggers []*db.TaskTrigger
+	for _, trigger := range m.allTriggers {
+		if m.triggerTask != nil && trigger.TaskID == m.triggerTask.ID {
+			triggers = append(triggers, trigger)
+		}
+	}
+	return triggers
+}
+
+// triggerTargets returns the tasks the selected task can trigger
+func (m Model) triggerTargets() []*db.Task {
+	var targets []*db.Task
+	for _, task := range m.tasks {
+		if m.triggerTask != nil && task.ID != m.triggerTask.ID {
+			targets = append(targets, task)
+		}
+	}
+	return targets
+}
+
+func (m *Model) loadTriggers() tea.Cmd {
+	return func() tea.Msg {
+		triggers, err := m.db.ListAllTaskTriggers()
+		if err != nil {
+			return errMsg{err}
+		}
+		return triggersLoadedMsg{triggers}
+	}
+}
+
+func (m *Model) saveTrigger() tea.Cmd {
+	targets := m.triggerTargets()
+	if m.triggerTask == nil || m.triggerTargetIdx >= len(targets) {
+		return nil
+	}
+	trigger := &db.TaskTrigger{
+		TaskID:       m.triggerTask.ID,
+		TargetTaskID: targets[m.triggerTargetIdx].ID,
+		Condition:    db.TriggerConditions[m.triggerCondIdx],
+	}
+	targetName := targets[m.triggerTargetIdx].Name
+	return func() tea.Msg {
+		if err := m.db.CreateTaskTrigger(trigger); err != nil {
+			if errors.Is(err, db.ErrTriggerCycle) {
+				return errMsg{fmt.Errorf("%s already leads back to this task", targetName)}
+			}
+			return errMsg{err}
+		}
+		return triggerChangedMsg{status: "Trigger added: " + targetName}
+	}
+}
+
+func (m *Model) deleteTrigger(trigger *db.TaskTrigger) tea.Cmd {
+	return func() tea.Msg {
+		if _, err := m.db.DeleteTaskTrigger(trigger.TaskID, trigger.ID); err != nil {
+			return errMsg{err}
+		}
+		return triggerChangedMsg{status: "Trigger removed: " + trigger.TargetTaskName}
+	}
+}
+
+func (m *Model) updateTriggers(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.triggerAdding {
+		targets := m.triggerTargets()
+		switch msg.String() {
+		case "esc":
+			m.triggerAdding = false
+		case "up", "k":
+			m.triggerTargetIdx = (m.triggerTargetIdx - 1 + len(targets)) % len(targets)
+		case "down", "j":
+			m.triggerTargetIdx = (m.triggerTargetIdx + 1) % len(targets)
+		case "left", "h":
+			m.triggerCondIdx = (m.triggerCondIdx - 1 + len(db.TriggerConditions)) % len(db.TriggerConditions)
+		case "right", "l":
+			m.triggerCondIdx = (m.triggerCondIdx + 1) % len(db.TriggerConditions)
+		case "enter", "ctrl+s":
+			return m, m.saveTrigger()
+		}
+		return m, nil
+	}
+
+	triggers := m.outgoingTriggers()
+	switch msg.String() {
+	case "esc", "q":
+		m.currentView = ViewList
+	case "up", "k":
+		if m.triggerCursor > 0 {
+			m.triggerCursor--
+		}
+	case "down", "j":
+		if m.triggerCursor < len(triggers)-1 {
+			m.triggerCursor++
+		}
+	case "a":
+		if len(m.triggerTargets()) == 0 {
+			m.setStatus("Add another task to trigger first", true)
+			return m, nil
+		}
+		m.triggerAdding = true
+		m.triggerTargetIdx = 0
+		m.triggerCondIdx = 0
+	case "d":
+		if m.triggerCursor < len(triggers) {
+			return m, m.deleteTrigger(triggers[m.triggerCursor])
+		}
+	}
+	return m, nil
+}
+
+// conditionLabel renders a trigger condition for display, e.g. "on success"
+func conditionLabel(condition string) string {
+	return strings.ReplaceAll(condition, "_", " ")
+}
+
+func (m Model) renderTriggers() string {
+	var b strings.Builder
+
+	name := ""
+	if m.triggerTask != nil {
+		name = m.triggerTask.Name
+	}
+	b.WriteString(spriteIcon)
+	b.WriteString(" ")
+	b.WriteString(logoStyle.Render("Triggers: " + name))
+	b.WriteString("\n\n")
+
+	// Upstream tasks
+	b.WriteString(inputLabelStyle.Render("Started by"))
+	b.WriteString("\n")
+	started := false
+	for _, trigger := range m.allTriggers {
+		if m.triggerTask != nil && trigger.TargetTaskID == m.triggerTask.ID {
+			b.WriteString(fmt.Sprintf("  %s (%s)\n", trigger.TaskName, conditionLabel(trigger.Condition)))
+			started = true
+		}
+	}
+	if !started {
+		b.WriteString(subtitleStyle.Render("  No other task starts this one"))
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
+
+	// Downstream tasks, selectable for deletion
+	b.WriteString(inputLabelStyle.Render("Starts"))
+	b.WriteString("\n")
+	triggers := m.outgoingTriggers()
+	for i, trigger := range triggers {
+		line := fmt.Sprintf("%s → %s", conditionLabel(trigger.Condition), trigger.TargetTaskName)
+		if i == m.triggerCursor && !m.triggerAdding {
+			b.WriteString(focusedInputStyle.Render("> " + line))
+		} else {
+			b.WriteString("  " + line)
+		}
+		b.WriteString("\n")
+	}
+	if len(triggers) == 0 {
+		b.WriteString(subtitleStyle.Render("  No triggers yet"))
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
+
+	// Full downstream chain
+	if len(triggers) > 0 && m.triggerTask != nil {
+		b.WriteString(inputLabelStyle.Render("Chain"))
+		b.WriteString("\n")
+		b.WriteString("  " + name + "\n")
+		m.renderChain(&b, m.triggerTask.ID, "  ", map[int64]bool{m.triggerTask.ID: true})
+		b.WriteString("\n")
+	}
+
+	if m.triggerAdding {
+		targets := m.triggerTargets()
+		b.WriteString(inputLabelStyle.Render("New Trigger"))
+		b.WriteString("\n")
+		b.WriteString(focusedInputStyle.Render(fmt.Sprintf("When this task finishes [%s], start [%s]",
+			conditionLabel(db.TriggerConditions[m.triggerCondIdx]), targets[m.triggerTargetIdx].Name)))
+		b.WriteString("\n\n")
+	}
+
+	// Status message
+	if m.statusMsg != "" {
+		if m.statusErr {
+			b.WriteString(errorMsgStyle.Render("✗ " + m.statusMsg))
+		} else {
+			b.WriteString(successMsgStyle.Render("✓ " + m.statusMsg))
+		}
+		b.WriteString("\n\n")
+	}
+
+	var helpText string
+	if m.triggerAdding {
+		helpText = helpKeyStyle.Render("←/→") + helpDescStyle.Render(" condition • ") +
+			helpKeyStyle.Render("↑/↓") + helpDescStyle.Render(" task • ") +
+			helpKeyStyle.Render("enter") + helpDescStyle.Render(" save • ") +
+			helpKeyStyle.Render("esc") + helpDescStyle.Render(" cancel")
+	} else {
+		helpText = helpKeyStyle.Render("a") + helpDescStyle.Render(" add • ") +
+			helpKeyStyle.Render("d") + helpDescStyle.Render(" delete • ") +
+			helpKeyStyle.Render("esc") + helpDescStyle.Render(" back")
+	}
+	b.WriteString(helpText)
+
+	return b.String()
+}
+
+// renderChain writes the tasks triggered downstream of taskID as a tree
+func (m Model) renderChain(b *strings.Builder, taskID int64, indent string, seen map[int64]bool) {
+	var children []*db.TaskTrigger
+	for _, trigger := range m.allTriggers {
+		if trigger.TaskID == taskID {
+			children = append(children, trigger)
+		}
+	}
+	for i, trigger := range children {
+		branch, next := "├─ ", "│  "
+		if i == len(children)-1 {
+			branch, next = "└─ ", "   "
+		}
+		b.WriteString(fmt.Sprintf("%s%s%s → %s\n", indent, branch, conditionLabel(trigger.Condition), trigger.TargetTaskName))
+		if !seen[trigger.TargetTaskID] {
+			seen[trigger.TargetTaskID] = true
+			m.renderChain(b, trigger.TargetTaskID, indent+next, seen)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package tui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ASRagab/claude-tasks/internal/db"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// usageRanges are the time ranges the usage screen cycles through
+var usageRanges = []struct {
+	label  string
+	window time.Duration
+}{
+	{"6h", 6 * time.Hour},
+	{"24h", 24 * time.Hour},
+	{"7d", 7 * 24 * time.Hour},
+	{"30d", 30 * 24 * time.Hour},
+}
+
+// defaultUsageRange is the index of the 7d range
+const defaultUsageRange = 2
+
+// sparkBlocks are the sparkline levels from empty to full
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// runMarkers label the tasks whose runs appear on the usage chart
+const runMarkers = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+type usageHistoryLoadedMsg struct {
+	samples []*db.UsageSample
+	runs    []*db.UsageRun
+}
+
+// usageProfile returns the profile the usage screen shows; empty for the
+// default account
+func (m Model) usageProfile() string {
+	if options := m.profileOptions(); m.usageProfileIdx < len(options) {
+		return options[m.usageProfileIdx]
+	}
+	return ""
+}
+
+func (m *Model) loadUsageHistory() tea.Cmd {
+	since := time.Now().Add(-usageRanges[m.usageRangeIdx].window)
+	profile := m.usageProfile()
+	return func() tea.Msg {
+		samples, err := m.db.ListUsageSamples(profile, since)
+		if err != nil {
+			return errMsg{err}
+		}
+		runs, err := m.db.ListUsageRuns(profile, since)
+		if err != nil {
+			return errMsg{err}
+		}
+		return usageHistoryLoadedMsg{samples: samples, runs: runs}
+	}
+}
+
+func (m *Model) updateUsageHistory(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc", "q":
+		m.currentView = ViewList
+	case "left", "h":
+		m.usageRangeIdx = (m.usageRangeIdx - 1 + len(usageRanges)) % len(usageRanges)
+		return m, m.loadUsageHistory()
+	case "right", "l":
+		m.usageRangeIdx = (m.usageRangeIdx + 1) % len(usageRanges)
+		return m, m.loadUsageHistory()
+	case "tab":
+		m.usageProfileIdx = (m.usageProfileIdx + 1) % len(m.profileOptions())
+		return m, m.loadUsageHistory()
+	case "r":
+		return m, m.loadUsageHistory()
+	}
+	return m, nil
+}
+
+// usageChartWidth is the number of columns in the usage charts
+func (m Model) usageChartWidth() int {
+	width := m.width - 20
+	if width > 120 {
+		width = 120
+	}
+	if width < 20 {
+		width = 20
+	}
+	return width
+}
+
+// usageColumn returns the chart column of t, or -1 if it is outside the range
+func usageColumn(t, start time.Time, window time.Duration, width int) int {
+	offset := t.Sub(start)
+	if offset < 0 || offset > window {
+		return -1
+	}
+	col := int(int64(offset) * int64(width) / int64(window))
+	if col >= width {
+		col = width - 1
+	}
+	return col
+}
+
+// renderSparkline renders the peak utilization in each column; columns
+// without samples are blank
+func (m Model) renderSparkline(peaks []float64, sampled []bool) string {
+	var b strings.Builder
+	for i, pct := range peaks {
+		if !sampled[i] {
+			b.WriteString(" ")
+			continue
+		}
+		level := int(pct / 100 * float64(len(sparkBlocks)))
+		level = max(0, min(level, len(sparkBlocks)-1))
+		style := lipgloss.NewStyle().Foreground(lipgloss.Color(m.getGradientColor(min(pct, 100))))
+		b.WriteString(style.Render(string(sparkBlocks[level])))
+	}
+	return b.String()
+}
+
+func (m Model) renderUsageHistory() string {
+	var b strings.Builder
+
+	selected := usageRanges[m.usageRangeIdx]
+	b.WriteString(spriteIcon)
+	b.WriteString(" ")
+	b.WriteString(logoStyle.Render("Usage History"))
+	b.WriteString("  ")
+	var ranges []string
+	for i, r := range usageRanges {
+		if i == m.usageRangeIdx {
+			ranges = append(ranges, "["+r.label+"]")
+		} else {
+			ranges = append(ranges, r.label)
+		}
+	}
+	b.WriteString(subtitleStyle.Render(strings.Join(ranges, "  ")))
+	if len(m.profiles) > 0 {
+		profile := m.usageProfile()
+		if profile == "" {
+			profile = "default"
+		}
+		b.WriteString("  ")
+		b.WriteString(inputLabelStyle.Render("Profile: " + profile))
+	}
+	b.WriteString("\n\n")
+
+	width := m.usageChartWidth()
+	end := time.Now()
+	start := end.Add(-selected.window)
+
+	fiveHour := make([]float64, width)
+	sevenDay := make([]float64, width)
+	sampled := make([]bool, width)
+	for _, sample := range m.usageSamples {
+		col := usageColumn(sample.SampledAt, start, selected.window, width)
+		if col < 0 {
+			continue
+		}
+		fiveHour[col] = max(fiveHour[col], sample.FiveHour)
+		sevenDay[col] = max(sevenDay[col], sample.SevenDay)
+		sampled[col] = true
+	}
+
+	if len(m.usageSamples) == 0 {
+		b.WriteString(subtitleStyle.Render("No usage recorded in this range yet. Usage is sampled whenever it is fetched."))
+		b.WriteString("\n\n")
+	} else {
+		latest := m.usageSamples[len(m.usageSamples)-1]
+		b.WriteString(fmt.Sprintf("  5h  %s %s\n", m.renderSparkline(fiveHour, sampled), m.formatUsagePct(latest.FiveHour)))
+		b.WriteString(fmt.Sprintf("  7d  %s %s\n", m.renderSparkline(sevenDay, sampled), m.formatUsagePct(latest.SevenDay)))
+	}
+
+	// Mark the columns where runs started with their task's letter
+	markers := make([]rune, width)
+	for i := range markers {
+		markers[i] = ' '
+	}
+	type taskRuns struct {
+		letter rune
+		name   string
+		runs   int
+		cost   float64
+	}
+	var legend []*taskRuns
+	byTask := map[int64]*taskRuns{}
+	for _, run := range m.usageRuns {
+		col := usageColumn(run.StartedAt, start, selected.window, width)
+		if col < 0 {
+			continue
+		}
+		entry, ok := byTask[run.TaskID]
+		if !ok {
+			letter := '?'
+			if len(legend) < len(runMarkers) {
+				letter = rune(runMarkers[len(legend)])
+			}
+			entry = &taskRuns{letter: letter, name: run.TaskName}
+			byTask[run.TaskID] = entry
+			legend = append(legend, entry)
+		}
+		entry.runs++
+		entry.cost += run.CostUSD
+		switch markers[col] {
+		case ' ', entry.letter:
+			markers[col] = entry.letter
+		default:
+			markers[col] = '+'
+		}
+	}
+	b.WriteString("  ▲   ")
+	b.WriteString(statusRunning.Render(string(markers)))
+	b.WriteString("\n")
+
+	// Time axis
+	startLabel := start.Format("Jan 2 15:04")
+	gap := max(1, width-len(startLabel)-len("now"))
+	b.WriteString(subtitleStyle.Render("      " + startLabel + strings.Repeat(" ", gap) + "now"))
+	b.WriteString("\n\n")
+
+	// Legend of the tasks that ran, most runs first
+	b.WriteString(inputLabelStyle.Render("Runs"))
+	b.WriteString(subtitleStyle.Render("  (+ marks several tasks in one column)"))
+	b.WriteString("\n")
+	if len(legend) == 0 {
+		b.WriteString(subtitleStyle.Render("  No runs in this range"))
+		b.WriteString("\n")
+	}
+	sort.SliceStable(legend, func(i, j int) bool { return legend[i].runs > legend[j].runs })
+	for _, entry := range legend {
+		runs := "runs"
+		if entry.runs == 1 {
+			runs = "run"
+		}
+		b.WriteString(fmt.Sprintf("  %s  %-30s %3d %s  $%.2f\n",
+			statusRunning.Render(string(entry.letter)), truncate(entry.name, 30), entry.runs, runs, entry.cost))
+	}
+	b.WriteString("\n")
+
+	helpText := helpKeyStyle.Render("←/→") + helpDescStyle.Render(" range • ")
+	if len(m.profiles) > 0 {
+		helpText += helpKeyStyle.Render("tab") + helpDescStyle.Render(" profile • ")
+	}
+	helpText += helpKeyStyle.Render("r") + helpDescStyle.Render(" refresh • ") +
+		helpKeyStyle.Render("esc") + helpDescStyle.Render(" back")
+	b.WriteString(helpText)
+
+	return b.String()
+}
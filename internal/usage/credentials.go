@@ -0,0 +1,101 @@
+package usage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultAPIURL is the Anthropic OAuth usage endpoint
+const DefaultAPIURL = "https://api.anthropic.com/api/oauth/usage"
+
+// Environment variables read by ConfigFromEnv
+const (
+	EnvAPIURL          = "CLAUDE_TASKS_USAGE_URL"
+	EnvCredentialsPath = "CLAUDE_TASKS_CREDENTIALS_PATH"
+	EnvOAuthToken      = "CLAUDE_TASKS_OAUTH_TOKEN"
+)
+
+// Config selects the usage endpoint and where the OAuth token comes from
+type Config struct {
+	// APIURL is the usage endpoint; defaults to DefaultAPIURL
+	APIURL string
+	// Token is used as is when set, instead of reading the credentials file
+	Token string
+	// CredentialsPath is the Claude credentials file; defaults to
+	// ~/.claude/.credentials.json
+	CredentialsPath string
+}
+
+// ConfigFromEnv returns the usage configuration from the environment
+func ConfigFromEnv() Config {
+	return Config{
+		APIURL:          strings.TrimSpace(os.Getenv(EnvAPIURL)),
+		Token:           strings.TrimSpace(os.Getenv(EnvOAuthToken)),
+		CredentialsPath: strings.TrimSpace(os.Getenv(EnvCredentialsPath)),
+	}
+}
+
+// ConfigForDir returns the usage configuration of a Claude config dir, as
+// used by a profile. Only the endpoint is taken from the environment.
+func ConfigForDir(configDir string) Config {
+	return Config{
+		APIURL:          strings.TrimSpace(os.Getenv(EnvAPIURL)),
+		CredentialsPath: filepath.Join(configDir, ".credentials.json"),
+	}
+}
+
+// DefaultCredentialsPath returns the credentials file written by the Claude CLI
+func DefaultCredentialsPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("could not determine home directory: %w", err)
+	}
+	return filepath.Join(home, ".claude", ".credentials.json"), nil
+}
+
+// credentialsFile tracks the credentials file so a token refreshed on disk
+// by the Claude CLI is picked up without restarting
+type credentialsFile struct {
+	path    string
+	modTime time.Time
+	size    int64
+}
+
+// changed reports whether the file differs from when it was last read
+func (f *credentialsFile) changed() bool {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		// Let the next read report the error
+		return true
+	}
+	return !info.ModTime().Equal(f.modTime) || info.Size() != f.size
+}
+
+// read returns the access token in the credentials file
+func (f *credentialsFile) read() (string, error) {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return "", fmt.Errorf("credentials not found at %s: %w", f.path, err)
+	}
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return "", fmt.Errorf("credentials not found at %s: %w", f.path, err)
+	}
+
+	var creds Credentials
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return "", fmt.Errorf("failed to parse credentials: %w", err)
+	}
+
+	if creds.ClaudeAIOAuth.AccessToken == "" {
+		return "", fmt.Errorf("no access token found in credentials")
+	}
+
+	f.modTime = info.ModTime()
+	f.size = info.Size()
+	return creds.ClaudeAIOAuth.AccessToken, nil
+}
@@ -0,0 +1,27 @@
+package usage
+
+import (
+	"log"
+
+	"github.com/ASRagab/claude-tasks/internal/db"
+)
+
+// RecordSamples stores each response fetched from the API as a usage sample
+// of the profile in the database, so utilization can be charted over time.
+// Responses served from the cache are not recorded again.
+func (c *Client) RecordSamples(database *db.DB, profile string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.record = func(r *Response) {
+		sample := &db.UsageSample{
+			Profile:          profile,
+			FiveHour:         r.FiveHour.Utilization,
+			SevenDay:         r.SevenDay.Utilization,
+			FiveHourResetsAt: r.FiveHour.ResetsAt,
+			SevenDayResetsAt: r.SevenDay.ResetsAt,
+		}
+		if _, err := database.RecordUsageSample(sample); err != nil {
+			log.Printf("record usage sample: %v", err)
+		}
+	}
+}
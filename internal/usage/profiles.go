@@ -0,0 +1,48 @@
+package usage
+
+import (
+	"sync"
+
+	"github.com/ASRagab/claude-tasks/internal/db"
+)
+
+// Profiles hands out one usage client per account profile, so each
+// account's usage is fetched with its own credentials and cached on its own
+type Profiles struct {
+	mu       sync.Mutex
+	database *db.DB // Records fetched usage when set
+	clients  map[string]*profileClient
+}
+
+type profileClient struct {
+	configDir string
+	client    *Client
+}
+
+// NewProfiles creates an empty set of profile usage clients that record
+// what they fetch in database, if it is not nil
+func NewProfiles(database *db.DB) *Profiles {
+	return &Profiles{database: database, clients: make(map[string]*profileClient)}
+}
+
+// Client returns the usage client of a profile. A client is created on first
+// use and again when the profile's config dir changes; failures are not
+// cached, so credentials that appear later are picked up.
+func (p *Profiles) Client(profile *db.Profile) (*Client, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if pc, ok := p.clients[profile.Name]; ok && pc.configDir == profile.ConfigDir {
+		return pc.client, nil
+	}
+	client, err := NewClientWithConfig(ConfigForDir(profile.ConfigDir))
+	if err != nil {
+		delete(p.clients, profile.Name)
+		return nil, err
+	}
+	if p.database != nil {
+		client.RecordSamples(p.database, profile.Name)
+	}
+	p.clients[profile.Name] = &profileClient{configDir: profile.ConfigDir, client: client}
+	return client, nil
+}
@@ -5,14 +5,10 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"os"
-	"path/filepath"
 	"sync"
 	"time"
 )
 
-const usageAPIURL = "https://api.anthropic.com/api/oauth/usage"
-
 // Bucket represents a usage time bucket (five_hour or seven_day)
 type Bucket struct {
 	Utilization float64 `json:"utilization"`
@@ -35,49 +31,53 @@ type Credentials struct {
 // Client handles usage API interactions
 type Client struct {
 	httpClient *http.Client
+	apiURL     string
 	token      string
+	credFile   *credentialsFile // nil when the token is configured directly
 	cache      *Response
 	cacheTime  time.Time
 	cacheTTL   time.Duration
 	mu         sync.RWMutex
+
+	// record is called with each response fetched from the API
+	record func(*Response)
 }
 
-// NewClient creates a new usage client
+// NewClient creates a new usage client configured from the environment
 func NewClient() (*Client, error) {
-	token, err := readCredentials()
-	if err != nil {
-		return nil, err
-	}
+	return NewClientWithConfig(ConfigFromEnv())
+}
 
-	return &Client{
+// NewClientWithConfig creates a new usage client with the given endpoint
+// and token source
+func NewClientWithConfig(cfg Config) (*Client, error) {
+	c := &Client{
 		httpClient: &http.Client{Timeout: 10 * time.Second},
-		token:      token,
+		apiURL:     cfg.APIURL,
+		token:      cfg.Token,
 		cacheTTL:   30 * time.Second, // Cache for 30 seconds
-	}, nil
-}
-
-func readCredentials() (string, error) {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return "", fmt.Errorf("could not determine home directory: %w", err)
-	}
-
-	credPath := filepath.Join(home, ".claude", ".credentials.json")
-	data, err := os.ReadFile(credPath)
-	if err != nil {
-		return "", fmt.Errorf("credentials not found at %s: %w", credPath, err)
 	}
-
-	var creds Credentials
-	if err := json.Unmarshal(data, &creds); err != nil {
-		return "", fmt.Errorf("failed to parse credentials: %w", err)
+	if c.apiURL == "" {
+		c.apiURL = DefaultAPIURL
 	}
 
-	if creds.ClaudeAIOAuth.AccessToken == "" {
-		return "", fmt.Errorf("no access token found in credentials")
+	if c.token == "" {
+		path := cfg.CredentialsPath
+		if path == "" {
+			var err error
+			if path, err = DefaultCredentialsPath(); err != nil {
+				return nil, err
+			}
+		}
+		c.credFile = &credentialsFile{path: path}
+		token, err := c.credFile.read()
+		if err != nil {
+			return nil, err
+		}
+		c.token = token
 	}
 
-	return creds.ClaudeAIOAuth.AccessToken, nil
+	return c, nil
 }
 
 // Fetch retrieves usage data from the API (with caching)
@@ -98,7 +98,16 @@ func (c *Client) Fetch() (*Response, error) {
 		return c.cache, nil
 	}
 
-	req, err := http.NewRequest("GET", usageAPIURL, nil)
+	// Pick up a token refreshed on disk since it was last read
+	if c.credFile != nil && c.credFile.changed() {
+		token, err := c.credFile.read()
+		if err != nil {
+			return nil, err
+		}
+		c.token = token
+	}
+
+	req, err := http.NewRequest("GET", c.apiURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -130,6 +139,9 @@ func (c *Client) Fetch() (*Response, error) {
 
 	c.cache = &usage
 	c.cacheTime = time.Now()
+	if c.record != nil {
+		c.record(&usage)
+	}
 
 	return &usage, nil
 }
@@ -137,17 +149,22 @@ func (c *Client) Fetch() (*Response, error) {
 // CheckThreshold returns true if usage is below the threshold, false if above
 // threshold is a percentage (0-100)
 func (c *Client) CheckThreshold(threshold float64) (bool, *Response, error) {
+	return c.CheckThresholds(threshold, threshold)
+}
+
+// CheckThresholds is CheckThreshold with separate thresholds for the 5h and
+// 7d buckets
+func (c *Client) CheckThresholds(fiveHour, sevenDay float64) (bool, *Response, error) {
 	usage, err := c.Fetch()
 	if err != nil {
 		return false, nil, err
 	}
+	return usage.BelowThresholds(fiveHour, sevenDay), usage, nil
+}
 
-	// Check both 5h and 7d buckets
-	if usage.FiveHour.Utilization >= threshold || usage.SevenDay.Utilization >= threshold {
-		return false, usage, nil
-	}
-
-	return true, usage, nil
+// BelowThresholds reports whether each bucket is below its threshold
+func (r *Response) BelowThresholds(fiveHour, sevenDay float64) bool {
+	return r.FiveHour.Utilization < fiveHour && r.SevenDay.Utilization < sevenDay
 }
 
 // MaxUtilization returns the higher of the two utilization values
@@ -160,7 +177,40 @@ func (r *Response) MaxUtilization() float64 {
 
 // TimeUntilReset returns duration until the 5-hour bucket resets
 func (r *Response) TimeUntilReset() time.Duration {
-	resetTime, err := time.Parse(time.RFC3339, r.FiveHour.ResetsAt)
+	return r.FiveHour.TimeUntilReset()
+}
+
+// SevenDayTimeUntilReset returns duration until the 7-day bucket resets
+func (r *Response) SevenDayTimeUntilReset() time.Duration {
+	return r.SevenDay.TimeUntilReset()
+}
+
+// TimeUntilBelow returns how long until every bucket at or above its
+// threshold has reset. It is zero when no bucket is over its threshold or
+// the reset time of one that is cannot be parsed.
+func (r *Response) TimeUntilBelow(fiveHour, sevenDay float64) time.Duration {
+	var wait time.Duration
+	for _, check := range []struct {
+		bucket    Bucket
+		threshold float64
+	}{{r.FiveHour, fiveHour}, {r.SevenDay, sevenDay}} {
+		bucket := check.bucket
+		if bucket.Utilization < check.threshold {
+			continue
+		}
+		d := bucket.TimeUntilReset()
+		if d <= 0 {
+			return 0
+		}
+		wait = max(wait, d)
+	}
+	return wait
+}
+
+// TimeUntilReset returns duration until the bucket resets; zero if the
+// reset time cannot be parsed
+func (b Bucket) TimeUntilReset() time.Duration {
+	resetTime, err := time.Parse(time.RFC3339, b.ResetsAt)
 	if err != nil {
 		return 0
 	}
@@ -0,0 +1,116 @@
+package usage
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newStubServer serves a fixed usage response and records the bearer
+// tokens it was called with
+func newStubServer(t *testing.T) (*httptest.Server, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var tokens []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		tokens = append(tokens, r.Header.Get("Authorization"))
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"five_hour":{"utilization":42,"resets_at":"2030-01-01T00:00:00Z"},"seven_day":{"utilization":7}}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), tokens...)
+	}
+}
+
+func writeCredentials(t *testing.T, path, token string, modTime time.Time) {
+	t.Helper()
+	data := `{"claudeAiOauth":{"accessToken":"` + token + `"}}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("write credentials: %v", err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("set credentials mtime: %v", err)
+	}
+}
+
+func TestClientRereadsCredentialsWhenFileChanges(t *testing.T) {
+	srv, tokens := newStubServer(t)
+	credPath := filepath.Join(t.TempDir(), "credentials.json")
+	now := time.Now()
+	writeCredentials(t, credPath, "first", now.Add(-time.Hour))
+
+	client, err := NewClientWithConfig(Config{APIURL: srv.URL, CredentialsPath: credPath})
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	client.cacheTTL = 0
+
+	resp, err := client.Fetch()
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if resp.FiveHour.Utilization != 42 || resp.SevenDay.Utilization != 7 {
+		t.Fatalf("unexpected usage %+v", resp)
+	}
+
+	writeCredentials(t, credPath, "second", now)
+	if _, err := client.Fetch(); err != nil {
+		t.Fatalf("fetch after refresh: %v", err)
+	}
+
+	got := tokens()
+	if len(got) != 2 || got[0] != "Bearer first" || got[1] != "Bearer second" {
+		t.Fatalf("expected the refreshed token to be used, got %v", got)
+	}
+}
+
+func TestClientUsesConfiguredToken(t *testing.T) {
+	srv, tokens := newStubServer(t)
+
+	client, err := NewClientWithConfig(Config{
+		APIURL:          srv.URL,
+		Token:           "from-env",
+		CredentialsPath: filepath.Join(t.TempDir(), "missing.json"),
+	})
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	if _, err := client.Fetch(); err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if got := tokens(); len(got) != 1 || got[0] != "Bearer from-env" {
+		t.Fatalf("expected the configured token, got %v", got)
+	}
+}
+
+func TestNewClientFailsWithoutCredentials(t *testing.T) {
+	credPath := filepath.Join(t.TempDir(), "credentials.json")
+	if _, err := NewClientWithConfig(Config{CredentialsPath: credPath}); err == nil {
+		t.Fatalf("expected an error for a missing credentials file")
+	}
+
+	writeCredentials(t, credPath, "", time.Now())
+	if _, err := NewClientWithConfig(Config{CredentialsPath: credPath}); err == nil {
+		t.Fatalf("expected an error for credentials without a token")
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv(EnvAPIURL, " http://127.0.0.1:9/usage ")
+	t.Setenv(EnvOAuthToken, "token")
+	t.Setenv(EnvCredentialsPath, "/tmp/creds.json")
+
+	cfg := ConfigFromEnv()
+	if cfg.APIURL != "http://127.0.0.1:9/usage" || cfg.Token != "token" || cfg.CredentialsPath != "/tmp/creds.json" {
+		t.Fatalf("unexpected config %+v", cfg)
+	}
+}
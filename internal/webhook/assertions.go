@@ -0,0 +1,23 @@
+package webhook
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ASRagab/claude-tasks/internal/db"
+)
+
+// formatAssertions lists how a run fared on the task's assertions for a
+// notification; why the failed ones failed is in the run's error
+func formatAssertions(run *db.TaskRun) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d of %d passed", len(run.Assertions)-len(run.FailedAssertions()), len(run.Assertions))
+	for _, result := range run.Assertions {
+		mark := "✓"
+		if !result.Passed {
+			mark = "✗"
+		}
+		fmt.Fprintf(&b, "\n%s `%s`", mark, result.Assertion)
+	}
+	return b.String()
+}
@@ -0,0 +1,30 @@
+package webhook
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ASRagab/claude-tasks/internal/db"
+)
+
+// maxNotifiedFiles is how many changed files a notification lists
+const maxNotifiedFiles = 10
+
+// formatChanges summarizes what a run changed for a notification: the
+// totals, then the changed files
+func formatChanges(changes *db.RunChanges) string {
+	var b strings.Builder
+	b.WriteString(changes.Summary())
+	for i, file := range changes.Files {
+		if i == maxNotifiedFiles {
+			fmt.Fprintf(&b, "\n…and %d more", len(changes.Files)-maxNotifiedFiles)
+			break
+		}
+		if file.Binary {
+			fmt.Fprintf(&b, "\n`%s` binary", file.Path)
+		} else {
+			fmt.Fprintf(&b, "\n`%s` +%d -%d", file.Path, file.Insertions, file.Deletions)
+		}
+	}
+	return b.String()
+}
@@ -62,6 +62,15 @@ func (d *Discord) SendResult(webhookURL string, task *db.Task, run *db.TaskRun)
 	case db.RunStatusFailed:
 		color = 0xFF0000 // Red
 		statusEmoji = "❌"
+	case db.RunStatusTimedOut:
+		color = 0xFF8800 // Orange
+		statusEmoji = "⏱️"
+	case db.RunStatusAssertionFailed:
+		color = 0xCC0066 // Magenta
+		statusEmoji = "⚠️"
+	case db.RunStatusCancelled:
+		color = 0x808080 // Gray
+		statusEmoji = "🚫"
 	default:
 		color = 0xFFFF00 // Yellow
 		statusEmoji = "⏳"
@@ -99,6 +108,43 @@ func (d *Discord) SendResult(webhookURL string, task *db.Task, run *db.TaskRun)
 		Footer:    &EmbedFooter{Text: "Claude Tasks Scheduler"},
 	}
 
+	if run.Changes != nil {
+		// Discord caps field values at 1024 chars
+		changes := formatChanges(run.Changes)
+		if len(changes) > 1000 {
+			changes = changes[:1000] + "..."
+		}
+		embed.Fields = append(embed.Fields, EmbedField{
+			Name:   "Changes",
+			Value:  changes,
+			Inline: false,
+		})
+	}
+
+	if len(run.ResultJSON) > 0 {
+		result := formatResult(run.ResultJSON, "**")
+		if len(result) > 1000 {
+			result = result[:1000] + "..."
+		}
+		embed.Fields = append(embed.Fields, EmbedField{
+			Name:   "Result",
+			Value:  result,
+			Inline: false,
+		})
+	}
+
+	if len(run.Assertions) > 0 {
+		assertions := formatAssertions(run)
+		if len(assertions) > 1000 {
+			assertions = assertions[:1000] + "..."
+		}
+		embed.Fields = append(embed.Fields, EmbedField{
+			Name:   "Assertions",
+			Value:  assertions,
+			Inline: false,
+		})
+	}
+
 	// Add error field if present - errors still use code block for readability
 	if run.Error != "" {
 		errMsg := run.Error
@@ -0,0 +1,56 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// maxNotifiedFields is how many fields of a structured result a
+	// notification lists
+	maxNotifiedFields = 10
+	// maxFieldValueLen caps each listed field value
+	maxFieldValueLen = 120
+)
+
+// formatResult summarizes a run's structured result for a notification:
+// the top-level fields of an object with their JSON values, or the whole
+// value otherwise. Field names are set in bold with the given markup.
+func formatResult(result json.RawMessage, bold string) string {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(result, &fields); err != nil || len(fields) == 0 {
+		return "`" + truncateValue(string(result)) + "`"
+	}
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for i, name := range names {
+		if i == maxNotifiedFields {
+			fmt.Fprintf(&b, "\n…and %d more", len(names)-maxNotifiedFields)
+			break
+		}
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		var value bytes.Buffer
+		if err := json.Compact(&value, fields[name]); err != nil {
+			value.Write(fields[name])
+		}
+		fmt.Fprintf(&b, "%s%s:%s `%s`", bold, name, bold, truncateValue(value.String()))
+	}
+	return b.String()
+}
+
+func truncateValue(value string) string {
+	if len(value) > maxFieldValueLen {
+		return value[:maxFieldValueLen] + "…"
+	}
+	return value
+}
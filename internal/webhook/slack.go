@@ -69,6 +69,18 @@ func (s *Slack) SendResult(webhookURL string, task *db.Task, run *db.TaskRun) er
 		color = "#FF0000" // Red
 		statusEmoji = ":x:"
 		statusText = "Failed"
+	case db.RunStatusTimedOut:
+		color = "#FF8800" // Orange
+		statusEmoji = ":stopwatch:"
+		statusText = "Timed out"
+	case db.RunStatusAssertionFailed:
+		color = "#CC0066" // Magenta
+		statusEmoji = ":warning:"
+		statusText = "Assertion failed"
+	case db.RunStatusCancelled:
+		color = "#808080" // Gray
+		statusEmoji = ":no_entry_sign:"
+		statusText = "Cancelled"
 	default:
 		color = "#FFFF00" // Yellow
 		statusEmoji = ":hourglass:"
@@ -124,6 +136,36 @@ func (s *Slack) SendResult(webhookURL string, task *db.Task, run *db.TaskRun) er
 		},
 	}
 
+	if run.Changes != nil {
+		blocks = append(blocks, SlackBlock{
+			Type: "section",
+			Text: &SlackTextObj{
+				Type: "mrkdwn",
+				Text: "*Changes:*\n" + formatChanges(run.Changes),
+			},
+		})
+	}
+
+	if len(run.ResultJSON) > 0 {
+		blocks = append(blocks, SlackBlock{
+			Type: "section",
+			Text: &SlackTextObj{
+				Type: "mrkdwn",
+				Text: "*Result:*\n" + formatResult(run.ResultJSON, "*"),
+			},
+		})
+	}
+
+	if len(run.Assertions) > 0 {
+		blocks = append(blocks, SlackBlock{
+			Type: "section",
+			Text: &SlackTextObj{
+				Type: "mrkdwn",
+				Text: "*Assertions:*\n" + formatAssertions(run),
+			},
+		})
+	}
+
 	// Add error block if present
 	if run.Error != "" {
 		errMsg := run.Error